@@ -0,0 +1,153 @@
+package ipintel
+
+import (
+	"net/netip"
+	"sort"
+	"strconv"
+)
+
+// Group summarizes the IPs sharing a key, e.g. a network or country, as
+// computed by Aggregate.
+type Group struct {
+	Key string `json:"key"`
+	IPs int    `json:"ips"`
+	// Number of IPs whose latest score is at or above the threshold
+	Proxies int `json:"proxies"`
+	Lookups int `json:"lookups"`
+	// Number of lookups of the IPs counting as proxy
+	ProxyLookups int     `json:"proxy_lookups"`
+	MeanScore    float64 `json:"mean_score"`
+	MaxScore     float32 `json:"max_score"`
+}
+
+// GroupKey returns the key of the group a record belongs to, or "" to
+// leave it out.
+type GroupKey func(rec Record) string
+
+// ByNetwork groups records by the network of their IP with the given
+// prefix lengths for IPv4 and IPv6, e.g. ByNetwork(24, 64).
+func ByNetwork(bits4, bits6 int) GroupKey {
+	return func(rec Record) string {
+		return networkKey(rec.IP, bits4, bits6)
+	}
+}
+
+// networkKey returns the network of ip with the prefix length bits4 for
+// IPv4 and bits6 for IPv6, e.g. "192.0.2.0/24", or "" if ip is invalid.
+func networkKey(ip string, bits4, bits6 int) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+	bits := bits6
+	if addr.Is4() {
+		bits = bits4
+	}
+	p, err := addr.Prefix(bits)
+	if err != nil {
+		return ""
+	}
+	return p.String()
+}
+
+// foldByIP returns one record per IP of recs: the first one, replaced
+// by each later one for which replace(kept, rec) reports true.
+func foldByIP(recs []Record, replace func(kept, rec Record) bool) map[string]Record {
+	kept := make(map[string]Record)
+	for _, rec := range recs {
+		if prev, ok := kept[rec.IP]; !ok || replace(prev, rec) {
+			kept[rec.IP] = rec
+		}
+	}
+	return kept
+}
+
+// latestByIP returns the most recent record of each IP of recs.
+func latestByIP(recs []Record) map[string]Record {
+	return foldByIP(recs, func(kept, rec Record) bool {
+		return rec.QueriedAt.After(kept.QueriedAt)
+	})
+}
+
+// lookupsByIP returns the number of records of each IP of recs.
+func lookupsByIP(recs []Record) map[string]int {
+	n := make(map[string]int)
+	for _, rec := range recs {
+		n[rec.IP]++
+	}
+	return n
+}
+
+// ByCountry groups records by the country of their IP (see
+// WithCountry), leaving out those without.
+func ByCountry(rec Record) string {
+	return rec.Country()
+}
+
+// ByASN groups records by the autonomous system of their IP as returned
+// by lookup, e.g. from an ASN database, in the form "AS64496". Records
+// lookup has no ASN for are left out.
+func ByASN(lookup func(netip.Addr) (uint32, bool)) GroupKey {
+	return func(rec Record) string {
+		addr, err := netip.ParseAddr(rec.IP)
+		if err != nil {
+			return ""
+		}
+		asn, ok := lookup(addr.Unmap())
+		if !ok {
+			return ""
+		}
+		return "AS" + strconv.FormatUint(uint64(asn), 10)
+	}
+}
+
+// Aggregate groups the IPs of recs by key, judging each IP by its most
+// recent record, and returns the groups with the most proxies first.
+// Ties are broken by the number of proxy lookups, then the mean score.
+func Aggregate(recs []Record, key GroupKey, threshold float32) []Group {
+	latest, lookups := latestByIP(recs), lookupsByIP(recs)
+
+	groups := make(map[string]*Group)
+	for ip, rec := range latest {
+		k := key(rec)
+		if k == "" {
+			continue
+		}
+		g := groups[k]
+		if g == nil {
+			g = &Group{Key: k}
+			groups[k] = g
+		}
+		g.IPs++
+		g.Lookups += lookups[ip]
+		if rec.Score >= threshold {
+			g.Proxies++
+			g.ProxyLookups += lookups[ip]
+		}
+		g.MeanScore += float64(rec.Score)
+		if rec.Score > g.MaxScore {
+			g.MaxScore = rec.Score
+		}
+	}
+
+	sorted := make([]Group, 0, len(groups))
+	for _, g := range groups {
+		g.MeanScore /= float64(g.IPs)
+		sorted = append(sorted, *g)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.Proxies != b.Proxies {
+			return a.Proxies > b.Proxies
+		}
+		if a.ProxyLookups != b.ProxyLookups {
+			return a.ProxyLookups > b.ProxyLookups
+		}
+		if a.MeanScore != b.MeanScore {
+			return a.MeanScore > b.MeanScore
+		}
+		return a.Key < b.Key
+	})
+	return sorted
+}
@@ -0,0 +1,37 @@
+package ipintel
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAggregateByNetwork(t *testing.T) {
+	now := time.Now()
+	rec := func(ip string, score float32, age time.Duration) Record {
+		return Record{Result: Result{IP: ip, Score: score, QueriedAt: now.Add(-age)}}
+	}
+	recs := []Record{
+		// judged by the latest lookup, which scored clean
+		rec("192.0.2.1", 1, 2*time.Hour),
+		rec("192.0.2.1", 0, time.Hour),
+		rec("192.0.2.2", 1, time.Hour),
+		rec("198.51.100.1", 1, time.Hour),
+		rec("2001:db8::1", 1, time.Hour),
+		rec("not an ip", 1, time.Hour),
+	}
+	groups := Aggregate(recs, ByNetwork(24, 64), 0.99)
+	want := map[string][3]int{ // IPs, proxies, lookups
+		"192.0.2.0/24":    {2, 1, 3},
+		"198.51.100.0/24": {1, 1, 1},
+		"2001:db8::/64":   {1, 1, 1},
+	}
+	if len(groups) != len(want) {
+		t.Fatalf("got %d groups, want %d: %+v", len(groups), len(want), groups)
+	}
+	for _, g := range groups {
+		w, ok := want[g.Key]
+		if !ok || g.IPs != w[0] || g.Proxies != w[1] || g.Lookups != w[2] {
+			t.Errorf("group %+v, want IPs, proxies and lookups %v", g, w)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package ipintel
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"sort"
+	"time"
+)
+
+// BlocklistEntry is an IP to be blocked until Expires.
+type BlocklistEntry struct {
+	IP      string    `json:"ip"`
+	Score   float32   `json:"score"`
+	Expires time.Time `json:"expires"`
+}
+
+// BlocklistFormat selects the output format of WriteBlocklist.
+type BlocklistFormat string
+
+const (
+	// PlainFormat writes one IP address per line.
+	PlainFormat BlocklistFormat = "plain"
+	// CIDRFormat writes one CIDR prefix per line, aggregating adjacent
+	// addresses into the smallest set of covering prefixes.
+	CIDRFormat BlocklistFormat = "cidr"
+	// JSONFormat writes a JSON array of BlocklistEntry.
+	JSONFormat BlocklistFormat = "json"
+)
+
+// Blocklist returns an entry for every IP whose most recent record in
+// recs scored at least threshold and is younger than ttl at now. An
+// entry expires ttl after its lookup. Entries are sorted by IP.
+//
+// Records that aren't of an IP address, such as those pseudonymized
+// with HashIP, are left out. Those of TruncateIP are listed under the
+// address of their network.
+func Blocklist(recs []Record, threshold float32, ttl time.Duration, now time.Time) []BlocklistEntry {
+	var entries []BlocklistEntry
+	for ip, rec := range latestByIP(recs) {
+		if _, err := netip.ParseAddr(ip); err != nil {
+			continue
+		}
+		expires := rec.QueriedAt.Add(ttl)
+		if rec.Score < threshold || !expires.After(now) {
+			continue
+		}
+		entries = append(entries, BlocklistEntry{IP: ip, Score: rec.Score, Expires: expires})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return compareIPs(entries[i].IP, entries[j].IP) < 0
+	})
+	return entries
+}
+
+// WriteBlocklist writes entries to w in the given format.
+func WriteBlocklist(w io.Writer, entries []BlocklistEntry, format BlocklistFormat) error {
+	switch format {
+	case JSONFormat:
+		if entries == nil {
+			entries = []BlocklistEntry{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	case PlainFormat, CIDRFormat:
+	default:
+		return fmt.Errorf("Unknown blocklist format %q", format)
+	}
+
+	lines := make([]string, 0, len(entries))
+	if format == PlainFormat {
+		for _, e := range entries {
+			lines = append(lines, e.IP)
+		}
+	} else {
+		addrs := make([]netip.Addr, 0, len(entries))
+		for _, e := range entries {
+			addr, err := netip.ParseAddr(e.IP)
+			if err != nil {
+				return fmt.Errorf("Invalid IP address %q in blocklist", e.IP)
+			}
+			addrs = append(addrs, addr.Unmap())
+		}
+		for _, p := range AggregatePrefixes(addrs) {
+			lines = append(lines, p.String())
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, l := range lines {
+		bw.WriteString(l)
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// AggregatePrefixes returns the smallest set of CIDR prefixes covering
+// exactly the given addresses, sorted.
+func AggregatePrefixes(addrs []netip.Addr) []netip.Prefix {
+	sorted := append([]netip.Addr(nil), addrs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Less(sorted[j]) })
+
+	var stack []netip.Prefix
+	for i, addr := range sorted {
+		if i > 0 && addr == sorted[i-1] {
+			continue
+		}
+		stack = append(stack, netip.PrefixFrom(addr, addr.BitLen()))
+		// merge the two topmost prefixes while they are siblings
+		for n := len(stack); n >= 2; n = len(stack) {
+			a, b := stack[n-2], stack[n-1]
+			if a.Bits() != b.Bits() || a.Bits() == 0 || a.Addr().Is4() != b.Addr().Is4() {
+				break
+			}
+			parent := netip.PrefixFrom(a.Addr(), a.Bits()-1).Masked()
+			if parent.Addr() != a.Addr() || !parent.Contains(b.Addr()) {
+				break
+			}
+			stack = append(stack[:n-2], parent)
+		}
+	}
+	return stack
+}
+
+// compareIPs orders IP addresses numerically, placing unparsable
+// addresses last in lexical order.
+func compareIPs(a, b string) int {
+	aa, errA := netip.ParseAddr(a)
+	ba, errB := netip.ParseAddr(b)
+	switch {
+	case errA == nil && errB == nil:
+		return aa.Compare(ba)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
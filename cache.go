@@ -0,0 +1,112 @@
+package ipintel
+
+import (
+	"context"
+	"time"
+)
+
+// Cache stores Results so repeated queries for an IP are answered
+// without the API. Implementations must be safe for concurrent use.
+type Cache interface {
+	// Get returns the Result stored under key, reporting false if
+	// there is none or it expired.
+	Get(ctx context.Context, key string) (Result, bool, error)
+	// Set stores res under key for ttl.
+	Set(ctx context.Context, key string, res Result, ttl time.Duration) error
+}
+
+// CacheKey returns the key a Client uses to cache the Result of ip
+// for the given check type.
+func CacheKey(ip string, check CheckType) string {
+	return string(check) + ":" + ip
+}
+
+// NamespaceCache returns a Cache keeping its entries in c under keys
+// prefixed with ns and a slash, so several Clients, e.g. of different
+// tenants, can share c without sharing Results. Purging, invalidating
+// and walking entries are not supported through it.
+func NamespaceCache(c Cache, ns string) Cache {
+	return namespaceCache{c, ns + "/"}
+}
+
+type namespaceCache struct {
+	c      Cache
+	prefix string
+}
+
+func (n namespaceCache) Get(ctx context.Context, key string) (Result, bool, error) {
+	return n.c.Get(ctx, n.prefix+key)
+}
+
+func (n namespaceCache) Set(ctx context.Context, key string, res Result, ttl time.Duration) error {
+	return n.c.Set(ctx, n.prefix+key, res, ttl)
+}
+
+// Locker coordinates lookups between processes sharing a Cache, so that
+// only one of them queries the API for an IP not yet cached.
+type Locker interface {
+	// TryLock takes the lock named key for at most ttl without waiting,
+	// reporting false if it is held by someone else. The returned
+	// unlock function releases a taken lock.
+	TryLock(ctx context.Context, key string, ttl time.Duration) (unlock func(), ok bool, err error)
+}
+
+// lockPoll is how often a waiting lookup checks whether the lock holder
+// has filled the cache.
+const lockPoll = 50 * time.Millisecond
+
+// lockedQuery queries the API for ip while holding the Locker's lock
+// for it. If another process holds the lock, it waits up to lockWait for
+// that process to cache its result before querying the API anyway.
+func (c *Client) lockedQuery(ctx context.Context, ip string, check CheckType, maxWait time.Duration) (Result, error) {
+	key := CacheKey(ip, check)
+	// long enough to cover a throttled query; should the lock expire
+	// early anyway, another process merely queries the API as well
+	unlock, ok, err := c.locker.TryLock(ctx, key, maxWait+c.lockWait)
+	if err == nil && !ok {
+		if res, ok := c.awaitCache(ctx, key); ok {
+			return res, nil
+		}
+	} else if ok {
+		defer unlock()
+	}
+
+	res, err := c.query(ctx, ip, check, maxWait)
+	if err == nil {
+		c.cacheSet(ctx, key, res)
+	}
+	return res, err
+}
+
+// awaitCache polls the cache for key for up to lockWait, going by the
+// Clock of c.
+func (c *Client) awaitCache(ctx context.Context, key string) (Result, bool) {
+	deadline := c.now().Add(c.lockWait)
+	for {
+		wait := min(lockPoll, deadline.Sub(c.now()))
+		if wait <= 0 || !c.sleep(ctx, wait) {
+			return Result{}, false
+		}
+		if res, ok := c.cacheGet(ctx, key); ok {
+			return res, true
+		}
+	}
+}
+
+// cacheGet looks up key, treating cache errors as misses.
+func (c *Client) cacheGet(ctx context.Context, key string) (Result, bool) {
+	res, ok, err := c.cache.Get(ctx, key)
+	if err != nil || !ok {
+		return Result{}, false
+	}
+	res.FromCache = true
+	// answered without a request this time
+	res.Attempts = 0
+	return res, true
+}
+
+// cacheSet stores res under key. The cache is an optimization only,
+// so errors are ignored.
+func (c *Client) cacheSet(ctx context.Context, key string, res Result) {
+	c.cache.Set(ctx, key, res, c.cacheTTL)
+}
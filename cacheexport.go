@@ -0,0 +1,72 @@
+package ipintel
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// CacheEntry is a cached Result with its key and the time it expires, a
+// zero Expires meaning never.
+type CacheEntry struct {
+	Key     string    `json:"key"`
+	Result  Result    `json:"result"`
+	Expires time.Time `json:"expires"`
+}
+
+// Walker is implemented by Caches able to list their entries, e.g. to
+// export them with ExportCache.
+type Walker interface {
+	// Walk calls fn with each unexpired entry until fn fails.
+	Walk(ctx context.Context, fn func(CacheEntry) error) error
+}
+
+// ExportCache writes the entries of w to out as JSON lines, one
+// CacheEntry per line, and returns their number. The output can be read
+// back with ImportCache, into a cache of any kind, e.g. to move scores
+// between machines or seed a test environment.
+func ExportCache(ctx context.Context, out io.Writer, w Walker) (int, error) {
+	bw := bufio.NewWriter(out)
+	enc := json.NewEncoder(bw)
+	var n int
+	err := w.Walk(ctx, func(e CacheEntry) error {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		return n, err
+	}
+	return n, bw.Flush()
+}
+
+// ImportCache stores the entries written by ExportCache in c, keeping
+// their expiry, and returns their number. Expired entries are skipped;
+// those without expiry are stored for ttl.
+func ImportCache(ctx context.Context, c Cache, r io.Reader, ttl time.Duration) (int, error) {
+	dec := json.NewDecoder(r)
+	var n int
+	for line := 1; ; line++ {
+		var e CacheEntry
+		if err := dec.Decode(&e); err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, fmt.Errorf("Entry %d: %w", line, err)
+		}
+		d := ttl
+		if !e.Expires.IsZero() {
+			if d = time.Until(e.Expires); d <= 0 {
+				continue
+			}
+		}
+		if err := c.Set(ctx, e.Key, e.Result, d); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
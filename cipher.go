@@ -0,0 +1,90 @@
+package ipintel
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+)
+
+// Cipher encrypts lookup data at rest with AES-GCM, e.g. for the
+// snapshots of ipintelcache and the database of ipintelstore. It is
+// safe for concurrent use.
+type Cipher struct {
+	aead cipher.AEAD
+	// Key of the nonces of SealDeterministic
+	nonceKey []byte
+}
+
+// NewCipher returns a Cipher using key, which must be 16, 24 or 32
+// bytes long for AES-128, AES-192 or AES-256.
+func NewCipher(key []byte) (*Cipher, error) {
+	switch len(key) {
+	case 16, 24, 32:
+	default:
+		return nil, fmt.Errorf("Invalid key length %d: must be 16, 24 or 32 bytes", len(key))
+	}
+	// separate keys for encryption and nonces, derived from key
+	encKey := deriveKey(key, "ipintel encryption")[:len(key)]
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{aead: aead, nonceKey: deriveKey(key, "ipintel nonce")}, nil
+}
+
+// ParseCipherKey decodes a base64 key for NewCipher, e.g. one made with
+// "openssl rand -base64 32".
+func ParseCipherKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid key: %w", err)
+	}
+	return key, nil
+}
+
+func deriveKey(key []byte, label string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(label))
+	return mac.Sum(nil)
+}
+
+// Seal encrypts and authenticates plaintext with a random nonce, which
+// is prepended to the returned ciphertext.
+func (c *Cipher) Seal(plaintext []byte) []byte {
+	nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(plaintext)+c.aead.Overhead())
+	rand.Read(nonce)
+	return c.aead.Seal(nonce, nonce, plaintext, nil)
+}
+
+// SealDeterministic is Seal with a nonce derived from plaintext, so
+// equal plaintexts give equal ciphertexts. This lets encrypted values
+// such as IPs still be looked up by equality, at the cost of revealing
+// which of them are equal.
+func (c *Cipher) SealDeterministic(plaintext []byte) []byte {
+	mac := hmac.New(sha256.New, c.nonceKey)
+	mac.Write(plaintext)
+	nonce := mac.Sum(nil)[:c.aead.NonceSize()]
+	return c.aead.Seal(nonce, nonce, plaintext, nil)
+}
+
+// Open decrypts a ciphertext returned by Seal or SealDeterministic,
+// failing if it was made with another key or modified.
+func (c *Cipher) Open(ciphertext []byte) ([]byte, error) {
+	n := c.aead.NonceSize()
+	if len(ciphertext) < n+c.aead.Overhead() {
+		return nil, fmt.Errorf("Failed to decrypt: ciphertext too short")
+	}
+	plaintext, err := c.aead.Open(nil, ciphertext[:n], ciphertext[n:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decrypt: wrong key or corrupt data")
+	}
+	return plaintext, nil
+}
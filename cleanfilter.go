@@ -0,0 +1,175 @@
+package ipintel
+
+import (
+	"hash/maphash"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CleanFilterList is the name of the list of Results answered by a
+// CleanFilter (see WithCleanFilter).
+const CleanFilterList = "clean-filter"
+
+// Defaults of NewCleanFilter.
+const (
+	DefaultCleanFilterCapacity = 100000
+	DefaultCleanFilterTTL      = time.Hour
+	// Share of IPs wrongly reported as clean
+	DefaultCleanFilterFPRate = 0.0001
+)
+
+// CleanFilter is a compact set of the IPs recently scored clean, which
+// is checked without locks or allocations. It is a pair of bloom
+// filters: adds go to the current one, which replaces the previous one
+// when it holds capacity IPs or half of ttl has passed, so an IP is
+// remembered for at most ttl. Being probabilistic, it reports about one
+// in 1/fpRate other IPs as clean as well. It is safe for concurrent use.
+type CleanFilter struct {
+	capacity int64
+	ttl      time.Duration
+	seed     maphash.Seed
+	// Bits and hash functions per filter
+	m uint64
+	k int
+
+	mu   sync.Mutex
+	gens atomic.Pointer[bloomPair]
+}
+
+type bloomPair struct {
+	cur, prev *bloom
+	// Time cur is to be rotated; zero until the first add or lookup,
+	// which starts the schedule at the time of the Client's Clock
+	until time.Time
+}
+
+type bloom struct {
+	words []atomic.Uint64
+	n     atomic.Int64
+}
+
+// NewCleanFilter returns a CleanFilter for capacity IPs per half of ttl
+// with the false positive rate fpRate. Zero values mean the defaults.
+func NewCleanFilter(capacity int, ttl time.Duration, fpRate float64) *CleanFilter {
+	if capacity <= 0 {
+		capacity = DefaultCleanFilterCapacity
+	}
+	if ttl <= 0 {
+		ttl = DefaultCleanFilterTTL
+	}
+	if fpRate <= 0 || fpRate >= 1 {
+		fpRate = DefaultCleanFilterFPRate
+	}
+	// the optimal size and number of hashes, halving the rate as a
+	// lookup checks two filters
+	m := math.Ceil(-float64(capacity) * math.Log(fpRate/2) / (math.Ln2 * math.Ln2))
+	f := &CleanFilter{
+		capacity: int64(capacity),
+		ttl:      ttl,
+		seed:     maphash.MakeSeed(),
+		m:        uint64(m),
+		k:        max(1, int(math.Round(m/float64(capacity)*math.Ln2))),
+	}
+	f.gens.Store(&bloomPair{cur: f.newBloom(), prev: f.newBloom()})
+	return f
+}
+
+func (f *CleanFilter) newBloom() *bloom {
+	return &bloom{words: make([]atomic.Uint64, (f.m+63)/64)}
+}
+
+// Add adds key, e.g. a CacheKey, to the set.
+func (f *CleanFilter) Add(key string) {
+	f.addAt(key, time.Now())
+}
+
+// addAt is Add at the time now.
+func (f *CleanFilter) addAt(key string, now time.Time) {
+	b := f.current(now).cur
+	h1, h2 := f.hash(key)
+	for i := range f.k {
+		bit := (h1 + uint64(i)*h2) % f.m
+		w := &b.words[bit/64]
+		if mask := uint64(1) << (bit % 64); w.Load()&mask == 0 {
+			w.Or(mask)
+		}
+	}
+	b.n.Add(1)
+}
+
+// Contains reports whether key was probably added within ttl.
+func (f *CleanFilter) Contains(key string) bool {
+	return f.containsAt(key, time.Now())
+}
+
+// containsAt is Contains at the time now.
+func (f *CleanFilter) containsAt(key string, now time.Time) bool {
+	g := f.current(now)
+	h1, h2 := f.hash(key)
+	return g.cur.contains(f, h1, h2) || g.prev.contains(f, h1, h2)
+}
+
+// Reset empties the set, e.g. after a policy change.
+func (f *CleanFilter) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.gens.Store(&bloomPair{cur: f.newBloom(), prev: f.newBloom()})
+}
+
+func (b *bloom) contains(f *CleanFilter, h1, h2 uint64) bool {
+	for i := range f.k {
+		bit := (h1 + uint64(i)*h2) % f.m
+		if b.words[bit/64].Load()&(uint64(1)<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// hash returns the two hashes of key the bit positions are derived from.
+func (f *CleanFilter) hash(key string) (uint64, uint64) {
+	h := maphash.String(f.seed, key)
+	return h & math.MaxUint32, h>>32 | 1
+}
+
+// current returns the filters at now, rotating them first if due.
+func (f *CleanFilter) current(now time.Time) *bloomPair {
+	g := f.gens.Load()
+	if now.Before(g.until) && g.cur.n.Load() < f.capacity {
+		return g
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	g = f.gens.Load()
+	if now.Before(g.until) && g.cur.n.Load() < f.capacity {
+		return g
+	}
+	prev, until := g.cur, now.Add(f.ttl/2)
+	if !now.Before(g.until) {
+		// keep the schedule, so no IP is remembered beyond ttl; after a
+		// full ttl without lookups, the current filter is stale too
+		if until = g.until.Add(f.ttl / 2); !now.Before(until) {
+			prev, until = f.newBloom(), now.Add(f.ttl/2)
+		}
+	}
+	g = &bloomPair{cur: f.newBloom(), prev: prev, until: until}
+	f.gens.Store(g)
+	return g
+}
+
+// WithCleanFilter remembers the IPs scoring below threshold, e.g. 0.5,
+// in f and answers lookups of them from f, before the cache and without
+// a Result to decode, which saves most of the work of lookups on sites
+// where nearly all traffic is clean. Such Results have a score of 0, the
+// List CleanFilterList and FromCache set. A small share of other IPs,
+// the false positive rate of f, is answered as clean too, so the filter
+// suits blocking policies trading that for throughput. Local lists and
+// hosting networks take precedence.
+func WithCleanFilter(f *CleanFilter, threshold float32) Option {
+	return func(c *Client) {
+		c.clean = f
+		c.cleanThreshold = threshold
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/netip"
+	"strconv"
+	"time"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+)
+
+func runAggregate(args []string) error {
+	fs := flag.NewFlagSet("aggregate", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: ipintel aggregate [flags]\n\nGroups the recorded IPs by network or country, most proxies first.\n\nFlags:")
+		fs.PrintDefaults()
+	}
+	db := fs.String("db", "", "SQLite database with recorded lookups (required)")
+	since := fs.Duration("since", 7*24*time.Hour, "only include lookups made within this period")
+	by := fs.String("by", "network", "grouping: network or country")
+	bits4 := fs.Int("prefix4", 24, "prefix length of IPv4 networks")
+	bits6 := fs.Int("prefix6", 64, "prefix length of IPv6 networks")
+	threshold := fs.Float64("threshold", 0.99, "score at or above which an IP counts as a proxy")
+	minProxies := fs.Int("min-proxies", 1, "only list groups with at least this many proxies")
+	top := fs.Int("top", 0, "number of groups listed, all if zero")
+	format := fs.String("format", "csv", "output format: csv, json, or cidr (networks only, for firewall rules)")
+	out := fs.String("o", "", "write to this file instead of stdout")
+	fs.Parse(args)
+
+	if *db == "" {
+		return fmt.Errorf("-db is required")
+	}
+	var key ipintel.GroupKey
+	switch *by {
+	case "network":
+		key = ipintel.ByNetwork(*bits4, *bits6)
+	case "country":
+		key = ipintel.ByCountry
+	default:
+		return fmt.Errorf("unknown grouping %q", *by)
+	}
+	switch {
+	case *format == "cidr" && *by != "network":
+		return fmt.Errorf("-format cidr needs -by network")
+	case *format != "csv" && *format != "json" && *format != "cidr":
+		return fmt.Errorf("unknown output format %q", *format)
+	}
+
+	st, err := openStore(*db)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	recs, err := st.Since(context.Background(), time.Now().Add(-*since))
+	if err != nil {
+		return err
+	}
+
+	var groups []ipintel.Group
+	for _, g := range ipintel.Aggregate(recs, key, float32(*threshold)) {
+		if g.Proxies < *minProxies || (*top > 0 && len(groups) >= *top) {
+			continue
+		}
+		groups = append(groups, g)
+	}
+
+	w, err := openOutput(*out)
+	if err != nil {
+		return err
+	}
+	switch *format {
+	case "json":
+		if groups == nil {
+			groups = []ipintel.Group{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(groups)
+	case "cidr":
+		err = writeGroupPrefixes(w, groups)
+	default:
+		err = writeGroupsCSV(w, groups)
+	}
+	if err != nil {
+		w.Abort()
+		return err
+	}
+	return w.Commit()
+}
+
+func writeGroupsCSV(w io.Writer, groups []ipintel.Group) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"key", "ips", "proxies", "lookups", "proxy_lookups", "mean_score", "max_score"})
+	for _, g := range groups {
+		cw.Write([]string{
+			g.Key,
+			strconv.Itoa(g.IPs),
+			strconv.Itoa(g.Proxies),
+			strconv.Itoa(g.Lookups),
+			strconv.Itoa(g.ProxyLookups),
+			strconv.FormatFloat(g.MeanScore, 'f', 3, 64),
+			strconv.FormatFloat(float64(g.MaxScore), 'f', -1, 32),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeGroupPrefixes writes the networks of groups, one per line.
+func writeGroupPrefixes(w io.Writer, groups []ipintel.Group) error {
+	for _, g := range groups {
+		p, err := netip.ParsePrefix(g.Key)
+		if err != nil {
+			continue
+		}
+		if _, err := fmt.Fprintln(w, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
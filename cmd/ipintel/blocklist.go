@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+)
+
+func runBlocklist(args []string) error {
+	fs := flag.NewFlagSet("blocklist", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: ipintel blocklist [flags]\n\nWrites the IPs whose latest recorded lookup scored at least the threshold.\n\nFlags:")
+		fs.PrintDefaults()
+	}
+	db := fs.String("db", "", "SQLite database with recorded lookups (required)")
+	threshold := fs.Float64("threshold", 0.99, "minimum score of listed IPs")
+	ttl := fs.Duration("ttl", 24*time.Hour, "time an entry stays listed after its lookup")
+	format := fs.String("format", "plain", "output format: plain, cidr or json")
+	out := fs.String("o", "", "write to this file instead of stdout")
+	fs.Parse(args)
+
+	if *db == "" {
+		return fmt.Errorf("-db is required")
+	}
+	st, err := openStore(*db)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	now := time.Now()
+	recs, err := st.Since(context.Background(), now.Add(-*ttl))
+	if err != nil {
+		return err
+	}
+	entries := ipintel.Blocklist(recs, float32(*threshold), *ttl, now)
+
+	w, err := openOutput(*out)
+	if err != nil {
+		return err
+	}
+	if err := ipintel.WriteBlocklist(w, entries, ipintel.BlocklistFormat(*format)); err != nil {
+		w.Abort()
+		return err
+	}
+	return w.Commit()
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+	"github.com/pierelucas/go-ipintel/ipintelconfig"
+)
+
+func runCache(args []string) error {
+	usage := "Usage: ipintel cache export [flags]\n       ipintel cache import [flags] [file]\n       ipintel cache invalidate [flags] ip|cidr...\n\nExports the entries of the configured cache as JSON lines, or imports\nthem from file or stdin, keeping their expiry, e.g. to move scores\nbetween machines, back them up or seed a test environment. Invalidate\ndrops the entries of IPs and ranges, forcing them to be checked again."
+	if len(args) == 0 || (args[0] != "export" && args[0] != "import" && args[0] != "invalidate") {
+		fmt.Fprintln(os.Stderr, usage+"\n\nRun \"ipintel cache export -h\" for the flags.")
+		os.Exit(2)
+	}
+	fs := flag.NewFlagSet("cache "+args[0], flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), usage+"\n\nFlags:")
+		fs.PrintDefaults()
+	}
+	config := fs.String("config", "", "YAML or TOML configuration file with a cache section (required)")
+	out := fs.String("o", "", "export to this file instead of stdout")
+	fs.Parse(args[1:])
+
+	if *config == "" {
+		return fmt.Errorf("-config is required")
+	}
+	cfg, err := ipintelconfig.LoadConfig(*config)
+	if err != nil {
+		return err
+	}
+	// the in-memory cache only outlives the process in its snapshot
+	if cc := cfg.Cache; cc == nil {
+		return fmt.Errorf("No cache configured")
+	} else if cc.Redis == nil && cc.Memcached == nil && cc.Snapshot == "" {
+		return fmt.Errorf("The in-memory cache requires cache.snapshot")
+	}
+	setup, err := cfg.Build(context.Background())
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "export":
+		err = exportCache(setup, *out)
+	case "import":
+		err = importCache(setup, fs.Arg(0))
+	case "invalidate":
+		err = invalidateCache(setup, fs.Args())
+	}
+	// after changes, this saves the snapshot
+	if cerr := setup.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func exportCache(setup *ipintelconfig.Setup, out string) error {
+	walker, ok := setup.Cache.(ipintel.Walker)
+	if !ok {
+		return fmt.Errorf("The configured cache can't list its entries")
+	}
+	w, err := openOutput(out)
+	if err != nil {
+		return err
+	}
+	n, err := ipintel.ExportCache(context.Background(), w, walker)
+	if err != nil {
+		w.Abort()
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d entries\n", n)
+	return w.Commit()
+}
+
+// importCache imports the file at path, or stdin if empty.
+func importCache(setup *ipintelconfig.Setup, path string) error {
+	var r io.Reader = os.Stdin
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	n, err := ipintel.ImportCache(context.Background(), setup.Cache, r, setup.CacheTTL)
+	fmt.Fprintf(os.Stderr, "Imported %d entries\n", n)
+	return err
+}
+
+// invalidateCache drops the entries of the IPs and CIDR ranges in args.
+func invalidateCache(setup *ipintelconfig.Setup, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("No IPs or ranges given")
+	}
+	ctx := context.Background()
+	var total int
+	for _, arg := range args {
+		var (
+			n   int
+			err error
+		)
+		if strings.Contains(arg, "/") {
+			prefix, perr := netip.ParsePrefix(arg)
+			if perr != nil {
+				return fmt.Errorf("Invalid range %q", arg)
+			}
+			n, err = setup.Client.InvalidateRange(ctx, prefix)
+		} else {
+			addr, perr := netip.ParseAddr(arg)
+			if perr != nil {
+				return fmt.Errorf("Invalid IP address %q", arg)
+			}
+			n, err = setup.Client.Invalidate(ctx, addr.String())
+		}
+		if err != nil {
+			return err
+		}
+		total += n
+	}
+	fmt.Fprintf(os.Stderr, "Invalidated %d entries\n", total)
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+)
+
+func runCheck(args []string) error {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: ipintel check [flags] [ip ...]\n\nLooks up the given IPs, or one IP per line read from stdin. With\n-resolve, hostnames and URLs are accepted as well, and all their\naddresses are looked up.\n\nFlags:")
+		fs.PrintDefaults()
+	}
+	cf := addClientFlags(fs)
+	format := fs.String("format", "csv", "output format: csv or jsonl")
+	resolve := fs.Bool("resolve", false, "resolve hostnames and look up all their addresses, with the API only")
+	fs.Parse(args)
+
+	w, err := newResultWriter(*format)
+	if err != nil {
+		return err
+	}
+	c, p, closeClient, err := cf.client()
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+
+	ips := fs.Args()
+	if len(ips) == 0 {
+		sc := bufio.NewScanner(os.Stdin)
+		for sc.Scan() {
+			if ip := strings.TrimSpace(sc.Text()); ip != "" {
+				ips = append(ips, ip)
+			}
+		}
+		if err := sc.Err(); err != nil {
+			return err
+		}
+	}
+
+	failed := 0
+	for _, ip := range ips {
+		var results []ipintel.Result
+		if *resolve {
+			results, err = c.CheckHost(context.Background(), ip)
+		} else {
+			var res ipintel.Result
+			res, err = p.GetProxyScore(context.Background(), ip)
+			results = []ipintel.Result{res}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", ip, err)
+			failed++
+			if !*resolve {
+				continue
+			}
+		}
+		for _, res := range results {
+			if err := w.Write(res); err != nil {
+				return err
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d lookups failed", failed, len(ips))
+	}
+	return nil
+}
+
+func newResultWriter(format string) (ipintel.ResultWriter, error) {
+	switch format {
+	case "csv":
+		return ipintel.NewCSVWriter(os.Stdout), nil
+	case "jsonl":
+		return ipintel.NewJSONLWriter(os.Stdout), nil
+	}
+	return nil, fmt.Errorf("unknown output format %q", format)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+	"github.com/pierelucas/go-ipintel/ipintelconfig"
+	"github.com/pierelucas/go-ipintel/ipintelproviders"
+)
+
+// clientFlags are the flags of the commands querying the API.
+type clientFlags struct {
+	config  *string
+	contact *string
+	check   *string
+	ssl     *bool
+	maxWait *time.Duration
+	db      *string
+	// Registered providers looked up along with the API
+	providers providerFlags
+}
+
+// providerFlags collects the -provider flags, each a provider name
+// optionally followed by its settings in query form, e.g.
+// "example?key=secret".
+type providerFlags []string
+
+func (p *providerFlags) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *providerFlags) Set(s string) error {
+	*p = append(*p, s)
+	return nil
+}
+
+func addClientFlags(fs *flag.FlagSet) *clientFlags {
+	f := &clientFlags{
+		config:  fs.String("config", "", "YAML or TOML configuration file, replacing the client flags below"),
+		contact: fs.String("contact", os.Getenv("IPINTEL_CONTACT"), "contact email address sent to the API, or a file:// or env:// secret reference (required, defaults to $IPINTEL_CONTACT)"),
+		check:   fs.String("check", "dynamic", "type of check: static or dynamic"),
+		ssl:     fs.Bool("https", true, "query the API over HTTPS; -https=false uses plain HTTP"),
+		maxWait: fs.Duration("max-wait", time.Minute, "maximum time to wait when throttled"),
+		db:      fs.String("db", "", "record lookups in the SQLite database at this path"),
+	}
+	fs.Var(&f.providers, "provider", "also look up IPs with this registered provider, given as name or name?key=value&...; repeatable (registered: "+strings.Join(ipintel.Providers(), ", ")+")")
+	return f
+}
+
+// client builds the Client configured by the flags and the Provider
+// fusing it with the configured providers, which is the Client itself
+// if there are none. The returned function releases their resources.
+func (f *clientFlags) client() (*ipintel.Client, ipintel.Provider, func(), error) {
+	if *f.config != "" {
+		cfg, err := ipintelconfig.LoadConfig(*f.config)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		for _, p := range f.providers {
+			pc, err := parseProviderFlag(p)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			cfg.Providers = append(cfg.Providers, pc)
+		}
+		setup, err := cfg.Build(context.Background())
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return setup.Client, setup.Provider, func() { setup.Close() }, nil
+	}
+
+	if *f.contact == "" {
+		return nil, nil, nil, fmt.Errorf("-contact is required")
+	}
+	email, err := ipintel.ResolveSecret(*f.contact)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	check, err := ipintel.ParseCheckType(*f.check)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var opts []ipintel.Option
+	closeFn := func() {}
+	if *f.db != "" {
+		st, err := openStore(*f.db)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		closeFn = func() { st.Close() }
+		opts = append(opts, ipintel.WithStore(st))
+	}
+	c := ipintel.NewClient(email, *f.ssl, check, *f.maxWait, opts...)
+	if err := c.Validate(); err != nil {
+		closeFn()
+		return nil, nil, nil, err
+	}
+	if len(f.providers) == 0 {
+		return c, c, closeFn, nil
+	}
+	providers := []ipintel.Provider{c}
+	for _, s := range f.providers {
+		pc, err := parseProviderFlag(s)
+		if err != nil {
+			closeFn()
+			return nil, nil, nil, err
+		}
+		p, err := ipintel.NewProvider(pc.Name, pc.Options)
+		if err != nil {
+			closeFn()
+			return nil, nil, nil, err
+		}
+		if cl, ok := p.(io.Closer); ok {
+			prev := closeFn
+			closeFn = func() { cl.Close(); prev() }
+		}
+		providers = append(providers, p)
+	}
+	return c, ipintelproviders.Fuse(0.99, providers...), closeFn, nil
+}
+
+// parseProviderFlag parses a -provider flag.
+func parseProviderFlag(s string) (ipintelconfig.ProviderConfig, error) {
+	name, query, _ := strings.Cut(s, "?")
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return ipintelconfig.ProviderConfig{}, fmt.Errorf("Invalid -provider %q: %w", s, err)
+	}
+	pc := ipintelconfig.ProviderConfig{Name: name, Options: make(map[string]string, len(values))}
+	for k, v := range values {
+		pc.Options[k] = v[len(v)-1]
+	}
+	return pc, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/pierelucas/go-ipintel/ipintellog"
+)
+
+// stateSaveInterval is how often -follow saves its state.
+const stateSaveInterval = 10 * time.Second
+
+type followOptions struct {
+	statePath   string
+	recheck     time.Duration
+	threshold   float32
+	proxiesOnly bool
+	format      string
+}
+
+// followLog scores the IPs of lines appended to path until interrupted,
+// writing a result for each IP not checked within opts.recheck.
+func followLog(cf *clientFlags, path string, parse ipintellog.Parser, opts followOptions) error {
+	format := "csv"
+	if opts.format == "json" {
+		format = "jsonl"
+	} else if opts.format != "csv" {
+		return fmt.Errorf("unknown output format %q", opts.format)
+	}
+	w, err := newResultWriter(format)
+	if err != nil {
+		return err
+	}
+
+	state := ipintellog.NewState()
+	if opts.statePath != "" {
+		if state, err = ipintellog.LoadState(opts.statePath); err != nil {
+			return err
+		}
+	}
+	save := func() {
+		if opts.statePath == "" {
+			return
+		}
+		if err := state.Save(opts.statePath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+	defer save()
+
+	_, c, closeClient, err := cf.client()
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	lastSave := time.Now()
+	err = ipintellog.Follow(ctx, path, parse, state, func(e ipintellog.Entry) {
+		ip := e.IP.Unmap().WithZone("")
+		if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+			return
+		}
+		if _, ok := state.Lookup(ip, opts.recheck); ok {
+			return
+		}
+		res, err := c.GetProxyScore(ctx, ip.String())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", ip, err)
+			return
+		}
+		state.Checked[ip] = res
+		if !opts.proxiesOnly || res.Score >= opts.threshold {
+			if w.Write(res) == nil {
+				w.Flush()
+			}
+		}
+		if time.Since(lastSave) >= stateSaveInterval {
+			save()
+			lastSave = time.Now()
+		}
+	})
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
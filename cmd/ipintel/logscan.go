@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+	"github.com/pierelucas/go-ipintel/ipintellog"
+)
+
+func runLogscan(args []string) error {
+	fs := flag.NewFlagSet("logscan", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: ipintel logscan [flags] [file ...]\n\nScores the client IPs of log files, or of stdin, busiest first.\nWith -flow-listen, the IPs of NetFlow or IPFIX flows received instead.\nWith -follow, the lines appended to a single file are scored as they\ncome, writing a result for each new IP.\n\nFlags:")
+		fs.PrintDefaults()
+	}
+	cf := addClientFlags(fs)
+	logFormat := fs.String("log-format", "access", "log format: access (common or combined), ssh (sshd failures in auth.log), ssh-journal (journalctl -o json), postfix, exim, or pcap (IPs of captured packets)")
+	flowListen := fs.String("flow-listen", "", "collect NetFlow v5/v9 or IPFIX flows on this UDP address instead of reading files")
+	flowDuration := fs.Duration("flow-duration", 5*time.Minute, "time to collect flows for with -flow-listen")
+	threshold := fs.Float64("threshold", 0.99, "score at or above which an IP counts as a proxy")
+	proxiesOnly := fs.Bool("proxies", false, "only list IPs counting as proxy")
+	format := fs.String("format", "csv", "output format: csv or json")
+	blocklist := fs.String("blocklist", "", "instead of the report, write the IPs counting as proxy as a blocklist: plain, cidr or json")
+	ttl := fs.Duration("ttl", 24*time.Hour, "time a blocklist entry stays listed after its lookup")
+	out := fs.String("o", "", "write to this file instead of stdout")
+	follow := fs.Bool("follow", false, "follow the file given, scoring new IPs as lines are appended")
+	statePath := fs.String("state", "", "with -follow, keep the read position and checked IPs in this file across restarts")
+	recheck := fs.Duration("recheck", 24*time.Hour, "with -follow, look up IPs again once their last lookup is this old")
+	fs.Parse(args)
+
+	if *follow {
+		if fs.NArg() != 1 {
+			return fmt.Errorf("-follow needs exactly one file")
+		}
+		if *out != "" || *blocklist != "" {
+			return fmt.Errorf("-follow writes to stdout only")
+		}
+		parse, err := logParser(*logFormat)
+		if err != nil {
+			return err
+		}
+		return followLog(cf, fs.Arg(0), parse, followOptions{
+			statePath:   *statePath,
+			recheck:     *recheck,
+			threshold:   float32(*threshold),
+			proxiesOnly: *proxiesOnly,
+			format:      *format,
+		})
+	}
+
+	read, err := logReader(*logFormat)
+	if err != nil {
+		return err
+	}
+	if *blocklist == "" && *format != "csv" && *format != "json" {
+		return fmt.Errorf("unknown output format %q", *format)
+	}
+
+	tally := ipintellog.NewTally()
+	if *flowListen != "" {
+		if err := collectFlows(tally, *flowListen, *flowDuration); err != nil {
+			return err
+		}
+	} else if fs.NArg() == 0 {
+		if err := read(tally, os.Stdin); err != nil {
+			return err
+		}
+	}
+	for _, path := range fs.Args() {
+		if *flowListen != "" {
+			break
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		err = read(tally, f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	_, c, closeClient, err := cf.client()
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	sources := tally.Sources()
+	ipintellog.Score(context.Background(), c, sources)
+
+	var listed []*ipintellog.Source
+	var entries, proxyEntries, proxies, failed int
+	for _, s := range sources {
+		entries += s.Count
+		if s.Err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", s.IP, s.Err)
+			failed++
+		}
+		proxy := s.Proxy(float32(*threshold))
+		if proxy {
+			proxies++
+			proxyEntries += s.Count
+		}
+		if proxy || !*proxiesOnly {
+			listed = append(listed, s)
+		}
+	}
+
+	w, err := openOutput(*out)
+	if err != nil {
+		return err
+	}
+	if *blocklist != "" {
+		recs := make([]ipintel.Record, 0, len(listed))
+		for _, s := range listed {
+			if s.Proxy(float32(*threshold)) {
+				recs = append(recs, ipintel.Record{Result: s.Result})
+			}
+		}
+		entries := ipintel.Blocklist(recs, float32(*threshold), *ttl, time.Now())
+		err = ipintel.WriteBlocklist(w, entries, ipintel.BlocklistFormat(*blocklist))
+	} else if *format == "json" {
+		err = writeSourcesJSON(w, listed)
+	} else {
+		err = writeSourcesCSV(w, listed)
+	}
+	if err != nil {
+		w.Abort()
+		return err
+	}
+	if err := w.Commit(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "%d of %d lines from %d IPs; %d of them from %d proxies\n",
+		entries, tally.Lines, len(sources), proxyEntries, proxies)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d lookups failed", failed, len(sources))
+	}
+	return nil
+}
+
+// logReader returns a function adding the entries of a file in format
+// to a Tally.
+func logReader(format string) (func(*ipintellog.Tally, io.Reader) error, error) {
+	if format == "pcap" {
+		return (*ipintellog.Tally).ReadPcap, nil
+	}
+	parse, err := logParser(format)
+	if err != nil {
+		return nil, err
+	}
+	return func(t *ipintellog.Tally, r io.Reader) error {
+		return t.Read(r, parse)
+	}, nil
+}
+
+// logParser returns the Parser of a line-based log format.
+func logParser(format string) (ipintellog.Parser, error) {
+	switch format {
+	case "access":
+		return ipintellog.ParseAccessLog, nil
+	case "ssh":
+		return ipintellog.ParseSSHAuth, nil
+	case "ssh-journal":
+		return ipintellog.Journal(ipintellog.ParseSSHAuth), nil
+	case "postfix":
+		return ipintellog.ParsePostfix, nil
+	case "exim":
+		return ipintellog.ParseExim, nil
+	case "pcap":
+		return nil, fmt.Errorf("log format pcap can't be followed")
+	}
+	return nil, fmt.Errorf("unknown log format %q", format)
+}
+
+// collectFlows adds the flows received on the UDP address addr for d to
+// t. Malformed packets are skipped.
+func collectFlows(t *ipintellog.Tally, addr string, d time.Duration) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(d))
+	dec := t.NewFlowDecoder()
+	buf := make([]byte, 65536)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if dec.Decode(buf[:n]) != nil {
+			t.Unparsed++
+		}
+	}
+}
+
+func writeSourcesCSV(w io.Writer, sources []*ipintellog.Source) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"ip", "count", "first", "last", "score", "risk", "sample"})
+	for _, s := range sources {
+		var score, risk string
+		if s.Err == nil {
+			score = strconv.FormatFloat(float64(s.Result.Score), 'f', -1, 32)
+			risk = s.Result.Risk().String()
+		}
+		cw.Write([]string{s.IP.String(), strconv.Itoa(s.Count), formatTime(s.First), formatTime(s.Last), score, risk, s.Sample})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// sourceJSON is the JSON representation of a Source.
+type sourceJSON struct {
+	IP     string          `json:"ip"`
+	Count  int             `json:"count"`
+	First  string          `json:"first,omitempty"`
+	Last   string          `json:"last,omitempty"`
+	Sample string          `json:"sample,omitempty"`
+	Result *ipintel.Result `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+func writeSourcesJSON(w io.Writer, sources []*ipintellog.Source) error {
+	v := make([]sourceJSON, len(sources))
+	for i, s := range sources {
+		v[i] = sourceJSON{
+			IP:     s.IP.String(),
+			Count:  s.Count,
+			First:  formatTime(s.First),
+			Last:   formatTime(s.Last),
+			Sample: s.Sample,
+		}
+		if s.Err != nil {
+			v[i].Error = s.Err.Error()
+		} else {
+			v[i].Result = &s.Result
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
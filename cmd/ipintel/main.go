@@ -0,0 +1,71 @@
+// Command ipintel queries the getipintel.net proxy detection API and
+// works with recorded lookups.
+//
+// Usage:
+//
+//	ipintel <command> [flags] [args]
+//
+// Commands:
+//
+//	check      look up the proxy score of IP addresses
+//	blocklist  export recorded IPs scoring above a threshold
+//	report     summarize recorded lookups
+//	aggregate  group recorded IPs by network or country
+//	logscan    score the client IPs of log files
+//	cache      export, import or invalidate cached scores
+//	serve      serve the scoring API and run scheduled jobs
+//
+// Run "ipintel <command> -h" for the flags of a command. Databases given
+// with -db are read and written encrypted with the base64 key in
+// $IPINTEL_ENCRYPTION_KEY, if set.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type command struct {
+	name  string
+	short string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"check", "look up the proxy score of IP addresses", runCheck},
+	{"blocklist", "export recorded IPs scoring above a threshold", runBlocklist},
+	{"report", "summarize recorded lookups", runReport},
+	{"aggregate", "group recorded IPs by network or country", runAggregate},
+	{"logscan", "score the client IPs of log files", runLogscan},
+	{"cache", "export, import or invalidate cached scores", runCache},
+	{"serve", "serve the scoring API and run scheduled jobs", runServe},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	for _, cmd := range commands {
+		if cmd.name == os.Args[1] {
+			if err := cmd.run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "ipintel %s: %v\n", cmd.name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	if os.Args[1] != "-h" && os.Args[1] != "help" {
+		fmt.Fprintf(os.Stderr, "ipintel: unknown command %q\n", os.Args[1])
+	}
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: ipintel <command> [flags] [args]\n\nCommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.short)
+	}
+	fmt.Fprintln(os.Stderr, "\nRun \"ipintel <command> -h\" for the flags of a command.")
+}
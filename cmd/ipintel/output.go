@@ -0,0 +1,50 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// output is a command's output file, or stdout. A file is written
+// atomically: it only replaces the target path on Commit.
+type output struct {
+	io.Writer
+	f    *os.File
+	path string
+}
+
+func openOutput(path string) (*output, error) {
+	if path == "" {
+		return &output{Writer: os.Stdout}, nil
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return nil, err
+	}
+	return &output{Writer: f, f: f, path: path}, nil
+}
+
+// Commit moves the written file into place.
+func (o *output) Commit() error {
+	if o.f == nil {
+		return nil
+	}
+	if err := o.f.Chmod(0644); err != nil {
+		o.Abort()
+		return err
+	}
+	if err := o.f.Close(); err != nil {
+		os.Remove(o.f.Name())
+		return err
+	}
+	return os.Rename(o.f.Name(), o.path)
+}
+
+// Abort discards the written file.
+func (o *output) Abort() {
+	if o.f != nil {
+		o.f.Close()
+		os.Remove(o.f.Name())
+	}
+}
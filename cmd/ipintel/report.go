@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"time"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+)
+
+func runReport(args []string) error {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: ipintel report [flags]\n\nSummarizes the lookups recorded in a database.\n\nFlags:")
+		fs.PrintDefaults()
+	}
+	db := fs.String("db", "", "SQLite database with recorded lookups (required)")
+	since := fs.Duration("since", 7*24*time.Hour, "only include lookups made within this period")
+	threshold := fs.Float64("threshold", 0.99, "score at or above which an IP counts as a proxy")
+	interval := fs.Duration("interval", 24*time.Hour, "width of the proxy rate buckets")
+	top := fs.Int("top", 10, "number of networks listed")
+	format := fs.String("format", "markdown", "output format: markdown, html or json")
+	out := fs.String("o", "", "write to this file instead of stdout")
+	fs.Parse(args)
+
+	if *db == "" {
+		return fmt.Errorf("-db is required")
+	}
+	if *format != "markdown" && *format != "html" && *format != "json" {
+		return fmt.Errorf("unknown output format %q", *format)
+	}
+	st, err := openStore(*db)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	recs, err := st.Since(context.Background(), time.Now().Add(-*since))
+	if err != nil {
+		return err
+	}
+	report := ipintel.NewReport(recs, ipintel.ReportOptions{
+		Threshold: float32(*threshold),
+		Interval:  *interval,
+		TopN:      *top,
+	})
+
+	w, err := openOutput(*out)
+	if err != nil {
+		return err
+	}
+	if *format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	} else if *format == "html" {
+		err = report.WriteHTML(w)
+	} else {
+		err = report.WriteMarkdown(w)
+	}
+	if err != nil {
+		w.Abort()
+		return err
+	}
+	return w.Commit()
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+	"github.com/pierelucas/go-ipintel/ipintelconfig"
+	"github.com/pierelucas/go-ipintel/ipintelserver"
+)
+
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: ipintel serve [flags]\n\nServes the scoring API, runs the jobs and forwards the TCP connections to\nthe gatekeepers of the server section of the configuration until\ninterrupted. SIGHUP reloads the lists, policies and providers of the\nconfiguration. On SIGTERM or SIGINT, running lookups are given\nserver.shutdown_timeout to finish before the cache and store are\nclosed.\n\nUnder systemd, the sockets of socket activation are used in place of\nthe listen addresses, the API's first, then the gatekeepers' in order,\nand readiness, reloads and the watchdog are notified for Type=notify.\n\nFlags:")
+		fs.PrintDefaults()
+	}
+	config := fs.String("config", "", "YAML or TOML configuration file (required)")
+	listen := fs.String("listen", "", "address to listen on, overriding server.listen")
+	fs.Parse(args)
+
+	if *config == "" {
+		return fmt.Errorf("-config is required")
+	}
+	cfg, err := ipintelconfig.LoadConfig(*config)
+	if err != nil {
+		return err
+	}
+	setup, err := cfg.Build(context.Background())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := setup.Close(); err != nil {
+			log.Printf("closing: %v", err)
+		}
+	}()
+
+	// filled below, once the server is set up
+	var gatekeepers []*ipintelserver.Gatekeeper
+	reload := func(ctx context.Context) error {
+		return reloadConfig(ctx, *config, setup, cfg, gatekeepers)
+	}
+	srvOpts := []ipintelserver.Option{
+		ipintelserver.WithClient(setup.Client),
+		ipintelserver.WithReloader(reload),
+	}
+	if setup.Cache != nil {
+		srvOpts = append(srvOpts, ipintelserver.WithInvalidator(setup.Client))
+	}
+	if setup.Lists != nil {
+		srvOpts = append(srvOpts, ipintelserver.WithLists(setup.Lists))
+	}
+	if sc := cfg.Server; sc != nil {
+		srvOpts = append(srvOpts, ipintelserver.WithBatchLimits(sc.MaxBatch, time.Duration(sc.BatchRetention)),
+			ipintelserver.WithMaxRunningBatches(sc.MaxRunningBatches))
+		if sc.AdminToken != "" {
+			token, err := ipintel.ResolveSecret(sc.AdminToken)
+			if err != nil {
+				return err
+			}
+			srvOpts = append(srvOpts, ipintelserver.WithAdminToken(token))
+		}
+		if sc.QueryLimit > 0 {
+			srvOpts = append(srvOpts, ipintelserver.WithQueryLimit(sc.QueryLimit, time.Duration(sc.QueryPeriod)))
+		}
+		if len(sc.Tokens) > 0 || len(sc.Tenants) > 0 {
+			tokens, err := sc.APITokens()
+			if err != nil {
+				return err
+			}
+			tenantTokens, err := sc.TenantTokens(setup)
+			if err != nil {
+				return err
+			}
+			srvOpts = append(srvOpts, ipintelserver.WithTokens(append(tokens, tenantTokens...)...))
+		}
+	}
+	srv := ipintelserver.New(setup.Provider, srvOpts...)
+	addr := "localhost:8080"
+	if sc := cfg.Server; sc != nil {
+		if sc.Listen != "" {
+			addr = sc.Listen
+		}
+		for _, jc := range sc.Jobs {
+			j, err := serverJob(setup, jc)
+			if err != nil {
+				return err
+			}
+			if err := srv.AddJob(j); err != nil {
+				return err
+			}
+		}
+	}
+	if *listen != "" {
+		addr = *listen
+	}
+
+	// sockets passed by systemd socket activation, the API's first,
+	// then those of the gatekeepers in their order
+	activated, err := ipintelserver.SystemdListeners()
+	if err != nil {
+		return err
+	}
+	listenOn := func(i int, addr string) (net.Listener, error) {
+		if i < len(activated) {
+			return activated[i], nil
+		}
+		return net.Listen("tcp", addr)
+	}
+	// listen first, so a taken port fails before anything runs
+	l, err := listenOn(0, addr)
+	if err != nil {
+		return err
+	}
+	if len(activated) > 0 {
+		addr = l.Addr().String()
+	}
+	if sc := cfg.Server; sc != nil && len(sc.ProxyProtocol) > 0 {
+		trusted, _ := ipintelconfig.ParsePrefixes(sc.ProxyProtocol)
+		l = ipintelserver.ProxyListener(l, trusted...)
+	}
+	scheme := "http"
+	if sc := cfg.Server; sc != nil && sc.TLS != nil {
+		tlsConfig, err := sc.TLS.ServerTLS(func(err error) {
+			log.Printf("tls: %v", err)
+		})
+		if err != nil {
+			l.Close()
+			return err
+		}
+		// after the PROXY protocol header, which precedes the handshake
+		l = tls.NewListener(l, tlsConfig)
+		scheme = "https"
+	}
+	listeners := []net.Listener{l}
+	defer func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}()
+	if sc := cfg.Server; sc != nil {
+		for i, gc := range sc.Gatekeepers {
+			gk, err := gatekeeper(setup.Provider, gc)
+			if err != nil {
+				return err
+			}
+			gl, err := listenOn(i+1, gc.Listen)
+			if err != nil {
+				return err
+			}
+			gatekeepers = append(gatekeepers, gk)
+			listeners = append(listeners, gl)
+		}
+	}
+	if extra := activated[min(len(listeners), len(activated)):]; len(extra) > 0 {
+		log.Printf("ignoring %d sockets passed by systemd beyond the API and gatekeepers", len(extra))
+		for _, l := range extra {
+			l.Close()
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	hs := &http.Server{Addr: addr, Handler: srv}
+	// one for the HTTP server and one per gatekeeper
+	errc := make(chan error, 1+len(gatekeepers))
+	go func() {
+		errc <- hs.Serve(l)
+	}()
+	jobsDone := make(chan struct{})
+	go func() {
+		srv.Run(ctx)
+		close(jobsDone)
+	}()
+	log.Printf("listening on %s://%s", scheme, addr)
+	go ipintelserver.SystemdWatchdog(ctx, func(err error) {
+		log.Printf("systemd: %v", err)
+	})
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				notify("RELOADING=1")
+				if err := reload(ctx); err != nil {
+					log.Printf("reload: %v", err)
+				}
+				notify("READY=1")
+			}
+		}
+	}()
+	for i, gk := range gatekeepers {
+		go func() {
+			if err := gk.Serve(ctx, listeners[i+1]); err != nil {
+				errc <- fmt.Errorf("gatekeeper %s: %w", cfg.Server.Gatekeepers[i].Listen, err)
+			}
+		}()
+		log.Printf("forwarding %s to %s", listeners[i+1].Addr(), cfg.Server.Gatekeepers[i].Backend)
+	}
+	notify("READY=1")
+
+	timeout := 30 * time.Second
+	if sc := cfg.Server; sc != nil && sc.ShutdownTimeout > 0 {
+		timeout = time.Duration(sc.ShutdownTimeout)
+	}
+	drained := make(chan error, 1)
+	select {
+	case err = <-errc:
+		log.Printf("serve: %v", err)
+		stop()
+		hs.Close()
+		drained <- srv.Shutdown(ctx)
+	case <-ctx.Done():
+		// from now on, a second signal ends the process right away
+		stop()
+		notify("STOPPING=1")
+		log.Printf("shutting down, waiting up to %s for lookups to finish", timeout)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		// along with hs.Shutdown, which waits for the streams it ends
+		go func() {
+			drained <- srv.Shutdown(shutdownCtx)
+		}()
+		// the gatekeepers stopped accepting connections with ctx
+		err = hs.Shutdown(shutdownCtx)
+		if errors.Is(err, context.DeadlineExceeded) {
+			log.Printf("closing the connections of unfinished requests")
+			err = hs.Close()
+		}
+	}
+	if <-drained != nil {
+		log.Printf("canceled the unfinished batch lookups")
+	}
+	<-jobsDone
+	// the deferred setup.Close then saves the cache and closes the store
+	if errors.Is(err, http.ErrServerClosed) {
+		err = nil
+	}
+	return err
+}
+
+// notify sends state to systemd, if it started the process, logging
+// failures.
+func notify(state string) {
+	if err := ipintelserver.SystemdNotify(state); err != nil {
+		log.Printf("systemd: %v", err)
+	}
+}
+
+// gatekeeper builds the TCP proxy configured by gc, logging drops and
+// errors.
+func gatekeeper(c ipintel.Checker, gc ipintelconfig.GatekeeperConfig) (*ipintelserver.Gatekeeper, error) {
+	policy, err := gc.Policy()
+	if err != nil {
+		return nil, err
+	}
+	opts := []ipintelserver.GatekeeperOption{
+		ipintelserver.WithPolicy(policy),
+		ipintelserver.WithConnErrorHandler(func(ip netip.Addr, err error) {
+			log.Printf("%s: %s: %v", gc.Listen, ip, err)
+		}),
+		ipintelserver.WithDropHandler(func(ip netip.Addr, res ipintel.Result) {
+			log.Printf("%s: dropped %s", gc.Listen, res)
+		}),
+	}
+	if gc.FailClosed {
+		opts = append(opts, ipintelserver.WithFailClosed())
+	}
+	if gc.CheckTimeout != 0 {
+		opts = append(opts, ipintelserver.WithCheckTimeout(time.Duration(gc.CheckTimeout)))
+	}
+	if len(gc.ProxyProtocol) > 0 {
+		trusted, err := ipintelconfig.ParsePrefixes(gc.ProxyProtocol)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, ipintelserver.WithProxyProtocol(trusted...))
+	}
+	if gc.BackendProxyProtocol != 0 {
+		opts = append(opts, ipintelserver.WithBackendProxyProtocol(gc.BackendProxyProtocol))
+	}
+	return ipintelserver.NewGatekeeper(c, gc.Backend, opts...), nil
+}
+
+// reloadConfig applies the configuration file at path to setup and to
+// the policies of the gatekeepers, which were configured by cfg and are
+// matched by their listen address. Added gatekeepers only start with
+// the next run.
+func reloadConfig(ctx context.Context, path string, setup *ipintelconfig.Setup, cfg *ipintelconfig.Config, gatekeepers []*ipintelserver.Gatekeeper) error {
+	newCfg, err := ipintelconfig.LoadConfig(path)
+	if err != nil {
+		return err
+	}
+	policies := make(map[string]ipintel.Policy)
+	if newCfg.Server != nil {
+		for _, gc := range newCfg.Server.Gatekeepers {
+			if policies[gc.Listen], err = gc.Policy(); err != nil {
+				return err
+			}
+		}
+	}
+	err = setup.Reload(ctx, newCfg)
+	for i, gk := range gatekeepers {
+		if p, ok := policies[cfg.Server.Gatekeepers[i].Listen]; ok {
+			gk.SetPolicy(p)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("reloaded %s", path)
+	return nil
+}
+
+// serverJob builds the job configured by jc. Its config was validated
+// by LoadConfig.
+func serverJob(setup *ipintelconfig.Setup, jc ipintelconfig.JobConfig) (ipintelserver.Job, error) {
+	sched, err := ipintelserver.ParseSchedule(jc.Schedule)
+	if err != nil {
+		return ipintelserver.Job{}, err
+	}
+	maxAge := time.Duration(jc.MaxAge)
+	if maxAge == 0 {
+		maxAge = 24 * time.Hour
+	}
+	j := ipintelserver.Job{Name: jc.Name, Schedule: sched}
+	switch jc.Type {
+	case "lists":
+		if setup.Lists == nil {
+			return j, fmt.Errorf("job %s: no lists configured", jc.Name)
+		}
+		j.Run = ipintelserver.RefreshLists(setup.Lists, nil, setup.ListSources...)
+	case "recheck":
+		budget := jc.Budget
+		if budget == 0 {
+			budget = 10
+		}
+		j.Run = ipintelserver.Recheck(&ipintel.Scheduler{
+			Checker: setup.Provider,
+			Source:  setup.Store,
+			MaxAge:  maxAge,
+			Budget:  budget,
+		})
+	case "report":
+		threshold := jc.Threshold
+		if threshold == 0 {
+			threshold = 0.99
+		}
+		j.Run = ipintelserver.WriteReport(setup.Store, jc.Path, maxAge, ipintel.ReportOptions{Threshold: threshold})
+	case "logscan":
+		format := jc.Format
+		if format == "" {
+			format = "access"
+		}
+		parse, err := logParser(format)
+		if err != nil {
+			return j, fmt.Errorf("job %s: %w", jc.Name, err)
+		}
+		j.Run = ipintelserver.ScanLog(setup.Provider, jc.Path, parse)
+	default:
+		return j, fmt.Errorf("job %s: unknown type %q", jc.Name, jc.Type)
+	}
+	return j, nil
+}
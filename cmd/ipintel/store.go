@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+	"github.com/pierelucas/go-ipintel/ipintelstore"
+)
+
+// openStore opens the database of the -db flag, encrypted with the key
+// in $IPINTEL_ENCRYPTION_KEY if set (see ipintelstore.WithCipher).
+func openStore(path string) (*ipintelstore.Store, error) {
+	v := os.Getenv("IPINTEL_ENCRYPTION_KEY")
+	if v == "" {
+		return ipintelstore.Open(path)
+	}
+	key, err := ipintel.ParseCipherKey(v)
+	if err != nil {
+		return nil, fmt.Errorf("$IPINTEL_ENCRYPTION_KEY: %w", err)
+	}
+	ci, err := ipintel.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("$IPINTEL_ENCRYPTION_KEY: %w", err)
+	}
+	return ipintelstore.Open(path, ipintelstore.WithCipher(ci))
+}
@@ -0,0 +1,188 @@
+package ipintel
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Codec encodes Results for caches storing them as bytes, such as those
+// of ipintelredis and ipintelmemcache. Only the fields worth caching are
+// kept: the IP, score, check type, provider, query time, Type and Extra.
+// Other formats, e.g. msgpack or protobuf, can be plugged in by
+// implementing Codec.
+type Codec interface {
+	Marshal(res Result) ([]byte, error)
+	Unmarshal(data []byte) (Result, error)
+}
+
+var (
+	_ Codec = JSONCodec{}
+	_ Codec = BinaryCodec{}
+)
+
+// JSONCodec encodes Results as JSON objects, the default of the caches.
+type JSONCodec struct{}
+
+// cacheEntryJSON is the JSON representation of a cached Result.
+type cacheEntryJSON struct {
+	IP        string                     `json:"ip"`
+	Score     float32                    `json:"score"`
+	Check     CheckType                  `json:"check"`
+	Provider  string                     `json:"provider"`
+	QueriedAt time.Time                  `json:"queried_at"`
+	Type      ProxyType                  `json:"type,omitempty"`
+	Extra     map[string]json.RawMessage `json:"extra,omitempty"`
+}
+
+// Marshal implements Codec.
+func (JSONCodec) Marshal(res Result) ([]byte, error) {
+	return json.Marshal(cacheEntryJSON{
+		IP:        res.IP,
+		Score:     res.Score,
+		Check:     res.Check,
+		Provider:  res.Provider,
+		QueriedAt: res.QueriedAt,
+		Type:      res.Type,
+		Extra:     res.Extra,
+	})
+}
+
+// Unmarshal implements Codec.
+func (JSONCodec) Unmarshal(data []byte) (Result, error) {
+	var e cacheEntryJSON
+	if err := json.Unmarshal(data, &e); err != nil {
+		return Result{}, err
+	}
+	return Result{
+		IP:        e.IP,
+		Score:     e.Score,
+		Check:     e.Check,
+		Provider:  e.Provider,
+		QueriedAt: e.QueriedAt,
+		Type:      e.Type,
+		Extra:     e.Extra,
+	}, nil
+}
+
+// binaryVersion is the first byte of BinaryCodec encodings.
+const binaryVersion = 1
+
+// BinaryCodec encodes Results in a compact binary format, less than
+// half the size of JSONCodec's and faster to encode and decode. Extra
+// fields are kept as JSON.
+type BinaryCodec struct{}
+
+// Marshal implements Codec.
+func (BinaryCodec) Marshal(res Result) ([]byte, error) {
+	b := make([]byte, 0, 64)
+	b = append(b, binaryVersion)
+	b = appendString(b, res.IP)
+	b = binary.LittleEndian.AppendUint32(b, math.Float32bits(res.Score))
+	b = appendString(b, string(res.Check))
+	b = appendString(b, res.Provider)
+	var queriedAt int64
+	if !res.QueriedAt.IsZero() {
+		queriedAt = res.QueriedAt.UnixNano()
+	}
+	b = binary.AppendVarint(b, queriedAt)
+	b = appendString(b, string(res.Type))
+	b = binary.AppendUvarint(b, uint64(len(res.Extra)))
+	for k, v := range res.Extra {
+		b = appendString(b, k)
+		b = appendString(b, string(v))
+	}
+	return b, nil
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// Unmarshal implements Codec.
+func (BinaryCodec) Unmarshal(data []byte) (Result, error) {
+	if len(data) == 0 || data[0] != binaryVersion {
+		return Result{}, fmt.Errorf("Unknown binary encoding")
+	}
+	d := binaryDecoder{data: data[1:]}
+	var res Result
+	res.IP = d.string()
+	res.Score = math.Float32frombits(d.uint32())
+	res.Check = CheckType(d.string())
+	res.Provider = d.string()
+	if t := d.varint(); t != 0 {
+		res.QueriedAt = time.Unix(0, t)
+	}
+	res.Type = ProxyType(d.string())
+	if n := d.uvarint(); n > 0 && n <= uint64(len(d.data)) {
+		res.Extra = make(map[string]json.RawMessage, n)
+		for range n {
+			k := d.string()
+			res.Extra[k] = json.RawMessage(d.string())
+		}
+	} else if n > 0 {
+		d.fail()
+	}
+	if d.err != nil {
+		return Result{}, d.err
+	}
+	return res, nil
+}
+
+// binaryDecoder reads the fields of a BinaryCodec encoding, keeping the
+// first error.
+type binaryDecoder struct {
+	data []byte
+	err  error
+}
+
+func (d *binaryDecoder) fail() {
+	if d.err == nil {
+		d.err = fmt.Errorf("Truncated binary encoding")
+	}
+	d.data = nil
+}
+
+func (d *binaryDecoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *binaryDecoder) varint() int64 {
+	v, n := binary.Varint(d.data)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *binaryDecoder) uint32() uint32 {
+	if len(d.data) < 4 {
+		d.fail()
+		return 0
+	}
+	v := binary.LittleEndian.Uint32(d.data)
+	d.data = d.data[4:]
+	return v
+}
+
+func (d *binaryDecoder) string() string {
+	n := d.uvarint()
+	if n > uint64(len(d.data)) {
+		d.fail()
+		return ""
+	}
+	s := string(d.data[:n])
+	d.data = d.data[n:]
+	return s
+}
@@ -0,0 +1,102 @@
+package ipintel
+
+import (
+	"context"
+	"fmt"
+	"math"
+)
+
+// Assessment is the composite risk of an IP determined by a Scorer.
+type Assessment struct {
+	Result Result `json:"result"`
+	// Risk from 0 (clean) to 100
+	Risk int `json:"risk"`
+	// Signals that contributed to Risk, e.g. "proxy score 0.99 (+69)"
+	Reasons []string `json:"reasons"`
+}
+
+// Scorer blends the signals known about an IP into a single risk from 0
+// to 100: the proxy score, local list hits, the proxy type (including
+// hosting networks, see WithHosting) and past block decisions. Each
+// signal adds its weight, scaled by the proxy score for the score
+// itself, and the sum is capped at 100. An IP on an allow list has a
+// risk of 0.
+//
+// Zero weights get their defaults; a negative weight disables the
+// signal.
+type Scorer struct {
+	Checker Checker
+	// Past lookups, for the history signal; optional. It must store
+	// plain IPs (see WithPseudonymizer) for them to be found.
+	History History
+	// Weight of a proxy score of 1; 70 by default
+	ScoreWeight int
+	// Weight of a deny list hit; 100 by default
+	ListWeight int
+	// Weight of a hosting network (TypeDatacenter); 30 by default
+	HostingWeight int
+	// Weight of a Tor, VPN or residential proxy Type; 30 by default
+	TypeWeight int
+	// Weight of an IP blocked before (DecisionBlock); 20 by default
+	HistoryWeight int
+}
+
+// Assess looks up ip and returns its composite risk.
+func (s *Scorer) Assess(ctx context.Context, ip string) (Assessment, error) {
+	res, err := s.Checker.GetProxyScore(ctx, ip)
+	if err != nil {
+		return Assessment{}, err
+	}
+	a := Assessment{Result: res, Reasons: []string{}}
+	add := func(weight, def int, reason string) {
+		if weight == 0 {
+			weight = def
+		}
+		if weight > 0 {
+			a.Risk += weight
+			a.Reasons = append(a.Reasons, fmt.Sprintf("%s (+%d)", reason, weight))
+		}
+	}
+
+	switch {
+	case res.List == HostingList:
+		// its score is set by the list, not determined
+	case res.List != "" && res.Score == 0:
+		a.Reasons = append(a.Reasons, "on allow list "+res.List)
+		return a, nil
+	case res.List != "":
+		add(s.ListWeight, 100, "on deny list "+res.List)
+	default:
+		weight := s.ScoreWeight
+		if weight == 0 {
+			weight = 70
+		}
+		if points := int(math.Round(float64(res.Score) * float64(weight))); points > 0 {
+			add(points, 0, "proxy score "+formatScore(res.Score))
+		}
+	}
+	switch res.Type {
+	case TypeDatacenter:
+		add(s.HostingWeight, 30, "hosting network")
+	case TypeTor, TypeVPN, TypeResidential:
+		add(s.TypeWeight, 30, "type "+string(res.Type))
+	}
+
+	if s.History != nil && s.HistoryWeight >= 0 {
+		recs, err := s.History.ByIP(ctx, ip)
+		if err != nil {
+			return a, err
+		}
+		var blocks int
+		for _, rec := range recs {
+			if rec.Decision == DecisionBlock {
+				blocks++
+			}
+		}
+		if blocks > 0 {
+			add(s.HistoryWeight, 20, fmt.Sprintf("%d earlier blocks", blocks))
+		}
+	}
+	a.Risk = min(a.Risk, 100)
+	return a, nil
+}
@@ -0,0 +1,40 @@
+package ipintel
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+var (
+	defaultMu     sync.RWMutex
+	defaultClient *Client
+)
+
+// SetDefault sets the Client used by the package-level functions.
+func SetDefault(c *Client) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultClient = c
+}
+
+// Default returns the Client used by the package-level functions,
+// or nil if SetDefault hasn't been called.
+func Default() *Client {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultClient
+}
+
+// GetProxyScore queries the API using the default Client.
+// Example:
+//
+//	ipintel.SetDefault(ipintel.NewClient("your@email.com", true, ipintel.Dynamic, 5*time.Second))
+//	res, err := ipintel.GetProxyScore(ctx, "192.0.2.1")
+func GetProxyScore(ctx context.Context, ip string) (Result, error) {
+	c := Default()
+	if c == nil {
+		return Result{}, fmt.Errorf("No default client, call SetDefault first")
+	}
+	return c.GetProxyScore(ctx, ip)
+}
@@ -0,0 +1,126 @@
+package ipintel
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// DefaultDNSTTL is how long a Resolver caches resolutions if its TTL
+// is zero.
+const DefaultDNSTTL = 5 * time.Minute
+
+// Resolver resolves and caches the addresses of the hosts dialed by a
+// Client, saving a DNS lookup per request. Set it with WithResolver.
+// It is safe for concurrent use.
+type Resolver struct {
+	// How long resolutions are cached; DefaultDNSTTL if zero
+	TTL time.Duration
+	// Lookup resolves host; net.DefaultResolver is used if nil. Return
+	// fixed addresses to bypass DNS altogether.
+	Lookup func(ctx context.Context, host string) ([]netip.Addr, error)
+	// Pin, if set, is called with the resolved addresses of host and
+	// returns those to connect to, e.g. only the expected ones. An
+	// error aborts the dial. Its result is cached.
+	Pin func(host string, addrs []netip.Addr) ([]netip.Addr, error)
+	// Dialer connects to the resolved addresses; a net.Dialer with a 30
+	// second timeout is used if nil.
+	Dialer *net.Dialer
+	// Clock the cached resolutions expire by. If nil, the system clock
+	// is used.
+	Clock Clock
+
+	mu    sync.Mutex
+	cache map[string]resolution
+}
+
+type resolution struct {
+	addrs   []netip.Addr
+	expires time.Time
+}
+
+// WithResolver dials the API through r, caching and optionally pinning
+// the addresses of its host. It configures the Transport of the HTTP
+// client set so far, without modifying a client passed to WithHTTPClient.
+func WithResolver(r *Resolver) Option {
+	return func(c *Client) {
+		c.ownTransport().DialContext = r.DialContext
+	}
+}
+
+// DialContext connects to addr, a "host:port", trying the addresses of
+// host in turn. It can be used as http.Transport.DialContext.
+func (r *Resolver) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	d := r.Dialer
+	if d == nil {
+		d = &net.Dialer{Timeout: 30 * time.Second}
+	}
+	if _, err := netip.ParseAddr(host); err == nil {
+		return d.DialContext(ctx, network, addr)
+	}
+
+	addrs, err := r.resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range addrs {
+		var conn net.Conn
+		if conn, err = d.DialContext(ctx, network, net.JoinHostPort(a.String(), port)); err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// resolve returns the cached addresses of host, looking them up if
+// needed.
+func (r *Resolver) resolve(ctx context.Context, host string) ([]netip.Addr, error) {
+	now := time.Now()
+	if r.Clock != nil {
+		now = r.Clock.Now()
+	}
+	r.mu.Lock()
+	res, ok := r.cache[host]
+	r.mu.Unlock()
+	if ok && now.Before(res.expires) {
+		return res.addrs, nil
+	}
+
+	var addrs []netip.Addr
+	var err error
+	if r.Lookup != nil {
+		addrs, err = r.Lookup(ctx, host)
+	} else {
+		addrs, err = net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if r.Pin != nil {
+		if addrs, err = r.Pin(host, addrs); err != nil {
+			return nil, err
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("No addresses for %s", host)
+	}
+
+	ttl := r.TTL
+	if ttl <= 0 {
+		ttl = DefaultDNSTTL
+	}
+	r.mu.Lock()
+	if r.cache == nil {
+		r.cache = make(map[string]resolution)
+	}
+	r.cache[host] = resolution{addrs: addrs, expires: now.Add(ttl)}
+	r.mu.Unlock()
+	return addrs, nil
+}
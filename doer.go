@@ -0,0 +1,134 @@
+package ipintel
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Doer sends the HTTP requests of API queries. *http.Client implements
+// it.
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// DoerFunc adapts a function to a Doer.
+type DoerFunc func(req *http.Request) (*http.Response, error)
+
+// Do calls f(req).
+func (f DoerFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Middleware wraps the Doer sending API requests, e.g. to log or time
+// them. Unlike a RoundTripper, it sees the request before redirects and
+// the response as returned by the HTTP client.
+type Middleware func(next Doer) Doer
+
+// WithMiddleware adds layers around the HTTP requests of API queries,
+// after those added before, so the first one sees each request first.
+// The Client's own layers wrap them: the retries of WithRetryPolicy
+// outermost, then the limiter and the query counter of Stats, so the
+// added layers see every request sent, retries included. The lists and
+// the cache answer lookups before any request is made and stay in front
+// of the chain. For example, to time requests:
+//
+//	timing := func(next ipintel.Doer) ipintel.Doer {
+//		return ipintel.DoerFunc(func(req *http.Request) (*http.Response, error) {
+//			start := time.Now()
+//			defer func() { observe(time.Since(start)) }()
+//			return next.Do(req)
+//		})
+//	}
+//	c := ipintel.NewClient(email, true, ipintel.Dynamic, 0, ipintel.WithMiddleware(timing))
+//
+// Request URLs contain the contact email; layers logging them should
+// strip it.
+func WithMiddleware(mw ...Middleware) Option {
+	return func(c *Client) {
+		c.middleware = append(c.middleware[:len(c.middleware):len(c.middleware)], mw...)
+	}
+}
+
+// buildDoer sets the Doer of c to its HTTP client wrapped in the added
+// middleware and its own layers, outermost first: retrying, limited and
+// counted. It is called once the options are applied.
+func (c *Client) buildDoer() {
+	var d Doer = c.httpClient
+	for i := len(c.middleware) - 1; i >= 0; i-- {
+		d = c.middleware[i](d)
+	}
+	d = c.counted(d)
+	d = c.limited(d)
+	if c.retry != nil {
+		d = c.retrying(d)
+	}
+	c.do = d
+}
+
+// queryState carries a query through the Doer chain in the context of
+// its request.
+type queryState struct {
+	maxWait time.Duration
+	// set by the layers
+	attempts int
+	sentAt   time.Time
+	// why the layers failed the request without sending it
+	rejected error
+}
+
+type queryStateKey struct{}
+
+// withQueryState returns ctx carrying st.
+func withQueryState(ctx context.Context, st *queryState) context.Context {
+	return context.WithValue(ctx, queryStateKey{}, st)
+}
+
+// stateOf returns the queryState of req, or a blank one if it has none.
+func stateOf(req *http.Request) *queryState {
+	if st, ok := req.Context().Value(queryStateKey{}).(*queryState); ok {
+		return st
+	}
+	return new(queryState)
+}
+
+// limited waits for the limiter of c before each request, then passes
+// it to the QueryGate of its context, if any. If the limiter doesn't
+// grant the query in time, the request fails with the context's error
+// or a *ThrottleError.
+func (c *Client) limited(next Doer) Doer {
+	return DoerFunc(func(req *http.Request) (*http.Response, error) {
+		st := stateOf(req)
+		ctx := req.Context()
+		var ok bool
+		if cl, isCtx := c.limiter.(ContextLimiter); isCtx {
+			ok = cl.WaitMaxDurationContext(ctx, 1, st.maxWait)
+		} else {
+			ok = c.limiter.WaitMaxDuration(1, st.maxWait)
+		}
+		if !ok {
+			if ctx.Err() != nil {
+				st.rejected = ctx.Err()
+			} else {
+				st.rejected = newThrottleError(c.limiter, st.maxWait)
+			}
+			return nil, st.rejected
+		}
+		if gate := queryGate(ctx); gate != nil {
+			if err := gate(ctx); err != nil {
+				st.rejected = err
+				return nil, err
+			}
+		}
+		return next.Do(req)
+	})
+}
+
+// counted counts the requests sent in the Stats of c.
+func (c *Client) counted(next Doer) Doer {
+	return DoerFunc(func(req *http.Request) (*http.Response, error) {
+		c.stats.queries.Add(1)
+		stateOf(req).sentAt = c.now()
+		return next.Do(req)
+	})
+}
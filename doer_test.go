@@ -0,0 +1,52 @@
+package ipintel
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareSeesRetries(t *testing.T) {
+	var served atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if served.Add(1)%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, `{"status":"success","result":"0.5","queryIP":%q}`, r.URL.Query().Get("ip"))
+	}))
+	defer srv.Close()
+
+	var built, seen atomic.Int32
+	mw := func(next Doer) Doer {
+		built.Add(1)
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			seen.Add(1)
+			return next.Do(req)
+		})
+	}
+	c := NewClient("test@example.com", false, Dynamic, 0, WithBaseURL(srv.URL), WithLimiter(unlimited{}),
+		WithMiddleware(mw), WithRetryPolicy(Backoff{Min: time.Millisecond}))
+	for i := range 3 {
+		res, err := c.GetProxyScore(context.Background(), fmt.Sprintf("192.0.2.%d", i+1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Attempts != 2 {
+			t.Errorf("Attempts = %d, want 2", res.Attempts)
+		}
+	}
+	if n := built.Load(); n != 1 {
+		t.Errorf("middleware built %d times, want 1", n)
+	}
+	if n := seen.Load(); n != 6 {
+		t.Errorf("middleware saw %d requests, want 6", n)
+	}
+	if n := c.Stats().Queries; n != 6 {
+		t.Errorf("Stats().Queries = %d, want 6", n)
+	}
+}
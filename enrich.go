@@ -0,0 +1,229 @@
+package ipintel
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// Extra keys set by the enrichers of this package.
+const (
+	// ASN announcing the IP, a number (see EnrichASN)
+	ExtraASN = "asn"
+	// Name of the AS, e.g. "AMAZON-02"
+	ExtraOrg = "org"
+	// ISO 3166 code of the country, the key the API uses as well (see
+	// WithCountry and EnrichCountry)
+	ExtraCountry = "Country"
+	// Hostname of the IP's PTR record (see EnrichReverseDNS)
+	ExtraHostname = "hostname"
+)
+
+// DefaultReverseDNSTimeout limits the PTR lookups of EnrichReverseDNS
+// unless it is given another timeout.
+const DefaultReverseDNSTimeout = time.Second
+
+// Enricher adds data to the Result of an API query, usually to its
+// Extra fields with SetExtra, e.g. from a local database.
+type Enricher func(ctx context.Context, res *Result) error
+
+// WithEnrichment runs enrichers, in order, on the Result of each API
+// query before it is recorded (see WithStore) and cached, so the added
+// data reaches reports, sinks and later lookups. Failing enrichers
+// don't fail the lookup; their errors are passed to onError if not nil.
+// Results answered by lists aren't enriched.
+func WithEnrichment(onError func(error), enrichers ...Enricher) Option {
+	return func(c *Client) {
+		c.enrichers = append(c.enrichers[:len(c.enrichers):len(c.enrichers)], enrichers...)
+		c.onEnrichError = onError
+	}
+}
+
+// enrich runs the enrichers of c on res.
+func (c *Client) enrich(ctx context.Context, res *Result) {
+	var errs []error
+	for _, e := range c.enrichers {
+		if err := e(ctx, res); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 && c.onEnrichError != nil {
+		c.onEnrichError(fmt.Errorf("Failed to enrich %s: %w", res.IP, errors.Join(errs...)))
+	}
+}
+
+// SetExtra sets the Extra field key to the JSON encoding of v. Extra is
+// copied first, as it may be shared with cached Results.
+func (r *Result) SetExtra(key string, v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	extra := maps.Clone(r.Extra)
+	if extra == nil {
+		extra = make(map[string]json.RawMessage)
+	}
+	extra[key] = raw
+	r.Extra = extra
+	return nil
+}
+
+// ASN returns the ASN of the IP as set by EnrichASN, or 0.
+func (r Result) ASN() uint32 {
+	var asn uint32
+	if raw, ok := r.Extra[ExtraASN]; ok {
+		json.Unmarshal(raw, &asn)
+	}
+	return asn
+}
+
+// Org returns the name of the AS of the IP as set by EnrichASN, or "".
+func (r Result) Org() string {
+	var org string
+	if raw, ok := r.Extra[ExtraOrg]; ok {
+		json.Unmarshal(raw, &org)
+	}
+	return org
+}
+
+// EnrichASN returns an Enricher setting the ASN and AS name of IPs
+// found in t.
+func EnrichASN(t *ASNTable) Enricher {
+	return func(ctx context.Context, res *Result) error {
+		addr, err := netip.ParseAddr(res.IP)
+		if err != nil {
+			return nil
+		}
+		asn, ok := t.Lookup(addr)
+		if !ok {
+			return nil
+		}
+		if err := res.SetExtra(ExtraASN, asn); err != nil {
+			return err
+		}
+		if org := t.Org(asn); org != "" {
+			return res.SetExtra(ExtraOrg, org)
+		}
+		return nil
+	}
+}
+
+// Hostname returns the hostname of the IP as set by EnrichReverseDNS,
+// or "".
+func (r Result) Hostname() string {
+	var host string
+	if raw, ok := r.Extra[ExtraHostname]; ok {
+		json.Unmarshal(raw, &host)
+	}
+	return host
+}
+
+// EnrichReverseDNS returns an Enricher setting the hostname of IPs with
+// a PTR record, e.g. "203-0-113-7.vultrusercontent.com", which abuse
+// desks often weigh as evidence of hosting or residential addresses.
+// Lookups are made with resolver, net.DefaultResolver if nil, and given
+// up after timeout, DefaultReverseDNSTimeout if zero, so a slow DNS
+// server delays API lookups by at most that long. IPs without a PTR
+// record aren't an error.
+func EnrichReverseDNS(resolver *net.Resolver, timeout time.Duration) Enricher {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	if timeout == 0 {
+		timeout = DefaultReverseDNSTimeout
+	}
+	return func(ctx context.Context, res *Result) error {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		names, err := resolver.LookupAddr(ctx, res.IP)
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(names) == 0 {
+			return nil
+		}
+		return res.SetExtra(ExtraHostname, strings.TrimSuffix(names[0], "."))
+	}
+}
+
+// EnrichCountry returns an Enricher setting the country of IPs the API
+// didn't tell it for, as returned by lookup, e.g. CountryTable.Lookup.
+// Country policies (see AllowCountries), ByCountry and reports then
+// work without asking the API.
+func EnrichCountry(lookup func(netip.Addr) (string, bool)) Enricher {
+	return func(ctx context.Context, res *Result) error {
+		if res.Country() != "" {
+			return nil
+		}
+		addr, err := netip.ParseAddr(res.IP)
+		if err != nil {
+			return nil
+		}
+		if country, ok := lookup(addr); ok {
+			return res.SetExtra(ExtraCountry, country)
+		}
+		return nil
+	}
+}
+
+// CountryTable is a local IP to country database read from CSV files
+// of address ranges, such as dbip-country-lite.csv by db-ip.com. Use
+// its Lookup method with EnrichCountry.
+type CountryTable struct {
+	ranges []ipRange[string]
+}
+
+// ReadCountryTable reads a table of lines "start,end,country" with the
+// ISO 3166 code of the country, e.g. "192.0.2.0,192.0.2.255,DE".
+// Further fields are ignored, as are ranges of the code "ZZ" (unknown).
+func ReadCountryTable(r io.Reader) (*CountryTable, error) {
+	t := &CountryTable{}
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("Line %d: expected start,end,country", n)
+		}
+		for i := range fields[:3] {
+			fields[i] = strings.Trim(fields[i], `" `)
+		}
+		start, err1 := netip.ParseAddr(fields[0])
+		end, err2 := netip.ParseAddr(fields[1])
+		if err1 != nil || err2 != nil || start.Is4() != end.Is4() {
+			return nil, fmt.Errorf("Line %d: invalid range", n)
+		}
+		country := strings.ToUpper(fields[2])
+		if len(country) != 2 {
+			return nil, fmt.Errorf("Line %d: invalid country %q", n, fields[2])
+		}
+		if country != "ZZ" {
+			t.ranges = append(t.ranges, ipRange[string]{start.Unmap(), end.Unmap(), country})
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	sortRanges(t.ranges)
+	return t, nil
+}
+
+// Lookup returns the country of ip.
+func (t *CountryTable) Lookup(ip netip.Addr) (string, bool) {
+	return findRange(t.ranges, ip)
+}
@@ -0,0 +1,74 @@
+package ipintel
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Error codes reported by the API (see APIError.Code).
+const (
+	CodeNoInput      = -1
+	CodeInvalidIP    = -2
+	CodeUnroutableIP = -3
+	CodeDatabase     = -4
+	CodeBanned       = -5
+	CodeNoContact    = -6
+)
+
+// ErrNotSampled is returned for IPs left out by sampling (see
+// WithSampling).
+var ErrNotSampled = errors.New("IP not sampled")
+
+// ErrPseudonymized is passed to Scheduler.OnResult for stale values that
+// aren't IP addresses, such as those recorded with HashIP, which can't
+// be looked up again.
+var ErrPseudonymized = errors.New("Stored value is not an IP address")
+
+// APIError is an error reported by the API, as opposed to a failure
+// reaching it. Use errors.As to tell them apart:
+//
+//	var apiErr *ipintel.APIError
+//	if errors.As(err, &apiErr) && apiErr.Code == ipintel.CodeInvalidIP {
+//		...
+//	}
+type APIError struct {
+	// Error code from the response (one of the Code constants), or 0
+	// if the API only returned an HTTP error status
+	Code int
+	// HTTP status code of the response
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return "API error: " + e.Message
+}
+
+// RateLimited reports whether the API rejected the query for exceeding
+// its rate limits.
+func (e *APIError) RateLimited() bool {
+	return e.StatusCode == http.StatusTooManyRequests
+}
+
+// ThrottleError is returned when the Limiter doesn't allow a query
+// within the maximum wait.
+type ThrottleError struct {
+	// Maximum wait of the query
+	MaxWait time.Duration
+	// Estimated time until a query is allowed, 0 if unknown
+	RetryIn time.Duration
+}
+
+func (e *ThrottleError) Error() string {
+	return fmt.Sprintf("Throttled: Can't make query within the next %s", e.MaxWait)
+}
+
+func newThrottleError(l Limiter, maxWait time.Duration) *ThrottleError {
+	e := &ThrottleError{MaxWait: maxWait}
+	if l, ok := l.(*limiter); ok {
+		e.RetryIn = l.retryIn()
+	}
+	return e
+}
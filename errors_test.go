@@ -0,0 +1,54 @@
+package ipintel_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+	"github.com/pierelucas/go-ipintel/ipinteltest"
+)
+
+func TestAPIError(t *testing.T) {
+	srv := ipinteltest.NewServer()
+	defer srv.Close()
+	srv.SetError("192.0.2.1", ipinteltest.ErrInvalidIP)
+	c := srv.Client(ipintel.Dynamic)
+
+	_, err := c.GetProxyScore(context.Background(), "192.0.2.1")
+	var apiErr *ipintel.APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("err = %v, want an *APIError", err)
+	}
+	if apiErr.Code != ipintel.CodeInvalidIP || apiErr.RateLimited() {
+		t.Errorf("APIError = %+v, want code %d", apiErr, ipintel.CodeInvalidIP)
+	}
+
+	srv.Throttle(1)
+	_, err = c.GetProxyScore(context.Background(), "192.0.2.2")
+	if !errors.As(err, &apiErr) || !apiErr.RateLimited() {
+		t.Errorf("err = %v, want a rate limited *APIError", err)
+	}
+}
+
+// refusing is a Limiter throttling every query.
+type refusing struct{}
+
+func (refusing) WaitMaxDuration(int64, time.Duration) bool { return false }
+
+func TestThrottleError(t *testing.T) {
+	srv := ipinteltest.NewServer()
+	defer srv.Close()
+	c := ipintel.NewClient("test@example.com", false, ipintel.Dynamic, time.Second,
+		ipintel.WithBaseURL(srv.URL+"/check.php"), ipintel.WithLimiter(refusing{}))
+
+	_, err := c.GetProxyScore(context.Background(), "192.0.2.1")
+	var te *ipintel.ThrottleError
+	if !errors.As(err, &te) || te.MaxWait != time.Second {
+		t.Errorf("err = %v, want a *ThrottleError for 1s", err)
+	}
+	if srv.Requests() != 0 {
+		t.Errorf("%d requests despite the limiter", srv.Requests())
+	}
+}
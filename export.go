@@ -0,0 +1,94 @@
+package ipintel
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// ResultWriter writes Results to an output format.
+type ResultWriter interface {
+	// Write writes a single Result.
+	Write(res Result) error
+	// Flush writes any buffered data to the underlying writer.
+	Flush() error
+}
+
+var (
+	_ ResultWriter = (*CSVWriter)(nil)
+	_ ResultWriter = (*JSONLWriter)(nil)
+)
+
+// csvHeader is the fixed column order of CSVWriter.
+var csvHeader = []string{"queried_at", "ip", "check", "score"}
+
+// CSVWriter writes Results as CSV with a header row and the columns
+// queried_at (RFC 3339, UTC), ip, check and score.
+type CSVWriter struct {
+	w           *csv.Writer
+	wroteHeader bool
+}
+
+// NewCSVWriter returns a CSVWriter writing to w.
+func NewCSVWriter(w io.Writer) *CSVWriter {
+	return &CSVWriter{w: csv.NewWriter(w)}
+}
+
+// Write writes res as a CSV record, preceded by the header on first use.
+func (cw *CSVWriter) Write(res Result) error {
+	if !cw.wroteHeader {
+		if err := cw.w.Write(csvHeader); err != nil {
+			return err
+		}
+		cw.wroteHeader = true
+	}
+	return cw.w.Write([]string{
+		formatTime(res.QueriedAt),
+		res.IP,
+		res.Check.String(),
+		formatScore(res.Score),
+	})
+}
+
+// Flush writes any buffered data to the underlying writer.
+func (cw *CSVWriter) Flush() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// JSONLWriter writes Results as JSON Lines, one object per line in
+// the format of Result.MarshalJSON.
+type JSONLWriter struct {
+	w *bufio.Writer
+}
+
+// NewJSONLWriter returns a JSONLWriter writing to w.
+func NewJSONLWriter(w io.Writer) *JSONLWriter {
+	return &JSONLWriter{w: bufio.NewWriter(w)}
+}
+
+// Write writes res as a single line of JSON.
+func (jw *JSONLWriter) Write(res Result) error {
+	line, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	if _, err = jw.w.Write(line); err != nil {
+		return err
+	}
+	return jw.w.WriteByte('\n')
+}
+
+// Flush writes any buffered data to the underlying writer.
+func (jw *JSONLWriter) Flush() error {
+	return jw.w.Flush()
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,73 @@
+package ipintel
+
+import (
+	"context"
+	"fmt"
+)
+
+// History is implemented by Stores that can return past lookups.
+type History interface {
+	Store
+	// ByIP returns all records for ip, oldest first.
+	ByIP(ctx context.Context, ip string) ([]Record, error)
+}
+
+// Change describes an IP crossing the change threshold between its
+// previous and its current lookup.
+type Change struct {
+	Previous Record
+	Current  Record
+	// Proxy is true if the IP turned into a proxy and false if it
+	// turned clean.
+	Proxy bool
+}
+
+// HasChanged reports whether the score of ip differs by at least delta
+// between its two most recent lookups. The Client's Store must
+// implement History.
+func (c *Client) HasChanged(ctx context.Context, ip string, delta float32) (bool, error) {
+	h, ok := c.store.(History)
+	if !ok {
+		return false, fmt.Errorf("Store does not keep history")
+	}
+	recs, err := h.ByIP(ctx, c.storedIP(ip))
+	if err != nil {
+		return false, err
+	}
+	n := len(recs)
+	if n < 2 {
+		return false, nil
+	}
+	diff := recs[n-1].Score - recs[n-2].Score
+	return diff >= delta || -diff >= delta, nil
+}
+
+// record stores res and fires the change hook if the IP crossed the
+// change threshold since its previous lookup.
+func (c *Client) record(ctx context.Context, res Result) error {
+	rec := Record{Result: res}
+	rec.IP = c.storedIP(res.IP)
+
+	var change *Change
+	if h, ok := c.store.(History); ok && c.onChange != nil {
+		prev, err := h.ByIP(ctx, rec.IP)
+		if err != nil {
+			return err
+		}
+		if n := len(prev); n > 0 {
+			last := prev[n-1]
+			was, is := last.Score >= c.changeThreshold, rec.Score >= c.changeThreshold
+			if was != is {
+				change = &Change{Previous: last, Current: rec, Proxy: is}
+			}
+		}
+	}
+
+	if err := c.store.Record(ctx, rec); err != nil {
+		return err
+	}
+	if change != nil {
+		c.onChange(*change)
+	}
+	return nil
+}
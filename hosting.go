@@ -0,0 +1,187 @@
+package ipintel
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//go:embed hosting.txt
+var hostingList string
+
+// HostingList is the name of the list of Results answered by a Hosting
+// set (see WithHosting).
+const HostingList = "hosting"
+
+// Hosting is a set of hosting and datacenter networks, given by their
+// ASN or prefixes. Checked before the API (see WithHosting), it flags
+// obvious hosting IPs without a query, keeping the quota for ambiguous
+// addresses. Matching ASNs requires a local ASN database such as an
+// ASNTable. It is safe for concurrent use; Load replaces the set while
+// in use.
+type Hosting struct {
+	mu       sync.RWMutex
+	asns     map[uint32]bool
+	prefixes *list
+}
+
+// DefaultHosting returns a Hosting set of the major cloud and hosting
+// providers' ASNs, as bundled with this version of the package.
+func DefaultHosting() *Hosting {
+	h := &Hosting{}
+	if err := h.Load(strings.NewReader(hostingList)); err != nil {
+		panic("ipintel: malformed bundled hosting list: " + err.Error())
+	}
+	return h
+}
+
+// Load replaces the set with the ASNs ("AS16509") and networks
+// ("192.0.2.0/24") read from r, one per line. Text after the entry, such
+// as the provider's name, empty lines and comments after '#' are
+// ignored.
+func (h *Hosting) Load(r io.Reader) error {
+	asns := make(map[uint32]bool)
+	var prefixes []netip.Prefix
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		entry := fields[0]
+		if digits, ok := strings.CutPrefix(strings.ToUpper(entry), "AS"); ok {
+			asn, err := strconv.ParseUint(digits, 10, 32)
+			if err != nil {
+				return fmt.Errorf("Line %d: invalid ASN %q", n, entry)
+			}
+			asns[uint32(asn)] = true
+			continue
+		}
+		p, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return fmt.Errorf("Line %d: invalid entry %q", n, entry)
+		}
+		prefixes = append(prefixes, p)
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	nl := &list{action: Deny, prefixes: normalizePrefixes(prefixes)}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.asns, h.prefixes = asns, nl
+	return nil
+}
+
+// Contains reports whether ip is in one of the networks of the set or,
+// if asn is not nil, belongs to one of its ASNs as told by asn.
+func (h *Hosting) Contains(ip netip.Addr, asn func(netip.Addr) (uint32, bool)) bool {
+	ip = ip.Unmap()
+	h.mu.RLock()
+	asns, prefixes := h.asns, h.prefixes
+	h.mu.RUnlock()
+	if prefixes != nil && prefixes.contains(ip) {
+		return true
+	}
+	if asn == nil {
+		return false
+	}
+	n, ok := asn(ip)
+	if !ok {
+		return false
+	}
+	return asns[n]
+}
+
+// ASNTable is a local IP to ASN database read from the TSV files
+// published by iptoasn.com (ip2asn-v4.tsv, ip2asn-v6.tsv or
+// ip2asn-combined.tsv). Use its Lookup method with WithHosting or
+// ByASN, or the table itself with EnrichASN.
+type ASNTable struct {
+	ranges []ipRange[uint32]
+	// names of the ASes, e.g. "AMAZON-02"
+	orgs map[uint32]string
+}
+
+// ipRange is an inclusive range of addresses mapped to val.
+type ipRange[T any] struct {
+	start, end netip.Addr
+	val        T
+}
+
+// sortRanges sorts ranges by start for findRange.
+func sortRanges[T any](ranges []ipRange[T]) {
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].start.Less(ranges[j].start)
+	})
+}
+
+// findRange returns the value of the range containing ip among ranges
+// sorted by start and not overlapping.
+func findRange[T any](ranges []ipRange[T], ip netip.Addr) (val T, ok bool) {
+	ip = ip.Unmap()
+	// index of the first range starting after ip
+	i := sort.Search(len(ranges), func(i int) bool {
+		return ip.Less(ranges[i].start)
+	})
+	if i == 0 {
+		return val, false
+	}
+	r := ranges[i-1]
+	if r.start.Is4() != ip.Is4() || r.end.Less(ip) {
+		return val, false
+	}
+	return r.val, true
+}
+
+// ReadASNTable reads a table of lines "start end asn country name",
+// separated by tabs. Ranges of ASN 0, which iptoasn uses for
+// unannounced space, are left out.
+func ReadASNTable(r io.Reader) (*ASNTable, error) {
+	t := &ASNTable{orgs: make(map[uint32]string)}
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		fields := strings.Split(sc.Text(), "\t")
+		if len(fields) < 3 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		start, err1 := netip.ParseAddr(fields[0])
+		end, err2 := netip.ParseAddr(fields[1])
+		asn, err3 := strconv.ParseUint(fields[2], 10, 32)
+		if err1 != nil || err2 != nil || err3 != nil || start.Is4() != end.Is4() {
+			return nil, fmt.Errorf("Line %d: invalid range", n)
+		}
+		if asn == 0 {
+			continue
+		}
+		t.ranges = append(t.ranges, ipRange[uint32]{start.Unmap(), end.Unmap(), uint32(asn)})
+		if len(fields) >= 5 && fields[4] != "" {
+			t.orgs[uint32(asn)] = fields[4]
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	sortRanges(t.ranges)
+	return t, nil
+}
+
+// Lookup returns the ASN announcing ip.
+func (t *ASNTable) Lookup(ip netip.Addr) (uint32, bool) {
+	return findRange(t.ranges, ip)
+}
+
+// Org returns the name of the AS asn, or "" if unknown.
+func (t *ASNTable) Org(asn uint32) string {
+	return t.orgs[asn]
+}
@@ -0,0 +1,95 @@
+package ipintel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// WithHostLookup sets the function resolving the hostnames passed to
+// CheckHost; net.DefaultResolver is used by default. With nil,
+// resolution is disabled and CheckHost only accepts IP addresses, e.g.
+// where DNS lookups of user-supplied names are not wanted.
+func WithHostLookup(lookup func(ctx context.Context, host string) ([]netip.Addr, error)) Option {
+	return func(c *Client) {
+		c.hostLookup = lookup
+		c.noHostLookup = lookup == nil
+	}
+}
+
+// CheckHost looks up all IPv4 and IPv6 addresses of host and returns
+// their Results, the highest score first, so the first one is the worst.
+// host may also be an IP address, a "host:port" or a URL, e.g. the
+// callback URL of a webhook, whose host is used. If some lookups fail,
+// the Results of the others are returned along with the errors.
+func (c *Client) CheckHost(ctx context.Context, host string) ([]Result, error) {
+	addrs, err := c.resolveHost(ctx, hostOf(host))
+	if err != nil {
+		return nil, err
+	}
+	var results []Result
+	var errs []error
+	for _, addr := range addrs {
+		res, err := c.GetProxyScore(ctx, addr.String())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", addr, err))
+			continue
+		}
+		results = append(results, res)
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	return results, errors.Join(errs...)
+}
+
+// hostOf returns the host of a URL or "host:port", or s itself.
+func hostOf(s string) string {
+	if strings.Contains(s, "://") {
+		if u, err := url.Parse(s); err == nil {
+			return u.Hostname()
+		}
+	}
+	if h, _, err := net.SplitHostPort(s); err == nil {
+		return h
+	}
+	return strings.Trim(s, "[]")
+}
+
+// resolveHost returns the distinct addresses of host.
+func (c *Client) resolveHost(ctx context.Context, host string) ([]netip.Addr, error) {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return []netip.Addr{addr.Unmap()}, nil
+	}
+	if c.noHostLookup {
+		return nil, fmt.Errorf("Invalid IP address %q: host resolution is disabled", host)
+	}
+	var addrs []netip.Addr
+	var err error
+	if c.hostLookup != nil {
+		addrs, err = c.hostLookup(ctx, host)
+	} else {
+		addrs, err = net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	}
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[netip.Addr]bool)
+	distinct := addrs[:0:0]
+	for _, a := range addrs {
+		a = a.Unmap().WithZone("")
+		if !seen[a] {
+			seen[a] = true
+			distinct = append(distinct, a)
+		}
+	}
+	if len(distinct) == 0 {
+		return nil, fmt.Errorf("No addresses for %s", host)
+	}
+	return distinct, nil
+}
@@ -0,0 +1,72 @@
+package ipintel_test
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+	"github.com/pierelucas/go-ipintel/ipinteltest"
+)
+
+func TestCheckHost(t *testing.T) {
+	srv := ipinteltest.NewServer()
+	defer srv.Close()
+	srv.SetScore("192.0.2.1", 0.25)
+	srv.SetScore("2001:db8::1", 1)
+	srv.SetError("192.0.2.3", ipinteltest.ErrUnroutableIP)
+	var looked []string
+	lookup := func(ctx context.Context, host string) ([]netip.Addr, error) {
+		looked = append(looked, host)
+		switch host {
+		case "webhook.example.com":
+			return []netip.Addr{
+				netip.MustParseAddr("192.0.2.1"),
+				netip.MustParseAddr("::ffff:192.0.2.1"),
+				netip.MustParseAddr("2001:db8::1"),
+			}, nil
+		case "partial.example.com":
+			return []netip.Addr{netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("192.0.2.3")}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+	c := srv.Client(ipintel.Dynamic).WithOptions(ipintel.WithHostLookup(lookup))
+	ctx := context.Background()
+
+	for _, host := range []string{"webhook.example.com", "webhook.example.com:443", "https://webhook.example.com/hook?id=1"} {
+		res, err := c.CheckHost(ctx, host)
+		if err != nil {
+			t.Fatalf("%s: %v", host, err)
+		}
+		if len(res) != 2 || res[0].IP != "2001:db8::1" || res[1].IP != "192.0.2.1" {
+			t.Errorf("%s: results %+v, want 2001:db8::1 then 192.0.2.1", host, res)
+		}
+	}
+
+	res, err := c.CheckHost(ctx, "partial.example.com")
+	if err == nil || len(res) != 1 || res[0].IP != "192.0.2.1" {
+		t.Errorf("partial failure: %+v, %v", res, err)
+	}
+
+	looked = nil
+	for _, host := range []string{"192.0.2.1", "[2001:db8::1]:8080", "http://[2001:db8::1]/"} {
+		if res, err := c.CheckHost(ctx, host); err != nil || len(res) != 1 {
+			t.Errorf("%s: %+v, %v", host, res, err)
+		}
+	}
+	if len(looked) != 0 {
+		t.Errorf("resolved IP addresses: %v", looked)
+	}
+
+	if _, err := c.CheckHost(ctx, "unknown.example.com"); err == nil {
+		t.Error("unresolvable host succeeded")
+	}
+	noDNS := c.WithOptions(ipintel.WithHostLookup(nil))
+	if _, err := noDNS.CheckHost(ctx, "webhook.example.com"); err == nil {
+		t.Error("hostname resolved with resolution disabled")
+	}
+	if _, err := noDNS.CheckHost(ctx, "192.0.2.1"); err != nil {
+		t.Errorf("IP address with resolution disabled: %v", err)
+	}
+}
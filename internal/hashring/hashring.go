@@ -0,0 +1,56 @@
+// Package hashring maps keys to nodes by consistent hashing: when a
+// node is added or removed, only the keys of about one node's share
+// move, instead of nearly all of them as with hashing modulo the number
+// of nodes.
+package hashring
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+)
+
+// points is the number of points of each node on the ring.
+const points = 160
+
+// Ring is an immutable set of nodes on the ring.
+type Ring struct {
+	points []point
+}
+
+type point struct {
+	hash uint32
+	node string
+}
+
+// New returns a Ring of nodes, e.g. server addresses. Points derive
+// from the names as given, so they don't move when a hostname resolves
+// differently.
+func New(nodes ...string) *Ring {
+	r := &Ring{}
+	for _, n := range nodes {
+		for p := 0; p < points; p++ {
+			h := crc32.ChecksumIEEE([]byte(n + "-" + strconv.Itoa(p)))
+			r.points = append(r.points, point{h, n})
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool {
+		return r.points[i].hash < r.points[j].hash
+	})
+	return r
+}
+
+// Pick returns the node of key, or "" if the ring is empty.
+func (r *Ring) Pick(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	h := crc32.ChecksumIEEE([]byte(key))
+	i := sort.Search(len(r.points), func(i int) bool {
+		return r.points[i].hash >= h
+	})
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.points[i].node
+}
@@ -0,0 +1,78 @@
+package ipintel
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+)
+
+// Invalidator is implemented by Caches able to delete the Results of
+// single IPs and IP ranges, e.g. to force re-checks after a false
+// positive or after a range changes hands.
+type Invalidator interface {
+	// Invalidate deletes the cached Results of ip for all check types
+	// and returns their number.
+	Invalidate(ctx context.Context, ip string) (int, error)
+	// InvalidateRange deletes the cached Results of all IPs in prefix
+	// and returns their number.
+	InvalidateRange(ctx context.Context, prefix netip.Prefix) (int, error)
+}
+
+var _ Invalidator = (*Client)(nil)
+
+// Invalidate deletes the cached Results of ip, so its next lookup asks
+// the API again. Unlike PurgeIP, recorded lookups are kept. The Cache
+// must implement Invalidator.
+func (c *Client) Invalidate(ctx context.Context, ip string) (int, error) {
+	return c.invalidate(func(inv Invalidator) (int, error) {
+		return inv.Invalidate(ctx, ip)
+	})
+}
+
+// InvalidateRange deletes the cached Results of all IPs in prefix, like
+// Invalidate.
+func (c *Client) InvalidateRange(ctx context.Context, prefix netip.Prefix) (int, error) {
+	return c.invalidate(func(inv Invalidator) (int, error) {
+		return inv.InvalidateRange(ctx, prefix.Masked())
+	})
+}
+
+// FlushCache deletes all cached Results, provided the Cache implements
+// Purger, and returns their number.
+func (c *Client) FlushCache(ctx context.Context) (int, error) {
+	var n int
+	if c.cache != nil {
+		p, ok := c.cache.(Purger)
+		if !ok {
+			return 0, fmt.Errorf("Cache can't be flushed")
+		}
+		var err error
+		if n, err = p.PurgeBefore(ctx, c.now()); err != nil {
+			return n, err
+		}
+	}
+	if c.clean != nil {
+		c.clean.Reset()
+	}
+	return n, nil
+}
+
+func (c *Client) invalidate(fn func(Invalidator) (int, error)) (int, error) {
+	var n int
+	if c.cache != nil {
+		inv, ok := c.cache.(Invalidator)
+		if !ok {
+			return 0, fmt.Errorf("Cache can't invalidate entries")
+		}
+		var err error
+		if n, err = fn(inv); err != nil {
+			return n, err
+		}
+	}
+	// after the cache, so the IPs aren't added back from it; a bloom
+	// filter can't forget single IPs
+	if c.clean != nil {
+		c.clean.Reset()
+	}
+	return n, nil
+}
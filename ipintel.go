@@ -1,27 +1,46 @@
 // Package ipintel is a simple Go wrapper for the getipintel.net
 // proxy detection API
+//
+// The core package only depends on the standard library and
+// golang.org/x/time/rate. Everything else lives in sub-packages that
+// plug in through the interfaces defined here, so programs only pull in
+// the dependencies they use, among them:
+//
+//   - ipintelcache, ipintelredis, ipintelmemcache: Cache implementations
+//   - ipintelstore: a SQLite Store, History and IdentityStore
+//   - ipintelproviders: combining several Providers
+//   - ipintelgroup: sharing scores between peers without a central cache
+//   - ipintelmw: HTTP middleware blocking proxies by Checker
+//   - ipinteltest: fake Providers, Clocks and API servers for tests
+//   - ipintelconfig: building a Client from a config file
+//   - ipintelserver: the scoring daemon and TCP gatekeeper
+//   - cmd/ipintel: the command line tool
 package ipintel
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
+	"hash/maphash"
+	"math"
 	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
-
-	"github.com/juju/ratelimit"
 )
 
 const (
-	version = "0.2.0"
+	version = "0.3.0"
 	urlBase = "check.getipintel.net/check.php"
 )
 
 var (
-	// throttle queries to ~15 req/min with a burst capacity of 15 (imposed by API)
-	rateLimiter = ratelimit.NewBucketWithQuantum(4*time.Second, 15, 1)
+	rateLimiter = NewLimiter(nil)
 
 	httpClient = http.Client{Timeout: 10 * time.Second}
-	userAgent  = "go-ipintel/" + version + " (github.com/janeczku/go-ipintel)"
+	userAgent  = "go-ipintel/" + version + " (github.com/pierelucas/go-ipintel)"
 )
 
 // CheckType represents the type of check used to determine the proxy score.
@@ -36,85 +55,449 @@ const (
 	Dynamic CheckType = "b"
 )
 
+// String returns "static" or "dynamic".
+func (t CheckType) String() string {
+	switch t {
+	case Static:
+		return "static"
+	case Dynamic:
+		return "dynamic"
+	}
+	return string(t)
+}
+
+// ParseCheckType parses "static" or "dynamic" (or the API flags
+// "m" and "b") into a CheckType.
+func ParseCheckType(s string) (CheckType, error) {
+	switch s {
+	case "static", string(Static):
+		return Static, nil
+	case "dynamic", string(Dynamic):
+		return Dynamic, nil
+	}
+	return "", fmt.Errorf("Unknown check type %q", s)
+}
+
 // Client is a struct used to make API queries.
+//
+// A Client is safe for concurrent use by multiple goroutines. Its
+// configuration is fixed when it is created, except for the check type
+// and maximum wait which may be changed at any time using SetCheck and
+// SetMaxWait; queries already in progress are not affected.
 type Client struct {
+	// New fields must be copied in WithOptions.
+
 	// Your email address
-	Email string
+	email string
 	// Scheme used for the API requests ("http" or "https")
-	Scheme string
+	scheme string
+	// Base URL of the API endpoint, overrides scheme when set
+	baseURL string
+	// User-Agent header of API requests
+	userAgent    string
+	limiter      Limiter
+	httpClient   *http.Client
+	store        Store
+	pseudonymize Pseudonymizer
+	lists        *Lists
+	cache        Cache
+	cacheTTL     time.Duration
+	locker       Locker
+	lockWait     time.Duration
+	// Change hook and the score threshold it fires on
+	onChange        func(Change)
+	changeThreshold float32
+	// Cap on the size of API responses
+	maxResponseSize int64
+	stats           *clientStats
+	noRedact        bool
+	// Output flags of the queries (oflags), e.g. "c" for the country
+	oflags string
+	// Hosting networks answered locally and the ASN lookup for them
+	hosting    *Hosting
+	hostingASN func(netip.Addr) (uint32, bool)
+	// Share of IPs queried, if below 1, and the seed selecting them
+	sampleRate float64
+	sampleSeed maphash.Seed
+	// Limit on the duration of a lookup, if positive
+	timeout time.Duration
+	// Background goroutines, a child scope of those of the client this
+	// one was derived from, and those the options of this client start
+	workers *workers
+	starts  []func(context.Context)
+	// Resolution of hostnames passed to CheckHost
+	hostLookup   func(ctx context.Context, host string) ([]netip.Addr, error)
+	noHostLookup bool
+	// Layers around the HTTP requests, outermost first, and the chain
+	// built by buildDoer
+	middleware []Middleware
+	do         Doer
+	// Decides on retrying failed queries; none if nil
+	retry RetryPolicy
+	// Enrichment of the Results of queries and its error handler
+	enrichers     []Enricher
+	onEnrichError func(error)
+	// Transport created for httpClient by ownTransport, if any. Not
+	// copied by WithOptions, so derived clients clone it before changes.
+	transport *http.Transport
+
+	mu sync.RWMutex
 	// Type of proxy check to use (Static/Dynamic)
-	Check CheckType
-	// Maximum time to wait when a query is being throttled.
-	// If set to zero calls to GetProxyScore() will block until
-	// there is enough capacity in the rate limiter bucket.
-	MaxWait time.Duration
+	check CheckType
+	// Maximum time to wait when a query is being throttled
+	maxWait time.Duration
+	// Set of IPs found clean and the score they must be below
+	clean          *CleanFilter
+	cleanThreshold float32
+	// Source of the time of lookups and retry waits; the system clock
+	// if nil
+	clock Clock
+}
+
+// Clock provides the current time and sleeping to time-dependent
+// components, so they can be tested with a fake clock.
+type Clock interface {
+	Now() time.Time
+	// Sleep waits for d, returning ctx.Err() if ctx is done first.
+	Sleep(ctx context.Context, d time.Duration) error
 }
 
 // NewClient creates a new Client using the given parameters.
+// mWait is the maximum time to wait when a query is being throttled.
+// The configuration is not checked; use Validate for that.
 // Example:
-//   c := ipintel.NewClient("your@email.com", false, ipintel.Static, 5*time.Second)
-func NewClient(email string, ssl bool, check CheckType, mWait time.Duration) *Client {
+//
+//	c := ipintel.NewClient("your@email.com", false, ipintel.Static, 5*time.Second)
+func NewClient(email string, ssl bool, check CheckType, mWait time.Duration, opts ...Option) *Client {
 	scheme := "http"
 	if ssl {
 		scheme = "https"
 	}
-	return &Client{
-		Email:   email,
-		Scheme:  scheme,
-		Check:   check,
-		MaxWait: mWait,
+	c := &Client{
+		email:           email,
+		scheme:          scheme,
+		check:           check,
+		maxWait:         mWait,
+		userAgent:       userAgent,
+		limiter:         rateLimiter,
+		httpClient:      &httpClient,
+		maxResponseSize: DefaultMaxResponseSize,
+		stats:           new(clientStats),
+		workers:         newWorkers(nil),
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
+	c.buildDoer()
+	c.start()
+	return c
 }
 
-// GetProxyScore queries the API and returns the proxy score for the given IP address.
-func (c *Client) GetProxyScore(ip string) (score float32, err error) {
-	if ok := rateLimiter.WaitMaxDuration(1, c.MaxWait); !ok {
-		err = fmt.Errorf("Throttled: Can't make query within the next %s", c.MaxWait)
-		return
+// WithOptions returns a new Client configured like c with opts applied
+// on top, e.g. c.WithOptions(ipintel.WithCheck(ipintel.Static)). Unless
+// replaced by opts, the new Client shares c's limiter, HTTP client,
+// cache, store and lists, so both draw from the same query quota.
+func (c *Client) WithOptions(opts ...Option) *Client {
+	d := &Client{
+		email:           c.email,
+		scheme:          c.scheme,
+		baseURL:         c.baseURL,
+		userAgent:       c.userAgent,
+		limiter:         c.limiter,
+		httpClient:      c.httpClient,
+		maxResponseSize: c.maxResponseSize,
+		stats:           c.stats,
+		noRedact:        c.noRedact,
+		oflags:          c.oflags,
+		store:           c.store,
+		pseudonymize:    c.pseudonymize,
+		lists:           c.lists,
+		hosting:         c.hosting,
+		hostingASN:      c.hostingASN,
+		sampleRate:      c.sampleRate,
+		sampleSeed:      c.sampleSeed,
+		timeout:         c.timeout,
+		workers:         newWorkers(c.workers),
+		hostLookup:      c.hostLookup,
+		noHostLookup:    c.noHostLookup,
+		middleware:      c.middleware,
+		retry:           c.retry,
+		enrichers:       c.enrichers,
+		onEnrichError:   c.onEnrichError,
+		clean:           c.clean,
+		cleanThreshold:  c.cleanThreshold,
+		cache:           c.cache,
+		cacheTTL:        c.cacheTTL,
+		locker:          c.locker,
+		lockWait:        c.lockWait,
+		onChange:        c.onChange,
+		changeThreshold: c.changeThreshold,
+		clock:           c.clock,
+		check:           c.Check(),
+		maxWait:         c.MaxWait(),
+	}
+	for _, opt := range opts {
+		opt(d)
 	}
+	d.buildDoer()
+	d.start()
+	return d
+}
 
-	req, err := http.NewRequest("GET", c.getURL(ip), nil)
-	if err != nil {
-		err = fmt.Errorf("Failed preparing request: %v", err)
-		return
+func (c *Client) now() time.Time {
+	if c.clock == nil {
+		return time.Now()
 	}
-	req.Header.Set("User-Agent", userAgent)
+	return c.clock.Now()
+}
 
-	resp, err := httpClient.Do(req)
-	if err != nil {
-		err = fmt.Errorf("Failed to query API: %v", err)
-		return
+// sleep waits for d with the Clock of c, reporting false if ctx is done
+// first.
+func (c *Client) sleep(ctx context.Context, d time.Duration) bool {
+	if c.clock == nil {
+		return sleepContext(ctx, d)
 	}
+	return c.clock.Sleep(ctx, d) == nil
+}
+
+// Email returns the contact email address sent with each query.
+func (c *Client) Email() string {
+	return c.email
+}
+
+// Check returns the type of proxy check used.
+func (c *Client) Check() CheckType {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.check
+}
+
+// SetCheck changes the type of proxy check used for subsequent queries.
+func (c *Client) SetCheck(check CheckType) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.check = check
+}
+
+// MaxWait returns the maximum time a query waits when being throttled.
+func (c *Client) MaxWait() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.maxWait
+}
+
+// SetMaxWait changes the maximum time subsequent queries wait
+// when being throttled.
+func (c *Client) SetMaxWait(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxWait = d
+}
+
+// Checker is the interface implemented by Client. Code depending on it
+// instead of *Client can substitute a fake in unit tests.
+type Checker interface {
+	GetProxyScore(ctx context.Context, ip string) (Result, error)
+}
+
+// Provider is a source of proxy scores. Client is the provider
+// backed by the getipintel.net API.
+type Provider interface {
+	Checker
+	// Name identifies the provider, e.g. in logs.
+	Name() string
+}
+
+var _ Provider = (*Client)(nil)
 
-	if resp.StatusCode == 429 {
-		err = fmt.Errorf("API error: Rate limit exceeded")
+// GetProxyScore queries the API and returns the Result for the given IP address.
+// The context governs the HTTP request and, if the Limiter implements
+// ContextLimiter, the wait for the rate limiter. It may carry a
+// QueryGate (see ContextWithQueryGate).
+// If the Client has a Store and recording the Result fails, the Result is
+// returned together with the error.
+func (c *Client) GetProxyScore(ctx context.Context, ip string) (Result, error) {
+	c.mu.RLock()
+	check, maxWait := c.check, c.maxWait
+	c.mu.RUnlock()
+	return c.lookup(ctx, ip, check, maxWait)
+}
+
+// CheckBoth looks up ip with a static and a dynamic check concurrently,
+// for callers wanting both the binary answer and the probabilistic
+// score. Unless answered by lists or the cache, this takes two queries
+// of the quota. If one lookup fails, the other's Result is returned
+// along with the error.
+func (c *Client) CheckBoth(ctx context.Context, ip string) (static, dynamic Result, err error) {
+	maxWait := c.MaxWait()
+	var staticErr error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		static, staticErr = c.lookup(ctx, ip, Static, maxWait)
+	}()
+	dynamic, err = c.lookup(ctx, ip, Dynamic, maxWait)
+	<-done
+	return static, dynamic, errors.Join(staticErr, err)
+}
+
+// lookup returns the Result of ip for check, answered by the lists, the
+// cache or the API.
+func (c *Client) lookup(ctx context.Context, ip string, check CheckType, maxWait time.Duration) (res Result, err error) {
+	start := c.now()
+	defer func() {
+		res.Latency = c.now().Sub(start)
+		c.stats.count(res, err)
+	}()
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	if c.lists != nil {
+		if addr, perr := netip.ParseAddr(ip); perr == nil {
+			if name, action, ok := c.lists.Lookup(addr); ok {
+				res = Result{IP: ip, Check: check, QueriedAt: c.now(), List: name}
+				if action == Deny {
+					res.Score = 1
+					// lists named after a type, e.g. "tor", tell it
+					if t, err := ParseProxyType(name); err == nil {
+						res.Type = t
+					}
+				}
+				return res, nil
+			}
+		}
+	}
+	if c.hosting != nil {
+		if addr, perr := netip.ParseAddr(ip); perr == nil && c.hosting.Contains(addr, c.hostingASN) {
+			return Result{IP: ip, Score: 1, Check: check, QueriedAt: c.now(), List: HostingList, Type: TypeDatacenter}, nil
+		}
+	}
+
+	key := CacheKey(ip, check)
+	if c.clean != nil {
+		if c.clean.containsAt(key, start) {
+			return Result{IP: ip, Check: check, QueriedAt: start, List: CleanFilterList, FromCache: true}, nil
+		}
+		defer func() {
+			if err == nil && res.Score < c.cleanThreshold {
+				c.clean.addAt(key, c.now())
+			}
+		}()
+	}
+	if c.cache == nil {
+		return c.query(ctx, ip, check, maxWait)
+	}
+	if res, ok := c.cacheGet(ctx, key); ok {
+		return res, nil
+	}
+	if c.locker != nil {
+		return c.lockedQuery(ctx, ip, check, maxWait)
+	}
+	res, err = c.query(ctx, ip, check, maxWait)
+	if err == nil {
+		c.cacheSet(ctx, key, res)
+	}
+	return
+}
+
+// sampled reports whether ip is among the IPs queried when sampling.
+func (c *Client) sampled(ip string) bool {
+	if c.sampleRate == 0 || c.sampleRate >= 1 {
+		return true
+	}
+	h := maphash.String(c.sampleSeed, ip)
+	return float64(h) < c.sampleRate*math.MaxUint64
+}
+
+// query queries the API, bypassing lists and cache, retrying failures
+// as decided by the RetryPolicy.
+func (c *Client) query(ctx context.Context, ip string, check CheckType, maxWait time.Duration) (res Result, err error) {
+	if !c.sampled(ip) {
+		err = ErrNotSampled
+		return
+	}
+	if res, err = c.send(ctx, ip, check, maxWait); err != nil {
 		return
 	}
+	if len(c.enrichers) > 0 {
+		c.enrich(ctx, &res)
+	}
 
-	type response struct {
-		Status string  `json:"status"`
-		ErrMsg string  `json:"message"`
-		Score  float32 `json:"result,string"`
+	if c.store != nil {
+		if err = c.record(ctx, res); err != nil {
+			err = fmt.Errorf("Failed to record result: %w", err)
+		}
 	}
+	return
+}
 
-	decoder := json.NewDecoder(resp.Body)
-	defer resp.Body.Close()
+// send sends the query through the Doer chain of c and parses the
+// response.
+func (c *Client) send(ctx context.Context, ip string, check CheckType, maxWait time.Duration) (res Result, err error) {
+	// errors may quote the request URL or the contact address anywhere
+	defer func() { err = c.redactErr(err) }()
+	st := &queryState{maxWait: maxWait}
+	req, err := http.NewRequestWithContext(withQueryState(ctx, st), "GET", c.getURL(ip, check), nil)
+	if err != nil {
+		err = fmt.Errorf("Failed preparing request: %w", err)
+		return
+	}
+	req.Header.Set("User-Agent", c.userAgent)
 
-	var respObj response
-	if err = decoder.Decode(&respObj); err != nil {
-		err = fmt.Errorf("Failed to parse API response: %v", err)
+	resp, err := c.do.Do(req)
+	if err != nil {
+		if err != st.rejected {
+			err = fmt.Errorf("Failed to query API: %w", err)
+		}
 		return
 	}
+	defer resp.Body.Close()
 
-	if respObj.Status != "success" {
-		err = fmt.Errorf("API error: %s", respObj.ErrMsg)
+	respObj, err := readResponse(resp, c.maxResponseSize)
+	if err != nil {
 		return
 	}
+	if respObj.IP == "" {
+		respObj.IP = ip
+	}
+	res = Result{
+		IP:        respObj.IP,
+		Score:     float32(respObj.Score),
+		Check:     check,
+		Provider:  c.Name(),
+		QueriedAt: st.sentAt,
+		Extra:     respObj.Extra,
+		Attempts:  max(st.attempts, 1),
+	}
+	return
+}
 
-	return respObj.Score, nil
+// Name returns "getipintel".
+func (c *Client) Name() string {
+	return "getipintel"
 }
 
-func (c *Client) getURL(ip string) string {
-	return fmt.Sprintf("%s://%s?ip=%s&contact=%s&flags=%s&format=json",
-		c.Scheme, urlBase, ip, c.Email, c.Check)
+func (c *Client) getURL(ip string, check CheckType) string {
+	base := c.baseURL
+	if base == "" {
+		base = c.scheme + "://" + urlBase
+	}
+	var b strings.Builder
+	b.Grow(len(base) + len(ip) + len(c.email) + 40)
+	b.WriteString(base)
+	b.WriteString("?ip=")
+	b.WriteString(url.QueryEscape(ip))
+	b.WriteString("&contact=")
+	b.WriteString(url.QueryEscape(c.email))
+	b.WriteString("&flags=")
+	b.WriteString(string(check))
+	b.WriteString("&format=json")
+	if c.oflags != "" {
+		b.WriteString("&oflags=")
+		b.WriteString(c.oflags)
+	}
+	return b.String()
 }
@@ -0,0 +1,232 @@
+package ipintel_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+	"github.com/pierelucas/go-ipintel/ipintelcache"
+	"github.com/pierelucas/go-ipintel/ipinteltest"
+)
+
+// The tests below are meant for the race detector: go test -race.
+
+func TestConcurrentSetCheck(t *testing.T) {
+	srv := ipinteltest.NewServer()
+	defer srv.Close()
+	srv.SetDefaultScore(0.5)
+	c := srv.Client(ipintel.Dynamic)
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				res, err := c.GetProxyScore(context.Background(), fmt.Sprintf("192.0.2.%d", i*20+j))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if res.Check != ipintel.Static && res.Check != ipintel.Dynamic {
+					t.Errorf("check type %v", res.Check)
+				}
+			}
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		if i%2 == 0 {
+			c.SetCheck(ipintel.Static)
+		} else {
+			c.SetCheck(ipintel.Dynamic)
+		}
+	}
+	wg.Wait()
+	c.SetCheck(ipintel.Static)
+	if got := c.Check(); got != ipintel.Static {
+		t.Errorf("Check() = %v, want %v", got, ipintel.Static)
+	}
+}
+
+func TestConcurrentSetMaxWait(t *testing.T) {
+	srv := ipinteltest.NewServer()
+	defer srv.Close()
+	c := srv.Client(ipintel.Dynamic)
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if _, err := c.GetProxyScore(context.Background(), fmt.Sprintf("198.51.100.%d", i*20+j)); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		c.SetMaxWait(time.Duration(i) * time.Millisecond)
+		c.MaxWait()
+	}
+	wg.Wait()
+	c.SetMaxWait(time.Second)
+	if got := c.MaxWait(); got != time.Second {
+		t.Errorf("MaxWait() = %v, want 1s", got)
+	}
+}
+
+func TestConcurrentWithOptions(t *testing.T) {
+	srv := ipinteltest.NewServer()
+	defer srv.Close()
+	srv.SetScore("203.0.113.1", 1)
+	c := srv.Client(ipintel.Dynamic)
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d := c.WithOptions(ipintel.WithCheck(ipintel.Static), ipintel.WithTimeout(time.Second))
+			for j := 0; j < 10; j++ {
+				res, err := d.GetProxyScore(context.Background(), "203.0.113.1")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if res.Check != ipintel.Static || res.Score != 1 {
+					t.Errorf("derived client got %v", res)
+				}
+				if _, err := c.GetProxyScore(context.Background(), "203.0.113.1"); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		c.SetCheck(ipintel.Dynamic)
+		c.SetMaxWait(time.Duration(i) * time.Millisecond)
+	}
+	wg.Wait()
+}
+
+func TestWithClock(t *testing.T) {
+	srv := ipinteltest.NewServer()
+	defer srv.Close()
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := ipinteltest.NewClock(start)
+	f := ipintel.NewCleanFilter(0, time.Hour, 0)
+	c := srv.Client(ipintel.Dynamic).WithOptions(ipintel.WithClock(clock), ipintel.WithCleanFilter(f, 0.5))
+	defer c.Close()
+
+	res, err := c.GetProxyScore(context.Background(), "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.QueriedAt.Equal(start) {
+		t.Errorf("QueriedAt = %v, want the time of the clock %v", res.QueriedAt, start)
+	}
+	if res, _ := c.GetProxyScore(context.Background(), "192.0.2.1"); res.List != ipintel.CleanFilterList {
+		t.Errorf("second lookup not answered by the clean filter: %+v", res)
+	}
+	// the filter forgets the IP after its ttl by the clock
+	clock.Advance(2 * time.Hour)
+	if res, _ := c.GetProxyScore(context.Background(), "192.0.2.1"); res.List == ipintel.CleanFilterList {
+		t.Error("clean filter answered after its ttl")
+	}
+	if n := srv.Requests(); n != 2 {
+		t.Errorf("%d queries, want 2", n)
+	}
+}
+
+// heldLocker reports every lock as held by someone else.
+type heldLocker struct{}
+
+func (heldLocker) TryLock(context.Context, string, time.Duration) (func(), bool, error) {
+	return nil, false, nil
+}
+
+func TestLockWaitFollowsClock(t *testing.T) {
+	srv := ipinteltest.NewServer()
+	defer srv.Close()
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := ipinteltest.NewClock(start)
+	c := srv.Client(ipintel.Dynamic).WithOptions(ipintel.WithClock(clock),
+		ipintel.WithCache(ipintelcache.New(10, clock), time.Hour), ipintel.WithLocker(heldLocker{}, time.Hour))
+	defer c.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.GetProxyScore(context.Background(), "192.0.2.1")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiting for the lock holder didn't follow the clock")
+	}
+	if waited := clock.Now().Sub(start); waited < time.Hour {
+		t.Errorf("gave up waiting after %v, want the lock wait of 1h", waited)
+	}
+	if n := srv.Requests(); n != 1 {
+		t.Errorf("%d queries, want 1", n)
+	}
+}
+
+func TestClockSleepHonorsContext(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := ipinteltest.NewClock(start)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := clock.Sleep(ctx, time.Hour); err != context.Canceled {
+		t.Errorf("Sleep() = %v, want %v", err, context.Canceled)
+	}
+	if !clock.Now().Equal(start) {
+		t.Error("Sleep advanced the clock after ctx was done")
+	}
+
+	// a limiter waiting with the clock gives up with ctx
+	lim := ipintel.NewLimiter(clock).(ipintel.ContextLimiter)
+	for i := 0; i < 15; i++ {
+		lim.WaitMaxDurationContext(context.Background(), 1, 0)
+	}
+	if lim.WaitMaxDurationContext(ctx, 1, time.Minute) {
+		t.Error("limiter waited although ctx was done")
+	}
+	if !lim.WaitMaxDurationContext(context.Background(), 1, time.Minute) {
+		t.Error("limiter didn't wait with the clock")
+	}
+}
+
+func TestStatsCountAnswerSources(t *testing.T) {
+	srv := ipinteltest.NewServer()
+	defer srv.Close()
+	h := &ipintel.Hosting{}
+	if err := h.Load(strings.NewReader("198.51.100.0/24\n")); err != nil {
+		t.Fatal(err)
+	}
+	c := srv.Client(ipintel.Dynamic).WithOptions(
+		ipintel.WithCleanFilter(ipintel.NewCleanFilter(0, 0, 0), 0.5),
+		ipintel.WithHosting(h, nil))
+	defer c.Close()
+	ctx := context.Background()
+	c.GetProxyScore(ctx, "192.0.2.1")
+	c.GetProxyScore(ctx, "192.0.2.1")
+	c.GetProxyScore(ctx, "198.51.100.1")
+	st := c.Stats()
+	if st.Queries != 1 || st.CleanFilterHits != 1 || st.HostingHits != 1 || st.ListHits != 0 {
+		t.Errorf("Stats() = %+v, want 1 query, 1 clean filter and 1 hosting hit", st)
+	}
+}
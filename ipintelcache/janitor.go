@@ -0,0 +1,72 @@
+package ipintelcache
+
+import (
+	"context"
+	"time"
+)
+
+// Defaults of RunJanitor.
+const (
+	DefaultSweepInterval = time.Minute
+	DefaultSweepBudget   = 1000
+)
+
+// Sweep drops expired entries, examining at most budget of them spread
+// over the shards, and returns the number dropped. Each shard is locked
+// for its share only, so lookups wait for at most budget/shards entries.
+// Entries are examined in random order (that of map iteration), so
+// repeated sweeps cover the whole cache without tracking a position.
+func (c *Cache) Sweep(budget int) int {
+	now := c.now()
+	per := max(budget/len(c.shards), 1)
+	var dropped, examined int
+	for _, s := range c.shards {
+		s.mu.Lock()
+		n := 0
+		for _, el := range s.items {
+			if n == per {
+				break
+			}
+			n++
+			if !now.Before(el.Value.(*entry).expires) {
+				s.remove(el)
+				s.expired.Add(1)
+				dropped++
+			}
+		}
+		s.mu.Unlock()
+		examined += n
+	}
+	c.sweeps.Add(1)
+	c.examined.Add(uint64(examined))
+	return dropped
+}
+
+// RunJanitor sweeps c every interval with the given budget until ctx is
+// done; zero values take DefaultSweepInterval and DefaultSweepBudget.
+// Expired entries are otherwise only dropped when looked up or evicted,
+// taking up room until then. Sweeps dropping more than a quarter of
+// budget are repeated right away, up to four times, so a burst of
+// expiries is cleared without full scans.
+func (c *Cache) RunJanitor(ctx context.Context, interval time.Duration, budget int) {
+	if interval == 0 {
+		interval = DefaultSweepInterval
+	}
+	if budget == 0 {
+		budget = DefaultSweepBudget
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for i := 0; i < 5; i++ {
+			if c.Sweep(budget) <= budget/4 {
+				break
+			}
+		}
+	}
+}
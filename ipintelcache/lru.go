@@ -0,0 +1,285 @@
+// Package ipintelcache provides an in-memory ipintel.Cache bounded in
+// size, for single-process deployments without Redis. Snapshots saved
+// to a file (see Cache.SaveEvery) let it survive restarts, and Tiered
+// puts it in front of a cache shared between processes.
+//
+// Example:
+//
+//	c := ipintel.NewClient("your@email.com", true, ipintel.Dynamic, 10*time.Second,
+//		ipintel.WithCache(ipintelcache.New(100000, nil), 24*time.Hour))
+package ipintelcache
+
+import (
+	"container/list"
+	"context"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+)
+
+// Cache is an ipintel.Cache keeping at most a fixed number of Results
+// in memory, evicting the least recently used one when full. Expired
+// entries are dropped when they are looked up or evicted. It is safe
+// for concurrent use.
+//
+// Keys are spread over independently locked shards so that concurrent
+// lookups rarely contend. Each shard holds an equal part of the
+// capacity and evicts on its own, so eviction order is LRU per shard
+// rather than across the whole cache.
+type Cache struct {
+	clock  ipintel.Clock
+	shards []*shard
+
+	sweeps, examined atomic.Uint64
+	// Encryption of snapshot files, if set
+	cipher *ipintel.Cipher
+}
+
+var (
+	_ ipintel.Cache       = (*Cache)(nil)
+	_ ipintel.Purger      = (*Cache)(nil)
+	_ ipintel.Invalidator = (*Cache)(nil)
+)
+
+// DefaultShards is the number of shards used by New.
+const DefaultShards = 16
+
+type shard struct {
+	mu         sync.Mutex
+	maxEntries int
+	// most recently used first
+	ll    *list.List
+	items map[string]*list.Element
+
+	// atomics, so Stats doesn't contend with lookups
+	entries                 atomic.Int64
+	hits, misses, evictions atomic.Uint64
+	expired                 atomic.Uint64
+}
+
+type entry struct {
+	key     string
+	res     ipintel.Result
+	expires time.Time
+}
+
+// Stats are the counters of a Cache.
+type Stats struct {
+	// Number of entries currently held, including expired ones not yet
+	// dropped
+	Entries int
+	Hits    uint64
+	Misses  uint64
+	// Number of unexpired entries dropped to make room for new ones
+	Evictions uint64
+	// Number of expired entries dropped, by lookups, Set or Sweep
+	Expired uint64
+	// Number of Sweep calls and the entries they examined
+	Sweeps   uint64
+	Examined uint64
+}
+
+// New returns a Cache holding at most maxEntries Results in
+// DefaultShards shards (fewer if maxEntries is small), using clock for
+// expiry. If clock is nil, the system clock is used.
+func New(maxEntries int, clock ipintel.Clock) *Cache {
+	return NewSharded(maxEntries, DefaultShards, clock)
+}
+
+// NewSharded is like New with the given number of shards. A single
+// shard gives exact LRU eviction at the cost of one lock for all
+// lookups.
+func NewSharded(maxEntries, shards int, clock ipintel.Clock) *Cache {
+	if maxEntries < 1 {
+		maxEntries = 1
+	}
+	if shards < 1 {
+		shards = 1
+	}
+	if shards > maxEntries {
+		shards = maxEntries
+	}
+	c := &Cache{clock: clock, shards: make([]*shard, shards)}
+	for i := range c.shards {
+		// spread the remainder so the capacities add up to maxEntries
+		size := maxEntries / shards
+		if i < maxEntries%shards {
+			size++
+		}
+		c.shards[i] = &shard{
+			maxEntries: size,
+			ll:         list.New(),
+			items:      make(map[string]*list.Element),
+		}
+	}
+	return c
+}
+
+func (c *Cache) now() time.Time {
+	if c.clock == nil {
+		return time.Now()
+	}
+	return c.clock.Now()
+}
+
+// shard returns the shard of key, chosen by its FNV-1a hash.
+func (c *Cache) shard(key string) *shard {
+	if len(c.shards) == 1 {
+		return c.shards[0]
+	}
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return c.shards[h%uint32(len(c.shards))]
+}
+
+// Get returns the Result stored under key.
+func (c *Cache) Get(ctx context.Context, key string) (ipintel.Result, bool, error) {
+	now := c.now()
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.items[key]
+	if !ok {
+		s.misses.Add(1)
+		return ipintel.Result{}, false, nil
+	}
+	e := el.Value.(*entry)
+	if !now.Before(e.expires) {
+		s.remove(el)
+		s.expired.Add(1)
+		s.misses.Add(1)
+		return ipintel.Result{}, false, nil
+	}
+	s.ll.MoveToFront(el)
+	s.hits.Add(1)
+	return e.res, true, nil
+}
+
+// Set stores res under key for ttl, evicting the least recently used
+// entry of its shard if that is full.
+func (c *Cache) Set(ctx context.Context, key string, res ipintel.Result, ttl time.Duration) error {
+	now := c.now()
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.items[key]; ok {
+		e := el.Value.(*entry)
+		e.res, e.expires = res, now.Add(ttl)
+		s.ll.MoveToFront(el)
+		return nil
+	}
+	for s.ll.Len() >= s.maxEntries {
+		oldest := s.ll.Back()
+		if now.Before(oldest.Value.(*entry).expires) {
+			s.evictions.Add(1)
+		} else {
+			s.expired.Add(1)
+		}
+		s.remove(oldest)
+	}
+	s.items[key] = s.ll.PushFront(&entry{key: key, res: res, expires: now.Add(ttl)})
+	s.entries.Add(1)
+	return nil
+}
+
+// PurgeIP deletes the cached Results of ip for all check types.
+func (c *Cache) PurgeIP(ctx context.Context, ip string) (int, error) {
+	var n int
+	for _, check := range []ipintel.CheckType{ipintel.Static, ipintel.Dynamic} {
+		key := ipintel.CacheKey(ip, check)
+		s := c.shard(key)
+		s.mu.Lock()
+		if el, ok := s.items[key]; ok {
+			s.remove(el)
+			n++
+		}
+		s.mu.Unlock()
+	}
+	return n, nil
+}
+
+// PurgeBefore deletes all cached Results queried before t.
+func (c *Cache) PurgeBefore(ctx context.Context, t time.Time) (int, error) {
+	var n int
+	for _, s := range c.shards {
+		s.mu.Lock()
+		for el := s.ll.Front(); el != nil; {
+			next := el.Next()
+			if el.Value.(*entry).res.QueriedAt.Before(t) {
+				s.remove(el)
+				n++
+			}
+			el = next
+		}
+		s.mu.Unlock()
+	}
+	return n, nil
+}
+
+// Invalidate deletes the cached Results of ip, as PurgeIP.
+func (c *Cache) Invalidate(ctx context.Context, ip string) (int, error) {
+	return c.PurgeIP(ctx, ip)
+}
+
+// InvalidateRange deletes the cached Results of all IPs in prefix.
+func (c *Cache) InvalidateRange(ctx context.Context, prefix netip.Prefix) (int, error) {
+	var n int
+	for _, s := range c.shards {
+		s.mu.Lock()
+		for el := s.ll.Front(); el != nil; {
+			next := el.Next()
+			if inRange(prefix, el.Value.(*entry).res.IP) {
+				s.remove(el)
+				n++
+			}
+			el = next
+		}
+		s.mu.Unlock()
+	}
+	return n, nil
+}
+
+// inRange reports whether ip is in prefix.
+func inRange(prefix netip.Prefix, ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	return err == nil && prefix.Contains(addr.Unmap())
+}
+
+// Len returns the number of entries held, including expired ones not
+// yet dropped.
+func (c *Cache) Len() int {
+	var n int64
+	for _, s := range c.shards {
+		n += s.entries.Load()
+	}
+	return int(n)
+}
+
+// Stats returns the current counters, summed over all shards. It takes
+// no locks, so the counters of different shards may be read at slightly
+// different times.
+func (c *Cache) Stats() Stats {
+	var total Stats
+	for _, s := range c.shards {
+		total.Entries += int(s.entries.Load())
+		total.Hits += s.hits.Load()
+		total.Misses += s.misses.Load()
+		total.Evictions += s.evictions.Load()
+		total.Expired += s.expired.Load()
+	}
+	total.Sweeps = c.sweeps.Load()
+	total.Examined = c.examined.Load()
+	return total
+}
+
+func (s *shard) remove(el *list.Element) {
+	s.ll.Remove(el)
+	delete(s.items, el.Value.(*entry).key)
+	s.entries.Add(-1)
+}
@@ -0,0 +1,105 @@
+package ipintelcache
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+	"github.com/pierelucas/go-ipintel/ipinteltest"
+)
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	c := NewSharded(2, 1, nil)
+	c.Set(ctx, "a", ipintel.Result{Score: 0.1}, time.Hour)
+	c.Set(ctx, "b", ipintel.Result{Score: 0.2}, time.Hour)
+	if _, ok, _ := c.Get(ctx, "a"); !ok {
+		t.Fatal("a missing")
+	}
+	c.Set(ctx, "c", ipintel.Result{Score: 0.3}, time.Hour)
+
+	if _, ok, _ := c.Get(ctx, "b"); ok {
+		t.Error("least recently used entry kept")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok, _ := c.Get(ctx, key); !ok {
+			t.Errorf("%s evicted", key)
+		}
+	}
+	if s := c.Stats(); s.Entries != 2 || s.Hits != 3 || s.Misses != 1 || s.Evictions != 1 {
+		t.Errorf("Stats() = %+v, want 2 entries, 3 hits, 1 miss and 1 eviction", s)
+	}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	ctx := context.Background()
+	clock := ipinteltest.NewClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	c := New(10, clock)
+	c.Set(ctx, "a", ipintel.Result{Score: 0.5}, time.Minute)
+
+	clock.Advance(59 * time.Second)
+	if res, ok, _ := c.Get(ctx, "a"); !ok || res.Score != 0.5 {
+		t.Errorf("Get before expiry = %v, %v", res, ok)
+	}
+	clock.Advance(time.Second)
+	if _, ok, _ := c.Get(ctx, "a"); ok {
+		t.Error("expired entry returned")
+	}
+	if n := c.Len(); n != 0 {
+		t.Errorf("Len() = %d after expiry, want 0", n)
+	}
+}
+
+func TestCachePurge(t *testing.T) {
+	ctx := context.Background()
+	c := NewSharded(10, 1, nil)
+	old := time.Now().Add(-time.Hour)
+	c.Set(ctx, ipintel.CacheKey("192.0.2.1", ipintel.Static), ipintel.Result{QueriedAt: old}, time.Hour)
+	c.Set(ctx, ipintel.CacheKey("192.0.2.1", ipintel.Dynamic), ipintel.Result{QueriedAt: time.Now()}, time.Hour)
+	c.Set(ctx, ipintel.CacheKey("192.0.2.2", ipintel.Dynamic), ipintel.Result{QueriedAt: old}, time.Hour)
+
+	if n, err := c.PurgeIP(ctx, "192.0.2.1"); n != 2 || err != nil {
+		t.Errorf("PurgeIP = %d, %v, want 2", n, err)
+	}
+	if n, err := c.PurgeBefore(ctx, time.Now().Add(-time.Minute)); n != 1 || err != nil {
+		t.Errorf("PurgeBefore = %d, %v, want 1", n, err)
+	}
+	if n := c.Len(); n != 0 {
+		t.Errorf("Len() = %d, want 0", n)
+	}
+}
+
+// BenchmarkCacheParallel compares the sharded cache with a single lock
+// under concurrent lookups, nine Gets to one Set.
+func BenchmarkCacheParallel(b *testing.B) {
+	const entries = 10000
+	keys := make([]string, entries)
+	for i := range keys {
+		keys[i] = ipintel.CacheKey(fmt.Sprintf("10.%d.%d.%d", i>>16&255, i>>8&255, i&255), ipintel.Dynamic)
+	}
+	for _, shards := range []int{1, DefaultShards} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			c := NewSharded(entries, shards, nil)
+			ctx := context.Background()
+			for _, k := range keys {
+				c.Set(ctx, k, ipintel.Result{Score: 0.5}, time.Hour)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				r := rand.New(rand.NewPCG(rand.Uint64(), 0))
+				for i := 0; pb.Next(); i++ {
+					k := keys[r.IntN(entries)]
+					if i%10 == 0 {
+						c.Set(ctx, k, ipintel.Result{Score: 0.5}, time.Hour)
+					} else {
+						c.Get(ctx, k)
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package ipintelcache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+)
+
+var _ ipintel.Walker = (*Cache)(nil)
+
+// Walk calls fn with the unexpired entries of c, the least recently used
+// of each shard first.
+func (c *Cache) Walk(ctx context.Context, fn func(ipintel.CacheEntry) error) error {
+	now := c.now()
+	for _, s := range c.shards {
+		// copy the entries, so fn doesn't run under the lock
+		s.mu.Lock()
+		entries := make([]ipintel.CacheEntry, 0, s.ll.Len())
+		for el := s.ll.Back(); el != nil; el = el.Prev() {
+			if e := el.Value.(*entry); now.Before(e.expires) {
+				entries = append(entries, ipintel.CacheEntry{Key: e.key, Result: e.res, Expires: e.expires})
+			}
+		}
+		s.mu.Unlock()
+		for _, e := range entries {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WriteSnapshot writes the unexpired entries of c to w in the format of
+// ipintel.ExportCache, the least recently used first, so reading them
+// back restores the order.
+func (c *Cache) WriteSnapshot(w io.Writer) error {
+	_, err := ipintel.ExportCache(context.Background(), w, c)
+	return err
+}
+
+// ReadSnapshot adds the unexpired entries written by WriteSnapshot or
+// ipintel.ExportCache to c, keeping their expiry.
+func (c *Cache) ReadSnapshot(r io.Reader) error {
+	now := c.now()
+	dec := json.NewDecoder(r)
+	for {
+		var e ipintel.CacheEntry
+		if err := dec.Decode(&e); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("Failed to parse snapshot: %w", err)
+		}
+		if ttl := e.Expires.Sub(now); ttl > 0 {
+			c.Set(context.Background(), e.Key, e.Result, ttl)
+		}
+	}
+}
+
+// EncryptSnapshots makes SaveFile encrypt snapshots with ci and
+// LoadFile decrypt them, so the IPs they hold aren't readable on disk.
+// It must be called before the cache is used.
+func (c *Cache) EncryptSnapshots(ci *ipintel.Cipher) {
+	c.cipher = ci
+}
+
+// SaveFile writes a snapshot of c to path, replacing the file
+// atomically, so a crash never leaves a partial snapshot behind. The
+// file and its directory are synced before SaveFile returns.
+func (c *Cache) SaveFile(path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("Failed to save cache: %w", err)
+	}
+	err = c.writeFile(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return fmt.Errorf("Failed to save cache: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("Failed to save cache: %w", err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("Failed to save cache: %w", err)
+	}
+	// make the rename itself durable
+	if err := syncDir(filepath.Dir(path)); err != nil {
+		return fmt.Errorf("Failed to save cache: %w", err)
+	}
+	return nil
+}
+
+// syncDir flushes the entries of the directory dir to disk.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// writeFile writes a snapshot to f, encrypted if c has a Cipher.
+func (c *Cache) writeFile(f *os.File) error {
+	if c.cipher == nil {
+		return c.WriteSnapshot(f)
+	}
+	var buf bytes.Buffer
+	if err := c.WriteSnapshot(&buf); err != nil {
+		return err
+	}
+	_, err := f.Write(c.cipher.Seal(buf.Bytes()))
+	return err
+}
+
+// LoadFile reads a snapshot saved by SaveFile into c. A missing file is
+// not an error, so it can be called on the first start.
+func (c *Cache) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if c.cipher != nil {
+		if data, err = c.cipher.Open(data); err != nil {
+			return fmt.Errorf("Failed to load cache: %w", err)
+		}
+	}
+	return c.ReadSnapshot(bytes.NewReader(data))
+}
+
+// SaveEvery saves a snapshot of c to path every interval until ctx is
+// done, and a last one then, passing failures to onError if not nil.
+// With LoadFile on startup, the cache survives restarts:
+//
+//	cache := ipintelcache.New(100000, nil)
+//	if err := cache.LoadFile(path); err != nil {
+//		...
+//	}
+//	go cache.SaveEvery(ctx, path, time.Minute, nil)
+func (c *Cache) SaveEvery(ctx context.Context, path string, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := c.SaveFile(path); err != nil && onError != nil {
+				onError(err)
+			}
+			return
+		case <-ticker.C:
+			if err := c.SaveFile(path); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
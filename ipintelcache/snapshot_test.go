@@ -0,0 +1,38 @@
+package ipintelcache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+)
+
+func TestSaveFileLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cache.snap")
+	ctx := context.Background()
+	c := New(10, nil)
+	key := ipintel.CacheKey("192.0.2.1", ipintel.Dynamic)
+	c.Set(ctx, key, ipintel.Result{IP: "192.0.2.1", Score: 0.5}, time.Hour)
+	if err := c.SaveFile(path); err != nil {
+		t.Fatal(err)
+	}
+	// a second save replaces the file
+	if err := c.SaveFile(path); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := os.ReadDir(dir)
+	if len(files) != 1 {
+		t.Errorf("%d files in %s, want only the snapshot", len(files), dir)
+	}
+	loaded := New(10, nil)
+	if err := loaded.LoadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if res, ok, _ := loaded.Get(ctx, key); !ok || res.Score != 0.5 {
+		t.Errorf("Get() = %v, %v after LoadFile", res, ok)
+	}
+}
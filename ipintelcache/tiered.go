@@ -0,0 +1,143 @@
+package ipintelcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"time"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+)
+
+// Tiered is an ipintel.Cache layering a local cache, usually a small
+// Cache, in front of a cache shared by several processes, such as an
+// ipintelredis.Cache, so hot IPs are answered without a network hop
+// while all processes still share their Results. Writes go to both.
+//
+// Results stay in the local cache for at most its own TTL, even if
+// changed or purged in the shared one meanwhile, so that TTL bounds how
+// stale answers of a process can be.
+//
+// Example:
+//
+//	shared := ipintelredis.NewCache(rdb, "")
+//	c := ipintel.NewClient("your@email.com", true, ipintel.Dynamic, 10*time.Second,
+//		ipintel.WithCache(ipintelcache.NewTiered(ipintelcache.New(10000, nil), time.Minute, shared), 24*time.Hour))
+type Tiered struct {
+	local, shared ipintel.Cache
+	localTTL      time.Duration
+}
+
+var (
+	_ ipintel.Cache       = (*Tiered)(nil)
+	_ ipintel.Purger      = (*Tiered)(nil)
+	_ ipintel.Walker      = (*Tiered)(nil)
+	_ ipintel.Invalidator = (*Tiered)(nil)
+)
+
+// NewTiered returns a Tiered cache keeping Results in local for up to
+// localTTL and in shared for the TTL they are set with.
+func NewTiered(local ipintel.Cache, localTTL time.Duration, shared ipintel.Cache) *Tiered {
+	return &Tiered{local: local, shared: shared, localTTL: localTTL}
+}
+
+// Get returns the Result stored under key in the local cache or, copying
+// it to the local cache, in the shared one. Errors of the local cache
+// are treated as misses.
+func (t *Tiered) Get(ctx context.Context, key string) (ipintel.Result, bool, error) {
+	if res, ok, err := t.local.Get(ctx, key); err == nil && ok {
+		return res, true, nil
+	}
+	res, ok, err := t.shared.Get(ctx, key)
+	if err != nil || !ok {
+		return ipintel.Result{}, false, err
+	}
+	t.local.Set(ctx, key, res, t.localTTL)
+	return res, true, nil
+}
+
+// Set stores res under key in both caches, for ttl in the shared one
+// and at most the local TTL in the local one.
+func (t *Tiered) Set(ctx context.Context, key string, res ipintel.Result, ttl time.Duration) error {
+	t.local.Set(ctx, key, res, min(ttl, t.localTTL))
+	return t.shared.Set(ctx, key, res, ttl)
+}
+
+// PurgeIP deletes the cached Results of ip from both caches, provided
+// they implement ipintel.Purger.
+func (t *Tiered) PurgeIP(ctx context.Context, ip string) (int, error) {
+	return t.purge(func(p ipintel.Purger) (int, error) {
+		return p.PurgeIP(ctx, ip)
+	})
+}
+
+// PurgeBefore deletes the Results queried before t from both caches,
+// provided they implement ipintel.Purger.
+func (t *Tiered) PurgeBefore(ctx context.Context, before time.Time) (int, error) {
+	return t.purge(func(p ipintel.Purger) (int, error) {
+		return p.PurgeBefore(ctx, before)
+	})
+}
+
+// Invalidate deletes the cached Results of ip from both caches,
+// provided they implement ipintel.Invalidator.
+func (t *Tiered) Invalidate(ctx context.Context, ip string) (int, error) {
+	return t.invalidate(func(inv ipintel.Invalidator) (int, error) {
+		return inv.Invalidate(ctx, ip)
+	})
+}
+
+// InvalidateRange deletes the cached Results of all IPs in prefix from
+// both caches, provided they implement ipintel.Invalidator.
+func (t *Tiered) InvalidateRange(ctx context.Context, prefix netip.Prefix) (int, error) {
+	return t.invalidate(func(inv ipintel.Invalidator) (int, error) {
+		return inv.InvalidateRange(ctx, prefix)
+	})
+}
+
+// invalidate fails if the shared cache isn't an ipintel.Invalidator, as
+// other processes would keep answering from it.
+func (t *Tiered) invalidate(fn func(ipintel.Invalidator) (int, error)) (int, error) {
+	shared, ok := t.shared.(ipintel.Invalidator)
+	if !ok {
+		return 0, fmt.Errorf("The shared cache can't invalidate entries")
+	}
+	n, err := fn(shared)
+	if err != nil {
+		return n, err
+	}
+	if local, ok := t.local.(ipintel.Invalidator); ok {
+		_, err = fn(local)
+	}
+	return n, err
+}
+
+// purge returns the entries deleted from the shared cache, as the local
+// one only holds copies of them.
+func (t *Tiered) purge(fn func(ipintel.Purger) (int, error)) (int, error) {
+	var errs []error
+	if p, ok := t.local.(ipintel.Purger); ok {
+		if _, err := fn(p); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	var n int
+	if p, ok := t.shared.(ipintel.Purger); ok {
+		var err error
+		if n, err = fn(p); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return n, errors.Join(errs...)
+}
+
+// Walk calls fn with the entries of the shared cache, provided it
+// implements ipintel.Walker.
+func (t *Tiered) Walk(ctx context.Context, fn func(ipintel.CacheEntry) error) error {
+	w, ok := t.shared.(ipintel.Walker)
+	if !ok {
+		return fmt.Errorf("The shared cache can't list its entries")
+	}
+	return w.Walk(ctx, fn)
+}
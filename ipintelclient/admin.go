@@ -0,0 +1,141 @@
+package ipintelclient
+
+import (
+	"context"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/pierelucas/go-ipintel/ipintelserver"
+)
+
+// Stats are the counters of the daemon's Client (see ipintel.Stats).
+type Stats struct {
+	Lookups         uint64 `json:"lookups"`
+	ListHits        uint64 `json:"list_hits"`
+	HostingHits     uint64 `json:"hosting_hits"`
+	CleanFilterHits uint64 `json:"clean_filter_hits"`
+	CacheHits       uint64 `json:"cache_hits"`
+	Queries         uint64 `json:"queries"`
+	Throttled       uint64 `json:"throttled"`
+	Unsampled       uint64 `json:"unsampled"`
+	Errors          uint64 `json:"errors"`
+}
+
+// Quota are the queries the daemon's limiter allows now (see
+// ipintel.Quota).
+type Quota struct {
+	Available int           `json:"available"`
+	Burst     int           `json:"burst"`
+	RetryIn   time.Duration `json:"retry_in"`
+}
+
+// List is a local list of the daemon. Entries are only set by List.
+type List struct {
+	Name string `json:"name"`
+	// "allow" or "deny"
+	Action  string   `json:"action"`
+	Size    int      `json:"size"`
+	Entries []string `json:"entries,omitempty"`
+}
+
+// ListPatch changes the entries of a list.
+type ListPatch struct {
+	// Action of the list if it is created; "deny" if empty
+	Action string `json:"action,omitempty"`
+	// IP addresses and CIDR prefixes to add and remove
+	Add    []string `json:"add,omitempty"`
+	Remove []string `json:"remove,omitempty"`
+}
+
+type invalidated struct {
+	Invalidated int `json:"invalidated"`
+}
+
+// ScheduledJobs returns the status of the daemon's scheduled jobs.
+func (c *Client) ScheduledJobs(ctx context.Context) ([]ipintelserver.JobStatus, error) {
+	var jobs []ipintelserver.JobStatus
+	_, err := c.do(ctx, http.MethodGet, "/admin/jobs", nil, &jobs)
+	return jobs, err
+}
+
+// RunScheduledJob runs the scheduled job name now.
+func (c *Client) RunScheduledJob(ctx context.Context, name string) error {
+	_, err := c.do(ctx, http.MethodPost, "/admin/jobs/"+url.PathEscape(name)+"/run", nil, nil)
+	return err
+}
+
+// Stats returns the counters of the daemon's Client.
+func (c *Client) Stats(ctx context.Context) (Stats, error) {
+	var st Stats
+	_, err := c.do(ctx, http.MethodGet, "/admin/stats", nil, &st)
+	return st, err
+}
+
+// Quota returns the queries the daemon's limiter allows now.
+func (c *Client) Quota(ctx context.Context) (Quota, error) {
+	var q Quota
+	_, err := c.do(ctx, http.MethodGet, "/admin/quota", nil, &q)
+	return q, err
+}
+
+// FlushCache drops all cached Results, returning their number if the
+// cache reports it.
+func (c *Client) FlushCache(ctx context.Context) (int, error) {
+	var inv invalidated
+	_, err := c.do(ctx, http.MethodDelete, "/admin/cache", nil, &inv)
+	return inv.Invalidated, err
+}
+
+// Invalidate drops the cached Results of ip, implementing
+// ipintel.Invalidator.
+func (c *Client) Invalidate(ctx context.Context, ip string) (int, error) {
+	var inv invalidated
+	_, err := c.do(ctx, http.MethodDelete, "/admin/cache/"+url.PathEscape(ip), nil, &inv)
+	return inv.Invalidated, err
+}
+
+// InvalidateRange drops the cached Results of the IPs in prefix,
+// implementing ipintel.Invalidator.
+func (c *Client) InvalidateRange(ctx context.Context, prefix netip.Prefix) (int, error) {
+	var inv invalidated
+	path := "/admin/cache/" + prefix.Addr().String() + "/" + strconv.Itoa(prefix.Bits())
+	_, err := c.do(ctx, http.MethodDelete, path, nil, &inv)
+	return inv.Invalidated, err
+}
+
+// Lists returns the daemon's local lists without their entries.
+func (c *Client) Lists(ctx context.Context) ([]List, error) {
+	var lists []List
+	_, err := c.do(ctx, http.MethodGet, "/admin/lists", nil, &lists)
+	return lists, err
+}
+
+// List returns the list name with its entries.
+func (c *Client) List(ctx context.Context, name string) (List, error) {
+	var l List
+	_, err := c.do(ctx, http.MethodGet, "/admin/lists/"+url.PathEscape(name), nil, &l)
+	return l, err
+}
+
+// PatchList adds and removes entries of the list name, creating it if
+// needed, and returns it without its entries.
+func (c *Client) PatchList(ctx context.Context, name string, p ListPatch) (List, error) {
+	var l List
+	_, err := c.do(ctx, http.MethodPatch, "/admin/lists/"+url.PathEscape(name), p, &l)
+	return l, err
+}
+
+// DeleteList removes the list name.
+func (c *Client) DeleteList(ctx context.Context, name string) error {
+	_, err := c.do(ctx, http.MethodDelete, "/admin/lists/"+url.PathEscape(name), nil, nil)
+	return err
+}
+
+// Reload makes the daemon reload its configuration.
+func (c *Client) Reload(ctx context.Context) error {
+	_, err := c.do(ctx, http.MethodPost, "/admin/reload", nil, nil)
+	return err
+}
@@ -0,0 +1,307 @@
+// Package ipintelclient is a client of the API of the daemon run by
+// "ipintel serve" (see ipintelserver), following its OpenAPI
+// specification served at /openapi.json. A Client is an ipintel.Checker,
+// so services can use the daemon's shared cache and quota in place of a
+// Client of their own.
+//
+// Example:
+//
+//	c := ipintelclient.New("https://ipintel.internal:8080", ipintelclient.WithAPIKey(key))
+//	res, err := c.GetProxyScore(ctx, "192.0.2.1")
+//	if err != nil {
+//		return err
+//	}
+//	if res.Risk() == ipintel.High {
+//		...
+//	}
+package ipintelclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+	"github.com/pierelucas/go-ipintel/ipintelserver"
+)
+
+// Client calls the API of a daemon. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	apiKey     string
+	adminToken string
+}
+
+var (
+	_ ipintel.Checker     = (*Client)(nil)
+	_ ipintel.Invalidator = (*Client)(nil)
+)
+
+// Option configures a Client in New.
+type Option func(*Client)
+
+// WithAPIKey sets the API key sent with the requests to the lookup API.
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// WithAdminToken sets the token sent with the requests to the admin
+// API.
+func WithAdminToken(token string) Option {
+	return func(c *Client) {
+		c.adminToken = token
+	}
+}
+
+// WithHTTPClient sets the HTTP client used, http.DefaultClient by
+// default. Its timeout also ends the event streams.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// New returns a Client of the daemon at baseURL, e.g.
+// "http://localhost:8080".
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Error is an error response of the daemon.
+type Error struct {
+	StatusCode int
+	Message    string
+	// From the Retry-After header of 429 responses, 0 if none
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("Daemon returned %d: %s", e.StatusCode, e.Message)
+}
+
+// NotFound reports whether err is a 404 response, e.g. for a job or list
+// that doesn't exist.
+func NotFound(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.StatusCode == http.StatusNotFound
+}
+
+// do sends a request to path with the JSON encoding of in as body, if
+// not nil, and decodes the response into out, if not nil. Statuses
+// other than 2xx are returned as *Error.
+func (c *Client) do(ctx context.Context, method, path string, in, out any) (*http.Response, error) {
+	resp, err := c.send(ctx, method, path, in, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return nil, fmt.Errorf("Failed to decode response: %w", err)
+		}
+	}
+	return resp, nil
+}
+
+// send sends a request to path, returning the response of 2xx statuses
+// with the body left to the caller.
+func (c *Client) send(ctx context.Context, method, path string, in any, header http.Header) (*http.Response, error) {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed preparing request: %w", err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	token := c.apiKey
+	if strings.HasPrefix(path, "/admin/") {
+		token = c.adminToken
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		e := &Error{StatusCode: resp.StatusCode, Message: resp.Status}
+		var ej struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&ej) == nil && ej.Error != "" {
+			e.Message = ej.Error
+		}
+		if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			e.RetryAfter = time.Duration(s) * time.Second
+		}
+		return nil, e
+	}
+	return resp, nil
+}
+
+// Check is the answer of GET /v1/check/{ip}.
+type Check struct {
+	Result ipintel.Result
+	// "block" or "allow" as decided by the policy of the tenant of the
+	// API key, "" if it has none
+	Decision string
+}
+
+// Check looks up ip.
+func (c *Client) Check(ctx context.Context, ip string) (Check, error) {
+	var ch Check
+	resp, err := c.do(ctx, http.MethodGet, "/v1/check/"+url.PathEscape(ip), nil, &ch.Result)
+	if err != nil {
+		return Check{}, err
+	}
+	ch.Decision = resp.Header.Get(ipintelserver.DecisionHeader)
+	return ch, nil
+}
+
+// GetProxyScore looks up ip, implementing ipintel.Checker.
+func (c *Client) GetProxyScore(ctx context.Context, ip string) (ipintel.Result, error) {
+	ch, err := c.Check(ctx, ip)
+	return ch.Result, err
+}
+
+// StartJob starts a batch lookup of ips, returning its status with the
+// ID to fetch the results with.
+func (c *Client) StartJob(ctx context.Context, ips []string) (ipintelserver.BatchStatus, error) {
+	var status ipintelserver.BatchStatus
+	_, err := c.do(ctx, http.MethodPost, "/v1/jobs", map[string][]string{"ips": ips}, &status)
+	return status, err
+}
+
+// Job returns the progress of a batch lookup and its results from
+// offset on.
+func (c *Client) Job(ctx context.Context, id string, offset int) (ipintelserver.BatchStatus, error) {
+	var status ipintelserver.BatchStatus
+	path := "/v1/jobs/" + url.PathEscape(id)
+	if offset > 0 {
+		path += "?offset=" + strconv.Itoa(offset)
+	}
+	_, err := c.do(ctx, http.MethodGet, path, nil, &status)
+	return status, err
+}
+
+// CancelJob stops a batch lookup, keeping its results so far.
+func (c *Client) CancelJob(ctx context.Context, id string) error {
+	_, err := c.do(ctx, http.MethodDelete, "/v1/jobs/"+url.PathEscape(id), nil, nil)
+	return err
+}
+
+// JobEvents streams the results of a batch lookup to fn, from the start,
+// and returns its final status without results once it ends. It stops
+// with the error of fn, if any, or io.ErrUnexpectedEOF if the daemon
+// ended the stream first.
+func (c *Client) JobEvents(ctx context.Context, id string, fn func(ipintelserver.BatchResult) error) (ipintelserver.BatchStatus, error) {
+	var status ipintelserver.BatchStatus
+	err := c.stream(ctx, "/v1/jobs/"+url.PathEscape(id)+"/events", func(event string, data []byte) (bool, error) {
+		switch event {
+		case "result":
+			var br ipintelserver.BatchResult
+			if err := json.Unmarshal(data, &br); err != nil {
+				return false, err
+			}
+			return true, fn(br)
+		case "done":
+			return false, json.Unmarshal(data, &status)
+		}
+		return true, nil
+	})
+	if err == nil && status.ID == "" {
+		// the daemon shut down before the lookup ended
+		err = io.ErrUnexpectedEOF
+	}
+	return status, err
+}
+
+// Events streams the Results answered by the daemon scoring at least
+// minScore to fn until ctx is done, fn fails or the daemon ends the
+// stream, e.g. when shutting down. It returns the error of fn, if any,
+// or io.EOF if the daemon ended the stream.
+func (c *Client) Events(ctx context.Context, minScore float32, fn func(ipintel.Result) error) error {
+	path := "/v1/events?min_score=" + strconv.FormatFloat(float64(minScore), 'f', -1, 32)
+	err := c.stream(ctx, path, func(event string, data []byte) (bool, error) {
+		if event != "result" {
+			return true, nil
+		}
+		var res ipintel.Result
+		if err := json.Unmarshal(data, &res); err != nil {
+			return false, err
+		}
+		return true, fn(res)
+	})
+	if err == nil {
+		return io.EOF
+	}
+	return err
+}
+
+// stream reads the server-sent events of path, passing each to fn until
+// it returns false or an error, or the stream ends.
+func (c *Client) stream(ctx context.Context, path string, fn func(event string, data []byte) (bool, error)) error {
+	resp, err := c.send(ctx, http.MethodGet, path, nil, http.Header{"Accept": {"text/event-stream"}})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(nil, 1<<20)
+	var event string
+	var data []byte
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case line == "":
+			if event == "" && data == nil {
+				continue
+			}
+			more, err := fn(event, data)
+			if err != nil || !more {
+				return err
+			}
+			event, data = "", nil
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = append(data, strings.TrimPrefix(line, "data: ")...)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return sc.Err()
+}
@@ -0,0 +1,571 @@
+package ipintelconfig
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+	"github.com/pierelucas/go-ipintel/ipintelcache"
+	"github.com/pierelucas/go-ipintel/ipintelmemcache"
+	"github.com/pierelucas/go-ipintel/ipintelproviders"
+	"github.com/pierelucas/go-ipintel/ipintelredis"
+	"github.com/pierelucas/go-ipintel/ipintelserver"
+	"github.com/pierelucas/go-ipintel/ipintelstore"
+)
+
+// defaultCacheTTL is used if a cache is configured without TTL.
+const defaultCacheTTL = 24 * time.Hour
+
+// defaultCacheSize is used if an in-memory cache is configured without
+// MaxEntries.
+const defaultCacheSize = 100000
+
+// defaultProviderThreshold is used if providers are configured without
+// ProviderThreshold.
+const defaultProviderThreshold = 0.99
+
+// Setup is what Build creates from a Config.
+type Setup struct {
+	Client *ipintel.Client
+	// Store is nil unless configured.
+	Store *ipintelstore.Store
+	// Lists holds the configured lists, loaded once by Build. With a
+	// server section it is never nil, so the admin API can add lists.
+	Lists *ipintel.Lists
+	// ListSources are the lists loaded from URLs, for use with
+	// Lists.RefreshEvery.
+	ListSources []ipintel.ListSource
+	// Provider is the Client fused with the configured providers, or
+	// the Client itself if there are none. It stays the same across
+	// Reloads, which replace what it delegates to.
+	Provider ipintel.Provider
+	// Cache is the Client's cache, nil unless configured, and CacheTTL
+	// how long it keeps Results.
+	Cache    ipintel.Cache
+	CacheTTL time.Duration
+
+	current reloadable
+	// Names of the configured lists
+	listNames []string
+	// guards reloads and closers
+	mu      sync.Mutex
+	closers []func() error
+}
+
+// Close stops the Client's background work and releases the store and
+// cache connections and the providers implementing io.Closer.
+func (s *Setup) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var first error
+	if s.Client != nil {
+		first = s.Client.Close()
+	}
+	for _, fn := range s.closers {
+		if err := fn(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// background runs fn until s is closed, which cancels its context and
+// waits for it to return.
+func (s *Setup) background(fn func(ctx context.Context) error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- fn(ctx)
+	}()
+	s.closers = append(s.closers, func() error {
+		cancel()
+		return <-done
+	})
+}
+
+// Build creates the configured Client, store, cache and lists. opts are
+// applied after the configured options. Lists are loaded before Build
+// returns.
+func (c *Config) Build(ctx context.Context, opts ...ipintel.Option) (s *Setup, err error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	s = &Setup{}
+	defer func() {
+		if err != nil {
+			s.Close()
+			s = nil
+		}
+	}()
+
+	// the ASN database may be used by both hosting and enrich
+	asnTables := make(map[string]*ipintel.ASNTable)
+	asnTable := func(path string) (*ipintel.ASNTable, error) {
+		if t, ok := asnTables[path]; ok {
+			return t, nil
+		}
+		var t *ipintel.ASNTable
+		err := loadFile(path, func(r io.Reader) (err error) {
+			t, err = ipintel.ReadASNTable(r)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		asnTables[path] = t
+		return t, nil
+	}
+
+	check := ipintel.Dynamic
+	if c.Check != "" {
+		check, _ = ipintel.ParseCheckType(c.Check)
+	}
+
+	var cOpts []ipintel.Option
+	if c.BaseURL != "" {
+		cOpts = append(cOpts, ipintel.WithBaseURL(c.BaseURL))
+	}
+	if c.Timeout > 0 {
+		cOpts = append(cOpts, ipintel.WithHTTPClient(&http.Client{Timeout: time.Duration(c.Timeout)}))
+	}
+	if c.Retries > 0 {
+		cOpts = append(cOpts, ipintel.WithRetryPolicy(ipintel.Backoff{Retries: c.Retries}))
+	}
+	if c.App != "" {
+		cOpts = append(cOpts, ipintel.WithUserAgent(c.App))
+	}
+	if c.Country {
+		cOpts = append(cOpts, ipintel.WithCountry())
+	}
+	if c.Sampling > 0 {
+		cOpts = append(cOpts, ipintel.WithSampling(c.Sampling))
+	}
+	if c.Proxy != "" {
+		u, _ := ipintel.ParseProxyURL(c.Proxy)
+		cOpts = append(cOpts, ipintel.WithProxy(u))
+	}
+	if c.TLS != nil {
+		tlsOpts, err := c.TLS.options()
+		if err != nil {
+			return nil, err
+		}
+		cOpts = append(cOpts, tlsOpts...)
+	}
+
+	var ci *ipintel.Cipher
+	if c.EncryptionKey != "" {
+		if ci, err = newCipher(c.EncryptionKey); err != nil {
+			return nil, fmt.Errorf("encryption_key: %w", err)
+		}
+	}
+
+	if cc := c.Cache; cc != nil && cc.Memcached != nil {
+		var mOpts []ipintelmemcache.Option
+		if cc.Memcached.Prefix != "" {
+			mOpts = append(mOpts, ipintelmemcache.WithPrefix(cc.Memcached.Prefix))
+		}
+		if cc.Memcached.Timeout > 0 {
+			mOpts = append(mOpts, ipintelmemcache.WithTimeout(time.Duration(cc.Memcached.Timeout)))
+		}
+		if cc.Codec == "binary" {
+			mOpts = append(mOpts, ipintelmemcache.WithCodec(ipintel.BinaryCodec{}))
+		}
+		mc, err := ipintelmemcache.NewCache(cc.Memcached.Servers, mOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("cache.memcached: %w", err)
+		}
+		s.closers = append(s.closers, mc.Close)
+		s.Cache = mc
+	} else if cc != nil && cc.Redis == nil {
+		mem := ipintelcache.New(cacheSize(cc), nil)
+		if ci != nil {
+			mem.EncryptSnapshots(ci)
+		}
+		if cc.Snapshot != "" {
+			if err := mem.LoadFile(cc.Snapshot); err != nil {
+				return nil, fmt.Errorf("cache.snapshot: %w", err)
+			}
+			interval := time.Duration(cc.SnapshotInterval)
+			if interval == 0 {
+				interval = time.Minute
+			}
+			var saveErr error
+			// stopping it saves a last snapshot
+			s.background(func(ctx context.Context) error {
+				mem.SaveEvery(ctx, cc.Snapshot, interval, func(err error) { saveErr = err })
+				return saveErr
+			})
+		}
+		s.background(func(ctx context.Context) error {
+			mem.RunJanitor(ctx, time.Duration(cc.SweepInterval), cc.SweepBudget)
+			return nil
+		})
+		s.Cache = mem
+	} else if cc != nil {
+		password, err := ipintel.ResolveSecret(cc.Redis.Password)
+		if err != nil {
+			return nil, fmt.Errorf("cache.redis.password: %w", err)
+		}
+		rdb := redis.NewClient(&redis.Options{
+			Addr:     cc.Redis.Addr,
+			Password: password,
+			DB:       cc.Redis.DB,
+		})
+		s.closers = append(s.closers, rdb.Close)
+		var rOpts []ipintelredis.CacheOption
+		if cc.Codec == "binary" {
+			rOpts = append(rOpts, ipintelredis.WithCodec(ipintel.BinaryCodec{}))
+		}
+		s.Cache = ipintelredis.NewCache(rdb, cc.Redis.Prefix, rOpts...)
+		if cc.Redis.LockWait > 0 {
+			cOpts = append(cOpts, ipintel.WithLocker(ipintelredis.NewLocker(rdb, cc.Redis.Prefix), time.Duration(cc.Redis.LockWait)))
+		}
+	}
+
+	if cc := c.Cache; cc != nil && cc.LocalTTL > 0 {
+		local := ipintelcache.New(cacheSize(cc), nil)
+		s.background(func(ctx context.Context) error {
+			local.RunJanitor(ctx, time.Duration(cc.SweepInterval), cc.SweepBudget)
+			return nil
+		})
+		s.Cache = ipintelcache.NewTiered(local, time.Duration(cc.LocalTTL), s.Cache)
+	}
+	if s.Cache != nil {
+		s.CacheTTL = cacheTTL(c.Cache)
+		cOpts = append(cOpts, ipintel.WithCache(s.Cache, s.CacheTTL))
+	}
+	if cc := c.Cache; cc != nil && cc.CleanFilter != nil {
+		cf := cc.CleanFilter
+		f := ipintel.NewCleanFilter(cf.Capacity, time.Duration(cf.TTL), cf.FPRate)
+		cOpts = append(cOpts, ipintel.WithCleanFilter(f, cf.Threshold))
+	}
+
+	if sc := c.Store; sc != nil {
+		var stOpts []ipintelstore.Option
+		if ci != nil {
+			stOpts = append(stOpts, ipintelstore.WithCipher(ci))
+		}
+		if s.Store, err = ipintelstore.Open(sc.Path, stOpts...); err != nil {
+			return nil, err
+		}
+		s.closers = append(s.closers, s.Store.Close)
+		cOpts = append(cOpts, ipintel.WithStore(s.Store))
+		switch sc.Pseudonymize {
+		case "truncate":
+			cOpts = append(cOpts, ipintel.WithPseudonymizer(ipintel.TruncateIP(24, 48)))
+		case "hash":
+			secret, err := ipintel.ResolveSecret(sc.Secret)
+			if err != nil {
+				return nil, fmt.Errorf("store.secret: %w", err)
+			}
+			cOpts = append(cOpts, ipintel.WithPseudonymizer(ipintel.HashIP([]byte(secret))))
+		}
+	}
+
+	if len(c.Lists) > 0 || c.Server != nil {
+		s.Lists = ipintel.NewLists()
+		for _, lc := range c.Lists {
+			src, err := loadList(ctx, s.Lists, lc)
+			if err != nil {
+				return nil, err
+			}
+			if src != nil {
+				s.ListSources = append(s.ListSources, *src)
+				if lc.Refresh > 0 {
+					cOpts = append(cOpts, ipintel.WithListRefresh(time.Duration(lc.Refresh), nil, *src))
+				}
+			}
+			s.listNames = append(s.listNames, lc.Name)
+		}
+		cOpts = append(cOpts, ipintel.WithLists(s.Lists))
+	}
+
+	if hc := c.Hosting; hc != nil {
+		h := ipintel.DefaultHosting()
+		if hc.File != "" {
+			if err := loadFile(hc.File, h.Load); err != nil {
+				return nil, fmt.Errorf("hosting.file: %w", err)
+			}
+		}
+		var asn func(netip.Addr) (uint32, bool)
+		if hc.ASNDB != "" {
+			t, err := asnTable(hc.ASNDB)
+			if err != nil {
+				return nil, fmt.Errorf("hosting.asn_db: %w", err)
+			}
+			asn = t.Lookup
+		}
+		cOpts = append(cOpts, ipintel.WithHosting(h, asn))
+	}
+
+	if ec := c.Enrich; ec != nil {
+		var enrichers []ipintel.Enricher
+		if ec.ASNDB != "" {
+			t, err := asnTable(ec.ASNDB)
+			if err != nil {
+				return nil, fmt.Errorf("enrich.asn_db: %w", err)
+			}
+			enrichers = append(enrichers, ipintel.EnrichASN(t))
+		}
+		if ec.CountryDB != "" {
+			var t *ipintel.CountryTable
+			err := loadFile(ec.CountryDB, func(r io.Reader) (err error) {
+				t, err = ipintel.ReadCountryTable(r)
+				return err
+			})
+			if err != nil {
+				return nil, fmt.Errorf("enrich.country_db: %w", err)
+			}
+			enrichers = append(enrichers, ipintel.EnrichCountry(t.Lookup))
+		}
+		if ec.ReverseDNS {
+			enrichers = append(enrichers, ipintel.EnrichReverseDNS(nil, time.Duration(ec.ReverseDNSTimeout)))
+		}
+		cOpts = append(cOpts, ipintel.WithEnrichment(nil, enrichers...))
+	}
+
+	contact, err := ipintel.ResolveSecret(c.Contact)
+	if err != nil {
+		return nil, fmt.Errorf("contact: %w", err)
+	}
+	s.Client = ipintel.NewClient(contact, c.Scheme != "http", check, time.Duration(c.MaxWait), append(cOpts, opts...)...)
+	if err := s.Client.Validate(); err != nil {
+		return nil, err
+	}
+
+	p, err := c.provider(s)
+	if err != nil {
+		return nil, err
+	}
+	s.current.p.Store(&p)
+	s.Provider = &s.current
+	return s, nil
+}
+
+// provider returns the Client of s fused with the configured providers,
+// or the Client if there are none.
+func (c *Config) provider(s *Setup) (ipintel.Provider, error) {
+	if len(c.Providers) == 0 {
+		return s.Client, nil
+	}
+	providers := []ipintel.Provider{s.Client}
+	for _, pc := range c.Providers {
+		p, err := ipintel.NewProvider(pc.Name, pc.Options)
+		if err != nil {
+			return nil, err
+		}
+		if cl, ok := p.(io.Closer); ok {
+			s.closers = append(s.closers, cl.Close)
+		}
+		providers = append(providers, p)
+	}
+	threshold := c.ProviderThreshold
+	if threshold == 0 {
+		threshold = defaultProviderThreshold
+	}
+	return ipintelproviders.Fuse(threshold, providers...), nil
+}
+
+// loadList loads the list configured by lc into l, returning its source
+// if it was downloaded.
+func loadList(ctx context.Context, l *ipintel.Lists, lc ListConfig) (*ipintel.ListSource, error) {
+	action, _ := parseAction(lc.Action)
+	if lc.URL != "" {
+		src := ipintel.ListSource{Name: lc.Name, URL: lc.URL, Action: action}
+		if err := l.Refresh(ctx, nil, src); err != nil {
+			return nil, err
+		}
+		return &src, nil
+	}
+	f, err := os.Open(lc.File)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := l.Load(lc.Name, action, f); err != nil {
+		return nil, fmt.Errorf("List %s: %w", lc.Name, err)
+	}
+	return nil, nil
+}
+
+func (t *TLSConfig) options() ([]ipintel.Option, error) {
+	version, _ := tlsVersion(t.MinVersion)
+	cfg := &tls.Config{MinVersion: version}
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates in tls.ca_file %s", t.CAFile)
+		}
+	}
+	opts := []ipintel.Option{ipintel.WithTLSConfig(cfg)}
+	if len(t.Pins) > 0 {
+		pins := make([][sha256.Size]byte, len(t.Pins))
+		for i, p := range t.Pins {
+			pins[i], _ = parsePin(p)
+		}
+		opts = append(opts, ipintel.WithPinnedKeys(pins...))
+	}
+	return opts, nil
+}
+
+// ServerTLS returns the TLS configuration of the daemon, serving the
+// certificate through an ipintelserver.CertReloader that passes failed
+// reloads to onError.
+func (t *ServerTLSConfig) ServerTLS(onError func(error)) (*tls.Config, error) {
+	version, err := tlsVersion(t.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	cr, err := ipintelserver.NewCertReloader(t.CertFile, t.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	cr.OnError = onError
+	return &tls.Config{GetCertificate: cr.GetCertificate, MinVersion: version}, nil
+}
+
+// APITokens returns the API keys of the daemon with their secrets
+// resolved.
+func (s *ServerConfig) APITokens() ([]ipintelserver.Token, error) {
+	return apiTokens(s.Tokens, nil)
+}
+
+// TenantTokens returns the API keys of the tenants of the daemon, each
+// set to its Tenant. The tenants' Clients are derived from the one of
+// setup, sharing its store and cache connection.
+func (s *ServerConfig) TenantTokens(setup *Setup) ([]ipintelserver.Token, error) {
+	var tokens []ipintelserver.Token
+	for _, tc := range s.Tenants {
+		policy, err := tc.Policy()
+		if err != nil {
+			return nil, err
+		}
+		// each account has a quota of its own
+		opts := []ipintel.Option{ipintel.WithLimiter(ipintel.NewLimiter(nil))}
+		if tc.Email != "" {
+			email, err := ipintel.ResolveSecret(tc.Email)
+			if err != nil {
+				return nil, fmt.Errorf("Tenant %s: %w", tc.Name, err)
+			}
+			opts = append(opts, ipintel.WithEmail(email))
+		}
+		if setup.Cache != nil {
+			// the lock of another namespace would only delay the lookup
+			opts = append(opts,
+				ipintel.WithCache(ipintel.NamespaceCache(setup.Cache, tc.Name), setup.CacheTTL),
+				ipintel.WithLocker(nil, 0))
+		}
+		t := &ipintelserver.Tenant{
+			Name:    tc.Name,
+			Checker: setup.Client.WithOptions(opts...),
+			Policy:  policy,
+		}
+		tt, err := apiTokens(tc.Tokens, t)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, tt...)
+	}
+	return tokens, nil
+}
+
+func apiTokens(tcs []TokenConfig, tenant *ipintelserver.Tenant) ([]ipintelserver.Token, error) {
+	tokens := make([]ipintelserver.Token, len(tcs))
+	for i, tc := range tcs {
+		key, err := ipintel.ResolveSecret(tc.Key)
+		if err != nil {
+			return nil, fmt.Errorf("Token %s: %w", tc.Name, err)
+		}
+		tokens[i] = ipintelserver.Token{
+			Name:        tc.Name,
+			Key:         key,
+			Rate:        tc.Rate,
+			Burst:       tc.Burst,
+			QueryLimit:  tc.QueryLimit,
+			QueryPeriod: time.Duration(tc.QueryPeriod),
+			Tenant:      tenant,
+		}
+	}
+	return tokens, nil
+}
+
+func tlsVersion(s string) (uint16, error) {
+	switch s {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("Invalid tls.min_version %q: must be 1.2 or 1.3", s)
+}
+
+func parsePin(s string) (pin [sha256.Size]byte, err error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(b) != sha256.Size {
+		return pin, fmt.Errorf("Invalid pin %q: must be a base64 SHA-256 hash", s)
+	}
+	copy(pin[:], b)
+	return pin, nil
+}
+
+func newCipher(ref string) (*ipintel.Cipher, error) {
+	v, err := ipintel.ResolveSecret(ref)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ipintel.ParseCipherKey(v)
+	if err != nil {
+		return nil, err
+	}
+	return ipintel.NewCipher(key)
+}
+
+func cacheSize(cc *CacheConfig) int {
+	if cc.MaxEntries == 0 {
+		return defaultCacheSize
+	}
+	return cc.MaxEntries
+}
+
+func cacheTTL(cc *CacheConfig) time.Duration {
+	if cc.TTL == 0 {
+		return defaultCacheTTL
+	}
+	return time.Duration(cc.TTL)
+}
+
+func parseAction(s string) (ipintel.ListAction, error) {
+	switch s {
+	case "allow":
+		return ipintel.Allow, nil
+	case "deny":
+		return ipintel.Deny, nil
+	}
+	return 0, fmt.Errorf("Invalid action %q: must be allow or deny", s)
+}
+
+// loadFile calls load with the content of the file at path.
+func loadFile(path string, load func(io.Reader) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return load(f)
+}
@@ -0,0 +1,24 @@
+package ipintelconfig
+
+import "testing"
+
+func TestValidateAdminToken(t *testing.T) {
+	for _, tt := range []struct {
+		listen, token string
+		ok            bool
+	}{
+		{"", "", true},
+		{"localhost:8080", "", true},
+		{"127.0.0.1:8080", "", true},
+		{"[::1]:8080", "", true},
+		{":8080", "", false},
+		{"0.0.0.0:8080", "", false},
+		{"192.0.2.1:8080", "", false},
+		{":8080", "secret", true},
+	} {
+		c := &Config{Contact: "test@example.com", Server: &ServerConfig{Listen: tt.listen, AdminToken: tt.token}}
+		if err := c.Validate(); (err == nil) != tt.ok {
+			t.Errorf("listen %q, token %q: Validate() = %v, want ok %v", tt.listen, tt.token, err, tt.ok)
+		}
+	}
+}
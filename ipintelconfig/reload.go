@@ -0,0 +1,84 @@
+package ipintelconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+)
+
+// reloadable is the Provider of a Setup, delegating to the one built
+// last.
+type reloadable struct {
+	p atomic.Pointer[ipintel.Provider]
+}
+
+func (r *reloadable) GetProxyScore(ctx context.Context, ip string) (ipintel.Result, error) {
+	return (*r.p.Load()).GetProxyScore(ctx, ip)
+}
+
+func (r *reloadable) Name() string {
+	return (*r.p.Load()).Name()
+}
+
+// Reload applies the lists, check type, maximum wait, providers and
+// provider threshold of c to s, keeping its Client, cache and store, so
+// rules can be tuned without starting over with an empty cache. Lists
+// no longer configured are removed; a list that fails to load keeps its
+// previous entries and is reported in the error. Other settings take
+// effect with the next Build.
+//
+// The providers replaced are closed with s, as lookups may still be
+// using them.
+func (s *Setup) Reload(ctx context.Context, c *Config) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	if len(c.Lists) > 0 && s.Lists == nil {
+		return fmt.Errorf("Lists require a restart, as none were configured")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errs []error
+	if s.Lists != nil {
+		var names []string
+		var sources []ipintel.ListSource
+		for _, lc := range c.Lists {
+			names = append(names, lc.Name)
+			src, err := loadList(ctx, s.Lists, lc)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if src != nil {
+				sources = append(sources, *src)
+			}
+		}
+		for _, name := range s.listNames {
+			if !slices.Contains(names, name) {
+				s.Lists.Remove(name)
+			}
+		}
+		s.listNames, s.ListSources = names, sources
+	}
+
+	check := ipintel.Dynamic
+	if c.Check != "" {
+		check, _ = ipintel.ParseCheckType(c.Check)
+	}
+	s.Client.SetCheck(check)
+	s.Client.SetMaxWait(time.Duration(c.MaxWait))
+
+	p, err := c.provider(s)
+	if err != nil {
+		errs = append(errs, err)
+	} else {
+		s.current.p.Store(&p)
+	}
+	return errors.Join(errs...)
+}
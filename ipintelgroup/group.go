@@ -0,0 +1,270 @@
+// Package ipintelgroup shares scores between the app servers of a
+// cluster without a central cache, in the manner of groupcache: each IP
+// is owned by one peer, chosen by consistent hashing, which looks it up
+// with its loader, usually an ipintel.Client, at most once at a time
+// and caches the Result. The other peers ask the owner over HTTP and
+// keep a copy in their own cache.
+//
+// Example:
+//
+//	g := ipintelgroup.New("http://10.0.0.1:8080", c)
+//	g.SetPeers("http://10.0.0.1:8080", "http://10.0.0.2:8080", "http://10.0.0.3:8080")
+//	http.Handle(ipintelgroup.DefaultPath, g)
+//	res, err := g.GetProxyScore(ctx, ip)
+//
+// The peer endpoint triggers lookups counting against the API quota, so
+// it should only be reachable by the peers.
+package ipintelgroup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+	"github.com/pierelucas/go-ipintel/internal/hashring"
+	"github.com/pierelucas/go-ipintel/ipintelcache"
+)
+
+// DefaultPath is the path of the peer endpoint, relative to the base
+// URL of each peer.
+const DefaultPath = "/_ipintel/group/"
+
+// Defaults of New.
+const (
+	DefaultCacheSize = 100000
+	DefaultTTL       = 24 * time.Hour
+	// Time to wait for a peer before looking the IP up locally
+	DefaultPeerTimeout = 2 * time.Second
+)
+
+// maxPeerResponse caps the size of peer responses.
+const maxPeerResponse = 64 << 10
+
+// Group is an ipintel.Provider answering lookups from the peer owning
+// each IP. If the owner can't be reached, the IP is looked up locally,
+// so a failed peer costs quota rather than availability. It is safe for
+// concurrent use.
+type Group struct {
+	self        string
+	loader      ipintel.Checker
+	cache       ipintel.Cache
+	ttl         time.Duration
+	httpClient  *http.Client
+	peerTimeout time.Duration
+	onError     func(error)
+
+	mu   sync.RWMutex
+	ring *hashring.Ring
+
+	flightMu sync.Mutex
+	flights  map[string]*flight
+}
+
+var _ ipintel.Provider = (*Group)(nil)
+
+// Option configures a Group in New.
+type Option func(*Group)
+
+// WithCache sets the cache of Results owned or fetched by the peer and
+// how long they are kept, by default an in-memory cache of
+// DefaultCacheSize entries and DefaultTTL.
+func WithCache(c ipintel.Cache, ttl time.Duration) Option {
+	return func(g *Group) {
+		g.cache, g.ttl = c, ttl
+	}
+}
+
+// WithHTTPClient sets the HTTP client for requests to peers.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(g *Group) {
+		g.httpClient = hc
+	}
+}
+
+// WithPeerTimeout sets how long to wait for the owner of an IP,
+// DefaultPeerTimeout by default.
+func WithPeerTimeout(d time.Duration) Option {
+	return func(g *Group) {
+		g.peerTimeout = d
+	}
+}
+
+// WithErrorHandler sets a function called with failed requests to
+// peers, which are otherwise only answered by a local lookup.
+func WithErrorHandler(fn func(error)) Option {
+	return func(g *Group) {
+		g.onError = fn
+	}
+}
+
+// New returns a Group of the peer with the base URL self, e.g.
+// "http://10.0.0.1:8080", looking up the IPs it owns with loader. Until
+// SetPeers is called, it owns all IPs.
+func New(self string, loader ipintel.Checker, opts ...Option) *Group {
+	self = strings.TrimSuffix(self, "/")
+	g := &Group{
+		self:        self,
+		loader:      loader,
+		ttl:         DefaultTTL,
+		httpClient:  http.DefaultClient,
+		peerTimeout: DefaultPeerTimeout,
+		ring:        hashring.New(self),
+		flights:     make(map[string]*flight),
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	if g.cache == nil {
+		g.cache = ipintelcache.New(DefaultCacheSize, nil)
+	}
+	return g
+}
+
+// SetPeers replaces the peers of the group, given by their base URLs.
+// All peers must be given the same list, including themselves.
+func (g *Group) SetPeers(peers ...string) {
+	nodes := make([]string, len(peers))
+	for i, p := range peers {
+		nodes[i] = strings.TrimSuffix(p, "/")
+	}
+	r := hashring.New(nodes...)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.ring = r
+}
+
+// Name returns "group".
+func (g *Group) Name() string {
+	return "group"
+}
+
+// GetProxyScore returns the Result of ip from the cache, the peer
+// owning ip or the loader.
+func (g *Group) GetProxyScore(ctx context.Context, ip string) (ipintel.Result, error) {
+	if res, ok := g.cached(ctx, ip); ok {
+		return res, nil
+	}
+	g.mu.RLock()
+	owner := g.ring.Pick(ip)
+	g.mu.RUnlock()
+	if owner != "" && owner != g.self {
+		res, err := g.fetch(ctx, owner, ip)
+		if err == nil {
+			g.cache.Set(ctx, ip, res, g.ttl)
+			return res, nil
+		}
+		if ctx.Err() != nil {
+			return ipintel.Result{}, ctx.Err()
+		}
+		if g.onError != nil {
+			g.onError(fmt.Errorf("Failed to ask peer %s: %w", owner, err))
+		}
+	}
+	return g.load(ctx, ip)
+}
+
+// ServeHTTP answers the lookups of peers for the IPs g owns, given as
+// DefaultPath+"?ip=...". They are never passed on to another peer, so
+// peers with different lists can't bounce requests between them.
+func (g *Group) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ip := r.URL.Query().Get("ip")
+	if ip == "" {
+		http.Error(w, "missing ip", http.StatusBadRequest)
+		return
+	}
+	res, ok := g.cached(r.Context(), ip)
+	if !ok {
+		var err error
+		if res, err = g.load(r.Context(), ip); err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+func (g *Group) cached(ctx context.Context, ip string) (ipintel.Result, bool) {
+	res, ok, err := g.cache.Get(ctx, ip)
+	if err != nil || !ok {
+		return ipintel.Result{}, false
+	}
+	res.FromCache = true
+	return res, true
+}
+
+// fetch asks peer for the Result of ip.
+func (g *Group) fetch(ctx context.Context, peer, ip string) (ipintel.Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, g.peerTimeout)
+	defer cancel()
+	u := peer + DefaultPath + "?ip=" + url.QueryEscape(ip)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return ipintel.Result{}, err
+	}
+	resp, err := g.httpClient.Do(req)
+	if err != nil {
+		return ipintel.Result{}, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPeerResponse))
+	if err != nil {
+		return ipintel.Result{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return ipintel.Result{}, fmt.Errorf("Peer returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var res ipintel.Result
+	if err := json.Unmarshal(body, &res); err != nil {
+		return ipintel.Result{}, fmt.Errorf("Failed to parse peer response: %w", err)
+	}
+	return res, nil
+}
+
+// flight is a lookup in progress, shared by all callers for its IP.
+type flight struct {
+	done chan struct{}
+	res  ipintel.Result
+	err  error
+}
+
+// load looks ip up with the loader, once at a time per IP, and caches
+// the Result. The lookup isn't canceled with ctx, which callers waiting
+// for it may share.
+func (g *Group) load(ctx context.Context, ip string) (ipintel.Result, error) {
+	g.flightMu.Lock()
+	f, ok := g.flights[ip]
+	if !ok {
+		f = &flight{done: make(chan struct{})}
+		g.flights[ip] = f
+		go func() {
+			f.res, f.err = g.loader.GetProxyScore(context.WithoutCancel(ctx), ip)
+			if f.err == nil {
+				g.cache.Set(context.WithoutCancel(ctx), ip, f.res, g.ttl)
+			}
+			g.flightMu.Lock()
+			delete(g.flights, ip)
+			g.flightMu.Unlock()
+			close(f.done)
+		}()
+	}
+	g.flightMu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return ipintel.Result{}, ctx.Err()
+	case <-f.done:
+		return f.res, f.err
+	}
+}
@@ -0,0 +1,93 @@
+// Package ipintelkafka provides an ipintel.Store publishing lookups to a
+// Kafka topic, so fraud and SIEM pipelines can consume them without
+// querying the applications doing the checks.
+//
+// Example:
+//
+//	p := ipintelkafka.New(&kafka.Writer{
+//		Addr:  kafka.TCP("localhost:9092"),
+//		Topic: "ipintel",
+//	}, ipintelkafka.WithMinScore(0.95))
+//	defer p.Close()
+//	c := ipintel.NewClient("your@email.com", true, ipintel.Dynamic, 0, ipintel.WithStore(p))
+//
+// To keep a database as well, combine both with ipintel.MultiStore.
+package ipintelkafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/segmentio/kafka-go"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+)
+
+// Publisher is an ipintel.Store writing each recorded lookup as a
+// message to a Kafka topic, keyed by IP so all lookups of an IP land in
+// the same partition.
+type Publisher struct {
+	w        *kafka.Writer
+	minScore float32
+	encode   func(ipintel.Record) ([]byte, error)
+}
+
+var _ ipintel.Store = (*Publisher)(nil)
+
+// Option configures a Publisher in New.
+type Option func(*Publisher)
+
+// New returns a Publisher writing with w. The messages are the JSON
+// representation of ipintel.Record unless changed with WithEncoder.
+//
+// Record waits for the write to complete unless w is asynchronous
+// (w.Async), in which case failed writes are only reported to
+// w.Completion.
+func New(w *kafka.Writer, opts ...Option) *Publisher {
+	p := &Publisher{w: w, encode: encodeJSON}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// WithMinScore makes the Publisher skip lookups scoring below score.
+func WithMinScore(score float32) Option {
+	return func(p *Publisher) {
+		p.minScore = score
+	}
+}
+
+// WithEncoder sets the function encoding records into message values,
+// e.g. to Avro for a schema registry.
+func WithEncoder(fn func(ipintel.Record) ([]byte, error)) Option {
+	return func(p *Publisher) {
+		p.encode = fn
+	}
+}
+
+func encodeJSON(rec ipintel.Record) ([]byte, error) {
+	return json.Marshal(rec)
+}
+
+// Record publishes rec unless it scores below the minimum score.
+func (p *Publisher) Record(ctx context.Context, rec ipintel.Record) error {
+	if rec.Score < p.minScore {
+		return nil
+	}
+	value, err := p.encode(rec)
+	if err != nil {
+		return fmt.Errorf("Failed to encode record: %w", err)
+	}
+	msg := kafka.Message{Key: []byte(rec.IP), Value: value, Time: rec.QueriedAt}
+	if err := p.w.WriteMessages(ctx, msg); err != nil {
+		return fmt.Errorf("Failed to publish record: %w", err)
+	}
+	return nil
+}
+
+// Close flushes pending messages and closes the writer.
+func (p *Publisher) Close() error {
+	return p.w.Close()
+}
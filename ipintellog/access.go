@@ -0,0 +1,44 @@
+package ipintellog
+
+import (
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// accessTimeLayout is the time format of the common log format.
+const accessTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// ParseAccessLog parses a line in the common or combined log format, as
+// written by Apache httpd and nginx:
+//
+//	192.0.2.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /a.gif HTTP/1.0" 200 2326
+//
+// The request line is the Text of the Entry. Lines whose host is a name
+// rather than an IP are not parsed.
+func ParseAccessLog(line string) (Entry, bool) {
+	host, rest, ok := strings.Cut(line, " ")
+	if !ok {
+		return Entry{}, false
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return Entry{}, false
+	}
+	e := Entry{IP: ip}
+
+	if i := strings.IndexByte(rest, '['); i >= 0 {
+		if j := strings.IndexByte(rest[i:], ']'); j >= 0 {
+			if t, err := time.Parse(accessTimeLayout, rest[i+1:i+j]); err == nil {
+				e.Time = t
+			}
+			rest = rest[i+j+1:]
+		}
+	}
+	if i := strings.IndexByte(rest, '"'); i >= 0 {
+		if j := strings.IndexByte(rest[i+1:], '"'); j >= 0 {
+			e.Text = rest[i+1 : i+1+j]
+		}
+	}
+	return e, true
+}
@@ -0,0 +1,48 @@
+package ipintellog
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestParseAccessLog(t *testing.T) {
+	for _, tt := range []struct {
+		line string
+		ok   bool
+		ip   string
+		time time.Time
+		text string
+	}{
+		{
+			line: `192.0.2.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326`,
+			ok:   true, ip: "192.0.2.1",
+			time: time.Date(2000, 10, 10, 20, 55, 36, 0, time.UTC),
+			text: "GET /apache_pb.gif HTTP/1.0",
+		},
+		{
+			line: `2001:db8::1 - - [05/Mar/2024:08:01:02 +0000] "POST /login HTTP/2.0" 302 0 "https://example.com/" "Mozilla/5.0 (X11; Linux x86_64)"`,
+			ok:   true, ip: "2001:db8::1",
+			time: time.Date(2024, 3, 5, 8, 1, 2, 0, time.UTC),
+			text: "POST /login HTTP/2.0",
+		},
+		// a malformed timestamp and request are left out
+		{line: `198.51.100.7 - - [yesterday] "GET`, ok: true, ip: "198.51.100.7"},
+		{line: `client.example.com - - [10/Oct/2000:13:55:36 -0700] "GET / HTTP/1.0" 200 1`},
+		{line: `300.1.2.3 - - [10/Oct/2000:13:55:36 -0700] "GET / HTTP/1.0" 200 1`},
+		{line: `192.0.2.1`},
+		{line: ``},
+	} {
+		e, ok := ParseAccessLog(tt.line)
+		if ok != tt.ok {
+			t.Errorf("ParseAccessLog(%q) ok = %v, want %v", tt.line, ok, tt.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if e.IP != netip.MustParseAddr(tt.ip) || !e.Time.Equal(tt.time) || e.Text != tt.text {
+			t.Errorf("ParseAccessLog(%q) = %+v, want IP %s, time %v, text %q", tt.line, e, tt.ip, tt.time, tt.text)
+		}
+	}
+}
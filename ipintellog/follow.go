@@ -0,0 +1,200 @@
+package ipintellog
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"time"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+)
+
+// FollowPoll is how often Follow checks a file for new lines.
+const FollowPoll = time.Second
+
+// State is the progress of following log files, persisted between runs
+// so a restarted analyzer neither reads a file again nor looks up IPs it
+// already checked. It is not safe for concurrent use.
+type State struct {
+	// Read position of each followed file by path
+	Files map[string]FileState `json:"files"`
+	// Latest lookup of each IP checked
+	Checked map[netip.Addr]ipintel.Result `json:"checked"`
+}
+
+// FileState is the read position in a followed file. The inode tells
+// whether the file at the path was rotated since; it is zero on
+// systems without inodes, where rotation is only noticed by the file
+// shrinking.
+type FileState struct {
+	Inode  uint64 `json:"inode"`
+	Offset int64  `json:"offset"`
+}
+
+// NewState returns an empty State.
+func NewState() *State {
+	return &State{Files: make(map[string]FileState), Checked: make(map[netip.Addr]ipintel.Result)}
+}
+
+// LoadState reads a State saved with Save, returning an empty State if
+// the file doesn't exist.
+func LoadState(path string) (*State, error) {
+	s := NewState()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Failed to read state: %w", err)
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("Failed to parse state: %w", err)
+	}
+	if s.Files == nil {
+		s.Files = make(map[string]FileState)
+	}
+	if s.Checked == nil {
+		s.Checked = make(map[netip.Addr]ipintel.Result)
+	}
+	return s, nil
+}
+
+// Save writes s to path, replacing the file atomically.
+func (s *State) Save(path string) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("Failed to save state: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return fmt.Errorf("Failed to save state: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("Failed to save state: %w", err)
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// Lookup returns the Result of checking ip, unless it was checked
+// longer than maxAge ago.
+func (s *State) Lookup(ip netip.Addr, maxAge time.Duration) (ipintel.Result, bool) {
+	res, ok := s.Checked[ip]
+	if !ok || time.Since(res.QueriedAt) > maxAge {
+		return ipintel.Result{}, false
+	}
+	return res, true
+}
+
+// Follow calls fn with the entries parsed from the file at path as
+// lines are appended to it, until ctx is done, starting at the position
+// recorded in s and keeping it up to date. When the file is rotated,
+// i.e. replaced by a new file or truncated, the rest of the old one is
+// read before continuing at the start of the new one. Lines not parsed
+// are skipped; an incomplete last line is read once completed.
+func Follow(ctx context.Context, path string, parse Parser, s *State, fn func(Entry)) error {
+	f, fst, err := openFollowed(path, s.Files[path])
+	if err != nil {
+		return err
+	}
+	defer func() { f.Close() }()
+
+	r := bufio.NewReader(f)
+	var partial []byte
+	draining := false
+	ticker := time.NewTicker(FollowPoll)
+	defer ticker.Stop()
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == nil {
+			fst.Offset += int64(len(line))
+			if e, ok := parse(string(trimEOL(append(partial, line...)))); ok {
+				fn(e)
+			}
+			partial = partial[:0]
+			s.Files[path] = fst
+			continue
+		} else if err != io.EOF {
+			return fmt.Errorf("Failed to read %s: %w", path, err)
+		}
+		// keep the incomplete line, but only count it once complete
+		partial = append(partial, line...)
+		fst.Offset += int64(len(line))
+		s.Files[path] = FileState{Inode: fst.Inode, Offset: fst.Offset - int64(len(partial))}
+
+		if draining {
+			if nf, nst, err := openFollowed(path, FileState{}); err == nil {
+				f.Close()
+				f, fst, partial = nf, nst, partial[:0]
+				r.Reset(f)
+				s.Files[path] = fst
+			}
+			draining = false
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		// read what was written before the rotation first
+		draining = rotated(path, f, fst)
+	}
+}
+
+// openFollowed opens path at the position of st, from the start if the
+// file is a different one or shorter.
+func openFollowed(path string, st FileState) (*os.File, FileState, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, FileState{}, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, FileState{}, err
+	}
+	ino := inode(fi)
+	if ino != st.Inode || fi.Size() < st.Offset {
+		st = FileState{Inode: ino}
+	}
+	if _, err := f.Seek(st.Offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, FileState{}, err
+	}
+	return f, st, nil
+}
+
+// rotated reports whether the file at path is no longer f, or f was
+// truncated below the read position.
+func rotated(path string, f *os.File, st FileState) bool {
+	fi, err := os.Stat(path)
+	if err != nil {
+		// moved away, but not yet replaced
+		return false
+	}
+	cur, err := f.Stat()
+	if err != nil {
+		return true
+	}
+	return !os.SameFile(fi, cur) || cur.Size() < st.Offset
+}
+
+func trimEOL(line []byte) []byte {
+	line = line[:len(line)-1]
+	if n := len(line); n > 0 && line[n-1] == '\r' {
+		line = line[:n-1]
+	}
+	return line
+}
@@ -0,0 +1,123 @@
+package ipintellog
+
+import (
+	"context"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+)
+
+const (
+	accessLine1 = `192.0.2.1 - - [10/Oct/2000:13:55:36 -0700] "GET / HTTP/1.0" 200 1`
+	accessLine2 = `192.0.2.2 - - [10/Oct/2000:13:55:37 -0700] "GET /a HTTP/1.0" 200 1`
+	accessLine3 = `192.0.2.3 - - [10/Oct/2000:13:55:38 -0700] "GET /b HTTP/1.0" 200 1`
+)
+
+// follow follows path until n entries arrived, returning their IPs.
+func follow(t *testing.T, path string, s *State, n int) []string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var ips []string
+	err := Follow(ctx, path, ParseAccessLog, s, func(e Entry) {
+		if ips = append(ips, e.IP.String()); len(ips) == n {
+			cancel()
+		}
+	})
+	if err != context.Canceled {
+		t.Fatalf("Follow() = %v after %v", err, ips)
+	}
+	return ips
+}
+
+func appendFile(t *testing.T, path, data string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFollowResumes(t *testing.T) {
+	dir := t.TempDir()
+	path, statePath := filepath.Join(dir, "access.log"), filepath.Join(dir, "state.json")
+	// an incomplete last line and a malformed one
+	appendFile(t, path, accessLine1+"\nnot a log line\r\n"+accessLine2+"\n"+accessLine3[:20])
+
+	s, err := LoadState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := follow(t, path, s, 2); len(got) != 2 || got[0] != "192.0.2.1" || got[1] != "192.0.2.2" {
+		t.Fatalf("entries %v, want 192.0.2.1 and 192.0.2.2", got)
+	}
+	rec := ipintel.Result{IP: "192.0.2.1", Score: 0.5, QueriedAt: time.Now()}
+	s.Checked[netip.MustParseAddr("192.0.2.1")] = rec
+	if err := s.Save(statePath); err != nil {
+		t.Fatal(err)
+	}
+
+	// the restarted follower reads the completed line only
+	appendFile(t, path, accessLine3[20:]+"\n")
+	s, err = LoadState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := follow(t, path, s, 1); got[0] != "192.0.2.3" {
+		t.Errorf("entries after restart %v, want 192.0.2.3", got)
+	}
+	if res, ok := s.Lookup(netip.MustParseAddr("192.0.2.1"), time.Hour); !ok || res.Score != rec.Score {
+		t.Errorf("Lookup after LoadState = %+v, %v, want the saved Result", res, ok)
+	}
+	if _, ok := s.Lookup(netip.MustParseAddr("192.0.2.1"), -time.Second); ok {
+		t.Error("Lookup returned a Result older than maxAge")
+	}
+}
+
+func TestFollowRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	appendFile(t, path, accessLine1+"\n")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var ips []string
+	err := Follow(ctx, path, ParseAccessLog, NewState(), func(e Entry) {
+		ips = append(ips, e.IP.String())
+		switch len(ips) {
+		case 1:
+			// rotated by renaming, with a last line written to the
+			// old file
+			appendFile(t, path, accessLine2+"\n")
+			if err := os.Rename(path, path+".1"); err != nil {
+				t.Fatal(err)
+			}
+			appendFile(t, path, accessLine3+"\n")
+		case 3:
+			cancel()
+		}
+	})
+	if err != context.Canceled {
+		t.Fatalf("Follow() = %v after %v", err, ips)
+	}
+	if len(ips) != 3 || ips[1] != "192.0.2.2" || ips[2] != "192.0.2.3" {
+		t.Errorf("entries %v, want the rest of the old file before the new one", ips)
+	}
+}
+
+func TestLoadStateMalformed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte(`{"files": [`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadState(path); err == nil {
+		t.Error("LoadState of a malformed file succeeded")
+	}
+}
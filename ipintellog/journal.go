@@ -0,0 +1,32 @@
+package ipintellog
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// Journal returns a Parser for the JSON export of journald, as written
+// by "journalctl -o json", parsing the MESSAGE field of an entry with
+// parse, e.g. ParseSSHAuth for "journalctl -u ssh -o json". The time of
+// the Entry is the time the journal received the message.
+func Journal(parse Parser) Parser {
+	return func(line string) (Entry, bool) {
+		var v struct {
+			// binary messages are arrays instead and fail to decode
+			Message   string `json:"MESSAGE"`
+			Timestamp string `json:"__REALTIME_TIMESTAMP"`
+		}
+		if err := json.Unmarshal([]byte(line), &v); err != nil {
+			return Entry{}, false
+		}
+		e, ok := parse(v.Message)
+		if !ok {
+			return Entry{}, false
+		}
+		if us, err := strconv.ParseInt(v.Timestamp, 10, 64); err == nil {
+			e.Time = time.UnixMicro(us)
+		}
+		return e, true
+	}
+}
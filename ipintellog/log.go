@@ -0,0 +1,138 @@
+// Package ipintellog finds the client IPs in log files, packet captures
+// and flow exports and scores them, to tell which traffic came from
+// proxies.
+//
+// Example:
+//
+//	t := ipintellog.NewTally()
+//	if err := t.Read(f, ipintellog.ParseAccessLog); err != nil {
+//		...
+//	}
+//	sources := t.Sources()
+//	ipintellog.Score(ctx, c, sources)
+package ipintellog
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/netip"
+	"sort"
+	"time"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+)
+
+// Entry is a log line attributed to a client IP.
+type Entry struct {
+	IP netip.Addr
+	// Time of the line, zero if the format has none
+	Time time.Time
+	// Format specific summary of the line, e.g. the request line
+	Text string
+}
+
+// Parser parses a line of a log format, reporting false for lines that
+// aren't in the format or have no client IP.
+type Parser func(line string) (Entry, bool)
+
+// Source is a client IP found in a log.
+type Source struct {
+	IP netip.Addr
+	// Number of entries of the IP
+	Count       int
+	First, Last time.Time
+	// Text of the first entry
+	Sample string
+
+	// Lookup outcome, set by Score
+	Result ipintel.Result
+	Err    error
+}
+
+// Proxy reports whether s was looked up and scored at least threshold.
+func (s *Source) Proxy(threshold float32) bool {
+	return s.Err == nil && !s.Result.QueriedAt.IsZero() && s.Result.Score >= threshold
+}
+
+// Tally counts the entries of each client IP. IPs that aren't globally
+// routable, like private and loopback addresses, can't be looked up and
+// are only counted in Skipped.
+type Tally struct {
+	sources map[netip.Addr]*Source
+	// Number of lines (or packets and flows) read, of those not parsed,
+	// and of entries with an IP that isn't globally routable
+	Lines, Unparsed, Skipped int
+}
+
+// NewTally returns an empty Tally.
+func NewTally() *Tally {
+	return &Tally{sources: make(map[netip.Addr]*Source)}
+}
+
+// Add counts e.
+func (t *Tally) Add(e Entry) {
+	ip := e.IP.Unmap().WithZone("")
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		t.Skipped++
+		return
+	}
+	s, ok := t.sources[ip]
+	if !ok {
+		s = &Source{IP: ip, First: e.Time, Sample: e.Text}
+		t.sources[ip] = s
+	}
+	s.Count++
+	if !e.Time.IsZero() {
+		if s.First.IsZero() || e.Time.Before(s.First) {
+			s.First = e.Time
+		}
+		if e.Time.After(s.Last) {
+			s.Last = e.Time
+		}
+	}
+}
+
+// Read parses the lines of r with parse and adds the entries.
+func (t *Tally) Read(r io.Reader, parse Parser) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	for sc.Scan() {
+		t.Lines++
+		if e, ok := parse(sc.Text()); ok {
+			t.Add(e)
+		} else {
+			t.Unparsed++
+		}
+	}
+	return sc.Err()
+}
+
+// Sources returns the client IPs counted, those with the most entries
+// first.
+func (t *Tally) Sources() []*Source {
+	sources := make([]*Source, 0, len(t.sources))
+	for _, s := range t.sources {
+		sources = append(sources, s)
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		if sources[i].Count != sources[j].Count {
+			return sources[i].Count > sources[j].Count
+		}
+		return sources[i].IP.Less(sources[j].IP)
+	})
+	return sources
+}
+
+// Score looks up each source with c in turn, storing the outcome in it,
+// until ctx is done. Each IP costs a query unless c caches it, so the
+// order of sources decides which are scored when the quota runs out.
+func Score(ctx context.Context, c ipintel.Checker, sources []*Source) {
+	for _, s := range sources {
+		if ctx.Err() != nil {
+			s.Err = ctx.Err()
+			continue
+		}
+		s.Result, s.Err = c.GetProxyScore(ctx, s.IP.String())
+	}
+}
@@ -0,0 +1,92 @@
+package ipintellog
+
+import (
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// ParsePostfix parses a connection line of Postfix's smtpd or
+// postscreen, e.g.
+//
+//	Oct 10 13:55:36 mail postfix/smtpd[4242]: connect from unknown[192.0.2.1]
+//
+// so each connection from a client counts once. The message after the
+// program name is the Text of the Entry. Other lines are not parsed.
+func ParsePostfix(line string) (Entry, bool) {
+	i := strings.Index(line, "postfix")
+	if i < 0 {
+		return Entry{}, false
+	}
+	j := strings.Index(line[i:], ": ")
+	if j < 0 {
+		return Entry{}, false
+	}
+	prog, msg := line[i:i+j], line[i+j+2:]
+	if !strings.Contains(prog, "/smtpd[") && !strings.Contains(prog, "/postscreen[") {
+		return Entry{}, false
+	}
+	// postscreen logs "CONNECT from"
+	if !strings.HasPrefix(strings.ToLower(msg), "connect from ") {
+		return Entry{}, false
+	}
+	ip, ok := bracketedIP(msg)
+	if !ok {
+		return Entry{}, false
+	}
+	return Entry{IP: ip, Time: syslogTime(line[:i]), Text: msg}, true
+}
+
+// eximTimeLayout is the timestamp at the start of Exim's main log lines.
+const eximTimeLayout = "2006-01-02 15:04:05"
+
+// ParseExim parses a line of Exim's main log about a message received
+// from (<=) or rejected for a remote host, e.g.
+//
+//	2024-10-10 13:55:36 1sX5Yz-000123-AB <= a@example.com H=(helo) [192.0.2.1] P=esmtp S=1234
+//
+// The IP is that of the H= field; deliveries to remote hosts are not
+// parsed. The line after the timestamp is the Text of the Entry.
+func ParseExim(line string) (Entry, bool) {
+	if len(line) < len(eximTimeLayout)+1 {
+		return Entry{}, false
+	}
+	t, err := time.ParseInLocation(eximTimeLayout, line[:len(eximTimeLayout)], time.Local)
+	if err != nil {
+		return Entry{}, false
+	}
+	msg := line[len(eximTimeLayout)+1:]
+	if !strings.Contains(msg, " <= ") && !strings.Contains(msg, "rejected") && !strings.Contains(msg, "SMTP connection from") {
+		return Entry{}, false
+	}
+	h := strings.Index(msg, "H=")
+	if h < 0 {
+		h = strings.Index(msg, "SMTP connection from")
+	}
+	if h < 0 {
+		return Entry{}, false
+	}
+	ip, ok := bracketedIP(msg[h:])
+	if !ok {
+		return Entry{}, false
+	}
+	return Entry{IP: ip, Time: t, Text: msg}, true
+}
+
+// bracketedIP returns the first IP enclosed in brackets in s.
+func bracketedIP(s string) (netip.Addr, bool) {
+	for {
+		i := strings.IndexByte(s, '[')
+		if i < 0 {
+			return netip.Addr{}, false
+		}
+		j := strings.IndexByte(s[i:], ']')
+		if j < 0 {
+			return netip.Addr{}, false
+		}
+		if ip, err := netip.ParseAddr(strings.TrimPrefix(s[i+1:i+j], "IPv6:")); err == nil {
+			return ip, true
+		}
+		s = s[i+j:]
+	}
+}
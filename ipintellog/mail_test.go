@@ -0,0 +1,64 @@
+package ipintellog
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestParsePostfix(t *testing.T) {
+	for _, tt := range []struct {
+		line string
+		ip   string
+	}{
+		{"Oct 10 13:55:36 mail postfix/smtpd[4242]: connect from unknown[192.0.2.1]", "192.0.2.1"},
+		{"Oct 10 13:55:36 mail postfix/smtpd[4242]: connect from mx.example.com[2001:db8::25]", "2001:db8::25"},
+		{"Mar  5 08:01:02 mx postfix/postscreen[311]: CONNECT from [198.51.100.3]:50123 to [203.0.113.1]:25", "198.51.100.3"},
+		{"Mar  5 08:01:02 mx postfix/submission/smtpd[311]: connect from client.example.net[203.0.113.50]", "203.0.113.50"},
+		// other messages and programs
+		{"Oct 10 13:55:36 mail postfix/smtpd[4242]: disconnect from unknown[192.0.2.1] ehlo=1 quit=1 commands=2", ""},
+		{"Oct 10 13:55:36 mail postfix/smtp[4243]: connect from unknown[192.0.2.1]", ""},
+		{"Oct 10 13:55:36 mail postfix/smtpd[4242]: connect from unknown[unknown]", ""},
+		{"Oct 10 13:55:36 mail postfix/smtpd[4242] connect from unknown[192.0.2.1]", ""},
+		{"Oct 10 13:55:36 host sshd[4242]: connect from unknown[192.0.2.1]", ""},
+	} {
+		e, ok := ParsePostfix(tt.line)
+		if ok != (tt.ip != "") {
+			t.Errorf("ParsePostfix(%q) ok = %v, want %v", tt.line, ok, tt.ip != "")
+			continue
+		}
+		if ok && (e.IP != netip.MustParseAddr(tt.ip) || e.Time.IsZero()) {
+			t.Errorf("ParsePostfix(%q) = %+v, want IP %s and a time", tt.line, e, tt.ip)
+		}
+	}
+}
+
+func TestParseExim(t *testing.T) {
+	for _, tt := range []struct {
+		line string
+		ip   string
+	}{
+		{"2024-10-10 13:55:36 1sX5Yz-000123-AB <= a@example.com H=(helo) [192.0.2.1] P=esmtp S=1234", "192.0.2.1"},
+		{"2024-10-10 13:55:36 1sX5Yz-000123-AB <= b@example.org H=mail.example.org [IPv6:2001:db8::25]:41234 P=esmtps S=4321", "2001:db8::25"},
+		{"2024-10-10 13:55:37 H=(spammer) [198.51.100.9] F=<x@example.net> rejected RCPT <y@example.com>: relay not permitted", "198.51.100.9"},
+		{"2024-10-10 13:55:38 SMTP connection from [203.0.113.4]:51000 (TCP/IP connection count = 1)", "203.0.113.4"},
+		// deliveries, lines without a host and malformed lines
+		{"2024-10-10 13:55:39 1sX5Yz-000123-AB => c@example.com R=dnslookup T=remote_smtp H=mx.example.com [192.0.2.25]", ""},
+		{"2024-10-10 13:55:39 1sX5Yz-000123-AB <= <> R=1sX5Yz-000122-AB U=exim P=local S=900", ""},
+		{"2024-99-10 13:55:36 1sX5Yz-000123-AB <= a@example.com H=(helo) [192.0.2.1] P=esmtp", ""},
+		{"2024-10-10 13:55", ""},
+	} {
+		e, ok := ParseExim(tt.line)
+		if ok != (tt.ip != "") {
+			t.Errorf("ParseExim(%q) ok = %v, want %v", tt.line, ok, tt.ip != "")
+			continue
+		}
+		if !ok {
+			continue
+		}
+		want := time.Date(2024, 10, 10, 13, 55, 0, 0, time.Local)
+		if e.IP != netip.MustParseAddr(tt.ip) || !e.Time.Truncate(time.Minute).Equal(want) {
+			t.Errorf("ParseExim(%q) = %+v, want IP %s at %v", tt.line, e, tt.ip, want)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package ipintellog
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"time"
+)
+
+// Information elements of NetFlow v9 and IPFIX carrying addresses.
+const (
+	ieSrcIPv4 = 8
+	ieDstIPv4 = 12
+	ieSrcIPv6 = 27
+	ieDstIPv6 = 28
+)
+
+// FlowDecoder decodes NetFlow v5, v9 and IPFIX export packets, e.g. as
+// received on a collector's UDP socket, into the Tally, adding an Entry
+// for the source and destination IP of each flow record. NetFlow v9 and
+// IPFIX records are only understood once their template arrived, so the
+// same FlowDecoder must be used for all packets of an exporter.
+type FlowDecoder struct {
+	tally *Tally
+	// templates by exporter source ID and template ID
+	templates map[[2]uint32][]flowField
+}
+
+type flowField struct {
+	id, length uint16
+}
+
+// NewFlowDecoder returns a FlowDecoder adding the flows to t.
+func (t *Tally) NewFlowDecoder() *FlowDecoder {
+	return &FlowDecoder{tally: t, templates: make(map[[2]uint32][]flowField)}
+}
+
+// Decode decodes an export packet.
+func (d *FlowDecoder) Decode(p []byte) error {
+	if len(p) < 4 {
+		return fmt.Errorf("Short flow packet")
+	}
+	switch v := binary.BigEndian.Uint16(p); v {
+	case 5:
+		return d.decodeV5(p)
+	case 9:
+		if len(p) < 20 {
+			return fmt.Errorf("Short flow packet")
+		}
+		t := time.Unix(int64(binary.BigEndian.Uint32(p[8:12])), 0)
+		d.decodeSets(binary.BigEndian.Uint32(p[16:20]), t, p[20:], 0, 1)
+		return nil
+	case 10:
+		if len(p) < 16 {
+			return fmt.Errorf("Short flow packet")
+		}
+		if n := int(binary.BigEndian.Uint16(p[2:4])); n <= len(p) {
+			p = p[:n]
+		}
+		t := time.Unix(int64(binary.BigEndian.Uint32(p[4:8])), 0)
+		d.decodeSets(binary.BigEndian.Uint32(p[12:16]), t, p[16:], 2, 3)
+		return nil
+	default:
+		return fmt.Errorf("Unsupported flow version %d", v)
+	}
+}
+
+func (d *FlowDecoder) decodeV5(p []byte) error {
+	const header, record = 24, 48
+	if len(p) < header {
+		return fmt.Errorf("Short flow packet")
+	}
+	count := int(binary.BigEndian.Uint16(p[2:4]))
+	t := time.Unix(int64(binary.BigEndian.Uint32(p[8:12])), 0)
+	for i := 0; i < count && header+(i+1)*record <= len(p); i++ {
+		r := p[header+i*record:]
+		d.tally.Lines++
+		d.tally.Add(Entry{IP: netip.AddrFrom4([4]byte(r[0:4])), Time: t})
+		d.tally.Add(Entry{IP: netip.AddrFrom4([4]byte(r[4:8])), Time: t})
+	}
+	return nil
+}
+
+// decodeSets decodes the flowsets of a v9 or IPFIX packet; the set IDs
+// of templates differ between both, options templates are skipped.
+func (d *FlowDecoder) decodeSets(source uint32, t time.Time, p []byte, templateSet, optionsSet uint16) {
+	for len(p) >= 4 {
+		id, n := binary.BigEndian.Uint16(p), int(binary.BigEndian.Uint16(p[2:]))
+		if n < 4 || n > len(p) {
+			return
+		}
+		body := p[4:n]
+		p = p[n:]
+		switch {
+		case id == templateSet:
+			d.readTemplates(source, body)
+		case id == optionsSet || id < 256:
+		default:
+			d.readRecords(d.templates[[2]uint32{source, uint32(id)}], t, body)
+		}
+	}
+}
+
+func (d *FlowDecoder) readTemplates(source uint32, p []byte) {
+	for len(p) >= 4 {
+		id, count := binary.BigEndian.Uint16(p), int(binary.BigEndian.Uint16(p[2:]))
+		p = p[4:]
+		fields := make([]flowField, 0, count)
+		for i := 0; i < count && len(p) >= 4; i++ {
+			f := flowField{id: binary.BigEndian.Uint16(p), length: binary.BigEndian.Uint16(p[2:])}
+			p = p[4:]
+			// IPFIX enterprise-specific field, followed by the
+			// enterprise number
+			if f.id&0x8000 != 0 && len(p) >= 4 {
+				p = p[4:]
+			}
+			fields = append(fields, f)
+		}
+		d.templates[[2]uint32{source, uint32(id)}] = fields
+	}
+}
+
+func (d *FlowDecoder) readRecords(fields []flowField, t time.Time, p []byte) {
+	size := 0
+	for _, f := range fields {
+		// variable-length IPFIX fields can't be stepped over
+		if f.length == 0xffff {
+			return
+		}
+		size += int(f.length)
+	}
+	if size == 0 {
+		return
+	}
+	for ; len(p) >= size; p = p[size:] {
+		d.tally.Lines++
+		off := 0
+		for _, f := range fields {
+			v := p[off : off+int(f.length)]
+			off += int(f.length)
+			switch {
+			case (f.id == ieSrcIPv4 || f.id == ieDstIPv4) && len(v) == 4:
+				d.tally.Add(Entry{IP: netip.AddrFrom4([4]byte(v)), Time: t})
+			case (f.id == ieSrcIPv6 || f.id == ieDstIPv6) && len(v) == 16:
+				d.tally.Add(Entry{IP: netip.AddrFrom16([16]byte(v)), Time: t})
+			}
+		}
+	}
+}
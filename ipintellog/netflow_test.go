@@ -0,0 +1,163 @@
+package ipintellog
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+var flowTime = time.Date(2024, 3, 5, 8, 0, 0, 0, time.UTC)
+
+// netflowV5 returns a NetFlow v5 packet with a record per pair of IPs.
+func netflowV5(ips ...string) []byte {
+	p := binary.BigEndian.AppendUint16(nil, 5)
+	p = binary.BigEndian.AppendUint16(p, uint16(len(ips)/2))
+	p = binary.BigEndian.AppendUint32(p, 0)
+	p = binary.BigEndian.AppendUint32(p, uint32(flowTime.Unix()))
+	p = append(p, make([]byte, 12)...)
+	for i := 0; i+1 < len(ips); i += 2 {
+		r := make([]byte, 48)
+		copy(r, netip.MustParseAddr(ips[i]).AsSlice())
+		copy(r[4:], netip.MustParseAddr(ips[i+1]).AsSlice())
+		p = append(p, r...)
+	}
+	return p
+}
+
+// flowSet returns a flowset of id holding body.
+func flowSet(id uint16, body []byte) []byte {
+	s := binary.BigEndian.AppendUint16(nil, id)
+	s = binary.BigEndian.AppendUint16(s, uint16(4+len(body)))
+	return append(s, body...)
+}
+
+// template returns a template record of id with fields of element
+// IDs and lengths.
+func template(id uint16, fields ...uint16) []byte {
+	t := binary.BigEndian.AppendUint16(nil, id)
+	t = binary.BigEndian.AppendUint16(t, uint16(len(fields)/2))
+	for _, f := range fields {
+		t = binary.BigEndian.AppendUint16(t, f)
+	}
+	return t
+}
+
+// addrs returns the concatenated bytes of ips.
+func addrs(ips ...string) []byte {
+	var b []byte
+	for _, ip := range ips {
+		b = append(b, netip.MustParseAddr(ip).AsSlice()...)
+	}
+	return b
+}
+
+// netflowV9 returns a NetFlow v9 packet of exporter source holding sets.
+func netflowV9(source uint32, sets ...[]byte) []byte {
+	p := binary.BigEndian.AppendUint16(nil, 9)
+	p = binary.BigEndian.AppendUint16(p, uint16(len(sets)))
+	p = binary.BigEndian.AppendUint32(p, 0)
+	p = binary.BigEndian.AppendUint32(p, uint32(flowTime.Unix()))
+	p = binary.BigEndian.AppendUint32(p, 1)
+	p = binary.BigEndian.AppendUint32(p, source)
+	for _, s := range sets {
+		p = append(p, s...)
+	}
+	return p
+}
+
+// ipfix returns an IPFIX message of observation domain source holding
+// sets.
+func ipfix(source uint32, sets ...[]byte) []byte {
+	var body []byte
+	for _, s := range sets {
+		body = append(body, s...)
+	}
+	p := binary.BigEndian.AppendUint16(nil, 10)
+	p = binary.BigEndian.AppendUint16(p, uint16(16+len(body)))
+	p = binary.BigEndian.AppendUint32(p, uint32(flowTime.Unix()))
+	p = binary.BigEndian.AppendUint32(p, 1)
+	p = binary.BigEndian.AppendUint32(p, source)
+	return append(p, body...)
+}
+
+func TestFlowDecoder(t *testing.T) {
+	tmpl4 := template(256, ieSrcIPv4, 4, ieDstIPv4, 4, 2, 4) // addresses and packet count
+	tmpl6 := template(300, ieSrcIPv6, 16, ieDstIPv6, 16)
+	for _, tt := range []struct {
+		name    string
+		packets [][]byte
+		want    []string
+		lines   int
+	}{
+		{"v5", [][]byte{netflowV5("192.0.2.1", "198.51.100.2", "203.0.113.3", "10.1.1.1")},
+			[]string{"192.0.2.1", "198.51.100.2", "203.0.113.3"}, 2},
+		{"v9", [][]byte{
+			netflowV9(7, flowSet(0, tmpl4)),
+			netflowV9(7, flowSet(256, append(addrs("192.0.2.1", "198.51.100.2"), 0, 0, 0, 9))),
+		}, []string{"192.0.2.1", "198.51.100.2"}, 1},
+		// data before its template, or of another exporter, is skipped
+		{"v9 without template", [][]byte{
+			netflowV9(7, flowSet(256, append(addrs("192.0.2.1", "198.51.100.2"), 0, 0, 0, 9))),
+			netflowV9(7, flowSet(0, tmpl4)),
+			netflowV9(8, flowSet(256, append(addrs("192.0.2.7", "198.51.100.7"), 0, 0, 0, 9))),
+		}, nil, 0},
+		{"ipfix", [][]byte{ipfix(1,
+			flowSet(2, tmpl6),
+			flowSet(3, template(400, 1, 4)),
+			flowSet(300, addrs("2001:db8::1", "2001:db8::2", "2001:db8::3", "2001:db8::4")),
+		)}, []string{"2001:db8::1", "2001:db8::2", "2001:db8::3", "2001:db8::4"}, 2},
+	} {
+		tally := NewTally()
+		d := tally.NewFlowDecoder()
+		for _, p := range tt.packets {
+			if err := d.Decode(p); err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+		}
+		if tally.Lines != tt.lines {
+			t.Errorf("%s: %d flows, want %d", tt.name, tally.Lines, tt.lines)
+		}
+		if got := tally.Sources(); len(got) != len(tt.want) {
+			t.Errorf("%s: %d sources, want %v", tt.name, len(got), tt.want)
+			continue
+		}
+		for _, ip := range tt.want {
+			if s := tally.sources[netip.MustParseAddr(ip)]; s == nil || !s.First.Equal(flowTime) {
+				t.Errorf("%s: source %s = %+v, want one seen at %v", tt.name, ip, s, flowTime)
+			}
+		}
+	}
+}
+
+func TestFlowDecoderMalformed(t *testing.T) {
+	for name, p := range map[string][]byte{
+		"empty":     nil,
+		"v5 header": netflowV5()[:20],
+		"v9 header": netflowV9(1)[:12],
+		"ipfix":     ipfix(1)[:10],
+		"version 1": {0, 1, 0, 0, 0, 0, 0, 0},
+	} {
+		if err := NewTally().NewFlowDecoder().Decode(p); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+	// bad set lengths and records cut short are dropped
+	tally := NewTally()
+	d := tally.NewFlowDecoder()
+	bad := flowSet(0, template(256, ieSrcIPv4, 4))
+	binary.BigEndian.PutUint16(bad[2:], 200)
+	for _, p := range [][]byte{
+		netflowV5("192.0.2.1", "192.0.2.2")[:30],
+		netflowV9(1, bad),
+		netflowV9(1, flowSet(0, template(256, ieSrcIPv4, 4, ieDstIPv4, 4)), flowSet(256, addrs("192.0.2.1"))),
+		ipfix(1, flowSet(2, template(256, ieSrcIPv4, 0xffff)), flowSet(256, addrs("192.0.2.1"))),
+	} {
+		if err := d.Decode(p); err != nil {
+			t.Errorf("Decode() = %v", err)
+		}
+	}
+	if n := len(tally.Sources()); n != 0 {
+		t.Errorf("%d sources from malformed packets, want 0", n)
+	}
+}
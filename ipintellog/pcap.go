@@ -0,0 +1,118 @@
+package ipintellog
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/netip"
+	"time"
+)
+
+// Link types of pcap files understood by ReadPcap.
+const (
+	linkEthernet = 1
+	linkRaw      = 101
+	linkLinuxSLL = 113
+)
+
+// ReadPcap adds an Entry for the source and destination IP of each IPv4
+// and IPv6 packet in the pcap file read from r, with the packet's
+// capture time, so the Tally counts the packets of each IP. Ethernet
+// (including VLAN tagged), raw IP and Linux cooked captures are
+// understood; pcapng files are not, convert them with
+// "editcap -F pcap".
+//
+// Only globally routable IPs are counted by the Tally, which leaves
+// the external peers of a capture taken inside a private network.
+func (t *Tally) ReadPcap(r io.Reader) error {
+	var hdr [24]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return fmt.Errorf("Failed to read pcap header: %w", err)
+	}
+	var order binary.ByteOrder
+	nano := false
+	switch magic := binary.LittleEndian.Uint32(hdr[:4]); magic {
+	case 0xa1b2c3d4, 0xa1b23c4d:
+		order = binary.LittleEndian
+		nano = magic == 0xa1b23c4d
+	case 0xd4c3b2a1, 0x4d3cb2a1:
+		order = binary.BigEndian
+		nano = magic == 0x4d3cb2a1
+	default:
+		return fmt.Errorf("Not a pcap file")
+	}
+	link := order.Uint32(hdr[20:24]) & 0xffff
+
+	var rec [16]byte
+	buf := make([]byte, 0, 65536)
+	for {
+		if _, err := io.ReadFull(r, rec[:]); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("Failed to read packet: %w", err)
+		}
+		sec, frac := int64(order.Uint32(rec[0:4])), int64(order.Uint32(rec[4:8]))
+		if !nano {
+			frac *= 1000
+		}
+		n := order.Uint32(rec[8:12])
+		if n > 1<<24 {
+			return fmt.Errorf("Invalid packet length %d", n)
+		}
+		if cap(buf) < int(n) {
+			buf = make([]byte, n)
+		}
+		buf = buf[:n]
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return fmt.Errorf("Failed to read packet: %w", err)
+		}
+		t.Lines++
+		src, dst, ok := packetIPs(link, buf)
+		if !ok {
+			t.Unparsed++
+			continue
+		}
+		at := time.Unix(sec, frac)
+		t.Add(Entry{IP: src, Time: at})
+		t.Add(Entry{IP: dst, Time: at})
+	}
+}
+
+// packetIPs returns the source and destination IP of a captured packet.
+func packetIPs(link uint32, p []byte) (src, dst netip.Addr, ok bool) {
+	var etherType uint16
+	switch link {
+	case linkEthernet:
+		if len(p) < 14 {
+			return
+		}
+		etherType, p = binary.BigEndian.Uint16(p[12:14]), p[14:]
+		// 802.1Q and 802.1ad tags
+		for (etherType == 0x8100 || etherType == 0x88a8) && len(p) >= 4 {
+			etherType, p = binary.BigEndian.Uint16(p[2:4]), p[4:]
+		}
+	case linkLinuxSLL:
+		if len(p) < 16 {
+			return
+		}
+		etherType, p = binary.BigEndian.Uint16(p[14:16]), p[16:]
+	case linkRaw:
+		if len(p) == 0 {
+			return
+		}
+		etherType = 0x0800
+		if p[0]>>4 == 6 {
+			etherType = 0x86dd
+		}
+	default:
+		return
+	}
+
+	switch {
+	case etherType == 0x0800 && len(p) >= 20 && p[0]>>4 == 4:
+		return netip.AddrFrom4([4]byte(p[12:16])), netip.AddrFrom4([4]byte(p[16:20])), true
+	case etherType == 0x86dd && len(p) >= 40 && p[0]>>4 == 6:
+		return netip.AddrFrom16([16]byte(p[8:24])), netip.AddrFrom16([16]byte(p[24:40])), true
+	}
+	return
+}
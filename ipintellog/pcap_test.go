@@ -0,0 +1,121 @@
+package ipintellog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+// pcapFile returns a little-endian pcap file of link type link holding
+// packets captured at at.
+func pcapFile(link uint32, at time.Time, packets ...[]byte) []byte {
+	b := binary.LittleEndian.AppendUint32(nil, 0xa1b2c3d4)
+	b = binary.LittleEndian.AppendUint16(b, 2)
+	b = binary.LittleEndian.AppendUint16(b, 4)
+	b = append(b, make([]byte, 8)...)
+	b = binary.LittleEndian.AppendUint32(b, 65535)
+	b = binary.LittleEndian.AppendUint32(b, link)
+	for _, p := range packets {
+		b = binary.LittleEndian.AppendUint32(b, uint32(at.Unix()))
+		b = binary.LittleEndian.AppendUint32(b, uint32(at.Nanosecond()/1000))
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(p)))
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(p)))
+		b = append(b, p...)
+	}
+	return b
+}
+
+// ipv4Packet returns the header of an IPv4 packet from src to dst.
+func ipv4Packet(src, dst string) []byte {
+	p := make([]byte, 20)
+	p[0] = 0x45
+	copy(p[12:], netip.MustParseAddr(src).AsSlice())
+	copy(p[16:], netip.MustParseAddr(dst).AsSlice())
+	return p
+}
+
+// ipv6Packet returns the header of an IPv6 packet from src to dst.
+func ipv6Packet(src, dst string) []byte {
+	p := make([]byte, 40)
+	p[0] = 0x60
+	copy(p[8:], netip.MustParseAddr(src).AsSlice())
+	copy(p[24:], netip.MustParseAddr(dst).AsSlice())
+	return p
+}
+
+// ethernet returns p in an Ethernet frame of etherType, after the VLAN
+// tags given.
+func ethernet(etherType uint16, p []byte, vlans ...uint16) []byte {
+	f := make([]byte, 12)
+	for _, id := range vlans {
+		f = binary.BigEndian.AppendUint16(f, 0x8100)
+		f = binary.BigEndian.AppendUint16(f, id)
+	}
+	f = binary.BigEndian.AppendUint16(f, etherType)
+	return append(f, p...)
+}
+
+func TestReadPcap(t *testing.T) {
+	at := time.Date(2024, 3, 5, 8, 1, 2, 123000, time.UTC)
+	sll := append(make([]byte, 14), 0x08, 0x00)
+	for _, tt := range []struct {
+		name     string
+		file     []byte
+		want     []string
+		unparsed int
+	}{
+		{"ethernet", pcapFile(linkEthernet, at,
+			ethernet(0x0800, ipv4Packet("192.0.2.1", "198.51.100.2")),
+			ethernet(0x86dd, ipv6Packet("2001:db8::1", "2001:db8::2"), 42),
+			// ARP and a truncated frame
+			ethernet(0x0806, make([]byte, 28)),
+			make([]byte, 10),
+		), []string{"192.0.2.1", "198.51.100.2", "2001:db8::1", "2001:db8::2"}, 2},
+		{"raw", pcapFile(linkRaw, at, ipv4Packet("203.0.113.5", "10.0.0.1"), ipv6Packet("2001:db8::5", "fe80::1")),
+			[]string{"203.0.113.5", "2001:db8::5"}, 0},
+		{"linux cooked", pcapFile(linkLinuxSLL, at, append(sll, ipv4Packet("192.0.2.9", "192.168.1.1")...)),
+			[]string{"192.0.2.9"}, 0},
+		{"unknown link", pcapFile(147, at, ipv4Packet("192.0.2.1", "192.0.2.2")), nil, 1},
+	} {
+		tally := NewTally()
+		if err := tally.ReadPcap(bytes.NewReader(tt.file)); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if tally.Unparsed != tt.unparsed {
+			t.Errorf("%s: %d packets unparsed, want %d", tt.name, tally.Unparsed, tt.unparsed)
+		}
+		got := tally.Sources()
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: %d sources, want %v", tt.name, len(got), tt.want)
+			continue
+		}
+		for _, ip := range tt.want {
+			s := tally.sources[netip.MustParseAddr(ip)]
+			if s == nil || !s.First.Equal(at) {
+				t.Errorf("%s: source %s = %+v, want one seen at %v", tt.name, ip, s, at)
+			}
+		}
+	}
+}
+
+func TestReadPcapMalformed(t *testing.T) {
+	at := time.Unix(0, 0)
+	valid := pcapFile(linkRaw, at, ipv4Packet("192.0.2.1", "192.0.2.2"))
+	long := pcapFile(linkRaw, at, ipv4Packet("192.0.2.1", "192.0.2.2"))
+	binary.LittleEndian.PutUint32(long[24+8:], 1<<25)
+	for name, file := range map[string][]byte{
+		"empty":            nil,
+		"short header":     valid[:10],
+		"pcapng":           append([]byte{0x0a, 0x0d, 0x0d, 0x0a}, valid[4:]...),
+		"truncated record": valid[:len(valid)-5],
+		"truncated packet": valid[:24+10],
+		"huge packet":      long,
+	} {
+		if err := NewTally().ReadPcap(bytes.NewReader(file)); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package ipintellog
+
+import (
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// sshFailures are the markers of sshd and PAM messages about failed
+// logins.
+var sshFailures = []string{
+	"Failed password",
+	"Failed publickey",
+	"Failed keyboard-interactive",
+	"Invalid user",
+	"authentication failure",
+	"maximum authentication attempts exceeded",
+	"Did not receive identification string",
+}
+
+// ParseSSHAuth parses an sshd failure line of an auth.log or secure
+// log, e.g.
+//
+//	Oct 10 13:55:36 host sshd[4242]: Failed password for root from 192.0.2.1 port 52144 ssh2
+//
+// The message after the program name is the Text of the Entry. Other
+// lines are not parsed. Traditional syslog timestamps lack the year,
+// which is taken to be the current one; RFC 3339 timestamps, as
+// written by rsyslog's high-precision format, are understood as well.
+func ParseSSHAuth(line string) (Entry, bool) {
+	var e Entry
+	msg := line
+	if i := strings.Index(line, "sshd"); i >= 0 {
+		if j := strings.Index(line[i:], ": "); j >= 0 {
+			e.Time = syslogTime(line[:i])
+			msg = line[i+j+2:]
+		}
+	}
+	failed := false
+	for _, m := range sshFailures {
+		if strings.Contains(msg, m) {
+			failed = true
+			break
+		}
+	}
+	if !failed {
+		return Entry{}, false
+	}
+	ip, ok := sshSource(msg)
+	if !ok {
+		return Entry{}, false
+	}
+	e.IP, e.Text = ip, msg
+	return e, true
+}
+
+// sshSource returns the IP after " from " or PAM's "rhost=".
+func sshSource(msg string) (netip.Addr, bool) {
+	for _, marker := range []string{" from ", "rhost="} {
+		i := strings.LastIndex(msg, marker)
+		if i < 0 {
+			continue
+		}
+		field, _, _ := strings.Cut(msg[i+len(marker):], " ")
+		if ip, err := netip.ParseAddr(field); err == nil {
+			return ip, true
+		}
+	}
+	return netip.Addr{}, false
+}
+
+// syslogTime parses the timestamp at the start of a syslog line
+// prefix, returning zero if there is none.
+func syslogTime(prefix string) time.Time {
+	prefix = strings.TrimSpace(prefix)
+	if first, _, _ := strings.Cut(prefix, " "); len(first) > 0 && first[0] >= '0' && first[0] <= '9' {
+		t, _ := time.Parse(time.RFC3339Nano, first)
+		return t
+	}
+	if len(prefix) < len(time.Stamp) {
+		return time.Time{}
+	}
+	t, err := time.ParseInLocation(time.Stamp, prefix[:len(time.Stamp)], time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	now := time.Now()
+	t = t.AddDate(now.Year(), 0, 0)
+	// a line from late December read in January
+	if t.After(now.Add(24 * time.Hour)) {
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t
+}
@@ -0,0 +1,89 @@
+package ipintellog
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestParseSSHAuth(t *testing.T) {
+	for _, tt := range []struct {
+		line string
+		ip   string
+		text string
+	}{
+		{
+			line: "Oct 10 13:55:36 host sshd[4242]: Failed password for root from 192.0.2.1 port 52144 ssh2",
+			ip:   "192.0.2.1", text: "Failed password for root from 192.0.2.1 port 52144 ssh2",
+		},
+		{
+			line: "Mar  5 08:01:02 bastion sshd[981]: Invalid user admin from 2001:db8::7 port 40022",
+			ip:   "2001:db8::7", text: "Invalid user admin from 2001:db8::7 port 40022",
+		},
+		{
+			line: "2024-03-05T08:01:02.123456+00:00 bastion sshd[981]: Failed publickey for git from 198.51.100.4 port 1234 ssh2: ED25519 SHA256:abc",
+			ip:   "198.51.100.4", text: "Failed publickey for git from 198.51.100.4 port 1234 ssh2: ED25519 SHA256:abc",
+		},
+		{
+			line: "Mar  5 08:01:02 bastion sshd[981]: pam_unix(sshd:auth): authentication failure; logname= uid=0 euid=0 tty=ssh ruser= rhost=203.0.113.9  user=root",
+			ip:   "203.0.113.9", text: "pam_unix(sshd:auth): authentication failure; logname= uid=0 euid=0 tty=ssh ruser= rhost=203.0.113.9  user=root",
+		},
+		{
+			line: "Mar  5 08:01:02 bastion sshd[981]: Did not receive identification string from 192.0.2.200 port 55555",
+			ip:   "192.0.2.200", text: "Did not receive identification string from 192.0.2.200 port 55555",
+		},
+		// successes, failures without an IP and other lines
+		{line: "Oct 10 13:55:36 host sshd[4242]: Accepted publickey for deploy from 192.0.2.1 port 52144 ssh2"},
+		{line: "Oct 10 13:55:36 host sshd[4242]: Failed password for root from unknown port 52144 ssh2"},
+		{line: "Oct 10 13:55:36 host CRON[17]: pam_unix(cron:session): session opened for user root"},
+		{line: ""},
+	} {
+		e, ok := ParseSSHAuth(tt.line)
+		if ok != (tt.ip != "") {
+			t.Errorf("ParseSSHAuth(%q) ok = %v, want %v", tt.line, ok, tt.ip != "")
+			continue
+		}
+		if ok && (e.IP != netip.MustParseAddr(tt.ip) || e.Text != tt.text || e.Time.IsZero()) {
+			t.Errorf("ParseSSHAuth(%q) = %+v, want IP %s, text %q and a time", tt.line, e, tt.ip, tt.text)
+		}
+	}
+}
+
+func TestSyslogTime(t *testing.T) {
+	if got, want := syslogTime("2024-03-05T08:01:02.5+01:00 host "), time.Date(2024, 3, 5, 7, 1, 2, 5e8, time.UTC); !got.Equal(want) {
+		t.Errorf("RFC 3339 time = %v, want %v", got, want)
+	}
+	got := syslogTime("Oct 10 13:55:36 host ")
+	if got.Month() != time.October || got.Day() != 10 || got.Hour() != 13 || got.After(time.Now().Add(24*time.Hour)) {
+		t.Errorf("syslog time = %v, want Oct 10 13:55:36 of the last year passed", got)
+	}
+	for _, prefix := range []string{"", "Oct 10", "Foo 99 99:99:99 host ", "2024-99-99T00:00:00Z "} {
+		if got := syslogTime(prefix); !got.IsZero() {
+			t.Errorf("syslogTime(%q) = %v, want zero", prefix, got)
+		}
+	}
+}
+
+func TestJournal(t *testing.T) {
+	parse := Journal(ParseSSHAuth)
+	for _, tt := range []struct {
+		line string
+		ip   string
+	}{
+		{`{"__REALTIME_TIMESTAMP":"1709625662123456","_COMM":"sshd","MESSAGE":"Failed password for invalid user oracle from 192.0.2.33 port 4711 ssh2"}`, "192.0.2.33"},
+		{`{"__REALTIME_TIMESTAMP":"1709625662123456","MESSAGE":"Server listening on 0.0.0.0 port 22."}`, ""},
+		// binary messages are arrays of bytes
+		{`{"__REALTIME_TIMESTAMP":"1709625662123456","MESSAGE":[70,97,105,108]}`, ""},
+		{`{"MESSAGE": "Failed password for root from 192.0.2.1`, ""},
+		{`Oct 10 13:55:36 host sshd[4242]: Failed password for root from 192.0.2.1 port 52144 ssh2`, ""},
+	} {
+		e, ok := parse(tt.line)
+		if ok != (tt.ip != "") {
+			t.Errorf("Journal(%q) ok = %v, want %v", tt.line, ok, tt.ip != "")
+			continue
+		}
+		if ok && (e.IP != netip.MustParseAddr(tt.ip) || !e.Time.Equal(time.UnixMicro(1709625662123456))) {
+			t.Errorf("Journal(%q) = %+v, want IP %s at the journal time", tt.line, e, tt.ip)
+		}
+	}
+}
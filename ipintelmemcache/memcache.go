@@ -0,0 +1,250 @@
+// Package ipintelmemcache provides an ipintel.Cache storing Results in
+// memcached, for deployments already running it instead of Redis. It
+// speaks the memcached text protocol itself, without dependencies.
+//
+// Example:
+//
+//	cache, err := ipintelmemcache.NewCache([]string{"10.0.0.1:11211", "10.0.0.2:11211"})
+//	if err != nil {
+//		...
+//	}
+//	defer cache.Close()
+//	c := ipintel.NewClient("your@email.com", true, ipintel.Dynamic, 10*time.Second,
+//		ipintel.WithCache(cache, 24*time.Hour))
+package ipintelmemcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"time"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+	"github.com/pierelucas/go-ipintel/internal/hashring"
+)
+
+// DefaultPrefix is prepended to all keys unless changed with
+// WithPrefix.
+const DefaultPrefix = "ipintel:"
+
+// DefaultTimeout limits each operation unless changed with WithTimeout.
+const DefaultTimeout = 500 * time.Millisecond
+
+// maxRelative is the longest expiry memcached takes as a number of
+// seconds; larger values are read as a Unix time.
+const maxRelative = 30 * 24 * time.Hour
+
+// MaxInvalidateRange is the largest number of addresses InvalidateRange
+// deletes the keys of.
+const MaxInvalidateRange = 4096
+
+// Cache is an ipintel.Cache storing Results in memcached. Keys are
+// spread over the servers by consistent hashing, so adding or removing
+// a server only moves about its share of them. It is safe for
+// concurrent use.
+//
+// memcached can't list its keys, so Cache doesn't implement
+// ipintel.Purger; PurgeIP is available on its own.
+// InvalidateRange is limited to small ranges for the same reason.
+type Cache struct {
+	servers map[string]*server
+	ring    *hashring.Ring
+	prefix  string
+	flags   uint32
+	expiry  func(ttl time.Duration) int32
+	timeout time.Duration
+	codec   ipintel.Codec
+}
+
+var (
+	_ ipintel.Cache       = (*Cache)(nil)
+	_ ipintel.Invalidator = (*Cache)(nil)
+)
+
+// Option configures a Cache.
+type Option func(*Cache)
+
+// WithPrefix sets the prefix of all keys, DefaultPrefix by default,
+// e.g. to share servers between applications.
+func WithPrefix(prefix string) Option {
+	return func(c *Cache) {
+		c.prefix = prefix
+	}
+}
+
+// WithFlags sets the opaque flags stored with each item, 0 by default.
+// Items with other flags are treated as misses, so caches with
+// different flags, e.g. a format version, can share keys safely.
+func WithFlags(flags uint32) Option {
+	return func(c *Cache) {
+		c.flags = flags
+	}
+}
+
+// WithExpiry sets how a TTL is turned into a memcached expiration time,
+// e.g. to cap it below the server's eviction horizon. By default, TTLs
+// up to 30 days are passed as seconds, rounded up, and longer ones as
+// the Unix time they end at, as memcached expects.
+func WithExpiry(expiry func(ttl time.Duration) int32) Option {
+	return func(c *Cache) {
+		c.expiry = expiry
+	}
+}
+
+// WithTimeout limits each operation to d, DefaultTimeout by default,
+// or the deadline of its context if sooner.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Cache) {
+		c.timeout = d
+	}
+}
+
+// WithCodec sets the encoding of cached Results, ipintel.JSONCodec by
+// default. Caches sharing keys must use the same one, or different
+// flags (see WithFlags).
+func WithCodec(codec ipintel.Codec) Option {
+	return func(c *Cache) {
+		c.codec = codec
+	}
+}
+
+// NewCache returns a Cache using servers given as "host:port" or the
+// path of a Unix socket. Connections are made as needed.
+func NewCache(servers []string, opts ...Option) (*Cache, error) {
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("No memcached servers")
+	}
+	c := &Cache{
+		servers: make(map[string]*server, len(servers)),
+		ring:    hashring.New(servers...),
+		prefix:  DefaultPrefix,
+		expiry:  expiration,
+		timeout: DefaultTimeout,
+		codec:   ipintel.JSONCodec{},
+	}
+	for _, addr := range servers {
+		c.servers[addr] = &server{addr: addr}
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if !validKey(c.prefix + "score:") {
+		return nil, fmt.Errorf("Invalid prefix %q", c.prefix)
+	}
+	return c, nil
+}
+
+// Close closes the idle connections to the servers.
+func (c *Cache) Close() error {
+	for _, s := range c.servers {
+		s.close()
+	}
+	return nil
+}
+
+// key returns the memcached key of key and its server.
+func (c *Cache) key(key string) (string, *server, error) {
+	key = c.prefix + "score:" + key
+	if !validKey(key) {
+		return "", nil, fmt.Errorf("Invalid key %q", key)
+	}
+	return key, c.servers[c.ring.Pick(key)], nil
+}
+
+// expiration is the default expiry mapping.
+func expiration(ttl time.Duration) int32 {
+	if ttl <= 0 {
+		return 0
+	}
+	if ttl > maxRelative {
+		return int32(time.Now().Add(ttl).Unix())
+	}
+	return int32((ttl + time.Second - 1) / time.Second)
+}
+
+// Get returns the Result stored under key.
+func (c *Cache) Get(ctx context.Context, key string) (ipintel.Result, bool, error) {
+	key, s, err := c.key(key)
+	if err != nil {
+		return ipintel.Result{}, false, err
+	}
+	var it item
+	err = s.do(ctx, c.timeout, func(conn *conn) (err error) {
+		it, err = conn.get(key)
+		return err
+	})
+	if errors.Is(err, errMiss) {
+		return ipintel.Result{}, false, nil
+	} else if err != nil {
+		return ipintel.Result{}, false, err
+	}
+	if it.flags != c.flags {
+		return ipintel.Result{}, false, nil
+	}
+	res, err := c.codec.Unmarshal(it.value)
+	if err != nil {
+		return ipintel.Result{}, false, err
+	}
+	return res, true, nil
+}
+
+// Set stores res under key for ttl.
+func (c *Cache) Set(ctx context.Context, key string, res ipintel.Result, ttl time.Duration) error {
+	data, err := c.codec.Marshal(res)
+	if err != nil {
+		return err
+	}
+	key, s, err := c.key(key)
+	if err != nil {
+		return err
+	}
+	it := item{value: data, flags: c.flags, expiration: c.expiry(ttl)}
+	return s.do(ctx, c.timeout, func(conn *conn) error {
+		return conn.set(key, it)
+	})
+}
+
+// PurgeIP deletes the cached Results of ip for all check types.
+func (c *Cache) PurgeIP(ctx context.Context, ip string) (int, error) {
+	var n int
+	for _, check := range []ipintel.CheckType{ipintel.Static, ipintel.Dynamic} {
+		key, s, err := c.key(ipintel.CacheKey(ip, check))
+		if err != nil {
+			return n, err
+		}
+		err = s.do(ctx, c.timeout, func(conn *conn) error {
+			return conn.delete(key)
+		})
+		if errors.Is(err, errMiss) {
+			continue
+		} else if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Invalidate deletes the cached Results of ip, as PurgeIP.
+func (c *Cache) Invalidate(ctx context.Context, ip string) (int, error) {
+	return c.PurgeIP(ctx, ip)
+}
+
+// InvalidateRange deletes the cached Results of all IPs in prefix,
+// which may hold at most MaxInvalidateRange addresses, e.g. an IPv4 /20,
+// as their keys are deleted one by one.
+func (c *Cache) InvalidateRange(ctx context.Context, prefix netip.Prefix) (int, error) {
+	if bits := prefix.Addr().BitLen() - prefix.Bits(); bits > 12 {
+		return 0, fmt.Errorf("Range %s exceeds %d addresses", prefix, MaxInvalidateRange)
+	}
+	var n int
+	for addr := prefix.Masked().Addr(); prefix.Contains(addr); addr = addr.Next() {
+		purged, err := c.PurgeIP(ctx, addr.String())
+		n += purged
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
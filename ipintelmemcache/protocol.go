@@ -0,0 +1,212 @@
+package ipintelmemcache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxIdleConns is the number of idle connections kept per server.
+const maxIdleConns = 4
+
+// errMiss reports a key not stored on the server.
+var errMiss = errors.New("Cache miss")
+
+// server is a memcached server and its idle connections.
+type server struct {
+	addr string
+	mu   sync.Mutex
+	idle []*conn
+}
+
+type conn struct {
+	nc net.Conn
+	rw *bufio.ReadWriter
+}
+
+// item is a stored value and its flags.
+type item struct {
+	value      []byte
+	flags      uint32
+	expiration int32
+}
+
+// validKey reports whether key can be sent in the text protocol.
+func validKey(key string) bool {
+	if len(key) == 0 || len(key) > 250 {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// do runs fn on an idle or new connection to s, with a deadline of
+// timeout or the deadline of ctx if sooner. Connections are reused
+// unless fn fails with other than a protocol-level error.
+func (s *server) do(ctx context.Context, timeout time.Duration, fn func(*conn) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	c, err := s.conn(ctx, deadline)
+	if err != nil {
+		return err
+	}
+	c.nc.SetDeadline(deadline)
+	err = fn(c)
+	var perr protocolError
+	if err == nil || errors.Is(err, errMiss) || errors.As(err, &perr) {
+		s.release(c)
+	} else {
+		c.nc.Close()
+	}
+	return err
+}
+
+func (s *server) conn(ctx context.Context, deadline time.Time) (*conn, error) {
+	s.mu.Lock()
+	if n := len(s.idle); n > 0 {
+		c := s.idle[n-1]
+		s.idle = s.idle[:n-1]
+		s.mu.Unlock()
+		return c, nil
+	}
+	s.mu.Unlock()
+
+	network := "tcp"
+	if strings.Contains(s.addr, "/") {
+		network = "unix"
+	}
+	d := net.Dialer{Deadline: deadline}
+	nc, err := d.DialContext(ctx, network, s.addr)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{nc, bufio.NewReadWriter(bufio.NewReader(nc), bufio.NewWriter(nc))}, nil
+}
+
+func (s *server) release(c *conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.idle) >= maxIdleConns {
+		c.nc.Close()
+		return
+	}
+	s.idle = append(s.idle, c)
+}
+
+// close closes the idle connections of s.
+func (s *server) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.idle {
+		c.nc.Close()
+	}
+	s.idle = nil
+}
+
+// protocolError is an error reply of the server, after which the
+// connection is still usable.
+type protocolError string
+
+func (e protocolError) Error() string {
+	return "Memcached replied " + string(e)
+}
+
+// line reads a reply line without the trailing "\r\n", returning
+// error replies as protocolErrors.
+func (c *conn) line() (string, error) {
+	l, err := c.rw.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	l = strings.TrimSuffix(l, "\r\n")
+	if l == "ERROR" || strings.HasPrefix(l, "CLIENT_ERROR ") || strings.HasPrefix(l, "SERVER_ERROR ") {
+		return "", protocolError(l)
+	}
+	return l, nil
+}
+
+func (c *conn) get(key string) (item, error) {
+	fmt.Fprintf(c.rw, "get %s\r\n", key)
+	if err := c.rw.Flush(); err != nil {
+		return item{}, err
+	}
+	l, err := c.line()
+	if err != nil {
+		return item{}, err
+	}
+	if l == "END" {
+		return item{}, errMiss
+	}
+	// VALUE <key> <flags> <bytes>
+	fields := strings.Fields(l)
+	if len(fields) != 4 || fields[0] != "VALUE" || fields[1] != key {
+		return item{}, fmt.Errorf("Unexpected reply %q", l)
+	}
+	flags, err1 := strconv.ParseUint(fields[2], 10, 32)
+	size, err2 := strconv.Atoi(fields[3])
+	if err1 != nil || err2 != nil || size < 0 {
+		return item{}, fmt.Errorf("Unexpected reply %q", l)
+	}
+	data := make([]byte, size+2)
+	if _, err := io.ReadFull(c.rw, data); err != nil {
+		return item{}, err
+	}
+	if !bytes.HasSuffix(data, []byte("\r\n")) {
+		return item{}, fmt.Errorf("Corrupt value of %s", key)
+	}
+	if l, err := c.line(); err != nil || l != "END" {
+		return item{}, fmt.Errorf("Missing END after value of %s", key)
+	}
+	return item{value: data[:size], flags: uint32(flags)}, nil
+}
+
+func (c *conn) set(key string, it item) error {
+	fmt.Fprintf(c.rw, "set %s %d %d %d\r\n", key, it.flags, it.expiration, len(it.value))
+	c.rw.Write(it.value)
+	c.rw.WriteString("\r\n")
+	if err := c.rw.Flush(); err != nil {
+		return err
+	}
+	l, err := c.line()
+	if err != nil {
+		return err
+	}
+	if l != "STORED" {
+		return protocolError(l)
+	}
+	return nil
+}
+
+func (c *conn) delete(key string) error {
+	fmt.Fprintf(c.rw, "delete %s\r\n", key)
+	if err := c.rw.Flush(); err != nil {
+		return err
+	}
+	l, err := c.line()
+	switch {
+	case err != nil:
+		return err
+	case l == "NOT_FOUND":
+		return errMiss
+	case l != "DELETED":
+		return protocolError(l)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+// Package chimw adapts ipintelmw to the chi router, letting checks be
+// enabled or skipped by route pattern.
+//
+// Example:
+//
+//	r := chi.NewRouter()
+//	r.Use(middleware.RealIP)
+//	r.Use(chimw.New(ipintelmw.New(c), chimw.Skip("/healthz", "/static/*")))
+//
+// chi's RealIP middleware replaces RemoteAddr with the client IP from
+// the True-Client-IP, X-Real-IP or X-Forwarded-For header, without a
+// port; ipintelmw.RemoteIP reads it as is. RealIP trusts these headers
+// from any peer, so only use it behind a proxy that sets them, and
+// prefer ipintelmw.WithTrustedProxies, which checks the peer first.
+package chimw
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/pierelucas/go-ipintel/ipintelmw"
+)
+
+// Option configures New.
+type Option func(*config)
+
+type config struct {
+	only []string
+	skip []string
+}
+
+// Only restricts checks to requests whose route pattern is one of
+// patterns, e.g. "/login" or "/api/*".
+func Only(patterns ...string) Option {
+	return func(c *config) {
+		c.only = append(c.only, patterns...)
+	}
+}
+
+// Skip lets requests whose route pattern is one of patterns through
+// unchecked.
+func Skip(patterns ...string) Option {
+	return func(c *config) {
+		c.skip = append(c.skip, patterns...)
+	}
+}
+
+// New returns chi middleware checking requests with m. Route patterns
+// are matched as registered with the router, e.g. "/users/{id}", and in
+// full when using subrouters. It works both with Router.Use, where the
+// route is not resolved yet and is matched ahead of time, and with
+// Router.With.
+func New(m *ipintelmw.Middleware, opts ...Option) func(http.Handler) http.Handler {
+	var cfg config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if len(cfg.only) == 0 && len(cfg.skip) == 0 {
+		return m.Handler
+	}
+	return func(next http.Handler) http.Handler {
+		checked := m.Handler(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if cfg.skipRequest(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			checked.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (c *config) skipRequest(r *http.Request) bool {
+	pattern := RoutePattern(r)
+	for _, p := range c.skip {
+		if p == pattern {
+			return true
+		}
+	}
+	if len(c.only) == 0 {
+		return false
+	}
+	for _, p := range c.only {
+		if p == pattern {
+			return false
+		}
+	}
+	return true
+}
+
+// RoutePattern returns the chi route pattern r is routed to, e.g.
+// "/users/{id}", or "" if r isn't routed by chi or matches no route.
+// Unlike chi.RouteContext(ctx).RoutePattern(), it also works in
+// middleware running before routing.
+func RoutePattern(r *http.Request) string {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil || rctx.Routes == nil {
+		return ""
+	}
+	path := r.URL.RawPath
+	if path == "" {
+		path = r.URL.Path
+	}
+	tctx := chi.NewRouteContext()
+	if !rctx.Routes.Match(tctx, r.Method, path) {
+		return ""
+	}
+	return tctx.RoutePattern()
+}
@@ -0,0 +1,129 @@
+package ipintelmw
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Headers CDNs set to the IP of the client connecting to their edge,
+// for ClientIPWithHeaders and WithClientIPHeaders. Only use those of the
+// CDN in front of the server, as it doesn't strip the others.
+const (
+	CloudflareHeader = "CF-Connecting-IP"
+	// set by Akamai and Cloudflare Enterprise
+	TrueClientIPHeader = "True-Client-IP"
+	FastlyHeader       = "Fastly-Client-IP"
+)
+
+// Forwarding headers for ClientIP.
+const (
+	// RFC 7239, e.g. "for=192.0.2.1, for=198.51.100.7"
+	Forwarded = "Forwarded"
+	// e.g. "192.0.2.1, 198.51.100.7"
+	XForwardedFor = "X-Forwarded-For"
+	// a single IP, as set by nginx's proxy_set_header
+	XRealIP = "X-Real-IP"
+)
+
+// ClientIP returns the IP of the client that sent r. The forwarding
+// header, one of Forwarded, XForwardedFor and XRealIP, or another one
+// listing IPs like X-Forwarded-For, must be the one the trustedProxies
+// set, and is only believed when set by one of them: starting from the
+// peer, the chain of hops in header is walked from the nearest hop back
+// while the hop is trusted, and the first untrusted hop is the client.
+// Other forwarding headers are ignored, as clients could send those the
+// proxies don't set or strip. Any peer not in trustedProxies is the
+// client itself, whatever headers it sends, and so is the peer if
+// header is empty.
+//
+// Should the chain contain a malformed entry, the last trusted hop
+// before it is returned.
+func ClientIP(r *http.Request, trustedProxies []netip.Prefix, header string) (netip.Addr, bool) {
+	return ClientIPWithHeaders(r, trustedProxies, header, nil)
+}
+
+// ClientIPWithHeaders is like ClientIP, but a trusted peer's first
+// valid header of headers, each holding a single IP, e.g.
+// CloudflareHeader, takes precedence over the forwarding header. Behind
+// a CDN, trustedProxies must cover its edge addresses or the proxies
+// between it and the server, and these must not pass on such headers
+// sent by clients.
+func ClientIPWithHeaders(r *http.Request, trustedProxies []netip.Prefix, header string, headers []string) (netip.Addr, bool) {
+	ip, ok := RemoteIP(r)
+	if !ok || !trusted(ip, trustedProxies) {
+		return ip, ok
+	}
+	for _, h := range headers {
+		if hop, ok := parseHop(r.Header.Get(h)); ok {
+			return hop, true
+		}
+	}
+
+	var hops []string
+	if lines := r.Header.Values(header); header == "" {
+		// the peer is the client
+	} else if strings.EqualFold(header, Forwarded) {
+		hops = forwardedFor(lines)
+	} else {
+		for _, line := range lines {
+			hops = append(hops, strings.Split(line, ",")...)
+		}
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, ok := parseHop(hops[i])
+		if !ok {
+			break
+		}
+		ip = hop
+		if !trusted(ip, trustedProxies) {
+			break
+		}
+	}
+	return ip, true
+}
+
+func trusted(ip netip.Addr, prefixes []netip.Prefix) bool {
+	for _, p := range prefixes {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedFor returns the for= values of the elements of the Forwarded
+// header lines (RFC 7239), in order. Elements without one yield "".
+func forwardedFor(lines []string) []string {
+	var hops []string
+	for _, line := range lines {
+		for _, elem := range strings.Split(line, ",") {
+			var hop string
+			for _, pair := range strings.Split(elem, ";") {
+				k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(k, "for") {
+					hop = strings.Trim(v, `"`)
+				}
+			}
+			hops = append(hops, hop)
+		}
+	}
+	return hops
+}
+
+// parseHop parses a hop of a forwarding header: an IP, optionally with
+// port, IPv6 optionally in brackets.
+func parseHop(s string) (netip.Addr, bool) {
+	s = strings.TrimSpace(s)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	ip, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return ip.Unmap().WithZone(""), true
+}
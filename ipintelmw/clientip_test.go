@@ -0,0 +1,65 @@
+package ipintelmw
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	lb := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	tests := []struct {
+		name    string
+		peer    string
+		header  string
+		headers map[string]string
+		want    string
+	}{
+		{"untrusted peer", "192.0.2.1:1234", XForwardedFor, map[string]string{"X-Forwarded-For": "198.51.100.7"}, "192.0.2.1"},
+		{"xff", "10.0.0.1:1234", XForwardedFor, map[string]string{"X-Forwarded-For": "198.51.100.7"}, "198.51.100.7"},
+		{"xff spoofed hop", "10.0.0.1:1234", XForwardedFor, map[string]string{"X-Forwarded-For": "203.0.113.9, 198.51.100.7"}, "198.51.100.7"},
+		{"xff trusted hops", "10.0.0.1:1234", XForwardedFor, map[string]string{"X-Forwarded-For": "198.51.100.7, 10.0.0.2"}, "198.51.100.7"},
+		{"forwarded ignored for xff", "10.0.0.1:1234", XForwardedFor, map[string]string{"Forwarded": "for=203.0.113.9", "X-Forwarded-For": "198.51.100.7"}, "198.51.100.7"},
+		{"x-real-ip ignored for xff", "10.0.0.1:1234", XForwardedFor, map[string]string{"X-Real-IP": "203.0.113.9"}, "10.0.0.1"},
+		{"xff ignored for forwarded", "10.0.0.1:1234", Forwarded, map[string]string{"X-Forwarded-For": "203.0.113.9"}, "10.0.0.1"},
+		{"forwarded", "10.0.0.1:1234", Forwarded, map[string]string{"Forwarded": `for="[2001:db8::1]:4711", for=10.0.0.2`}, "2001:db8::1"},
+		{"x-real-ip", "10.0.0.1:1234", XRealIP, map[string]string{"X-Real-IP": "198.51.100.7"}, "198.51.100.7"},
+		{"no header", "10.0.0.1:1234", "", map[string]string{"X-Forwarded-For": "198.51.100.7"}, "10.0.0.1"},
+		{"malformed hop", "10.0.0.1:1234", XForwardedFor, map[string]string{"X-Forwarded-For": "203.0.113.9, bogus, 10.0.0.2"}, "10.0.0.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.peer
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			ip, ok := ClientIP(r, lb, tt.header)
+			if !ok || ip.String() != tt.want {
+				t.Errorf("ClientIP = %v, %t, want %s", ip, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientIPWithHeaders(t *testing.T) {
+	lb := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-Forwarded-For", "198.51.100.7")
+	r.Header.Set(CloudflareHeader, "203.0.113.9")
+
+	if ip, _ := ClientIP(r, lb, XForwardedFor); ip.String() != "198.51.100.7" {
+		t.Errorf("ClientIP believed %s without CDN headers", ip)
+	}
+	if ip, _ := ClientIPWithHeaders(r, lb, XForwardedFor, []string{FastlyHeader}); ip.String() != "198.51.100.7" {
+		t.Errorf("ClientIPWithHeaders believed %s of another CDN", ip)
+	}
+	if ip, _ := ClientIPWithHeaders(r, lb, XForwardedFor, []string{CloudflareHeader}); ip.String() != "203.0.113.9" {
+		t.Errorf("ClientIPWithHeaders = %s, want the CDN header", ip)
+	}
+	r.RemoteAddr = "192.0.2.1:1234"
+	if ip, _ := ClientIPWithHeaders(r, lb, XForwardedFor, []string{CloudflareHeader}); ip.String() != "192.0.2.1" {
+		t.Errorf("ClientIPWithHeaders believed %s from an untrusted peer", ip)
+	}
+}
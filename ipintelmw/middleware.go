@@ -0,0 +1,451 @@
+// Package ipintelmw provides net/http middleware that rejects requests
+// from proxies and VPN exit nodes.
+//
+// Example:
+//
+//	c := ipintel.NewClient("your@email.com", true, ipintel.Dynamic, 0,
+//		ipintel.WithCache(ipintelcache.New(100000, nil), 24*time.Hour))
+//	mw := ipintelmw.New(c)
+//	http.ListenAndServe(":8080", mw.Handler(mux))
+//
+// Handlers further down get the Result of the requests let through
+// with FromContext, e.g. to log the score or ask risky clients for a
+// second factor:
+//
+//	if res, ok := ipintelmw.FromContext(r.Context()); ok && res.Risk() >= ipintel.Medium {
+//		...
+//	}
+//
+// Blocked requests get 403 Forbidden unless WithBlockResponder sets
+// another answer, e.g. a redirect to an appeal page, and WithChallenge
+// answers the less risky ones with e.g. a CAPTCHA.
+//
+// A lookup only waits for the limiter up to the Client's maximum wait,
+// so a zero maximum wait keeps requests from ever blocking on the
+// API's rate limit.
+package ipintelmw
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+)
+
+// DefaultLookupInterval is the minimum time between two live lookups of
+// the same client IP unless changed with WithLookupInterval.
+const DefaultLookupInterval = 10 * time.Minute
+
+// DefaultLookupTimeout bounds a live lookup unless changed with
+// WithLookupTimeout.
+const DefaultLookupTimeout = 10 * time.Second
+
+// ScoreHeader is the conventional header name for WithScoreHeader and
+// WithScoreResponseHeader.
+const ScoreHeader = "X-IPIntel-Score"
+
+// defaultMaxTracked bounds the number of client IPs remembered for
+// lookup limiting.
+const defaultMaxTracked = 100000
+
+// Middleware checks the client IP of each request and rejects those
+// at or above the blocking risk level. Requests whose IP can't be
+// checked are let through. It is safe for concurrent use.
+type Middleware struct {
+	checker   ipintel.Checker
+	blockRisk ipintel.RiskLevel
+	interval  time.Duration
+	timeout   time.Duration
+	onError   func(*http.Request, error)
+	skip      func(*http.Request) bool
+	trusted   []netip.Prefix
+	fwdHeader string
+	ipHeaders []string
+	recent    *recent
+	decisions ipintel.Store
+	// replaces blockRisk if set
+	policy ipintel.Policy
+	// answer blocked and challenged requests
+	onBlock     Responder
+	challenge   ipintel.Policy
+	onChallenge Responder
+	passed      func(*http.Request) bool
+
+	annotateOnly bool
+	reqHeader    string
+	respHeader   string
+}
+
+// Option configures a Middleware in New.
+type Option func(*Middleware)
+
+// New returns a Middleware checking client IPs with c, which should
+// have a Cache so repeat visitors don't cost a query each.
+func New(c ipintel.Checker, opts ...Option) *Middleware {
+	m := &Middleware{
+		checker:   c,
+		blockRisk: ipintel.High,
+		interval:  DefaultLookupInterval,
+		timeout:   DefaultLookupTimeout,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.onBlock == nil {
+		m.onBlock = StatusResponder(http.StatusForbidden)
+	}
+	if m.onChallenge == nil {
+		m.onChallenge = StatusResponder(http.StatusForbidden)
+	}
+	m.recent = &recent{
+		max:      defaultMaxTracked,
+		entries:  make(map[netip.Addr]recentEntry),
+		inflight: make(map[netip.Addr]*inflight),
+	}
+	return m
+}
+
+// WithBlockRisk sets the risk level at and above which requests are
+// rejected; ipintel.High by default.
+func WithBlockRisk(l ipintel.RiskLevel) Option {
+	return func(m *Middleware) {
+		m.blockRisk = l
+	}
+}
+
+// WithPolicy sets the Policy deciding which requests are rejected,
+// replacing the blocking risk level, e.g. to add geofencing:
+//
+//	ipintelmw.WithPolicy(ipintel.AnyOf(
+//		ipintel.BlockRisk(ipintel.High),
+//		ipintel.BlockCountries("KP"),
+//	))
+func WithPolicy(p ipintel.Policy) Option {
+	return func(m *Middleware) {
+		m.policy = p
+	}
+}
+
+// WithLookupInterval sets the minimum time between two lookups of the
+// same client IP. Within it, the previous outcome is reused without
+// consulting the Checker, and an IP whose lookup failed is let through
+// unchecked. This keeps a single visitor, e.g. one rotating URLs to
+// bypass caching further up, from using up the API quota.
+func WithLookupInterval(d time.Duration) Option {
+	return func(m *Middleware) {
+		m.interval = d
+	}
+}
+
+// WithLookupTimeout sets the maximum duration of a live lookup,
+// DefaultLookupTimeout if zero. The lookup outlives the request that
+// started it, as others from the same IP may be waiting for it.
+func WithLookupTimeout(d time.Duration) Option {
+	return func(m *Middleware) {
+		if d <= 0 {
+			d = DefaultLookupTimeout
+		}
+		m.timeout = d
+	}
+}
+
+// WithErrorHandler sets a function called with failed lookups, e.g. to
+// log them. The request is let through regardless.
+func WithErrorHandler(fn func(r *http.Request, err error)) Option {
+	return func(m *Middleware) {
+		m.onError = fn
+	}
+}
+
+// WithTrustedProxies sets the reverse proxies and load balancers in
+// front of the server and the forwarding header they set, e.g.
+// XForwardedFor for an nginx appending $proxy_add_x_forwarded_for,
+// which tells the client IP (see ClientIP). Other forwarding headers
+// are ignored. By default, the peer address is checked and all
+// forwarding headers are ignored.
+func WithTrustedProxies(header string, prefixes ...netip.Prefix) Option {
+	return func(m *Middleware) {
+		m.fwdHeader = header
+		m.trusted = append(m.trusted, prefixes...)
+	}
+}
+
+// WithClientIPHeaders sets the headers of a CDN with the client IP,
+// e.g. CloudflareHeader, that trusted proxies' requests are checked for
+// before the forwarding header (see ClientIPWithHeaders). By default,
+// none are believed, as any client could send them where no CDN sets
+// them.
+func WithClientIPHeaders(headers ...string) Option {
+	return func(m *Middleware) {
+		m.ipHeaders = headers
+	}
+}
+
+// WithAnnotateOnly makes the Middleware let all requests through,
+// leaving the decision to the application, with the Result in the
+// request context (see FromContext) and, if set, the score headers.
+func WithAnnotateOnly() Option {
+	return func(m *Middleware) {
+		m.annotateOnly = true
+	}
+}
+
+// WithScoreHeader sets the name of a request header, e.g. ScoreHeader,
+// to set to the score when annotating only, for handlers and upstream
+// servers further down. A header of that name sent by the client is
+// always removed.
+func WithScoreHeader(name string) Option {
+	return func(m *Middleware) {
+		m.reqHeader = name
+	}
+}
+
+// WithScoreResponseHeader sets the name of a response header, e.g.
+// ScoreHeader, to set to the score when annotating only. Note that this discloses the score
+// to the client.
+func WithScoreResponseHeader(name string) Option {
+	return func(m *Middleware) {
+		m.respHeader = name
+	}
+}
+
+// WithDecisionStore sets a Store recording the decision on each IP
+// looked up, as ipintel.DecisionBlock, ipintel.DecisionChallenge (see
+// WithChallenge) or ipintel.DecisionAllow, e.g. to broadcast blocks to
+// other nodes. Outcomes reused within the lookup interval and lookups
+// when annotating only aren't recorded. Failures are passed to the
+// error handler.
+func WithDecisionStore(s ipintel.Store) Option {
+	return func(m *Middleware) {
+		m.decisions = s
+	}
+}
+
+// WithSkip sets a function reporting requests to let through
+// unchecked, e.g. health checks or static assets.
+func WithSkip(fn func(r *http.Request) bool) Option {
+	return func(m *Middleware) {
+		m.skip = fn
+	}
+}
+
+// Handler wraps next, rejecting requests from IPs at or above the
+// blocking risk level, or blocked by the Policy, with 403 Forbidden or
+// the block Responder, and answering those challenged with the
+// challenge Responder, unless annotating only. The Result of the
+// others is put in their context (see FromContext).
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.reqHeader != "" {
+			r.Header.Del(m.reqHeader)
+		}
+		if m.skip != nil && m.skip(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ip, ok := ClientIPWithHeaders(r, m.trusted, m.fwdHeader, m.ipHeaders)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		res, ok := m.check(r, ip)
+		if !ok {
+			if r.Context().Err() != nil {
+				// the client is gone, don't serve it unchecked
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		r = r.WithContext(context.WithValue(r.Context(), contextKey{}, res))
+		switch {
+		case m.annotateOnly:
+			m.setHeaders(w, r, res)
+		case m.blocks(res):
+			m.onBlock(w, r, res)
+			return
+		case m.challenges(r, res):
+			m.onChallenge(w, r, res)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type contextKey struct{}
+
+// FromContext returns the Result of the client IP put in the context of
+// a request let through by a Middleware. There is none for requests
+// skipped, without a client IP or whose lookup failed.
+func FromContext(ctx context.Context) (ipintel.Result, bool) {
+	res, ok := ctx.Value(contextKey{}).(ipintel.Result)
+	return res, ok
+}
+
+// setHeaders sets the score headers of r to the score of res.
+func (m *Middleware) setHeaders(w http.ResponseWriter, r *http.Request, res ipintel.Result) {
+	score := strconv.FormatFloat(float64(res.Score), 'f', -1, 32)
+	if m.respHeader != "" {
+		w.Header().Set(m.respHeader, score)
+	}
+	if m.reqHeader != "" {
+		r.Header.Set(m.reqHeader, score)
+	}
+}
+
+// check looks up ip unless it was looked up within the lookup interval,
+// in which case that outcome is returned. Requests arriving while ip is
+// looked up wait for that lookup rather than starting their own. The
+// lookup isn't canceled along with the request that started it, so the
+// others get its outcome.
+func (m *Middleware) check(r *http.Request, ip netip.Addr) (ipintel.Result, bool) {
+	now := time.Now()
+	e, call, found := m.recent.get(ip, now.Add(-m.interval))
+	if found {
+		return e.res, e.ok
+	}
+	if call != nil {
+		select {
+		case <-call.done:
+			return call.e.res, call.e.ok
+		case <-r.Context().Done():
+			return ipintel.Result{}, false
+		}
+	}
+	res, err := m.lookup(r, ip, now)
+	if err != nil && m.onError != nil && !errors.Is(err, ipintel.ErrNotSampled) {
+		m.onError(r, err)
+	}
+	if err == nil && m.decisions != nil && !m.annotateOnly {
+		m.recordDecision(r, res)
+	}
+	return res, err == nil
+}
+
+// lookup looks up ip, passing the outcome to the requests waiting for
+// it, even if the Checker panics.
+func (m *Middleware) lookup(r *http.Request, ip netip.Addr, now time.Time) (res ipintel.Result, err error) {
+	err = errors.New("Lookup panicked")
+	defer func() {
+		m.recent.finish(ip, recentEntry{res: res, ok: err == nil, at: now})
+	}()
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), m.timeout)
+	defer cancel()
+	return m.checker.GetProxyScore(ctx, ip.String())
+}
+
+// blocks reports whether requests from the IP of res are rejected.
+func (m *Middleware) blocks(res ipintel.Result) bool {
+	if m.policy != nil {
+		return m.policy(res)
+	}
+	return res.Risk() >= m.blockRisk
+}
+
+func (m *Middleware) recordDecision(r *http.Request, res ipintel.Result) {
+	rec := ipintel.Record{Result: res, Decision: ipintel.DecisionAllow}
+	if m.blocks(res) {
+		rec.Decision = ipintel.DecisionBlock
+	} else if m.challenge != nil && m.challenge(res) {
+		rec.Decision = ipintel.DecisionChallenge
+	}
+	if err := m.decisions.Record(r.Context(), rec); err != nil && m.onError != nil {
+		m.onError(r, err)
+	}
+}
+
+// RemoteIP returns the IP in r.RemoteAddr, which is the peer that sent
+// r unless a middleware further up rewrote it. A bare IP without port,
+// as set by some such middlewares, is accepted as well.
+func RemoteIP(r *http.Request) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return ip.Unmap().WithZone(""), true
+}
+
+// recent remembers the latest lookup outcome of up to max IPs and the
+// lookups in progress.
+type recent struct {
+	mu       sync.Mutex
+	max      int
+	entries  map[netip.Addr]recentEntry
+	inflight map[netip.Addr]*inflight
+}
+
+// inflight is a lookup in progress, shared by the requests from its IP
+// arriving meanwhile.
+type inflight struct {
+	// closed once e is set
+	done chan struct{}
+	e    recentEntry
+}
+
+type recentEntry struct {
+	res ipintel.Result
+	ok  bool
+	at  time.Time
+}
+
+// get returns the entry of ip if it is newer than since. Otherwise, it
+// returns the lookup of ip in progress to wait for, or nil if there is
+// none, in which case the caller is to look ip up and call finish.
+func (rc *recent) get(ip netip.Addr, since time.Time) (recentEntry, *inflight, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if e, ok := rc.entries[ip]; ok && e.at.After(since) {
+		return e, nil, true
+	}
+	if call, ok := rc.inflight[ip]; ok {
+		return recentEntry{}, call, false
+	}
+	rc.inflight[ip] = &inflight{done: make(chan struct{})}
+	return recentEntry{}, nil, false
+}
+
+// finish ends the lookup of ip with e, passing it to the requests
+// waiting for it, and stores it.
+func (rc *recent) finish(ip netip.Addr, e recentEntry) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	call := rc.inflight[ip]
+	delete(rc.inflight, ip)
+	call.e = e
+	close(call.done)
+	rc.put(ip, e)
+}
+
+// put stores the entry of ip, pruning the older entries when full. The
+// caller holds rc.mu.
+func (rc *recent) put(ip netip.Addr, e recentEntry) {
+	if _, ok := rc.entries[ip]; !ok && len(rc.entries) >= rc.max {
+		rc.prune()
+	}
+	rc.entries[ip] = e
+}
+
+// prune drops the entries older than their mean age, roughly the older
+// half, so IPs not seen for a while go before active ones.
+func (rc *recent) prune() {
+	var sum int64
+	for _, e := range rc.entries {
+		sum += e.at.UnixNano() / int64(len(rc.entries))
+	}
+	mean := time.Unix(0, sum)
+	for ip, e := range rc.entries {
+		if !e.at.After(mean) {
+			delete(rc.entries, ip)
+		}
+	}
+}
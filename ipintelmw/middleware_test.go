@@ -0,0 +1,108 @@
+package ipintelmw
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+)
+
+// slowChecker counts its lookups, each taking a while.
+type slowChecker struct {
+	calls atomic.Int32
+	score float32
+}
+
+func (c *slowChecker) GetProxyScore(ctx context.Context, ip string) (ipintel.Result, error) {
+	c.calls.Add(1)
+	select {
+	case <-time.After(50 * time.Millisecond):
+	case <-ctx.Done():
+		return ipintel.Result{}, ctx.Err()
+	}
+	return ipintel.Result{IP: ip, Score: c.score}, nil
+}
+
+func TestConcurrentRequestsShareLookup(t *testing.T) {
+	c := &slowChecker{score: 1}
+	h := New(c).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	var wg sync.WaitGroup
+	codes := make([]int, 20)
+	for i := range codes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+			codes[i] = w.Code
+		}()
+	}
+	wg.Wait()
+	if n := c.calls.Load(); n != 1 {
+		t.Errorf("%d lookups for one IP, want 1", n)
+	}
+	for i, code := range codes {
+		if code != http.StatusForbidden {
+			t.Errorf("request %d: status %d, want %d", i, code, http.StatusForbidden)
+		}
+	}
+}
+
+func TestCanceledRequestKeepsSharedLookup(t *testing.T) {
+	c := &slowChecker{score: 1}
+	var served atomic.Int32
+	h := New(c).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served.Add(1)
+	}))
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan struct{})
+	go func() {
+		defer close(first)
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+	}()
+	for c.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	var wg sync.WaitGroup
+	codes := make([]int, 5)
+	for i := range codes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+			codes[i] = w.Code
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	wg.Wait()
+	<-first
+	if n := c.calls.Load(); n != 1 {
+		t.Errorf("%d lookups for one IP, want 1", n)
+	}
+	if n := served.Load(); n != 0 {
+		t.Errorf("%d requests served unchecked, want 0", n)
+	}
+	for i, code := range codes {
+		if code != http.StatusForbidden {
+			t.Errorf("request %d: status %d, want %d", i, code, http.StatusForbidden)
+		}
+	}
+}
+
+func TestChallengeWithoutResponder(t *testing.T) {
+	c := &slowChecker{score: 0.96}
+	m := New(c, WithChallenge(ipintel.BlockRisk(ipintel.Medium), nil, nil))
+	h := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,84 @@
+package ipintelmw
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+)
+
+// Responder answers a request the Middleware doesn't let through, given
+// the Result of its client IP, which is also in the request context
+// (see FromContext), e.g. to render it into a page.
+type Responder func(w http.ResponseWriter, r *http.Request, res ipintel.Result)
+
+// WithBlockResponder sets the Responder answering blocked requests;
+// StatusResponder(http.StatusForbidden) if nil, the default.
+func WithBlockResponder(fn Responder) Option {
+	return func(m *Middleware) {
+		m.onBlock = fn
+	}
+}
+
+// WithChallenge answers requests that aren't blocked but whose Result
+// matches p with fn, e.g. a CAPTCHA page for medium risk IPs, or
+// StatusResponder(http.StatusForbidden) if fn is nil:
+//
+//	ipintelmw.WithChallenge(ipintel.BlockRisk(ipintel.Medium), captchaPage, hasCaptchaCookie)
+//
+// Requests for which passed, if not nil, reports true, e.g. as they
+// carry proof of a solved challenge, are let through.
+func WithChallenge(p ipintel.Policy, fn Responder, passed func(r *http.Request) bool) Option {
+	return func(m *Middleware) {
+		m.challenge = p
+		m.onChallenge = fn
+		m.passed = passed
+	}
+}
+
+// StatusResponder returns a Responder answering with the text of status,
+// e.g. http.StatusTooManyRequests to look like a rate limit.
+func StatusResponder(status int) Responder {
+	return func(w http.ResponseWriter, r *http.Request, res ipintel.Result) {
+		http.Error(w, http.StatusText(status), status)
+	}
+}
+
+// JSONResponder returns a Responder answering with status and a JSON
+// body with the text of status and the Result, for APIs:
+//
+//	{"error": "Forbidden", "result": {"ip": "192.0.2.1", "score": 1, ...}}
+func JSONResponder(status int) Responder {
+	return func(w http.ResponseWriter, r *http.Request, res ipintel.Result) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(struct {
+			Error  string         `json:"error"`
+			Result ipintel.Result `json:"result"`
+		}{http.StatusText(status), res})
+	}
+}
+
+// RedirectResponder returns a Responder redirecting to target with 303
+// See Other, e.g. to an appeal page. "{ip}", "{risk}" and "{url}" in
+// target are replaced by the client IP, its risk level and the URL of
+// the request, escaped for use in a query:
+//
+//	ipintelmw.RedirectResponder("/appeal?ip={ip}&from={url}")
+func RedirectResponder(target string) Responder {
+	return func(w http.ResponseWriter, r *http.Request, res ipintel.Result) {
+		loc := strings.NewReplacer(
+			"{ip}", url.QueryEscape(res.IP),
+			"{risk}", url.QueryEscape(res.Risk().String()),
+			"{url}", url.QueryEscape(r.URL.RequestURI()),
+		).Replace(target)
+		http.Redirect(w, r, loc, http.StatusSeeOther)
+	}
+}
+
+// challenges reports whether r is answered by the challenge Responder.
+func (m *Middleware) challenges(r *http.Request, res ipintel.Result) bool {
+	return m.challenge != nil && m.challenge(res) && (m.passed == nil || !m.passed(r))
+}
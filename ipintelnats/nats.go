@@ -0,0 +1,170 @@
+// Package ipintelnats connects ipintel to NATS: a Publisher emitting
+// lookups to a subject, and a responder answering checks sent as
+// requests, for internal services that would rather not speak HTTP.
+//
+// Example:
+//
+//	nc, err := nats.Connect(nats.DefaultURL)
+//	...
+//	c := ipintel.NewClient("your@email.com", true, ipintel.Dynamic, 0,
+//		ipintel.WithStore(ipintelnats.NewPublisher(nc, "ipintel.lookups")))
+//	sub, err := ipintelnats.Serve(nc, ipintelnats.DefaultCheckSubject, c)
+//
+// A service then checks an IP with:
+//
+//	msg, err := nc.Request("ipintel.check", []byte("192.0.2.1"), time.Second)
+package ipintelnats
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+)
+
+// DefaultCheckSubject is the conventional subject to Serve checks on.
+const DefaultCheckSubject = "ipintel.check"
+
+// DefaultCheckTimeout bounds a check answered by Serve.
+const DefaultCheckTimeout = 30 * time.Second
+
+// DefaultMaxConcurrent is the number of checks Serve answers at once
+// unless changed with WithMaxConcurrent.
+const DefaultMaxConcurrent = 64
+
+// BusyMessage is the error of the Reply to requests arriving while Serve
+// answers the maximum number of checks already.
+const BusyMessage = "Too many concurrent checks"
+
+// Publisher is an ipintel.Store publishing each recorded lookup as JSON
+// to a subject. NATS buffers publications, so Record doesn't wait for
+// the server.
+type Publisher struct {
+	nc       *nats.Conn
+	subject  string
+	minScore float32
+}
+
+var _ ipintel.Store = (*Publisher)(nil)
+
+// Option configures a Publisher in NewPublisher.
+type Option func(*Publisher)
+
+// NewPublisher returns a Publisher publishing to subject on nc.
+func NewPublisher(nc *nats.Conn, subject string, opts ...Option) *Publisher {
+	p := &Publisher{nc: nc, subject: subject}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// WithMinScore makes the Publisher skip lookups scoring below score.
+func WithMinScore(score float32) Option {
+	return func(p *Publisher) {
+		p.minScore = score
+	}
+}
+
+// Record publishes rec unless it scores below the minimum score.
+func (p *Publisher) Record(ctx context.Context, rec ipintel.Record) error {
+	if rec.Score < p.minScore {
+		return nil
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("Failed to encode record: %w", err)
+	}
+	if err := p.nc.Publish(p.subject, data); err != nil {
+		return fmt.Errorf("Failed to publish record: %w", err)
+	}
+	return nil
+}
+
+// Reply is the JSON reply to a check request: either the Result or the
+// error message of the failed lookup.
+type Reply struct {
+	Result *ipintel.Result `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// ServeOption configures Serve.
+type ServeOption func(*server)
+
+type server struct {
+	maxConcurrent int
+}
+
+// WithMaxConcurrent sets the number of checks Serve answers at once,
+// DefaultMaxConcurrent if n is not positive.
+func WithMaxConcurrent(n int) ServeOption {
+	return func(s *server) {
+		if n > 0 {
+			s.maxConcurrent = n
+		}
+	}
+}
+
+// Serve answers requests on subject, each holding an IP address, with
+// a Reply from checking it with c. Several processes serving the same
+// subject share the requests through the "ipintel" queue group. The
+// subscription runs until unsubscribed or nc is closed.
+//
+// Requests are answered concurrently, so one waiting for the limiter
+// doesn't hold up those answered from the cache, up to
+// DefaultMaxConcurrent at once (see WithMaxConcurrent). Requests beyond
+// that get a Reply with the error BusyMessage.
+func Serve(nc *nats.Conn, subject string, c ipintel.Checker, opts ...ServeOption) (*nats.Subscription, error) {
+	s := &server{maxConcurrent: DefaultMaxConcurrent}
+	for _, opt := range opts {
+		opt(s)
+	}
+	sem := make(chan struct{}, s.maxConcurrent)
+	sub, err := nc.QueueSubscribe(subject, "ipintel", func(m *nats.Msg) {
+		if m.Reply == "" {
+			return
+		}
+		select {
+		case sem <- struct{}{}:
+		default:
+			respond(m, Reply{Error: BusyMessage})
+			return
+		}
+		go func() {
+			defer func() { <-sem }()
+			respond(m, check(c, string(m.Data)))
+		}()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to subscribe to %s: %w", subject, err)
+	}
+	return sub, nil
+}
+
+func respond(m *nats.Msg, r Reply) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return
+	}
+	m.Respond(data)
+}
+
+func check(c ipintel.Checker, ip string) Reply {
+	ip = strings.TrimSpace(ip)
+	if _, err := netip.ParseAddr(ip); err != nil {
+		return Reply{Error: fmt.Sprintf("Invalid IP address %q", ip)}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultCheckTimeout)
+	defer cancel()
+	res, err := c.GetProxyScore(ctx, ip)
+	if err != nil {
+		return Reply{Error: err.Error()}
+	}
+	return Reply{Result: &res}
+}
@@ -0,0 +1,107 @@
+// Package ipintelproviders combines several ipintel.Provider
+// implementations, e.g. a Client and a commercial proxy database, into
+// one.
+package ipintelproviders
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+)
+
+// Fusion is a Provider looking up each IP with several providers and
+// combining their answers: the Result is that of the highest score, and
+// if it reaches the threshold, its Type is derived from the types the
+// providers scoring the IP as a proxy told. Providers tell the type by
+// setting Result.Type, like an ipintel.Client does for IPs on a deny
+// list named after a type, e.g. "tor". It is safe for concurrent use.
+type Fusion struct {
+	providers []ipintel.Provider
+	threshold float32
+}
+
+var _ ipintel.Provider = (*Fusion)(nil)
+
+// Fuse returns a Fusion of providers counting IPs scoring at or above
+// threshold as proxies. It panics if providers is empty.
+func Fuse(threshold float32, providers ...ipintel.Provider) *Fusion {
+	if len(providers) == 0 {
+		panic("ipintelproviders: Fuse without providers")
+	}
+	return &Fusion{providers: providers, threshold: threshold}
+}
+
+// Name returns the names of the providers joined by "+".
+func (f *Fusion) Name() string {
+	names := make([]string, len(f.providers))
+	for i, p := range f.providers {
+		names[i] = p.Name()
+	}
+	return strings.Join(names, "+")
+}
+
+// GetProxyScore looks up ip with all providers concurrently. Failed
+// lookups are left out; if all fail, the first error is returned.
+func (f *Fusion) GetProxyScore(ctx context.Context, ip string) (ipintel.Result, error) {
+	start := time.Now()
+	results := make([]ipintel.Result, len(f.providers))
+	errs := make([]error, len(f.providers))
+	var wg sync.WaitGroup
+	for i, p := range f.providers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = p.GetProxyScore(ctx, ip)
+		}()
+	}
+	wg.Wait()
+
+	best := -1
+	var ok []ipintel.Result
+	var attempts int
+	for i, err := range errs {
+		attempts += results[i].Attempts
+		if err != nil {
+			continue
+		}
+		ok = append(ok, results[i])
+		if best < 0 || results[i].Score > results[best].Score {
+			best = i
+		}
+	}
+	if best < 0 {
+		return ipintel.Result{}, errs[0]
+	}
+	res := results[best]
+	res.Latency, res.Attempts = time.Since(start), attempts
+	res.Type = ""
+	if res.Score >= f.threshold {
+		res.Type = f.classify(ok)
+	}
+	return res, nil
+}
+
+// classify returns the type told by most providers scoring the IP at or
+// above the threshold, the most specific one on a tie.
+func (f *Fusion) classify(results []ipintel.Result) ipintel.ProxyType {
+	votes := make(map[ipintel.ProxyType]int)
+	for _, r := range results {
+		if r.Score >= f.threshold && r.Type != "" && r.Type != ipintel.TypeUnknown {
+			votes[r.Type]++
+		}
+	}
+	t, n := ipintel.TypeUnknown, 0
+	for _, pt := range typePrecedence {
+		if votes[pt] > n {
+			t, n = pt, votes[pt]
+		}
+	}
+	return t
+}
+
+// typePrecedence orders the types from the most to the least specific
+// signal, for breaking ties between providers.
+var typePrecedence = []ipintel.ProxyType{ipintel.TypeTor, ipintel.TypeVPN, ipintel.TypeResidential, ipintel.TypeDatacenter}
@@ -0,0 +1,74 @@
+package ipintelredis
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/redis/go-redis/v9"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+)
+
+// Broadcaster is an ipintel.Store publishing block decisions, e.g. those
+// recorded by ipintelmw.WithDecisionStore, to a Redis channel, so other
+// nodes and non-Go services can block the IP without looking it up
+// themselves. Records with other decisions are ignored.
+//
+// The messages are the JSON representation of ipintel.Record.
+type Broadcaster struct {
+	rdb     redis.UniversalClient
+	channel string
+}
+
+var _ ipintel.Store = (*Broadcaster)(nil)
+
+// NewBroadcaster returns a Broadcaster publishing with rdb to the
+// channel prefix+"decisions", with DefaultPrefix if prefix is empty.
+func NewBroadcaster(rdb redis.UniversalClient, prefix string) *Broadcaster {
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	return &Broadcaster{rdb: rdb, channel: prefix + "decisions"}
+}
+
+// Record publishes rec if it is a block decision.
+func (b *Broadcaster) Record(ctx context.Context, rec ipintel.Record) error {
+	if rec.Decision != ipintel.DecisionBlock {
+		return nil
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return b.rdb.Publish(ctx, b.channel, data).Err()
+}
+
+// Listen calls fn with each decision published by Broadcasters using
+// the same prefix until ctx is done, e.g. to add the IP to a deny list.
+// Malformed messages are skipped.
+func Listen(ctx context.Context, rdb redis.UniversalClient, prefix string, fn func(ipintel.Record)) error {
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	sub := rdb.Subscribe(ctx, prefix+"decisions")
+	defer sub.Close()
+	// wait for the subscription, so failures are returned
+	if _, err := sub.Receive(ctx); err != nil {
+		return err
+	}
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			var rec ipintel.Record
+			if json.Unmarshal([]byte(msg.Payload), &rec) == nil {
+				fn(rec)
+			}
+		}
+	}
+}
@@ -0,0 +1,233 @@
+// Package ipintelredis provides a Redis-backed ipintel.Cache and
+// ipintel.Locker, letting several processes share scores and
+// deduplicate lookups of the same IP, and a Broadcaster sharing block
+// decisions over pub/sub.
+//
+// Example:
+//
+//	rdb := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+//	c := ipintel.NewClient("your@email.com", true, ipintel.Dynamic, 10*time.Second,
+//		ipintel.WithCache(ipintelredis.NewCache(rdb, ""), 24*time.Hour),
+//		ipintel.WithLocker(ipintelredis.NewLocker(rdb, ""), 5*time.Second))
+package ipintelredis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+)
+
+// DefaultPrefix is prepended to all keys if no prefix is given.
+const DefaultPrefix = "ipintel:"
+
+// Cache is an ipintel.Cache storing Results in Redis.
+type Cache struct {
+	rdb    redis.UniversalClient
+	prefix string
+	codec  ipintel.Codec
+}
+
+var (
+	_ ipintel.Cache       = (*Cache)(nil)
+	_ ipintel.Purger      = (*Cache)(nil)
+	_ ipintel.Walker      = (*Cache)(nil)
+	_ ipintel.Invalidator = (*Cache)(nil)
+)
+
+// CacheOption configures a Cache in NewCache.
+type CacheOption func(*Cache)
+
+// WithCodec sets the encoding of cached Results, ipintel.JSONCodec by
+// default. All processes sharing keys must use the same one.
+func WithCodec(codec ipintel.Codec) CacheOption {
+	return func(c *Cache) {
+		c.codec = codec
+	}
+}
+
+// NewCache returns a Cache using rdb. Keys are prefixed with prefix,
+// or DefaultPrefix if empty.
+func NewCache(rdb redis.UniversalClient, prefix string, opts ...CacheOption) *Cache {
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	c := &Cache{rdb: rdb, prefix: prefix, codec: ipintel.JSONCodec{}}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Get returns the Result stored under key.
+func (c *Cache) Get(ctx context.Context, key string) (ipintel.Result, bool, error) {
+	data, err := c.rdb.Get(ctx, c.prefix+"score:"+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return ipintel.Result{}, false, nil
+	} else if err != nil {
+		return ipintel.Result{}, false, err
+	}
+	res, err := c.codec.Unmarshal(data)
+	if err != nil {
+		return ipintel.Result{}, false, err
+	}
+	return res, true, nil
+}
+
+// Set stores res under key for ttl.
+func (c *Cache) Set(ctx context.Context, key string, res ipintel.Result, ttl time.Duration) error {
+	data, err := c.codec.Marshal(res)
+	if err != nil {
+		return err
+	}
+	return c.rdb.Set(ctx, c.prefix+"score:"+key, data, ttl).Err()
+}
+
+// PurgeIP deletes the cached Results of ip for all check types.
+func (c *Cache) PurgeIP(ctx context.Context, ip string) (int, error) {
+	keys := []string{
+		c.prefix + "score:" + ipintel.CacheKey(ip, ipintel.Static),
+		c.prefix + "score:" + ipintel.CacheKey(ip, ipintel.Dynamic),
+	}
+	n, err := c.rdb.Del(ctx, keys...).Result()
+	return int(n), err
+}
+
+// PurgeBefore deletes all cached Results queried before t. It scans all
+// keys of the cache and is meant for occasional use only; expiry of old
+// entries is normally left to their TTL.
+func (c *Cache) PurgeBefore(ctx context.Context, t time.Time) (int, error) {
+	var n int
+	iter := c.rdb.Scan(ctx, 0, c.prefix+"score:*", 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		data, err := c.rdb.Get(ctx, key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue
+		} else if err != nil {
+			return n, err
+		}
+		if res, err := c.codec.Unmarshal(data); err == nil && !res.QueriedAt.Before(t) {
+			continue
+		}
+		if err := c.rdb.Del(ctx, key).Err(); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, iter.Err()
+}
+
+// Invalidate deletes the cached Results of ip, as PurgeIP.
+func (c *Cache) Invalidate(ctx context.Context, ip string) (int, error) {
+	return c.PurgeIP(ctx, ip)
+}
+
+// InvalidateRange deletes the cached Results of all IPs in prefix. Like
+// PurgeBefore, it scans all keys.
+func (c *Cache) InvalidateRange(ctx context.Context, prefix netip.Prefix) (int, error) {
+	var n int
+	iter := c.rdb.Scan(ctx, 0, c.prefix+"score:*", 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		// keys end in the IP (see ipintel.CacheKey)
+		_, ip, _ := strings.Cut(strings.TrimPrefix(key, c.prefix+"score:"), ":")
+		addr, err := netip.ParseAddr(ip)
+		if err != nil || !prefix.Contains(addr.Unmap()) {
+			continue
+		}
+		deleted, err := c.rdb.Del(ctx, key).Result()
+		if err != nil {
+			return n, err
+		}
+		n += int(deleted)
+	}
+	return n, iter.Err()
+}
+
+// Walk calls fn with the entries of the cache. Like PurgeBefore, it
+// scans all keys; entries set or deleted meanwhile may be missed.
+func (c *Cache) Walk(ctx context.Context, fn func(ipintel.CacheEntry) error) error {
+	iter := c.rdb.Scan(ctx, 0, c.prefix+"score:*", 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		var get *redis.StringCmd
+		var pttl *redis.DurationCmd
+		_, err := c.rdb.Pipelined(ctx, func(p redis.Pipeliner) error {
+			get, pttl = p.Get(ctx, key), p.PTTL(ctx, key)
+			return nil
+		})
+		if errors.Is(err, redis.Nil) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		data, _ := get.Bytes()
+		res, err := c.codec.Unmarshal(data)
+		if err != nil {
+			continue
+		}
+		ce := ipintel.CacheEntry{Key: strings.TrimPrefix(key, c.prefix+"score:"), Result: res}
+		// negative if the key has no expiry
+		if ttl := pttl.Val(); ttl > 0 {
+			ce.Expires = time.Now().Add(ttl)
+		}
+		if err := fn(ce); err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
+
+// Locker is an ipintel.Locker using Redis keys as locks.
+type Locker struct {
+	rdb    redis.UniversalClient
+	prefix string
+}
+
+var _ ipintel.Locker = (*Locker)(nil)
+
+// NewLocker returns a Locker using rdb. Keys are prefixed with prefix,
+// or DefaultPrefix if empty.
+func NewLocker(rdb redis.UniversalClient, prefix string) *Locker {
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	return &Locker{rdb: rdb, prefix: prefix}
+}
+
+// unlockScript deletes the lock only if it is still held by the caller,
+// so an expired and re-taken lock is left alone.
+var unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// TryLock takes the lock named key for at most ttl.
+func (l *Locker) TryLock(ctx context.Context, key string, ttl time.Duration) (func(), bool, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, false, err
+	}
+	token := hex.EncodeToString(buf)
+
+	lockKey := l.prefix + "lock:" + key
+	ok, err := l.rdb.SetNX(ctx, lockKey, token, ttl).Result()
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	return func() {
+		// use a fresh context, ctx may be done by now
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		unlockScript.Run(ctx, l.rdb, []string{lockKey}, token)
+	}, true, nil
+}
@@ -0,0 +1,262 @@
+package ipintelserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+)
+
+// WithAdminToken requires requests to the admin API to carry token in
+// an "Authorization: Bearer" header. Without it, the admin API only
+// answers requests received on a loopback address or a Unix socket.
+func WithAdminToken(token string) Option {
+	return func(s *Server) {
+		s.adminToken = token
+	}
+}
+
+// WithClient serves the stats and quota endpoints of the admin API for
+// c, usually the Client answering the lookups.
+func WithClient(c *ipintel.Client) Option {
+	return func(s *Server) {
+		s.client = c
+	}
+}
+
+// WithLists serves the list endpoints of the admin API, which edit l.
+// Lists refreshed from a source are replaced on the next refresh, so
+// entries are best added to lists of their own.
+func WithLists(l *ipintel.Lists) Option {
+	return func(s *Server) {
+		s.lists = l
+	}
+}
+
+// WithReloader serves POST /admin/reload, which calls reload, e.g. to
+// apply the policies of a changed configuration file.
+func WithReloader(reload func(ctx context.Context) error) Option {
+	return func(s *Server) {
+		s.reload = reload
+	}
+}
+
+// handleAdmin registers h for pattern, requiring the admin token if
+// there is one, and a local listener otherwise.
+func (s *Server) handleAdmin(pattern string, h http.HandlerFunc) {
+	s.handle(pattern, func(w http.ResponseWriter, r *http.Request) {
+		if s.adminToken == "" && !onLoopback(r) {
+			writeError(w, http.StatusForbidden, "Admin API requires an admin token off localhost")
+			return
+		}
+		if s.adminToken != "" {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="ipintel admin"`)
+				writeError(w, http.StatusUnauthorized, "Invalid admin token")
+				return
+			}
+		}
+		h(w, r)
+	})
+}
+
+// onLoopback reports whether r was received on a loopback address or a
+// Unix socket.
+func onLoopback(r *http.Request) bool {
+	addr, _ := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if addr == nil {
+		return false
+	}
+	if addr.Network() == "unix" {
+		return true
+	}
+	ap, err := netip.ParseAddrPort(addr.String())
+	return err == nil && ap.Addr().Unmap().IsLoopback()
+}
+
+// statsJSON is the body of GET /admin/stats.
+type statsJSON struct {
+	Lookups         uint64 `json:"lookups"`
+	ListHits        uint64 `json:"list_hits"`
+	HostingHits     uint64 `json:"hosting_hits"`
+	CleanFilterHits uint64 `json:"clean_filter_hits"`
+	CacheHits       uint64 `json:"cache_hits"`
+	Queries         uint64 `json:"queries"`
+	Throttled       uint64 `json:"throttled"`
+	Unsampled       uint64 `json:"unsampled"`
+	Errors          uint64 `json:"errors"`
+}
+
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	st := s.client.Stats()
+	writeJSON(w, http.StatusOK, statsJSON{
+		Lookups:         st.Lookups,
+		ListHits:        st.ListHits,
+		HostingHits:     st.HostingHits,
+		CleanFilterHits: st.CleanFilterHits,
+		CacheHits:       st.CacheHits,
+		Queries:         st.Queries,
+		Throttled:       st.Throttled,
+		Unsampled:       st.Unsampled,
+		Errors:          st.Errors,
+	})
+}
+
+// quotaJSON is the body of GET /admin/quota.
+type quotaJSON struct {
+	Available int           `json:"available"`
+	Burst     int           `json:"burst"`
+	RetryIn   time.Duration `json:"retry_in"`
+}
+
+func (s *Server) handleQuota(w http.ResponseWriter, r *http.Request) {
+	q, ok := s.client.Quota()
+	if !ok {
+		writeError(w, http.StatusNotImplemented, "The limiter doesn't report its quota")
+		return
+	}
+	writeJSON(w, http.StatusOK, quotaJSON{q.Available, q.Burst, q.RetryIn})
+}
+
+// flusher is implemented by Invalidators able to drop all cached
+// Results, such as ipintel.Client.
+type flusher interface {
+	FlushCache(ctx context.Context) (int, error)
+}
+
+func (s *Server) handleFlush(w http.ResponseWriter, r *http.Request) {
+	n, err := s.invalidator.(flusher).FlushCache(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, invalidatedJSON{n})
+}
+
+// listJSON describes a list in the admin API. Entries are only sent for
+// GET /admin/lists/{name}.
+type listJSON struct {
+	Name    string   `json:"name"`
+	Action  string   `json:"action"`
+	Size    int      `json:"size"`
+	Entries []string `json:"entries,omitempty"`
+}
+
+func (s *Server) describeList(name string, entries bool) (listJSON, bool) {
+	action, prefixes, ok := s.lists.Get(name)
+	if !ok {
+		return listJSON{}, false
+	}
+	lj := listJSON{Name: name, Action: "deny", Size: len(prefixes)}
+	if action == ipintel.Allow {
+		lj.Action = "allow"
+	}
+	if entries {
+		lj.Entries = make([]string, len(prefixes))
+		for i, p := range prefixes {
+			if p.IsSingleIP() {
+				lj.Entries[i] = p.Addr().String()
+			} else {
+				lj.Entries[i] = p.String()
+			}
+		}
+	}
+	return lj, true
+}
+
+func (s *Server) handleLists(w http.ResponseWriter, r *http.Request) {
+	lists := []listJSON{}
+	for _, name := range s.lists.Names() {
+		if lj, ok := s.describeList(name, false); ok {
+			lists = append(lists, lj)
+		}
+	}
+	writeJSON(w, http.StatusOK, lists)
+}
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	lj, ok := s.describeList(r.PathValue("name"), true)
+	if !ok {
+		writeError(w, http.StatusNotFound, "No such list")
+		return
+	}
+	writeJSON(w, http.StatusOK, lj)
+}
+
+// listPatch is the body of PATCH /admin/lists/{name}.
+type listPatch struct {
+	// Action of the list if it is created; "deny" if empty
+	Action string `json:"action"`
+	// IP addresses and CIDR prefixes to add and remove
+	Add    []string `json:"add"`
+	Remove []string `json:"remove"`
+}
+
+// handlePatchList adds entries to a list, creating it if needed, and
+// removes entries from it.
+func (s *Server) handlePatchList(w http.ResponseWriter, r *http.Request) {
+	var req listPatch
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBatchBody)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+	var action ipintel.ListAction
+	switch req.Action {
+	case "", "deny":
+		action = ipintel.Deny
+	case "allow":
+		action = ipintel.Allow
+	default:
+		writeError(w, http.StatusBadRequest, "Invalid action: must be allow or deny")
+		return
+	}
+	add, err := ipintel.ParseList(strings.NewReader(strings.Join(req.Add, "\n")))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid add: "+err.Error())
+		return
+	}
+	remove, err := ipintel.ParseList(strings.NewReader(strings.Join(req.Remove, "\n")))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid remove: "+err.Error())
+		return
+	}
+
+	name := r.PathValue("name")
+	if len(add) > 0 {
+		s.lists.Add(name, action, add...)
+	}
+	if len(remove) > 0 {
+		s.lists.Delete(name, remove...)
+	}
+	lj, ok := s.describeList(name, false)
+	if !ok {
+		writeError(w, http.StatusNotFound, "No such list")
+		return
+	}
+	writeJSON(w, http.StatusOK, lj)
+}
+
+func (s *Server) handleDeleteList(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if _, ok := s.describeList(name, false); !ok {
+		writeError(w, http.StatusNotFound, "No such list")
+		return
+	}
+	s.lists.Remove(name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleReload(w http.ResponseWriter, r *http.Request) {
+	if err := s.reload(r.Context()); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
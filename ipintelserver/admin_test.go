@@ -0,0 +1,56 @@
+package ipintelserver
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminWithoutTokenOnlyOnLoopback(t *testing.T) {
+	s := New(nil)
+	for _, tt := range []struct {
+		local net.Addr
+		want  int
+	}{
+		{&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8080}, http.StatusOK},
+		{&net.TCPAddr{IP: net.IPv6loopback, Port: 8080}, http.StatusOK},
+		{&net.UnixAddr{Name: "/run/ipintel.sock", Net: "unix"}, http.StatusOK},
+		{&net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 8080}, http.StatusForbidden},
+		{nil, http.StatusForbidden},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/admin/jobs", nil)
+		if tt.local != nil {
+			r = r.WithContext(context.WithValue(r.Context(), http.LocalAddrContextKey, tt.local))
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("on %v: status %d, want %d", tt.local, w.Code, tt.want)
+		}
+	}
+}
+
+func TestAdminToken(t *testing.T) {
+	s := New(nil, WithAdminToken("secret"))
+	for _, tt := range []struct {
+		auth string
+		want int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"Bearer secret", http.StatusOK},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/admin/jobs", nil)
+		r = r.WithContext(context.WithValue(r.Context(), http.LocalAddrContextKey, &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 8080}))
+		if tt.auth != "" {
+			r.Header.Set("Authorization", tt.auth)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("Authorization %q: status %d, want %d", tt.auth, w.Code, tt.want)
+		}
+	}
+}
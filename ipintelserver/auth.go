@@ -0,0 +1,117 @@
+package ipintelserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Token is an API key of a service using the lookup API, sent as
+// "Authorization: Bearer <key>" or "X-API-Key: <key>".
+type Token struct {
+	// Name identifies the service, e.g. in logs
+	Name string
+	Key  string
+	// Requests per second allowed for the token; unlimited if zero
+	Rate float64
+	// Requests allowed at once above the rate; the rate rounded up, at
+	// least 1, if zero
+	Burst int
+	// API queries allowed for the lookups of the token per period,
+	// DefaultQueryPeriod if zero, replacing the default of
+	// WithQueryLimit; see there
+	QueryLimit  int
+	QueryPeriod time.Duration
+	// Tenant the token belongs to; nil for the Server's own lookups
+	Tenant *Tenant
+}
+
+// apiToken is a Token with its limiter.
+type apiToken struct {
+	Token
+	// nil if unlimited
+	limiter *rate.Limiter
+	// nil if its queries are unlimited
+	consumer *consumer
+}
+
+type tokenKey struct{}
+
+// WithTokens requires the requests to the lookup API, GET /v1/..., POST
+// /v1/jobs etc., to carry one of tokens, each limited to its own rate.
+// The admin API is protected separately, see WithAdminToken.
+func WithTokens(tokens ...Token) Option {
+	return func(s *Server) {
+		if s.tokens == nil {
+			s.tokens = make(map[[sha256.Size]byte]*apiToken)
+		}
+		for _, t := range tokens {
+			at := &apiToken{Token: t}
+			if t.Rate > 0 {
+				burst := t.Burst
+				if burst == 0 {
+					burst = max(int(math.Ceil(t.Rate)), 1)
+				}
+				at.limiter = rate.NewLimiter(rate.Limit(t.Rate), burst)
+			}
+			s.tokens[sha256.Sum256([]byte(t.Key))] = at
+		}
+	}
+}
+
+// TokenName returns the name of the Token a request to the lookup API
+// was authenticated with, if any.
+func TokenName(ctx context.Context) (string, bool) {
+	t, ok := ctx.Value(tokenKey{}).(*apiToken)
+	if !ok {
+		return "", false
+	}
+	return t.Name, true
+}
+
+// requestKey returns the API key of r.
+func requestKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	key, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return key
+}
+
+// handleAPI registers h for pattern, requiring a Token and keeping to
+// its rate if there are any, and limiting the queries of the consumer.
+func (s *Server) handleAPI(pattern string, h http.HandlerFunc) {
+	s.handle(pattern, func(w http.ResponseWriter, r *http.Request) {
+		if s.tokens == nil {
+			h(w, r.WithContext(withConsumer(r.Context(), s.consumer(r, nil))))
+			return
+		}
+		key := requestKey(r)
+		// tokens are looked up by hash, so the lookup time tells
+		// nothing about the keys
+		t, ok := s.tokens[sha256.Sum256([]byte(key))]
+		if key == "" || !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ipintel"`)
+			writeError(w, http.StatusUnauthorized, "Invalid API key")
+			return
+		}
+		if t.limiter != nil {
+			now := time.Now()
+			res := t.limiter.ReserveN(now, 1)
+			if delay := res.DelayFrom(now); delay > 0 {
+				res.CancelAt(now)
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+				writeError(w, http.StatusTooManyRequests, "Rate limit of the API key exceeded")
+				return
+			}
+		}
+		ctx := context.WithValue(r.Context(), tokenKey{}, t)
+		h(w, r.WithContext(withConsumer(ctx, s.consumer(r, t))))
+	})
+}
@@ -0,0 +1,300 @@
+package ipintelserver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"time"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+)
+
+// Defaults of the batch lookups of the API (see WithBatchLimits).
+const (
+	DefaultMaxBatch       = 10000
+	DefaultBatchRetention = 24 * time.Hour
+	// Batch lookups a consumer may run at once (see
+	// WithMaxRunningBatches)
+	DefaultMaxRunningBatches = 4
+)
+
+// maxBatchBody caps the size of batch requests, which allows for about
+// twice DefaultMaxBatch IPv6 addresses.
+const maxBatchBody = 1 << 20
+
+// States of a batch lookup.
+const (
+	BatchRunning  = "running"
+	BatchDone     = "done"
+	BatchCanceled = "canceled"
+)
+
+// BatchStatus is the state of a batch lookup, called a job in the API,
+// and the results so far.
+type BatchStatus struct {
+	ID    string `json:"id"`
+	State string `json:"state"`
+	// Number of IPs, and of those looked up so far and failed
+	Total   int       `json:"total"`
+	Done    int       `json:"done"`
+	Failed  int       `json:"failed"`
+	Created time.Time `json:"created"`
+	// Time the lookup ended, nil while running
+	Finished *time.Time `json:"finished,omitempty"`
+	// Results in the order of the IPs, from the requested offset on
+	Results []BatchResult `json:"results"`
+}
+
+// BatchResult is the outcome of looking up one IP of a batch.
+type BatchResult struct {
+	IP     string          `json:"ip"`
+	Result *ipintel.Result `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+type batch struct {
+	ips []string
+	// Token name or source IP of the consumer starting the batch
+	owner string
+	// only visible to the tokens of the tenant starting the batch
+	tenant *Tenant
+	cancel context.CancelFunc
+	// guarded by Server.batchMu
+	status BatchStatus
+	// closed and replaced when status changes
+	changed chan struct{}
+}
+
+// WithBatchLimits limits batch lookups to max IPs, DefaultMaxBatch if
+// zero, and keeps finished ones for retention, DefaultBatchRetention if
+// zero, for their results to be fetched.
+func WithBatchLimits(max int, retention time.Duration) Option {
+	return func(s *Server) {
+		if max > 0 {
+			s.maxBatch = max
+		}
+		if retention > 0 {
+			s.batchRetention = retention
+		}
+	}
+}
+
+// WithMaxRunningBatches limits the batch lookups each consumer, a Token
+// or a source IP, may run at once to n, DefaultMaxRunningBatches if
+// zero. Further ones are refused with 429 Too Many Requests until one
+// ends.
+func WithMaxRunningBatches(n int) Option {
+	return func(s *Server) {
+		if n > 0 {
+			s.maxRunning = n
+		}
+	}
+}
+
+// batchOwner returns the consumer of r that its batch lookups count
+// against: the name of its Token, or its source IP without Tokens.
+func batchOwner(r *http.Request) string {
+	if name, ok := TokenName(r.Context()); ok {
+		return name
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// batchRequest is the body of POST /v1/jobs.
+type batchRequest struct {
+	IPs []string `json:"ips"`
+}
+
+// handleBatch starts a batch lookup. The IPs are looked up one after
+// the other, as the API's rate limits allow, and the job ID is returned
+// right away.
+func (s *Server) handleBatch(w http.ResponseWriter, r *http.Request) {
+	var req batchRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBatchBody)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+	if len(req.IPs) == 0 {
+		writeError(w, http.StatusBadRequest, "No IPs given")
+		return
+	}
+	if len(req.IPs) > s.maxBatch {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("At most %d IPs per job", s.maxBatch))
+		return
+	}
+	ips := make([]string, len(req.IPs))
+	for i, v := range req.IPs {
+		addr, err := netip.ParseAddr(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid IP address %q", v))
+			return
+		}
+		ips[i] = addr.String()
+	}
+
+	id := make([]byte, 16)
+	rand.Read(id)
+	// the lookups count against the consumer's queries
+	ctx, cancel := context.WithCancel(withConsumer(s.ctx, consumerOf(r.Context())))
+	b := &batch{ips: ips, owner: batchOwner(r), tenant: tenantOf(r.Context()), cancel: cancel, changed: make(chan struct{}), status: BatchStatus{
+		ID:      hex.EncodeToString(id),
+		State:   BatchRunning,
+		Total:   len(ips),
+		Created: time.Now(),
+		Results: make([]BatchResult, 0, len(ips)),
+	}}
+	s.batchMu.Lock()
+	select {
+	case <-s.draining:
+		s.batchMu.Unlock()
+		cancel()
+		writeError(w, http.StatusServiceUnavailable, "Shutting down")
+		return
+	default:
+	}
+	if s.running[b.owner] >= s.maxRunning {
+		s.batchMu.Unlock()
+		cancel()
+		writeError(w, http.StatusTooManyRequests, fmt.Sprintf("At most %d running jobs per consumer", s.maxRunning))
+		return
+	}
+	s.running[b.owner]++
+	s.expireBatches()
+	s.batches[b.status.ID] = b
+	status := b.snapshot(len(ips))
+	// under batchMu, so Shutdown doesn't miss it
+	s.batchWG.Add(1)
+	s.batchMu.Unlock()
+
+	go func() {
+		defer s.batchWG.Done()
+		s.runBatch(ctx, b)
+	}()
+	w.Header().Set("Location", s.prefix+"/v1/jobs/"+status.ID)
+	writeJSON(w, http.StatusAccepted, status)
+}
+
+func (s *Server) runBatch(ctx context.Context, b *batch) {
+	defer b.cancel()
+	checker := s.checkerFor(b.tenant)
+	for _, ip := range b.ips {
+		res, err := checker.GetProxyScore(ctx, ip)
+		if ctx.Err() != nil {
+			break
+		}
+		br := BatchResult{IP: ip}
+		if err != nil {
+			br.Error = err.Error()
+		} else {
+			br.Result = &res
+			s.feed.publish(b.tenant, res)
+		}
+		s.batchMu.Lock()
+		b.status.Results = append(b.status.Results, br)
+		b.status.Done++
+		if err != nil {
+			b.status.Failed++
+		}
+		b.notify()
+		s.batchMu.Unlock()
+	}
+	s.batchMu.Lock()
+	defer s.batchMu.Unlock()
+	b.status.State = BatchDone
+	if b.status.Done < b.status.Total {
+		b.status.State = BatchCanceled
+	}
+	now := time.Now()
+	b.status.Finished = &now
+	b.notify()
+	if s.running[b.owner]--; s.running[b.owner] == 0 {
+		delete(s.running, b.owner)
+	}
+}
+
+// notify wakes the streams of b. The caller holds Server.batchMu.
+func (b *batch) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// snapshot returns the status of b with the results from offset on. The
+// caller holds Server.batchMu.
+func (b *batch) snapshot(offset int) BatchStatus {
+	status := b.status
+	offset = min(offset, len(status.Results))
+	// a copy, as runBatch appends to the results
+	status.Results = append([]BatchResult{}, status.Results[offset:]...)
+	return status
+}
+
+// expireBatches drops the batches finished before the retention. The
+// caller holds Server.batchMu.
+func (s *Server) expireBatches() {
+	cutoff := time.Now().Add(-s.batchRetention)
+	for id, b := range s.batches {
+		if f := b.status.Finished; f != nil && f.Before(cutoff) {
+			delete(s.batches, id)
+		}
+	}
+}
+
+// handleBatchStatus returns the progress of a batch lookup and its
+// results so far, or those from ?offset=n on for polling clients.
+func (s *Server) handleBatchStatus(w http.ResponseWriter, r *http.Request) {
+	var offset int
+	if v := r.URL.Query().Get("offset"); v != "" {
+		var err error
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			writeError(w, http.StatusBadRequest, "Invalid offset")
+			return
+		}
+	}
+	s.batchMu.Lock()
+	s.expireBatches()
+	b, ok := s.batches[r.PathValue("id")]
+	ok = ok && b.tenant == tenantOf(r.Context())
+	var status BatchStatus
+	if ok {
+		status = b.snapshot(offset)
+	}
+	s.batchMu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "No such job")
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// batch returns the batch lookup of the request path, if it belongs to
+// the tenant of the request.
+func (s *Server) batch(r *http.Request) (*batch, bool) {
+	s.batchMu.Lock()
+	defer s.batchMu.Unlock()
+	b, ok := s.batches[r.PathValue("id")]
+	if !ok || b.tenant != tenantOf(r.Context()) {
+		return nil, false
+	}
+	return b, true
+}
+
+// handleCancelBatch stops a batch lookup, keeping its results so far.
+func (s *Server) handleCancelBatch(w http.ResponseWriter, r *http.Request) {
+	b, ok := s.batch(r)
+	if !ok {
+		writeError(w, http.StatusNotFound, "No such job")
+		return
+	}
+	b.cancel()
+	w.WriteHeader(http.StatusAccepted)
+}
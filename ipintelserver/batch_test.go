@@ -0,0 +1,51 @@
+package ipintelserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+)
+
+// blockingChecker answers lookups once its context is done.
+type blockingChecker struct{}
+
+func (blockingChecker) GetProxyScore(ctx context.Context, ip string) (ipintel.Result, error) {
+	<-ctx.Done()
+	return ipintel.Result{}, ctx.Err()
+}
+
+func TestMaxRunningBatches(t *testing.T) {
+	s := New(blockingChecker{}, WithMaxRunningBatches(1))
+	post := func(remote string) int {
+		r := httptest.NewRequest(http.MethodPost, "/v1/jobs", strings.NewReader(`{"ips": ["192.0.2.1"]}`))
+		r.RemoteAddr = remote
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w.Code
+	}
+	for _, tt := range []struct {
+		remote string
+		want   int
+	}{
+		{"198.51.100.1:1234", http.StatusAccepted},
+		{"198.51.100.1:1235", http.StatusTooManyRequests},
+		{"198.51.100.2:1234", http.StatusAccepted},
+	} {
+		if code := post(tt.remote); code != tt.want {
+			t.Errorf("job from %s: status %d, want %d", tt.remote, code, tt.want)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.Shutdown(ctx)
+	s.batchMu.Lock()
+	defer s.batchMu.Unlock()
+	if len(s.running) != 0 {
+		t.Errorf("running jobs left after they ended: %v", s.running)
+	}
+}
@@ -0,0 +1,171 @@
+package ipintelserver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+)
+
+// DefaultQueryPeriod is the period of query limits given without one.
+const DefaultQueryPeriod = 24 * time.Hour
+
+// maxConsumers is the number of consumers tracked by source IP. Above
+// it, those idle for a whole period are forgotten, then the less
+// recently active ones.
+const maxConsumers = 10000
+
+// QueryLimitError fails the lookups of a consumer that used up its
+// share of API queries (see WithQueryLimit).
+type QueryLimitError struct {
+	// Name of the Token or source IP of the consumer
+	Consumer string
+	// Estimated time until the consumer can query again
+	RetryIn time.Duration
+}
+
+func (e *QueryLimitError) Error() string {
+	return fmt.Sprintf("Query limit of %s exceeded, retry in %s", e.Consumer, e.RetryIn.Round(time.Second))
+}
+
+// queryLimit is a number of API queries per period.
+type queryLimit struct {
+	limit  int
+	period time.Duration
+}
+
+// consumer is a service using the lookup API, identified by its Token
+// or source IP, with its share of API queries.
+type consumer struct {
+	name    string
+	limiter *rate.Limiter
+	// guarded by Server.consumerMu
+	lastUsed time.Time
+}
+
+// WithQueryLimit limits the API queries of each consumer to limit per
+// period, e.g. 100 per 24h, so one misbehaving service can't use up the
+// quota all share; period is DefaultQueryPeriod if zero. Lookups
+// answered by lists or the cache are free. A consumer is a Token or,
+// without WithTokens, a source IP. Tokens with a QueryLimit keep to
+// theirs instead.
+//
+// Only the queries of an ipintel.Client counting the lookups are
+// limited, not those of other providers.
+func WithQueryLimit(limit int, period time.Duration) Option {
+	return func(s *Server) {
+		s.queryLimit = newQueryLimit(limit, period)
+	}
+}
+
+func newQueryLimit(limit int, period time.Duration) queryLimit {
+	if period == 0 {
+		period = DefaultQueryPeriod
+	}
+	return queryLimit{limit, period}
+}
+
+func newLimiter(ql queryLimit) *rate.Limiter {
+	return rate.NewLimiter(rate.Every(ql.period/time.Duration(ql.limit)), ql.limit)
+}
+
+// gate is the ipintel.QueryGate of c's lookups.
+func (c *consumer) gate(ctx context.Context) error {
+	now := time.Now()
+	r := c.limiter.ReserveN(now, 1)
+	if delay := r.DelayFrom(now); delay > 0 {
+		r.CancelAt(now)
+		return &QueryLimitError{Consumer: c.name, RetryIn: delay}
+	}
+	return nil
+}
+
+// initConsumers sets up the query limits of the Tokens once all
+// options are applied.
+func (s *Server) initConsumers() {
+	s.consumers = make(map[string]*consumer)
+	for _, t := range s.tokens {
+		ql := s.queryLimit
+		if t.QueryLimit > 0 {
+			ql = newQueryLimit(t.QueryLimit, t.QueryPeriod)
+		}
+		if ql.limit > 0 {
+			t.consumer = &consumer{name: t.Name, limiter: newLimiter(ql)}
+		}
+	}
+}
+
+// consumer returns the consumer of r, authenticated with t if there are
+// Tokens, or nil if its queries are unlimited.
+func (s *Server) consumer(r *http.Request, t *apiToken) *consumer {
+	if s.tokens != nil {
+		return t.consumer
+	}
+	if s.queryLimit.limit == 0 {
+		return nil
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	now := time.Now()
+	s.consumerMu.Lock()
+	defer s.consumerMu.Unlock()
+	c, ok := s.consumers[ip]
+	if !ok {
+		if len(s.consumers) >= maxConsumers {
+			s.pruneConsumers(now)
+		}
+		c = &consumer{name: ip, limiter: newLimiter(s.queryLimit)}
+		s.consumers[ip] = c
+	}
+	c.lastUsed = now
+	return c
+}
+
+// pruneConsumers forgets the consumers idle for a whole period, whose
+// buckets are full again, so nothing is lost. If none is, it forgets
+// those not active since their mean last use, roughly the older half,
+// which restarts them with a full bucket. The caller holds consumerMu.
+func (s *Server) pruneConsumers(now time.Time) {
+	for k, c := range s.consumers {
+		if now.Sub(c.lastUsed) > s.queryLimit.period {
+			delete(s.consumers, k)
+		}
+	}
+	if len(s.consumers) < maxConsumers {
+		return
+	}
+	var sum int64
+	for _, c := range s.consumers {
+		sum += c.lastUsed.UnixNano() / int64(len(s.consumers))
+	}
+	mean := time.Unix(0, sum)
+	for k, c := range s.consumers {
+		if !c.lastUsed.After(mean) {
+			delete(s.consumers, k)
+		}
+	}
+}
+
+// withConsumer returns ctx with the QueryGate of c, if any.
+func withConsumer(ctx context.Context, c *consumer) context.Context {
+	if c == nil {
+		return ctx
+	}
+	ctx = context.WithValue(ctx, consumerKey{}, c)
+	return ipintel.ContextWithQueryGate(ctx, c.gate)
+}
+
+type consumerKey struct{}
+
+// consumerOf returns the consumer of a request context, nil if none.
+func consumerOf(ctx context.Context) *consumer {
+	c, _ := ctx.Value(consumerKey{}).(*consumer)
+	return c
+}
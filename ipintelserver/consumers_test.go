@@ -0,0 +1,47 @@
+package ipintelserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+	"github.com/pierelucas/go-ipintel/ipinteltest"
+)
+
+func TestConsumersBounded(t *testing.T) {
+	s := New(nil, WithQueryLimit(10, 0))
+	for i := range maxConsumers + 1 {
+		r := httptest.NewRequest("GET", "/v1/check/192.0.2.1", nil)
+		r.RemoteAddr = fmt.Sprintf("10.%d.%d.1:1234", i>>8, i&0xff)
+		s.consumer(r, nil)
+	}
+	if n := len(s.consumers); n > maxConsumers {
+		t.Errorf("%d consumers tracked, want at most %d", n, maxConsumers)
+	}
+}
+
+// closedLimiter never grants a query.
+type closedLimiter struct{}
+
+func (closedLimiter) WaitMaxDuration(int64, time.Duration) bool { return false }
+
+func TestThrottledQueryKeepsShare(t *testing.T) {
+	srv := ipinteltest.NewServer()
+	defer srv.Close()
+	c := srv.Client(ipintel.Dynamic).WithOptions(ipintel.WithLimiter(closedLimiter{}))
+	defer c.Close()
+
+	con := &consumer{name: "test", limiter: newLimiter(newQueryLimit(1, 0))}
+	_, err := c.GetProxyScore(withConsumer(context.Background(), con), "192.0.2.1")
+	var throttled *ipintel.ThrottleError
+	if !errors.As(err, &throttled) {
+		t.Fatalf("GetProxyScore() = %v, want a ThrottleError", err)
+	}
+	if err := con.gate(context.Background()); err != nil {
+		t.Errorf("query throttled by the limiter used up the share: %v", err)
+	}
+}
@@ -0,0 +1,197 @@
+package ipintelserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+)
+
+// DefaultEventScore is the score at and above which lookups are sent to
+// GET /v1/events unless the request asks for another one.
+const DefaultEventScore = 0.99
+
+// eventBuffer is the number of Results buffered per subscriber of the
+// live feed; a slower subscriber misses Results.
+const eventBuffer = 64
+
+// keepAliveInterval is how often an idle stream sends a comment, so
+// proxies don't close it.
+const keepAliveInterval = 30 * time.Second
+
+// feed passes the Results answered by the Server to the subscribers of
+// GET /v1/events of the same Tenant.
+type feed struct {
+	mu   sync.Mutex
+	subs map[chan ipintel.Result]*Tenant
+}
+
+func (f *feed) subscribe(t *Tenant) chan ipintel.Result {
+	ch := make(chan ipintel.Result, eventBuffer)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.subs == nil {
+		f.subs = make(map[chan ipintel.Result]*Tenant)
+	}
+	f.subs[ch] = t
+	return ch
+}
+
+func (f *feed) unsubscribe(ch chan ipintel.Result) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.subs, ch)
+}
+
+// publish passes res to the subscribers of t without blocking.
+func (f *feed) publish(t *Tenant, res ipintel.Result) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for ch, sub := range f.subs {
+		if sub != t {
+			continue
+		}
+		select {
+		case ch <- res:
+		default:
+		}
+	}
+}
+
+// eventStream writes server-sent events.
+type eventStream struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+func newEventStream(w http.ResponseWriter) *eventStream {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// keep proxies such as nginx from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	es := &eventStream{w, http.NewResponseController(w)}
+	es.flush()
+	return es
+}
+
+// send writes an event of the given type and ID, if not empty, with the
+// JSON encoding of v as data.
+func (es *eventStream) send(event, id string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		fmt.Fprintf(es.w, "id: %s\n", id)
+	}
+	if _, err := fmt.Fprintf(es.w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	return es.flush()
+}
+
+func (es *eventStream) keepAlive() error {
+	if _, err := fmt.Fprint(es.w, ": keep-alive\n\n"); err != nil {
+		return err
+	}
+	return es.flush()
+}
+
+func (es *eventStream) flush() error {
+	return es.rc.Flush()
+}
+
+// handleEvents streams the Results answered by the Server, for lookups
+// and batches, scoring at least ?min_score=, DefaultEventScore by
+// default, as "result" events.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	minScore := float32(DefaultEventScore)
+	if v := r.URL.Query().Get("min_score"); v != "" {
+		f, err := strconv.ParseFloat(v, 32)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid min_score")
+			return
+		}
+		minScore = float32(f)
+	}
+	ch := s.feed.subscribe(tenantOf(r.Context()))
+	defer s.feed.unsubscribe(ch)
+
+	es := newEventStream(w)
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.draining:
+			return
+		case <-ticker.C:
+			err = es.keepAlive()
+		case res := <-ch:
+			if res.Score >= minScore {
+				err = es.send("result", "", res)
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// handleBatchEvents streams the results of a batch lookup as "result"
+// events with their index as ID, from the start or after the
+// Last-Event-ID of a reconnecting client, then its final status as a
+// "done" event without results.
+func (s *Server) handleBatchEvents(w http.ResponseWriter, r *http.Request) {
+	var next int
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			next = n + 1
+		}
+	}
+	b, ok := s.batch(r)
+	if !ok {
+		writeError(w, http.StatusNotFound, "No such job")
+		return
+	}
+
+	es := newEventStream(w)
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+	for {
+		s.batchMu.Lock()
+		status := b.snapshot(next)
+		changed := b.changed
+		s.batchMu.Unlock()
+
+		for _, br := range status.Results {
+			if err := es.send("result", strconv.Itoa(next), br); err != nil {
+				return
+			}
+			next++
+		}
+		if status.Finished != nil {
+			status.Results = []BatchResult{}
+			es.send("done", "", status)
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.draining:
+			return
+		case <-ticker.C:
+			if es.keepAlive() != nil {
+				return
+			}
+		case <-changed:
+		}
+	}
+}
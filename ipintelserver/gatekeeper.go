@@ -0,0 +1,301 @@
+package ipintelserver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"sync"
+	"syscall"
+	"time"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+)
+
+// DefaultCheckTimeout is the time a Gatekeeper waits for the lookup of
+// a peer IP unless changed with WithCheckTimeout.
+const DefaultCheckTimeout = 5 * time.Second
+
+// Gatekeeper is a TCP proxy in front of a backend, e.g. a game server,
+// that doesn't check its clients itself. It looks up the peer IP of each
+// connection and forwards it to the backend unless the IP is at or above
+// the blocking risk level, in which case the connection is closed. The
+// Checker should have a Cache, so reconnects don't cost a query each.
+// It is safe for concurrent use.
+type Gatekeeper struct {
+	checker    ipintel.Checker
+	backend    string
+	blockRisk  ipintel.RiskLevel
+	failClosed bool
+	timeout    time.Duration
+	onError    func(ip netip.Addr, err error)
+	onDrop     func(ip netip.Addr, res ipintel.Result)
+	dialer     net.Dialer
+	// replaces blockRisk if set; guarded by mu, see SetPolicy
+	mu     sync.RWMutex
+	policy ipintel.Policy
+	// PROXY protocol
+	proxiesIn  []netip.Prefix
+	versionOut int
+}
+
+// GatekeeperOption configures a Gatekeeper in NewGatekeeper.
+type GatekeeperOption func(*Gatekeeper)
+
+// NewGatekeeper returns a Gatekeeper checking peer IPs with c and
+// forwarding connections to the TCP address backend.
+func NewGatekeeper(c ipintel.Checker, backend string, opts ...GatekeeperOption) *Gatekeeper {
+	g := &Gatekeeper{
+		checker:   c,
+		backend:   backend,
+		blockRisk: ipintel.High,
+		timeout:   DefaultCheckTimeout,
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g
+}
+
+// WithBlockRisk sets the risk level at and above which connections are
+// dropped; ipintel.High by default.
+func WithBlockRisk(l ipintel.RiskLevel) GatekeeperOption {
+	return func(g *Gatekeeper) {
+		g.blockRisk = l
+	}
+}
+
+// WithPolicy sets the Policy deciding which connections are dropped,
+// replacing the blocking risk level.
+func WithPolicy(p ipintel.Policy) GatekeeperOption {
+	return func(g *Gatekeeper) {
+		g.policy = p
+	}
+}
+
+// SetPolicy replaces the Policy deciding which connections are dropped,
+// e.g. after a configuration reload. Connections already checked are
+// not affected.
+func (g *Gatekeeper) SetPolicy(p ipintel.Policy) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.policy = p
+}
+
+// WithFailClosed makes the Gatekeeper drop connections whose peer IP
+// can't be checked, instead of forwarding them.
+func WithFailClosed() GatekeeperOption {
+	return func(g *Gatekeeper) {
+		g.failClosed = true
+	}
+}
+
+// WithCheckTimeout sets the time to wait for the lookup of a peer IP,
+// after which the lookup counts as failed.
+func WithCheckTimeout(d time.Duration) GatekeeperOption {
+	return func(g *Gatekeeper) {
+		g.timeout = d
+	}
+}
+
+// WithConnErrorHandler sets a function called with failed lookups and
+// backend connections, e.g. to log them.
+func WithConnErrorHandler(fn func(ip netip.Addr, err error)) GatekeeperOption {
+	return func(g *Gatekeeper) {
+		g.onError = fn
+	}
+}
+
+// WithDropHandler sets a function called with the Result of each
+// connection dropped for its risk level or by the Policy.
+func WithDropHandler(fn func(ip netip.Addr, res ipintel.Result)) GatekeeperOption {
+	return func(g *Gatekeeper) {
+		g.onDrop = fn
+	}
+}
+
+// WithProxyProtocol makes the Gatekeeper read a PROXY protocol header
+// from connections by the trusted load balancers, checking the client
+// IP it announces instead of the load balancer's (see ProxyListener).
+func WithProxyProtocol(trusted ...netip.Prefix) GatekeeperOption {
+	return func(g *Gatekeeper) {
+		g.proxiesIn = append(g.proxiesIn, trusted...)
+	}
+}
+
+// WithBackendProxyProtocol makes the Gatekeeper send a PROXY protocol
+// header of version 1 or 2 to the backend, so it sees the client IP
+// rather than the Gatekeeper's.
+func WithBackendProxyProtocol(version int) GatekeeperOption {
+	return func(g *Gatekeeper) {
+		g.versionOut = version
+	}
+}
+
+// ListenAndServe listens on the TCP address addr and calls Serve.
+func (g *Gatekeeper) ListenAndServe(ctx context.Context, addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return g.Serve(ctx, l)
+}
+
+// Serve accepts connections on l until ctx is done, then closes l and
+// returns nil. Connections already forwarded are left to end on their
+// own.
+func (g *Gatekeeper) Serve(ctx context.Context, l net.Listener) error {
+	if len(g.proxiesIn) > 0 {
+		l = ProxyListener(l, g.proxiesIn...)
+	}
+	stop := context.AfterFunc(ctx, func() { l.Close() })
+	defer stop()
+	var delay time.Duration
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if transientAcceptError(err) {
+				delay = min(max(2*delay, 5*time.Millisecond), time.Second)
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-time.After(delay):
+				}
+				continue
+			}
+			return err
+		}
+		delay = 0
+		go g.handle(ctx, conn)
+	}
+}
+
+// transientAcceptError reports whether Accept may succeed again after
+// err, such as when running out of file descriptors or when a client
+// resets its connection before it is accepted.
+func transientAcceptError(err error) bool {
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE) ||
+		errors.Is(err, syscall.ECONNABORTED)
+}
+
+func (g *Gatekeeper) handle(ctx context.Context, conn net.Conn) {
+	if pc, ok := conn.(*proxyConn); ok {
+		if err := pc.header(); err != nil {
+			if g.onError != nil {
+				ip, _ := peerIP(pc.Conn)
+				g.onError(ip, err)
+			}
+			conn.Close()
+			return
+		}
+	}
+	ip, ok := peerIP(conn)
+	if !ok || !g.allow(ctx, ip) {
+		conn.Close()
+		return
+	}
+	backend, err := g.dialer.DialContext(ctx, "tcp", g.backend)
+	if err != nil {
+		if g.onError != nil {
+			g.onError(ip, err)
+		}
+		conn.Close()
+		return
+	}
+	if g.versionOut != 0 {
+		if err := writeProxyHeader(backend, g.versionOut, conn); err != nil {
+			if g.onError != nil {
+				g.onError(ip, err)
+			}
+			conn.Close()
+			backend.Close()
+			return
+		}
+	}
+	pipe(conn, backend)
+}
+
+// writeProxyHeader writes the PROXY protocol header of conn to w.
+func writeProxyHeader(w io.Writer, version int, conn net.Conn) error {
+	src, err := netip.ParseAddrPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+	dst, err := netip.ParseAddrPort(conn.LocalAddr().String())
+	if err != nil {
+		return err
+	}
+	return WriteProxyHeader(w, version, src, dst)
+}
+
+// allow reports whether the connection of ip is forwarded.
+func (g *Gatekeeper) allow(ctx context.Context, ip netip.Addr) bool {
+	ctx, cancel := context.WithTimeout(ctx, g.timeout)
+	defer cancel()
+	res, err := g.checker.GetProxyScore(ctx, ip.String())
+	if err != nil {
+		if g.onError != nil {
+			g.onError(ip, err)
+		}
+		return !g.failClosed
+	}
+	g.mu.RLock()
+	policy := g.policy
+	g.mu.RUnlock()
+	blocked := res.Risk() >= g.blockRisk
+	if policy != nil {
+		blocked = policy(res)
+	}
+	if blocked {
+		if g.onDrop != nil {
+			g.onDrop(ip, res)
+		}
+		return false
+	}
+	return true
+}
+
+// peerIP returns the IP of the remote end of conn.
+func peerIP(conn net.Conn) (netip.Addr, bool) {
+	ap, err := netip.ParseAddrPort(conn.RemoteAddr().String())
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return ap.Addr().Unmap().WithZone(""), true
+}
+
+// pipe copies between a and b in both directions until both are done,
+// then closes them. The end of one direction is passed on as a half
+// close where supported, so protocols relying on it keep working.
+func pipe(a, b net.Conn) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		copyHalf(b, a)
+	}()
+	go func() {
+		defer wg.Done()
+		copyHalf(a, b)
+	}()
+	wg.Wait()
+	a.Close()
+	b.Close()
+}
+
+func copyHalf(dst, src net.Conn) {
+	io.Copy(dst, src)
+	if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+	} else {
+		dst.Close()
+	}
+}
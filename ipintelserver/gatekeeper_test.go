@@ -0,0 +1,42 @@
+package ipintelserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+// errListener fails Accept with the errors in turn.
+type errListener struct {
+	net.Listener
+	errs    []error
+	accepts int
+}
+
+func (l *errListener) Accept() (net.Conn, error) {
+	err := l.errs[min(l.accepts, len(l.errs)-1)]
+	l.accepts++
+	return nil, err
+}
+
+func (l *errListener) Close() error { return nil }
+
+func TestServeBacksOffTransientErrors(t *testing.T) {
+	fatal := errors.New("listener broke")
+	l := &errListener{errs: []error{
+		&net.OpError{Op: "accept", Net: "tcp", Err: os.NewSyscallError("accept", syscall.EMFILE)},
+		&net.OpError{Op: "accept", Net: "tcp", Err: os.NewSyscallError("accept", syscall.ENFILE)},
+		&net.OpError{Op: "accept", Net: "tcp", Err: os.NewSyscallError("accept", syscall.ECONNABORTED)},
+		fatal,
+	}}
+	g := NewGatekeeper(nil, "127.0.0.1:1")
+	if err := g.Serve(context.Background(), l); err != fatal {
+		t.Errorf("Serve() = %v, want %v", err, fatal)
+	}
+	if l.accepts != 4 {
+		t.Errorf("Accept called %d times, want 4", l.accepts)
+	}
+}
@@ -0,0 +1,55 @@
+package ipintelserver
+
+import (
+	"net/http"
+	"strings"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+)
+
+// DefaultHandlerPrefix is the path NewHandler serves its routes under
+// unless configured otherwise.
+const DefaultHandlerPrefix = "/ipintel"
+
+// WithPrefix serves the routes of the Server under prefix, e.g.
+// "/ipintel" for GET /ipintel/v1/check/{ip}, so it can be mounted in the
+// mux of another service. The Location of batch lookups includes it.
+func WithPrefix(prefix string) Option {
+	return func(s *Server) {
+		s.prefix = strings.TrimSuffix(prefix, "/")
+	}
+}
+
+// HandlerConfig configures the Handler of NewHandler.
+type HandlerConfig struct {
+	// Answers the lookups, usually an ipintel.Client
+	Checker ipintel.Checker
+	// Path the routes are served under; DefaultHandlerPrefix if empty
+	Prefix string
+	// Further options of the Server, e.g. WithTokens or WithClient
+	Options []Option
+}
+
+// NewHandler returns the scoring API answering lookups with
+// cfg.Checker, for services serving it along with their own routes
+// rather than running a daemon:
+//
+//	mux.Handle("/ipintel/", ipintelserver.NewHandler(ipintelserver.HandlerConfig{Checker: c}))
+//
+// Batch lookups run until done or canceled. For jobs and a graceful
+// shutdown, use New WithPrefix, which returns a Server with Run and
+// Shutdown.
+func NewHandler(cfg HandlerConfig) http.Handler {
+	prefix := cfg.Prefix
+	if prefix == "" {
+		prefix = DefaultHandlerPrefix
+	}
+	return New(cfg.Checker, append([]Option{WithPrefix(prefix)}, cfg.Options...)...)
+}
+
+// handle registers h for pattern, a method and path, under the prefix of
+// the Server.
+func (s *Server) handle(pattern string, h http.HandlerFunc) {
+	method, path, _ := strings.Cut(pattern, " ")
+	s.mux.HandleFunc(method+" "+s.prefix+path, h)
+}
@@ -0,0 +1,273 @@
+package ipintelserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+	"github.com/pierelucas/go-ipintel/ipintellog"
+)
+
+// Job is a task the Server runs on a schedule.
+type Job struct {
+	// Name identifies the job in the admin API
+	Name     string
+	Schedule Schedule
+	Run      func(ctx context.Context) error
+}
+
+// JobStatus is the state of a job as reported by the admin API.
+type JobStatus struct {
+	Name    string    `json:"name"`
+	Running bool      `json:"running"`
+	Next    time.Time `json:"next"`
+	Runs    int       `json:"runs"`
+	// Number of runs that returned an error
+	Failures     int           `json:"failures"`
+	LastStart    time.Time     `json:"last_start,omitempty"`
+	LastDuration time.Duration `json:"last_duration"`
+	LastError    string        `json:"last_error,omitempty"`
+}
+
+type job struct {
+	Job
+	// signals a manual run
+	trigger chan struct{}
+	// guarded by Server.mu
+	status JobStatus
+}
+
+// MustParseSchedule is like ParseSchedule but panics on error.
+func MustParseSchedule(spec string) Schedule {
+	s, err := ParseSchedule(spec)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// AddJob adds j to the jobs run by Run. Jobs must be added before Run
+// is called. A job is never run concurrently with itself: a run due
+// while the previous one is still going is skipped.
+func (s *Server) AddJob(j Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, other := range s.jobs {
+		if other.Name == j.Name {
+			return fmt.Errorf("Duplicate job %q", j.Name)
+		}
+	}
+	s.jobs = append(s.jobs, &job{Job: j, trigger: make(chan struct{}, 1), status: JobStatus{Name: j.Name}})
+	return nil
+}
+
+// Jobs returns the status of all jobs.
+func (s *Server) Jobs() []JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	statuses := make([]JobStatus, len(s.jobs))
+	for i, j := range s.jobs {
+		statuses[i] = j.status
+	}
+	return statuses
+}
+
+// RunJob makes the job called name run now, reporting false if there is
+// no such job. It doesn't wait for the run.
+func (s *Server) RunJob(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, j := range s.jobs {
+		if j.Name == name {
+			select {
+			case j.trigger <- struct{}{}:
+			default:
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// Run runs the jobs on their schedules until ctx is done, waits for
+// running jobs to return and returns ctx.Err(). Jobs get a context
+// canceled when ctx is done. Batch lookups and event streams are ended
+// by Shutdown.
+func (s *Server) Run(ctx context.Context) error {
+	s.mu.Lock()
+	jobs := append([]*job(nil), s.jobs...)
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	for _, j := range jobs {
+		go func(j *job) {
+			s.runJob(ctx, j)
+			done <- struct{}{}
+		}(j)
+	}
+	for range jobs {
+		<-done
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (s *Server) runJob(ctx context.Context, j *job) {
+	for {
+		next := j.Schedule.Next(time.Now())
+		s.mu.Lock()
+		j.status.Next = next
+		s.mu.Unlock()
+
+		var timer *time.Timer
+		var due <-chan time.Time
+		if !next.IsZero() {
+			timer = time.NewTimer(time.Until(next))
+			due = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-due:
+		case <-j.trigger:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		start := time.Now()
+		s.mu.Lock()
+		j.status.Running, j.status.LastStart = true, start
+		s.mu.Unlock()
+		err := j.Run(ctx)
+		s.mu.Lock()
+		j.status.Running = false
+		j.status.Runs++
+		j.status.LastDuration = time.Since(start)
+		j.status.LastError = ""
+		if err != nil {
+			j.status.Failures++
+			j.status.LastError = err.Error()
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.Jobs())
+}
+
+func (s *Server) handleRunJob(w http.ResponseWriter, r *http.Request) {
+	if !s.RunJob(r.PathValue("name")) {
+		writeError(w, http.StatusNotFound, "No such job")
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// RefreshLists returns a job function refreshing srcs into lists, e.g.
+// Tor exit lists. All sources are refreshed even if one fails.
+func RefreshLists(lists *ipintel.Lists, hc *http.Client, srcs ...ipintel.ListSource) func(context.Context) error {
+	return func(ctx context.Context) error {
+		var first error
+		for _, src := range srcs {
+			if err := lists.Refresh(ctx, hc, src); err != nil && first == nil {
+				first = err
+			}
+		}
+		return first
+	}
+}
+
+// Recheck returns a job function re-checking stale IPs, such as
+// blocklist entries, once with sched (see ipintel.Scheduler.RunOnce).
+func Recheck(sched *ipintel.Scheduler) func(context.Context) error {
+	return func(ctx context.Context) error {
+		_, err := sched.RunOnce(ctx)
+		return err
+	}
+}
+
+// RecordSource is a Store returning past lookups, such as
+// ipintelstore.Store.
+type RecordSource interface {
+	Since(ctx context.Context, t time.Time) ([]ipintel.Record, error)
+}
+
+// WriteReport returns a job function writing a report of the lookups
+// of the last period found in src to path, replacing the file
+// atomically. The format follows the extension: HTML for .html, JSON for
+// .json and Markdown otherwise.
+func WriteReport(src RecordSource, path string, period time.Duration, opts ipintel.ReportOptions) func(context.Context) error {
+	return func(ctx context.Context) error {
+		recs, err := src.Since(ctx, time.Now().Add(-period))
+		if err != nil {
+			return err
+		}
+		report := ipintel.NewReport(recs, opts)
+		f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".html":
+			err = report.WriteHTML(f)
+		case ".json":
+			enc := json.NewEncoder(f)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(report)
+		default:
+			err = report.WriteMarkdown(f)
+		}
+		if err == nil {
+			err = f.Chmod(0644)
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(f.Name())
+			return err
+		}
+		return os.Rename(f.Name(), path)
+	}
+}
+
+// ScanLog returns a job function reading the log file at path with
+// parse and looking up its client IPs with c, most active first. IPs
+// found by earlier runs are normally answered by c's cache. The run
+// fails if any lookup fails.
+func ScanLog(c ipintel.Checker, path string, parse ipintellog.Parser) func(context.Context) error {
+	return func(ctx context.Context) error {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		t := ipintellog.NewTally()
+		err = t.Read(f, parse)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		sources := t.Sources()
+		ipintellog.Score(ctx, c, sources)
+		failed := 0
+		for _, s := range sources {
+			if s.Err != nil {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d lookups failed", failed, len(sources))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,20 @@
+package ipintelserver
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// OpenAPI is the OpenAPI 3 specification of the API of a Server, served
+// at GET /openapi.json. It describes all endpoints, including those of
+// the admin API a Server only serves with their options.
+//
+//go:embed openapi.json
+var OpenAPI []byte
+
+// handleOpenAPI serves the specification, open to all clients, as it
+// holds nothing but the API.
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(OpenAPI)
+}
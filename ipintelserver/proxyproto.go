@@ -0,0 +1,245 @@
+package ipintelserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProxyHeaderTimeout is the time a peer has to send its PROXY protocol
+// header after connecting to a ProxyListener.
+const ProxyHeaderTimeout = 10 * time.Second
+
+// proxyV2Sig starts PROXY protocol v2 headers.
+var proxyV2Sig = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// ProxyListener returns a Listener accepting connections from l that
+// start with a HAProxy PROXY protocol header, v1 or v2, if their peer is
+// in trusted, e.g. the load balancers in front of the server. The
+// RemoteAddr and LocalAddr of such connections are the client and server
+// addresses of the header, and reading them fails if the header is
+// missing or malformed. Connections from other peers are passed
+// unchanged. To require a header from all peers, trust 0.0.0.0/0 and
+// ::/0.
+//
+// The header is read on the first call of Read, RemoteAddr or LocalAddr,
+// so a slow peer doesn't hold up Accept.
+func ProxyListener(l net.Listener, trusted ...netip.Prefix) net.Listener {
+	return &proxyListener{Listener: l, trusted: trusted}
+}
+
+type proxyListener struct {
+	net.Listener
+	trusted []netip.Prefix
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	ip, ok := peerIP(conn)
+	if !ok {
+		return conn, nil
+	}
+	for _, p := range l.trusted {
+		if p.Contains(ip) {
+			return &proxyConn{Conn: conn}, nil
+		}
+	}
+	return conn, nil
+}
+
+// proxyConn is a connection starting with a PROXY protocol header.
+type proxyConn struct {
+	net.Conn
+	once     sync.Once
+	r        *bufio.Reader
+	src, dst net.Addr
+	err      error
+}
+
+// header reads the header unless done and returns the error reading it.
+func (c *proxyConn) header() error {
+	c.once.Do(func() {
+		c.Conn.SetReadDeadline(time.Now().Add(ProxyHeaderTimeout))
+		c.r = bufio.NewReader(c.Conn)
+		var src, dst netip.AddrPort
+		src, dst, c.err = ReadProxyHeader(c.r)
+		c.Conn.SetReadDeadline(time.Time{})
+		if c.err == nil && src.IsValid() {
+			c.src, c.dst = net.TCPAddrFromAddrPort(src), net.TCPAddrFromAddrPort(dst)
+		}
+	})
+	return c.err
+}
+
+func (c *proxyConn) Read(p []byte) (int, error) {
+	if err := c.header(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	if c.header(); c.src != nil {
+		return c.src
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *proxyConn) LocalAddr() net.Addr {
+	if c.header(); c.dst != nil {
+		return c.dst
+	}
+	return c.Conn.LocalAddr()
+}
+
+// CloseWrite closes the writing side of the connection if supported,
+// otherwise the whole connection.
+func (c *proxyConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return c.Conn.Close()
+}
+
+// ReadProxyHeader reads a PROXY protocol header, v1 or v2, from r and
+// returns the client and server addresses it announces. They are
+// invalid for headers without addresses, such as health checks of the
+// load balancer (v1 UNKNOWN, v2 LOCAL) and non-IP connections.
+func ReadProxyHeader(r *bufio.Reader) (src, dst netip.AddrPort, err error) {
+	b, err := r.Peek(1)
+	if err != nil {
+		return src, dst, err
+	}
+	if b[0] == proxyV2Sig[0] {
+		return readProxyV2(r)
+	}
+	return readProxyV1(r)
+}
+
+func readProxyV1(r *bufio.Reader) (src, dst netip.AddrPort, err error) {
+	// at most 107 bytes including CRLF
+	var line []byte
+	for len(line) < 107 {
+		c, err := r.ReadByte()
+		if err != nil {
+			return src, dst, err
+		}
+		line = append(line, c)
+		if c == '\n' {
+			break
+		}
+	}
+	s, ok := strings.CutSuffix(string(line), "\r\n")
+	if !ok || !strings.HasPrefix(s, "PROXY ") {
+		return src, dst, fmt.Errorf("Malformed PROXY protocol header")
+	}
+	f := strings.Fields(s)
+	if len(f) >= 2 && f[1] == "UNKNOWN" {
+		return src, dst, nil
+	}
+	if len(f) != 6 || (f[1] != "TCP4" && f[1] != "TCP6") {
+		return src, dst, fmt.Errorf("Malformed PROXY protocol header %q", s)
+	}
+	if src, err = parseAddrPort(f[2], f[4]); err == nil {
+		dst, err = parseAddrPort(f[3], f[5])
+	}
+	if err != nil || src.Addr().Is4() != (f[1] == "TCP4") || dst.Addr().Is4() != (f[1] == "TCP4") {
+		return netip.AddrPort{}, netip.AddrPort{}, fmt.Errorf("Malformed PROXY protocol header %q", s)
+	}
+	return src, dst, nil
+}
+
+func parseAddrPort(ip, port string) (netip.AddrPort, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+	return netip.AddrPortFrom(addr, uint16(p)), nil
+}
+
+func readProxyV2(r *bufio.Reader) (src, dst netip.AddrPort, err error) {
+	hdr := make([]byte, 16)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return src, dst, err
+	}
+	if !bytes.Equal(hdr[:12], proxyV2Sig) || hdr[12]>>4 != 2 {
+		return src, dst, fmt.Errorf("Malformed PROXY protocol v2 header")
+	}
+	body := make([]byte, binary.BigEndian.Uint16(hdr[14:]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return src, dst, err
+	}
+	switch hdr[12] & 0xf {
+	case 0: // LOCAL
+		return src, dst, nil
+	case 1: // PROXY
+	default:
+		return src, dst, fmt.Errorf("Unknown PROXY protocol v2 command %d", hdr[12]&0xf)
+	}
+	var n int
+	switch hdr[13] >> 4 {
+	case 1:
+		n = 4
+	case 2:
+		n = 16
+	default:
+		// unspecified or Unix sockets: no IP addresses
+		return src, dst, nil
+	}
+	if len(body) < 2*n+4 {
+		return src, dst, fmt.Errorf("Short PROXY protocol v2 header")
+	}
+	srcIP, _ := netip.AddrFromSlice(body[:n])
+	dstIP, _ := netip.AddrFromSlice(body[n : 2*n])
+	src = netip.AddrPortFrom(srcIP, binary.BigEndian.Uint16(body[2*n:]))
+	dst = netip.AddrPortFrom(dstIP, binary.BigEndian.Uint16(body[2*n+2:]))
+	return src, dst, nil
+}
+
+// WriteProxyHeader writes a PROXY protocol header of version 1 or 2 to
+// w, announcing a TCP connection from src to dst. If only one of them is
+// IPv4, it is written as an IPv4-mapped IPv6 address.
+func WriteProxyHeader(w io.Writer, version int, src, dst netip.AddrPort) error {
+	srcIP, dstIP := src.Addr().Unmap(), dst.Addr().Unmap()
+	if srcIP.Is4() != dstIP.Is4() {
+		srcIP, dstIP = netip.AddrFrom16(srcIP.As16()), netip.AddrFrom16(dstIP.As16())
+	}
+	switch version {
+	case 1:
+		proto := "TCP6"
+		if srcIP.Is4() {
+			proto = "TCP4"
+		}
+		_, err := fmt.Fprintf(w, "PROXY %s %s %s %d %d\r\n", proto, srcIP, dstIP, src.Port(), dst.Port())
+		return err
+	case 2:
+		b := append([]byte(nil), proxyV2Sig...)
+		if srcIP.Is4() {
+			b = append(b, 0x21, 0x11, 0, 12)
+		} else {
+			b = append(b, 0x21, 0x21, 0, 36)
+		}
+		b = append(b, srcIP.AsSlice()...)
+		b = append(b, dstIP.AsSlice()...)
+		b = binary.BigEndian.AppendUint16(b, src.Port())
+		b = binary.BigEndian.AppendUint16(b, dst.Port())
+		_, err := w.Write(b)
+		return err
+	}
+	return fmt.Errorf("Unknown PROXY protocol version %d", version)
+}
@@ -0,0 +1,143 @@
+package ipintelserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+// proxyV2 returns a v2 header of version/command verCmd and family/
+// protocol famProto with body, its length given by the header.
+func proxyV2(verCmd, famProto byte, body []byte) []byte {
+	b := append([]byte(nil), proxyV2Sig...)
+	b = append(b, verCmd, famProto)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(body)))
+	return append(b, body...)
+}
+
+// v2Addrs returns the address block of a v2 header.
+func v2Addrs(src, dst string, srcPort, dstPort uint16) []byte {
+	b := append(netip.MustParseAddr(src).AsSlice(), netip.MustParseAddr(dst).AsSlice()...)
+	b = binary.BigEndian.AppendUint16(b, srcPort)
+	return binary.BigEndian.AppendUint16(b, dstPort)
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	v4 := v2Addrs("192.0.2.1", "198.51.100.2", 52144, 443)
+	v6 := v2Addrs("2001:db8::1", "2001:db8::2", 52144, 443)
+	long := "PROXY TCP6 " + strings.Repeat("f", 100) + "\r\n"
+	for _, tt := range []struct {
+		name     string
+		header   []byte
+		src, dst string
+		bad      bool
+	}{
+		{name: "v1 TCP4", header: []byte("PROXY TCP4 192.0.2.1 198.51.100.2 52144 443\r\n"), src: "192.0.2.1:52144", dst: "198.51.100.2:443"},
+		{name: "v1 TCP6", header: []byte("PROXY TCP6 2001:db8::1 2001:db8::2 52144 443\r\n"), src: "[2001:db8::1]:52144", dst: "[2001:db8::2]:443"},
+		{name: "v1 UNKNOWN", header: []byte("PROXY UNKNOWN\r\n")},
+		{name: "v1 UNKNOWN with addresses", header: []byte("PROXY UNKNOWN ffff:f::1 ffff:f::2 1 2\r\n")},
+		{name: "v1 without CR", header: []byte("PROXY TCP4 192.0.2.1 198.51.100.2 52144 443\n"), bad: true},
+		{name: "v1 truncated", header: []byte("PROXY TCP4 192.0.2.1 198.51"), bad: true},
+		{name: "v1 overlong", header: []byte(long), bad: true},
+		{name: "v1 missing port", header: []byte("PROXY TCP4 192.0.2.1 198.51.100.2 52144\r\n"), bad: true},
+		{name: "v1 bad port", header: []byte("PROXY TCP4 192.0.2.1 198.51.100.2 52144 65536\r\n"), bad: true},
+		{name: "v1 family mismatch", header: []byte("PROXY TCP4 2001:db8::1 198.51.100.2 1 2\r\n"), bad: true},
+		{name: "v1 bad protocol", header: []byte("PROXY UDP4 192.0.2.1 198.51.100.2 1 2\r\n"), bad: true},
+		{name: "not a header", header: []byte("GET / HTTP/1.1\r\n"), bad: true},
+		{name: "empty", header: nil, bad: true},
+
+		{name: "v2 TCP4", header: proxyV2(0x21, 0x11, v4), src: "192.0.2.1:52144", dst: "198.51.100.2:443"},
+		{name: "v2 TCP6", header: proxyV2(0x21, 0x21, v6), src: "[2001:db8::1]:52144", dst: "[2001:db8::2]:443"},
+		// TLVs follow the addresses
+		{name: "v2 TCP4 with TLVs", header: proxyV2(0x21, 0x11, append(v4, 0x04, 0, 1, 0)), src: "192.0.2.1:52144", dst: "198.51.100.2:443"},
+		{name: "v2 LOCAL", header: proxyV2(0x20, 0x00, nil)},
+		{name: "v2 LOCAL with addresses", header: proxyV2(0x20, 0x11, v4)},
+		{name: "v2 unix socket", header: proxyV2(0x21, 0x31, make([]byte, 216))},
+		{name: "v2 unspecified family", header: proxyV2(0x21, 0x00, nil)},
+		{name: "v2 short for TCP4", header: proxyV2(0x21, 0x11, v4[:10]), bad: true},
+		{name: "v2 TCP6 length of TCP4", header: proxyV2(0x21, 0x21, v4), bad: true},
+		{name: "v2 bad command", header: proxyV2(0x22, 0x11, v4), bad: true},
+		{name: "v2 bad version", header: proxyV2(0x11, 0x11, v4), bad: true},
+		{name: "v2 bad signature", header: append([]byte("\r\n\r\n\x00\r\nQUIX\n"), proxyV2(0x21, 0x11, v4)[12:]...), bad: true},
+		{name: "v2 truncated header", header: proxyV2(0x21, 0x11, v4)[:14], bad: true},
+		{name: "v2 truncated body", header: proxyV2(0x21, 0x11, v4)[:20], bad: true},
+	} {
+		r := bufio.NewReader(io.MultiReader(bytes.NewReader(tt.header), strings.NewReader("payload")))
+		src, dst, err := ReadProxyHeader(r)
+		if tt.bad {
+			if err == nil {
+				t.Errorf("%s: no error, got %v -> %v", tt.name, src, dst)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := addrString(src); got != tt.src {
+			t.Errorf("%s: source %s, want %s", tt.name, got, tt.src)
+		}
+		if got := addrString(dst); got != tt.dst {
+			t.Errorf("%s: destination %s, want %s", tt.name, got, tt.dst)
+		}
+		// the header is consumed, the payload left
+		if rest, _ := io.ReadAll(r); string(rest) != "payload" {
+			t.Errorf("%s: left %q after the header, want the payload", tt.name, rest)
+		}
+	}
+}
+
+// addrString returns ap as a string, "" if invalid.
+func addrString(ap netip.AddrPort) string {
+	if !ap.IsValid() {
+		return ""
+	}
+	return ap.String()
+}
+
+func TestWriteProxyHeader(t *testing.T) {
+	for _, version := range []int{1, 2} {
+		for _, tt := range []struct{ src, dst, wantSrc, wantDst string }{
+			{"192.0.2.1:1234", "198.51.100.2:443", "192.0.2.1:1234", "198.51.100.2:443"},
+			{"[2001:db8::1]:1234", "[2001:db8::2]:443", "[2001:db8::1]:1234", "[2001:db8::2]:443"},
+			{"192.0.2.1:1234", "[2001:db8::2]:443", "[::ffff:192.0.2.1]:1234", "[2001:db8::2]:443"},
+		} {
+			var buf bytes.Buffer
+			if err := WriteProxyHeader(&buf, version, netip.MustParseAddrPort(tt.src), netip.MustParseAddrPort(tt.dst)); err != nil {
+				t.Fatal(err)
+			}
+			src, dst, err := ReadProxyHeader(bufio.NewReader(&buf))
+			if err != nil || src.String() != tt.wantSrc || dst.String() != tt.wantDst {
+				t.Errorf("v%d %s -> %s: read back %v -> %v, %v", version, tt.src, tt.dst, src, dst, err)
+			}
+		}
+	}
+	if err := WriteProxyHeader(io.Discard, 3, netip.AddrPort{}, netip.AddrPort{}); err == nil {
+		t.Error("WriteProxyHeader of version 3 succeeded")
+	}
+}
+
+func FuzzReadProxyHeader(f *testing.F) {
+	f.Add([]byte("PROXY TCP4 192.0.2.1 198.51.100.2 52144 443\r\n"))
+	f.Add([]byte("PROXY TCP6 2001:db8::1 2001:db8::2 52144 443\r\n"))
+	f.Add([]byte("PROXY UNKNOWN\r\n"))
+	f.Add(proxyV2(0x21, 0x11, v2Addrs("192.0.2.1", "198.51.100.2", 1, 2)))
+	f.Add(proxyV2(0x21, 0x21, v2Addrs("2001:db8::1", "2001:db8::2", 1, 2)))
+	f.Add(proxyV2(0x20, 0x00, nil))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		src, dst, err := ReadProxyHeader(bufio.NewReader(bytes.NewReader(data)))
+		if err != nil {
+			return
+		}
+		if src.IsValid() != dst.IsValid() {
+			t.Fatalf("only one address valid: %v -> %v", src, dst)
+		}
+		if src.IsValid() && src.Addr().Is4() != dst.Addr().Is4() {
+			t.Fatalf("addresses of different families: %v -> %v", src, dst)
+		}
+	})
+}
@@ -0,0 +1,291 @@
+// Package ipintelserver provides the scoring service run by
+// "ipintel serve": an HTTP API answering lookups from a shared Checker,
+// so all services of an organization draw from one cache and quota, and
+// background jobs such as list refreshes and reports.
+//
+// Example:
+//
+//	srv := ipintelserver.New(c)
+//	srv.AddJob(ipintelserver.Job{
+//		Name:     "tor",
+//		Schedule: ipintelserver.MustParseSchedule("@every 1h"),
+//		Run:      ipintelserver.RefreshLists(lists, nil, torSource),
+//	})
+//	go srv.Run(ctx)
+//	http.ListenAndServe("127.0.0.1:8080", srv)
+//
+// The API:
+//
+//	GET    /v1/check/{ip}             the Result of ip
+//	POST   /v1/jobs                   look up {"ips": [...]} in the background
+//	GET    /v1/jobs/{id}              the progress and results of a lookup
+//	GET    /v1/jobs/{id}/events       stream the results of a lookup
+//	DELETE /v1/jobs/{id}              cancel a lookup
+//	GET    /v1/events                 stream Results scoring at least ?min_score=
+//	GET    /openapi.json              the OpenAPI specification of the API
+//	GET    /admin/jobs                the status of all jobs
+//	POST   /admin/jobs/{name}/run     run a job now
+//	GET    /admin/stats               the counters of the Client
+//	GET    /admin/quota               the queries the limiter allows now
+//	DELETE /admin/cache               drop all cached Results
+//	DELETE /admin/cache/{ip}          drop the cached Results of ip
+//	DELETE /admin/cache/{ip}/{bits}   drop those of a range, e.g. 192.0.2.0/24
+//	GET    /admin/lists               the local lists and their sizes
+//	GET    /admin/lists/{name}        the entries of a list
+//	PATCH  /admin/lists/{name}        {"add": [...], "remove": [...]} entries
+//	DELETE /admin/lists/{name}        remove a list
+//	POST   /admin/reload              reload the configuration
+//
+// The stats and quota endpoints are only served WithClient, the cache
+// endpoints WithInvalidator, the list endpoints WithLists and reloads
+// WithReloader. NewHandler serves the API under /ipintel for mounting
+// in the mux of another service.
+//
+// The admin API is only served on localhost unless protected
+// WithAdminToken. The lookup API should be protected WithTokens unless
+// the Server only listens on localhost. WithQueryLimit keeps each
+// consumer of the lookup API to its share of the API quota. Tokens of a
+// Tenant have their lookups answered by its own Checker. They see only
+// its jobs and events, so several teams can share one daemon.
+//
+// For TLS, a CertReloader serves certificates that are renewed in
+// place. Under systemd, the Server can be served on the sockets of
+// SystemdListeners and report its state with SystemdNotify. Package
+// ipintelclient is a client of the API.
+//
+// For TCP services that can't check their clients themselves, a
+// Gatekeeper proxies connections to them, dropping those of risky IPs.
+package ipintelserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+)
+
+// Server serves the scoring API and runs the jobs added to it. It is
+// safe for concurrent use.
+type Server struct {
+	checker ipintel.Checker
+	mux     *http.ServeMux
+	// Path the routes are served under; "" for the root
+	prefix string
+	// API keys of the lookup API by their SHA-256 hash; open if nil
+	tokens map[[sha256.Size]byte]*apiToken
+	// Default share of API queries and the consumers of the API not
+	// identified by a Token
+	queryLimit queryLimit
+	consumerMu sync.Mutex
+	consumers  map[string]*consumer
+	// Parts of the admin API, each enabled by its option
+	adminToken  string
+	invalidator ipintel.Invalidator
+	client      *ipintel.Client
+	lists       *ipintel.Lists
+	reload      func(ctx context.Context) error
+
+	mu   sync.Mutex
+	jobs []*job
+
+	// Closed by Shutdown, ending streams and refusing batch lookups,
+	// and canceled once its deadline passes, ending batch lookups
+	draining  chan struct{}
+	drainOnce sync.Once
+	ctx       context.Context
+	stop      context.CancelFunc
+	// Batch lookups
+	maxBatch       int
+	batchRetention time.Duration
+	maxRunning     int
+	batchWG        sync.WaitGroup
+	batchMu        sync.Mutex
+	batches        map[string]*batch
+	// running batches by owner, guarded by batchMu
+	running map[string]int
+	// Subscribers of the live feed of Results
+	feed feed
+}
+
+// Option configures a Server in New.
+type Option func(*Server)
+
+// WithInvalidator serves the cache endpoints of the admin API with
+// inv, usually the ipintel.Client answering the lookups.
+func WithInvalidator(inv ipintel.Invalidator) Option {
+	return func(s *Server) {
+		s.invalidator = inv
+	}
+}
+
+// New returns a Server answering lookups with c.
+func New(c ipintel.Checker, opts ...Option) *Server {
+	s := &Server{
+		checker:        c,
+		mux:            http.NewServeMux(),
+		maxBatch:       DefaultMaxBatch,
+		batchRetention: DefaultBatchRetention,
+		maxRunning:     DefaultMaxRunningBatches,
+		batches:        make(map[string]*batch),
+		running:        make(map[string]int),
+		draining:       make(chan struct{}),
+	}
+	s.ctx, s.stop = context.WithCancel(context.Background())
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.initConsumers()
+	s.handleAPI("GET /v1/check/{ip}", s.handleCheck)
+	s.handleAPI("POST /v1/jobs", s.handleBatch)
+	s.handleAPI("GET /v1/jobs/{id}", s.handleBatchStatus)
+	s.handleAPI("GET /v1/jobs/{id}/events", s.handleBatchEvents)
+	s.handleAPI("DELETE /v1/jobs/{id}", s.handleCancelBatch)
+	s.handleAPI("GET /v1/events", s.handleEvents)
+	s.handle("GET /openapi.json", s.handleOpenAPI)
+	s.handleAdmin("GET /admin/jobs", s.handleJobs)
+	s.handleAdmin("POST /admin/jobs/{name}/run", s.handleRunJob)
+	if s.client != nil {
+		s.handleAdmin("GET /admin/stats", s.handleStats)
+		s.handleAdmin("GET /admin/quota", s.handleQuota)
+	}
+	if s.invalidator != nil {
+		if _, ok := s.invalidator.(flusher); ok {
+			s.handleAdmin("DELETE /admin/cache", s.handleFlush)
+		}
+		s.handleAdmin("DELETE /admin/cache/{ip}", s.handleInvalidate)
+		s.handleAdmin("DELETE /admin/cache/{ip}/{bits}", s.handleInvalidate)
+	}
+	if s.lists != nil {
+		s.handleAdmin("GET /admin/lists", s.handleLists)
+		s.handleAdmin("GET /admin/lists/{name}", s.handleList)
+		s.handleAdmin("PATCH /admin/lists/{name}", s.handlePatchList)
+		s.handleAdmin("DELETE /admin/lists/{name}", s.handleDeleteList)
+	}
+	if s.reload != nil {
+		s.handleAdmin("POST /admin/reload", s.handleReload)
+	}
+	return s
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Shutdown ends the event streams and refuses new batch lookups, then
+// waits for the running ones to finish until ctx is done, canceling
+// them from then on, and returns ctx.Err() if it was. It is meant to be
+// called along with http.Server.Shutdown, which waits for the streams.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.drainOnce.Do(func() {
+		s.batchMu.Lock()
+		close(s.draining)
+		s.batchMu.Unlock()
+	})
+	done := make(chan struct{})
+	go func() {
+		s.batchWG.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		s.stop()
+		return nil
+	case <-ctx.Done():
+		s.stop()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// errorJSON is the body of error responses.
+type errorJSON struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, errorJSON{msg})
+}
+
+func (s *Server) handleCheck(w http.ResponseWriter, r *http.Request) {
+	ip, err := netip.ParseAddr(r.PathValue("ip"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid IP address")
+		return
+	}
+	tenant := tenantOf(r.Context())
+	res, err := s.checkerFor(tenant).GetProxyScore(r.Context(), ip.String())
+	if err != nil {
+		var qe *QueryLimitError
+		if errors.As(err, &qe) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(qe.RetryIn.Seconds()))))
+		}
+		writeError(w, lookupStatus(err), err.Error())
+		return
+	}
+	s.feed.publish(tenant, res)
+	writeDecision(w, tenant, res)
+	writeJSON(w, http.StatusOK, res)
+}
+
+// invalidatedJSON is the body of cache invalidation responses.
+type invalidatedJSON struct {
+	Invalidated int `json:"invalidated"`
+}
+
+func (s *Server) handleInvalidate(w http.ResponseWriter, r *http.Request) {
+	var (
+		n   int
+		err error
+	)
+	if bits := r.PathValue("bits"); bits != "" {
+		prefix, perr := netip.ParsePrefix(r.PathValue("ip") + "/" + bits)
+		if perr != nil {
+			writeError(w, http.StatusBadRequest, "Invalid IP range")
+			return
+		}
+		n, err = s.invalidator.InvalidateRange(r.Context(), prefix)
+	} else {
+		ip, perr := netip.ParseAddr(r.PathValue("ip"))
+		if perr != nil {
+			writeError(w, http.StatusBadRequest, "Invalid IP address")
+			return
+		}
+		n, err = s.invalidator.Invalidate(r.Context(), ip.String())
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, invalidatedJSON{n})
+}
+
+// lookupStatus returns the HTTP status of a failed lookup.
+func lookupStatus(err error) int {
+	var te *ipintel.ThrottleError
+	var qe *QueryLimitError
+	var ae *ipintel.APIError
+	switch {
+	case errors.As(err, &te), errors.As(err, &qe):
+		return http.StatusTooManyRequests
+	case errors.As(err, &ae) && (ae.Code == ipintel.CodeInvalidIP || ae.Code == ipintel.CodeUnroutableIP):
+		return http.StatusBadRequest
+	case errors.As(err, &ae) && ae.RateLimited():
+		return http.StatusTooManyRequests
+	}
+	return http.StatusBadGateway
+}
@@ -0,0 +1,113 @@
+package ipintelserver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sdListenFDsStart is the first file descriptor passed by systemd.
+const sdListenFDsStart = 3
+
+// SystemdListeners returns the sockets passed by systemd socket
+// activation, in the order of the socket unit, or none if the process
+// wasn't started that way. The LISTEN_* variables are removed from the
+// environment, so child processes don't take the sockets for theirs.
+//
+// Example unit files, ipintel.socket and ipintel.service:
+//
+//	[Socket]
+//	ListenStream=8080
+//
+//	[Service]
+//	Type=notify
+//	ExecStart=/usr/local/bin/ipintel serve -config /etc/ipintel.yaml
+//	ExecReload=/bin/kill -HUP $MAINPID
+//	WatchdogSec=30
+func SystemdListeners() ([]net.Listener, error) {
+	pid, fds := os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS")
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if pid != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(fds)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("Invalid LISTEN_FDS %q", fds)
+	}
+	listeners := make([]net.Listener, 0, n)
+	for i := 0; i < n; i++ {
+		name := "LISTEN_FD_" + strconv.Itoa(sdListenFDsStart+i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(sdListenFDsStart+i), name)
+		// FileListener duplicates the descriptor
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("Socket %s passed by systemd: %w", name, err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// SystemdNotify sends state, e.g. "READY=1" or "STOPPING=1", to the
+// service manager, if the process was started with NOTIFY_SOCKET, like
+// sd_notify(3). It does nothing otherwise.
+func SystemdNotify(state string) error {
+	path := os.Getenv("NOTIFY_SOCKET")
+	if path == "" {
+		return nil
+	}
+	// abstract socket
+	if path[0] == '@' {
+		path = "\x00" + path[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("Failed to notify systemd: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("Failed to notify systemd: %w", err)
+	}
+	return nil
+}
+
+// SystemdWatchdog keeps the watchdog of the service manager from
+// restarting the process, sending "WATCHDOG=1" at half the interval of
+// WatchdogSec= until ctx is done and passing failures to onError if not
+// nil. It returns right away if the watchdog isn't enabled for the
+// process.
+func SystemdWatchdog(ctx context.Context, onError func(error)) {
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return
+	}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(usec) * time.Microsecond / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := SystemdNotify("WATCHDOG=1"); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package ipintelserver
+
+import (
+	"context"
+	"net/http"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+)
+
+// Tenant is a customer of a Server shared by several teams, selected by
+// the Tokens it is set on. Its lookups, batch lookups and event streams
+// are kept apart from those of other tenants.
+//
+// Example:
+//
+//	acme := &ipintelserver.Tenant{
+//		Name: "acme",
+//		Checker: c.WithOptions(
+//			ipintel.WithEmail("ops@acme.example"),
+//			ipintel.WithLimiter(ipintel.NewLimiter(nil)),
+//			ipintel.WithCache(ipintel.NamespaceCache(cache, "acme"), 24*time.Hour),
+//		),
+//		Policy: ipintel.BlockRisk(ipintel.Medium),
+//	}
+//	srv := ipintelserver.New(c, ipintelserver.WithTokens(
+//		ipintelserver.Token{Name: "acme-web", Key: key, Tenant: acme},
+//	))
+type Tenant struct {
+	Name string
+	// Answers the lookups of the tenant, usually a Client with its own
+	// contact address, Limiter and cache namespace
+	Checker ipintel.Checker
+	// Decides the X-IPIntel-Decision header, "block" or "allow", of
+	// the tenant's lookups; none is sent if nil
+	Policy ipintel.Policy
+}
+
+// DecisionHeader is the response header of GET /v1/check/{ip} telling
+// the decision of the Tenant's Policy.
+const DecisionHeader = "X-IPIntel-Decision"
+
+// tenantOf returns the Tenant of a request context, nil for the
+// default one of the Server.
+func tenantOf(ctx context.Context) *Tenant {
+	if t, ok := ctx.Value(tokenKey{}).(*apiToken); ok {
+		return t.Tenant
+	}
+	return nil
+}
+
+// checkerFor returns the Checker of tenant t.
+func (s *Server) checkerFor(t *Tenant) ipintel.Checker {
+	if t != nil {
+		return t.Checker
+	}
+	return s.checker
+}
+
+// writeDecision sets the decision header of res if t has a Policy.
+func writeDecision(w http.ResponseWriter, t *Tenant, res ipintel.Result) {
+	if t == nil || t.Policy == nil {
+		return
+	}
+	decision := "allow"
+	if t.Policy(res) {
+		decision = "block"
+	}
+	w.Header().Set(DecisionHeader, decision)
+}
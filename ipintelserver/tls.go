@@ -0,0 +1,85 @@
+package ipintelserver
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// certCheckInterval is how often a CertReloader looks for changed
+// files.
+const certCheckInterval = 10 * time.Second
+
+// CertReloader serves a TLS certificate from files, loading it again
+// when they change, e.g. after a renewal by certbot, so the Server
+// needn't be restarted. It is safe for concurrent use.
+//
+// Example:
+//
+//	cr, err := ipintelserver.NewCertReloader("cert.pem", "key.pem")
+//	if err != nil {
+//		return err
+//	}
+//	hs := &http.Server{Handler: srv, TLSConfig: &tls.Config{GetCertificate: cr.GetCertificate}}
+//	hs.ListenAndServeTLS("", "")
+type CertReloader struct {
+	certFile, keyFile string
+	// Called with failed reloads; the previous certificate stays in use
+	OnError func(error)
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+	checked time.Time
+}
+
+// NewCertReloader loads the PEM encoded certificate chain and key of the
+// given files.
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	cr := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if err := cr.load(); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+// load reads the files if they changed. The caller holds cr.mu, except
+// in NewCertReloader.
+func (cr *CertReloader) load() error {
+	var modTime time.Time
+	for _, path := range []string{cr.certFile, cr.keyFile} {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if fi.ModTime().After(modTime) {
+			modTime = fi.ModTime()
+		}
+	}
+	if cr.cert != nil && modTime.Equal(cr.modTime) {
+		return nil
+	}
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return fmt.Errorf("Failed to load certificate %s: %w", cr.certFile, err)
+	}
+	cr.cert, cr.modTime = &cert, modTime
+	return nil
+}
+
+// GetCertificate returns the current certificate, for use as
+// tls.Config.GetCertificate. The files are checked for changes at most
+// every 10 seconds.
+func (cr *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	if now := time.Now(); now.Sub(cr.checked) >= certCheckInterval {
+		cr.checked = now
+		if err := cr.load(); err != nil && cr.OnError != nil {
+			cr.OnError(err)
+		}
+	}
+	return cr.cert, nil
+}
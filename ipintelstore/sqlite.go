@@ -0,0 +1,341 @@
+// Package ipintelstore provides an SQLite-backed ipintel.Store.
+//
+// It uses a pure-Go SQLite driver, so no cgo is required. With
+// WithCipher, IPs, identities and extra fields are stored encrypted.
+//
+// Example:
+//
+//	st, err := ipintelstore.Open("ipintel.db")
+//	...
+//	c := ipintel.NewClient("your@email.com", true, ipintel.Dynamic, 0, ipintel.WithStore(st))
+package ipintelstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+
+	// register the "sqlite" database/sql driver
+	_ "modernc.org/sqlite"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS lookups (
+	id         INTEGER PRIMARY KEY,
+	ip         TEXT    NOT NULL,
+	score      REAL    NOT NULL,
+	check_type TEXT    NOT NULL,
+	provider   TEXT    NOT NULL,
+	decision   TEXT    NOT NULL,
+	queried_at INTEGER NOT NULL,
+	extra      TEXT
+);
+CREATE INDEX IF NOT EXISTS lookups_ip ON lookups (ip);
+CREATE INDEX IF NOT EXISTS lookups_queried_at ON lookups (queried_at);
+CREATE TABLE IF NOT EXISTS identities (
+	id         INTEGER PRIMARY KEY,
+	identity   TEXT    NOT NULL,
+	ip         TEXT    NOT NULL,
+	score      REAL    NOT NULL,
+	check_type TEXT    NOT NULL,
+	queried_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS identities_identity ON identities (identity, queried_at);
+CREATE INDEX IF NOT EXISTS identities_ip ON identities (ip);
+`
+
+const columns = "ip, score, check_type, provider, decision, queried_at, extra"
+
+// Store is an ipintel.Store keeping every recorded lookup in an SQLite
+// database. It is safe for concurrent use.
+type Store struct {
+	db     *sql.DB
+	cipher *ipintel.Cipher
+	// Clock Enforce ages records by; the system clock if nil
+	clock ipintel.Clock
+}
+
+var (
+	_ ipintel.History       = (*Store)(nil)
+	_ ipintel.StaleSource   = (*Store)(nil)
+	_ ipintel.Purger        = (*Store)(nil)
+	_ ipintel.IdentityStore = (*Store)(nil)
+)
+
+// Option configures a Store in Open.
+type Option func(*Store)
+
+// WithCipher encrypts the IPs, identities and extra fields of records
+// with c. IPs and identities are encrypted deterministically (see
+// ipintel.Cipher.SealDeterministic) to be looked up, so the database
+// reveals which records share them, but not their values. A database
+// must be written with the same key from the start.
+func WithCipher(c *ipintel.Cipher) Option {
+	return func(s *Store) {
+		s.cipher = c
+	}
+}
+
+// WithClock makes Enforce age records by clock, e.g. the one passed to
+// ipintel.WithClock.
+func WithClock(clock ipintel.Clock) Option {
+	return func(s *Store) {
+		s.clock = clock
+	}
+}
+
+// Open opens (creating it if needed) the SQLite database at path.
+func Open(path string, opts ...Option) (*Store, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open database: %w", err)
+	}
+	// SQLite allows a single writer only
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("Failed to create schema: %w", err)
+	}
+	s := &Store{db: db}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s, nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Record stores rec.
+func (s *Store) Record(ctx context.Context, rec ipintel.Record) error {
+	var extra []byte
+	if len(rec.Extra) > 0 {
+		var err error
+		if extra, err = json.Marshal(rec.Extra); err != nil {
+			return err
+		}
+		if s.cipher != nil {
+			extra = []byte(base64.StdEncoding.EncodeToString(s.cipher.Seal(extra)))
+		}
+	}
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO lookups ("+columns+") VALUES (?, ?, ?, ?, ?, ?, ?)",
+		s.seal(rec.IP), rec.Score, string(rec.Check), rec.Provider, rec.Decision,
+		rec.QueriedAt.UnixNano(), extra)
+	return err
+}
+
+// ByIP returns all records for ip, oldest first.
+func (s *Store) ByIP(ctx context.Context, ip string) ([]ipintel.Record, error) {
+	return s.query(ctx, "SELECT "+columns+" FROM lookups WHERE ip = ? ORDER BY queried_at", s.seal(ip))
+}
+
+// Since returns all records queried at or after t, oldest first.
+func (s *Store) Since(ctx context.Context, t time.Time) ([]ipintel.Record, error) {
+	return s.query(ctx, "SELECT "+columns+" FROM lookups WHERE queried_at >= ? ORDER BY queried_at", t.UnixNano())
+}
+
+// RecordIdentity stores that identity used the IP of rec, for
+// ipintel.Tracker.
+func (s *Store) RecordIdentity(ctx context.Context, identity string, rec ipintel.Record) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO identities (identity, ip, score, check_type, queried_at) VALUES (?, ?, ?, ?, ?)",
+		s.seal(identity), s.seal(rec.IP), rec.Score, string(rec.Check), rec.QueriedAt.UnixNano())
+	return err
+}
+
+// ByIdentity returns the records of identity queried at or after t,
+// oldest first. They hold the IP, score, check type and time only.
+func (s *Store) ByIdentity(ctx context.Context, identity string, t time.Time) ([]ipintel.Record, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT ip, score, check_type, queried_at FROM identities
+		WHERE identity = ? AND queried_at >= ? ORDER BY queried_at`, s.seal(identity), t.UnixNano())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recs []ipintel.Record
+	for rows.Next() {
+		var (
+			rec       ipintel.Record
+			check     string
+			queriedAt int64
+		)
+		if err := rows.Scan(&rec.IP, &rec.Score, &check, &queriedAt); err != nil {
+			return nil, err
+		}
+		if rec.IP, err = s.open(rec.IP); err != nil {
+			return nil, err
+		}
+		rec.Check = ipintel.CheckType(check)
+		rec.QueriedAt = time.Unix(0, queriedAt)
+		recs = append(recs, rec)
+	}
+	return recs, rows.Err()
+}
+
+// PurgeIdentity deletes all records of identity.
+func (s *Store) PurgeIdentity(ctx context.Context, identity string) (int, error) {
+	return s.exec(ctx, "DELETE FROM identities WHERE identity = ?", s.seal(identity))
+}
+
+// TopScores returns the n IPs with the highest recorded scores, one
+// record per IP (the one with its highest score), highest first.
+func (s *Store) TopScores(ctx context.Context, n int) ([]ipintel.Record, error) {
+	// SQLite fills the bare columns from the row holding MAX(score)
+	return s.query(ctx, `SELECT ip, MAX(score), check_type, provider, decision, queried_at, extra
+		FROM lookups GROUP BY ip ORDER BY 2 DESC, ip LIMIT ?`, n)
+}
+
+// Stale returns up to limit IPs whose most recent record was queried
+// before t, least recently queried first.
+func (s *Store) Stale(ctx context.Context, before time.Time, limit int) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT ip FROM lookups GROUP BY ip
+		HAVING MAX(queried_at) < ? ORDER BY MAX(queried_at) LIMIT ?`, before.UnixNano(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ips []string
+	for rows.Next() {
+		var ip string
+		if err := rows.Scan(&ip); err != nil {
+			return nil, err
+		}
+		if ip, err = s.open(ip); err != nil {
+			return nil, err
+		}
+		ips = append(ips, ip)
+	}
+	return ips, rows.Err()
+}
+
+// PurgeBefore deletes all records queried before t, including those of
+// identities.
+func (s *Store) PurgeBefore(ctx context.Context, t time.Time) (int, error) {
+	n, err := s.exec(ctx, "DELETE FROM lookups WHERE queried_at < ?", t.UnixNano())
+	if err != nil {
+		return n, err
+	}
+	m, err := s.exec(ctx, "DELETE FROM identities WHERE queried_at < ?", t.UnixNano())
+	return n + m, err
+}
+
+// PurgeIP deletes all records of ip, including those of identities.
+func (s *Store) PurgeIP(ctx context.Context, ip string) (int, error) {
+	ip = s.seal(ip)
+	n, err := s.exec(ctx, "DELETE FROM lookups WHERE ip = ?", ip)
+	if err != nil {
+		return n, err
+	}
+	m, err := s.exec(ctx, "DELETE FROM identities WHERE ip = ?", ip)
+	return n + m, err
+}
+
+// Enforce deletes the records exceeding r and returns their number. It
+// should be called periodically, e.g. from a time.Ticker loop.
+func (s *Store) Enforce(ctx context.Context, r ipintel.Retention) (int, error) {
+	var n int
+	if r.MaxAge > 0 {
+		now := time.Now()
+		if s.clock != nil {
+			now = s.clock.Now()
+		}
+		purged, err := s.PurgeBefore(ctx, now.Add(-r.MaxAge))
+		if err != nil {
+			return n, err
+		}
+		n += purged
+	}
+	if r.MaxEntries > 0 {
+		purged, err := s.exec(ctx, `DELETE FROM lookups WHERE id NOT IN
+			(SELECT id FROM lookups ORDER BY queried_at DESC, id DESC LIMIT ?)`, r.MaxEntries)
+		if err != nil {
+			return n, err
+		}
+		n += purged
+	}
+	return n, nil
+}
+
+func (s *Store) exec(ctx context.Context, query string, args ...interface{}) (int, error) {
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func (s *Store) query(ctx context.Context, query string, args ...interface{}) ([]ipintel.Record, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recs []ipintel.Record
+	for rows.Next() {
+		var (
+			rec       ipintel.Record
+			check     string
+			queriedAt int64
+			extra     []byte
+		)
+		if err := rows.Scan(&rec.IP, &rec.Score, &check, &rec.Provider, &rec.Decision, &queriedAt, &extra); err != nil {
+			return nil, err
+		}
+		rec.Check = ipintel.CheckType(check)
+		rec.QueriedAt = time.Unix(0, queriedAt)
+		if rec.IP, err = s.open(rec.IP); err != nil {
+			return nil, err
+		}
+		if len(extra) > 0 && s.cipher != nil {
+			if extra, err = s.openBytes(string(extra)); err != nil {
+				return nil, err
+			}
+		}
+		if len(extra) > 0 {
+			if err := json.Unmarshal(extra, &rec.Extra); err != nil {
+				return nil, fmt.Errorf("Failed to decode extra fields: %w", err)
+			}
+		}
+		recs = append(recs, rec)
+	}
+	return recs, rows.Err()
+}
+
+// seal returns the stored form of v, which is v itself without a
+// Cipher.
+func (s *Store) seal(v string) string {
+	if s.cipher == nil {
+		return v
+	}
+	return base64.StdEncoding.EncodeToString(s.cipher.SealDeterministic([]byte(v)))
+}
+
+// open returns the value of the stored form v.
+func (s *Store) open(v string) (string, error) {
+	if s.cipher == nil {
+		return v, nil
+	}
+	b, err := s.openBytes(v)
+	return string(b), err
+}
+
+func (s *Store) openBytes(v string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(v)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decrypt: not encrypted")
+	}
+	return s.cipher.Open(data)
+}
@@ -0,0 +1,31 @@
+package ipintelstore
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+	"github.com/pierelucas/go-ipintel/ipinteltest"
+)
+
+func TestEnforceWithClock(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	s, err := Open(filepath.Join(t.TempDir(), "lookups.db"), WithClock(ipinteltest.NewClock(now)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	ctx := context.Background()
+	for _, age := range []time.Duration{time.Hour, 3 * time.Hour} {
+		rec := ipintel.Record{Result: ipintel.Result{IP: "192.0.2.1", Check: ipintel.Dynamic, QueriedAt: now.Add(-age)}}
+		if err := s.Record(ctx, rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n, err := s.Enforce(ctx, ipintel.Retention{MaxAge: 2 * time.Hour})
+	if err != nil || n != 1 {
+		t.Errorf("Enforce() = %d, %v; want 1 record older than 2h by the clock", n, err)
+	}
+}
@@ -0,0 +1,211 @@
+// Package ipintelsyslog provides an ipintel.Store sending lookups and
+// block decisions to a syslog collector in the RFC 5424 format.
+//
+// Example:
+//
+//	s, err := ipintelsyslog.Dial("udp", "logs.example.com:514",
+//		ipintelsyslog.WithFacility(ipintelsyslog.Local3))
+//	...
+//	defer s.Close()
+//	c := ipintel.NewClient("your@email.com", true, ipintel.Dynamic, 0, ipintel.WithStore(s))
+//	mw := ipintelmw.New(c, ipintelmw.WithDecisionStore(s))
+package ipintelsyslog
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+)
+
+// Facility is a syslog facility.
+type Facility int
+
+// Facilities commonly used for application logs.
+const (
+	Daemon   Facility = 3
+	Auth     Facility = 4
+	AuthPriv Facility = 10
+	Local0   Facility = 16
+	Local1   Facility = 17
+	Local2   Facility = 18
+	Local3   Facility = 19
+	Local4   Facility = 20
+	Local5   Facility = 21
+	Local6   Facility = 22
+	Local7   Facility = 23
+)
+
+// Severity is a syslog severity.
+type Severity int
+
+// Severities, from most to least severe.
+const (
+	Emergency Severity = iota
+	Alert
+	Critical
+	Error
+	Warning
+	Notice
+	Informational
+	Debug
+)
+
+// sdID is the structured data ID of the lookup fields. 32473 is the
+// enterprise number reserved for documentation (RFC 5612).
+const sdID = "ipintel@32473"
+
+// Sink is an ipintel.Store writing each record as a syslog message. It
+// is safe for concurrent use.
+type Sink struct {
+	network, addr string
+	facility      Facility
+	lookupSev     Severity
+	blockSev      Severity
+	hostname      string
+	appName       string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+var _ ipintel.Store = (*Sink)(nil)
+
+// Option configures a Sink in Dial.
+type Option func(*Sink)
+
+// Dial returns a Sink sending to the collector at addr over network:
+// "udp", "tcp" or "unix" for a local socket such as /dev/log. Messages
+// over TCP are framed by octet counting (RFC 6587). A failed write is
+// retried once over a new connection.
+//
+// By default, the facility is Local0, lookups are Informational and
+// block decisions Warning, and the app name is "ipintel".
+func Dial(network, addr string, opts ...Option) (*Sink, error) {
+	s := &Sink{
+		network:   network,
+		addr:      addr,
+		facility:  Local0,
+		lookupSev: Informational,
+		blockSev:  Warning,
+		appName:   "ipintel",
+	}
+	s.hostname, _ = os.Hostname()
+	for _, opt := range opts {
+		opt(s)
+	}
+	if err := s.dial(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// WithFacility sets the facility of the messages.
+func WithFacility(f Facility) Option {
+	return func(s *Sink) {
+		s.facility = f
+	}
+}
+
+// WithSeverity sets the severities of lookups and of block decisions.
+func WithSeverity(lookup, block Severity) Option {
+	return func(s *Sink) {
+		s.lookupSev, s.blockSev = lookup, block
+	}
+}
+
+// WithAppName sets the APP-NAME field of the messages.
+func WithAppName(name string) Option {
+	return func(s *Sink) {
+		s.appName = name
+	}
+}
+
+func (s *Sink) dial() error {
+	conn, err := net.DialTimeout(s.network, s.addr, 10*time.Second)
+	if err != nil {
+		return fmt.Errorf("Failed to connect to syslog: %w", err)
+	}
+	s.conn = conn
+	return nil
+}
+
+// Record sends rec.
+func (s *Sink) Record(ctx context.Context, rec ipintel.Record) error {
+	sev := s.lookupSev
+	if rec.Decision == ipintel.DecisionBlock {
+		sev = s.blockSev
+	}
+	msg := s.format(rec, sev, time.Now())
+	if s.network == "tcp" {
+		msg = strconv.Itoa(len(msg)) + " " + msg
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		if _, err := s.conn.Write([]byte(msg)); err == nil {
+			return nil
+		}
+		s.conn.Close()
+		s.conn = nil
+	}
+	if err := s.dial(); err != nil {
+		return err
+	}
+	if _, err := s.conn.Write([]byte(msg)); err != nil {
+		return fmt.Errorf("Failed to write to syslog: %w", err)
+	}
+	return nil
+}
+
+// format formats rec as an RFC 5424 message with its fields as
+// structured data and Record.String as the message.
+func (s *Sink) format(rec ipintel.Record, sev Severity, now time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %d - [%s", int(s.facility)*8+int(sev),
+		now.UTC().Format(time.RFC3339Nano), header(s.hostname), header(s.appName), os.Getpid(), sdID)
+	param := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, ` %s="%s"`, name, sdEscaper.Replace(value))
+		}
+	}
+	param("ip", rec.IP)
+	param("score", strconv.FormatFloat(float64(rec.Score), 'f', -1, 32))
+	param("check", rec.Check.String())
+	param("risk", rec.Risk().String())
+	param("provider", rec.Provider)
+	param("list", rec.List)
+	param("decision", rec.Decision)
+	b.WriteString("] ")
+	b.WriteString(rec.String())
+	return b.String()
+}
+
+// header returns a header field, "-" if empty.
+func header(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return strings.ReplaceAll(s, " ", "_")
+}
+
+var sdEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`, `]`, `\]`)
+
+// Close closes the connection to the collector.
+func (s *Sink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
@@ -0,0 +1,86 @@
+package ipinteltest
+
+import (
+	"context"
+	"net/http"
+	"net/netip"
+	"time"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+)
+
+// Rule scores ip, reporting false if it does not apply to ip.
+type Rule func(ip netip.Addr) (score float32, ok bool)
+
+// IP returns a Rule scoring the single address ip.
+// It panics if ip is not a valid IP address.
+func IP(ip string, score float32) Rule {
+	addr := netip.MustParseAddr(ip).Unmap()
+	return func(a netip.Addr) (float32, bool) {
+		return score, a == addr
+	}
+}
+
+// Prefix returns a Rule scoring all addresses within the CIDR prefix.
+// It panics if prefix is not a valid CIDR prefix.
+func Prefix(prefix string, score float32) Rule {
+	p := netip.MustParsePrefix(prefix)
+	return func(a netip.Addr) (float32, bool) {
+		return score, p.Contains(a)
+	}
+}
+
+// Provider is a deterministic fake ipintel.Provider that answers
+// from a fixed set of rules without any network access.
+// It is safe for concurrent use.
+type Provider struct {
+	rules []Rule
+	def   float32
+}
+
+var _ ipintel.Provider = (*Provider)(nil)
+
+// StaticProvider returns a Provider answering with the given scores.
+// IPs not in the map get a score of 0. It panics if a key is not a
+// valid IP address.
+func StaticProvider(scores map[string]float32) *Provider {
+	p := &Provider{}
+	for ip, score := range scores {
+		p.rules = append(p.rules, IP(ip, score))
+	}
+	return p
+}
+
+// RuleProvider returns a Provider answering with the score of the first
+// matching rule, or def if no rule matches.
+func RuleProvider(def float32, rules ...Rule) *Provider {
+	return &Provider{rules: rules, def: def}
+}
+
+// Name returns "fake".
+func (p *Provider) Name() string {
+	return "fake"
+}
+
+// GetProxyScore returns the score for ip. Like the API, it fails
+// for malformed addresses.
+func (p *Provider) GetProxyScore(ctx context.Context, ip string) (ipintel.Result, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ipintel.Result{}, &ipintel.APIError{
+			Code:       ErrInvalidIP,
+			StatusCode: http.StatusBadRequest,
+			Message:    errMessages[ErrInvalidIP],
+		}
+	}
+	addr = addr.Unmap()
+
+	score := p.def
+	for _, rule := range p.rules {
+		if s, ok := rule(addr); ok {
+			score = s
+			break
+		}
+	}
+	return ipintel.Result{IP: ip, Score: score, Provider: p.Name(), QueriedAt: time.Now()}, nil
+}
@@ -0,0 +1,173 @@
+package ipinteltest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// Mode selects whether a Recorder captures or replays API exchanges.
+type Mode int
+
+const (
+	// Replay answers requests from the fixture file without network access.
+	Replay Mode = iota
+	// Record forwards requests to the real API and captures the exchanges.
+	Record
+)
+
+// Interaction is a single recorded request/response pair.
+type Interaction struct {
+	Method string      `json:"method"`
+	Query  string      `json:"query"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body"`
+}
+
+// Recorder is an http.RoundTripper that records API exchanges to a
+// fixture file and replays them deterministically. Requests are matched
+// by method and query with the contact parameter ignored; it is redacted
+// from recorded fixtures. Identical requests are replayed in the order
+// they were recorded.
+//
+// Example:
+//
+//	rec, err := ipinteltest.NewRecorder("testdata/lookup.json", ipinteltest.Replay)
+//	...
+//	c := ipintel.NewClient("your@email.com", true, ipintel.Dynamic, 0,
+//		ipintel.WithHTTPClient(rec.HTTPClient()))
+type Recorder struct {
+	// Transport used to reach the API in Record mode.
+	// If nil, http.DefaultTransport is used.
+	Transport http.RoundTripper
+
+	mode         Mode
+	path         string
+	mu           sync.Mutex
+	interactions []Interaction
+	replayed     map[int]bool
+}
+
+// NewRecorder creates a Recorder for the fixture file at path. In Replay
+// mode the file is loaded immediately; in Record mode it is written by Save.
+func NewRecorder(path string, mode Mode) (*Recorder, error) {
+	r := &Recorder{
+		mode:     mode,
+		path:     path,
+		replayed: make(map[int]bool),
+	}
+	if mode == Record {
+		return r, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read fixture: %w", err)
+	}
+	if err := json.Unmarshal(data, &r.interactions); err != nil {
+		return nil, fmt.Errorf("Failed to parse fixture %s: %w", path, err)
+	}
+	return r, nil
+}
+
+// HTTPClient returns an http.Client using the Recorder as transport.
+func (r *Recorder) HTTPClient() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	query := matchQuery(req)
+	if r.mode == Record {
+		return r.record(req, query)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, it := range r.interactions {
+		if r.replayed[i] || it.Method != req.Method || it.Query != query {
+			continue
+		}
+		r.replayed[i] = true
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", it.Status, http.StatusText(it.Status)),
+			StatusCode:    it.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        it.Header.Clone(),
+			Body:          io.NopCloser(bytes.NewBufferString(it.Body)),
+			ContentLength: int64(len(it.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("No recorded interaction for %s %s", req.Method, query)
+}
+
+// Save writes the recorded interactions to the fixture file.
+func (r *Recorder) Save() error {
+	if r.mode != Record {
+		return nil
+	}
+	r.mu.Lock()
+	data, err := json.MarshalIndent(r.interactions, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(r.path, append(data, '\n'), 0644)
+}
+
+func (r *Recorder) record(req *http.Request, query string) (*http.Response, error) {
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	// the API echoes the contact address back in its response
+	var fields map[string]interface{}
+	if json.Unmarshal(body, &fields) == nil {
+		if _, ok := fields["contact"]; ok {
+			fields["contact"] = "redacted"
+			body, _ = json.Marshal(fields)
+		}
+	}
+
+	header := resp.Header.Clone()
+	header.Del("Set-Cookie")
+
+	r.mu.Lock()
+	r.interactions = append(r.interactions, Interaction{
+		Method: req.Method,
+		Query:  query,
+		Status: resp.StatusCode,
+		Header: header,
+		Body:   string(body),
+	})
+	r.mu.Unlock()
+	return resp, nil
+}
+
+// matchQuery returns the request query without the contact parameter,
+// with keys sorted.
+func matchQuery(req *http.Request) string {
+	q := req.URL.Query()
+	q.Del("contact")
+	return q.Encode()
+}
@@ -0,0 +1,190 @@
+// Package ipinteltest provides a fake getipintel.net server for testing
+// code that uses the ipintel package without network access.
+//
+// Example:
+//
+//	srv := ipinteltest.NewServer()
+//	defer srv.Close()
+//	srv.SetScore("1.2.3.4", 0.99)
+//	c := srv.Client(ipintel.Dynamic)
+package ipinteltest
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+)
+
+// Error codes returned by the API in the result field.
+const (
+	ErrNoInput      = ipintel.CodeNoInput
+	ErrInvalidIP    = ipintel.CodeInvalidIP
+	ErrUnroutableIP = ipintel.CodeUnroutableIP
+	ErrDatabase     = ipintel.CodeDatabase
+	ErrBanned       = ipintel.CodeBanned
+	ErrNoContact    = ipintel.CodeNoContact
+)
+
+var errMessages = map[int]string{
+	ErrNoInput:      "Invalid no input",
+	ErrInvalidIP:    "Invalid IP address",
+	ErrUnroutableIP: "Unroutable address / private address",
+	ErrDatabase:     "Unable to reach database, most likely the database is being updated. Keep an eye on twitter for more information.",
+	ErrBanned:       "Your connecting IP has been banned from the system or you do not have permission to access a particular service. Did you exceed your query limits? Did you use an invalid email address?",
+	ErrNoContact:    "You did not provide any contact information with your query or the contact information is invalid.",
+}
+
+// Server is a fake getipintel.net API endpoint. It answers queries
+// with scripted scores and errors and is safe for concurrent use.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	scores   map[string]float32
+	errors   map[string]int
+	def      float32
+	latency  time.Duration
+	throttle int
+	requests int
+}
+
+// NewServer starts a new fake API server. Unscripted IPs get a score of 0.
+// The caller should call Close when finished.
+func NewServer() *Server {
+	s := &Server{
+		scores: make(map[string]float32),
+		errors: make(map[string]int),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// SetScore scripts the score returned for ip.
+func (s *Server) SetScore(ip string, score float32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.errors, ip)
+	s.scores[ip] = score
+}
+
+// SetDefaultScore sets the score returned for IPs without a scripted score.
+func (s *Server) SetDefaultScore(score float32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.def = score
+}
+
+// SetError scripts the API error returned for ip (one of the Err* codes).
+func (s *Server) SetError(ip string, code int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.scores, ip)
+	s.errors[ip] = code
+}
+
+// SetLatency delays every response by d.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// Throttle makes the server answer the next n requests with
+// HTTP 429 (Too Many Requests).
+func (s *Server) Throttle(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.throttle = n
+}
+
+// Requests returns the number of requests the server has received.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// Client returns a Client that queries this server using the given
+// check type. Its queries are not throttled by the package-wide limiter.
+func (s *Server) Client(check ipintel.CheckType) *ipintel.Client {
+	return ipintel.NewClient("test@example.com", false, check, 0,
+		ipintel.WithBaseURL(s.URL+"/check.php"),
+		ipintel.WithLimiter(unlimited{}))
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	ip := q.Get("ip")
+
+	s.mu.Lock()
+	s.requests++
+	latency := s.latency
+	throttled := s.throttle > 0
+	if throttled {
+		s.throttle--
+	}
+	score, scripted := s.scores[ip]
+	if !scripted {
+		score = s.def
+	}
+	code, failed := s.errors[ip]
+	s.mu.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if throttled {
+		http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+		return
+	}
+
+	if !failed {
+		parsed := net.ParseIP(ip)
+		switch {
+		case q.Get("contact") == "":
+			code, failed = ErrNoContact, true
+		case ip == "":
+			code, failed = ErrNoInput, true
+		case parsed == nil:
+			code, failed = ErrInvalidIP, true
+		case parsed.IsPrivate() || parsed.IsLoopback() || parsed.IsUnspecified():
+			code, failed = ErrUnroutableIP, true
+		}
+	}
+
+	resp := map[string]string{
+		"status":      "success",
+		"result":      strconv.FormatFloat(float64(score), 'f', -1, 32),
+		"queryIP":     ip,
+		"queryFlags":  q.Get("flags"),
+		"queryFormat": "json",
+		"contact":     q.Get("contact"),
+	}
+	status := http.StatusOK
+	if failed {
+		resp["status"] = "error"
+		resp["result"] = strconv.Itoa(code)
+		resp["message"] = errMessages[code]
+		status = http.StatusBadRequest
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// unlimited is a Limiter that never throttles.
+type unlimited struct{}
+
+func (unlimited) WaitMaxDuration(int64, time.Duration) bool { return true }
@@ -0,0 +1,288 @@
+// Package ipintelwebhook provides an ipintel.Store posting lookups to an
+// HTTP endpoint in batches, e.g. to feed a data warehouse.
+//
+// Example:
+//
+//	b := ipintelwebhook.New("https://ingest.example.com/ipintel",
+//		ipintelwebhook.WithHeader("Authorization", "Bearer "+token))
+//	defer b.Close(context.Background())
+//	c := ipintel.NewClient("your@email.com", true, ipintel.Dynamic, 0, ipintel.WithStore(b))
+package ipintelwebhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+)
+
+// Defaults of a Batcher.
+const (
+	DefaultBatchSize = 500
+	DefaultInterval  = 10 * time.Second
+	DefaultQueueSize = 10000
+	DefaultRetries   = 5
+)
+
+// Backoff bounds between retries of a batch.
+const (
+	minBackoff = time.Second
+	maxBackoff = time.Minute
+)
+
+// Batcher is an ipintel.Store collecting records and posting them as a
+// JSON array of ipintel.Record to an endpoint, once a batch is full or
+// the interval since the last post passed. It is safe for concurrent
+// use.
+//
+// Batches are posted one at a time. A batch failing with a network
+// error, 429 or 5xx is retried with exponential backoff; once the
+// retries are used up, or on any other status, it is dropped and the
+// error passed to the error handler. While a batch is being posted,
+// records queue up; when the queue is full, Record blocks until there is
+// room, slowing down the lookups rather than losing records.
+type Batcher struct {
+	url        string
+	httpClient *http.Client
+	header     http.Header
+	batchSize  int
+	interval   time.Duration
+	queueSize  int
+	retries    int
+	onError    func(error)
+
+	queue chan ipintel.Record
+	// stop is closed by Close to end the waits of Record, drain once no
+	// Record can enqueue anymore, so run posts all queued records
+	stop, drain chan struct{}
+	done        chan struct{}
+	cancel      context.CancelFunc
+	closeOnce   sync.Once
+
+	// held for reading by Record while enqueueing
+	mu     sync.RWMutex
+	closed bool
+}
+
+var _ ipintel.Store = (*Batcher)(nil)
+
+// Option configures a Batcher in New.
+type Option func(*Batcher)
+
+// New returns a Batcher posting to url and starts its background
+// goroutine; call Close to stop it.
+func New(url string, opts ...Option) *Batcher {
+	b := &Batcher{
+		url:        url,
+		httpClient: http.DefaultClient,
+		header:     make(http.Header),
+		batchSize:  DefaultBatchSize,
+		interval:   DefaultInterval,
+		queueSize:  DefaultQueueSize,
+		retries:    DefaultRetries,
+		stop:       make(chan struct{}),
+		drain:      make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	b.queue = make(chan ipintel.Record, b.queueSize)
+	ctx, cancel := context.WithCancel(context.Background())
+	b.cancel = cancel
+	go b.run(ctx)
+	return b
+}
+
+// WithBatchSize sets the number of records posted at most at once.
+func WithBatchSize(n int) Option {
+	return func(b *Batcher) {
+		b.batchSize = max(n, 1)
+	}
+}
+
+// WithInterval sets the maximum time records wait before being posted,
+// DefaultInterval if d is not positive.
+func WithInterval(d time.Duration) Option {
+	return func(b *Batcher) {
+		if d <= 0 {
+			d = DefaultInterval
+		}
+		b.interval = d
+	}
+}
+
+// WithQueueSize sets the number of records queued at most before Record
+// blocks.
+func WithQueueSize(n int) Option {
+	return func(b *Batcher) {
+		b.queueSize = max(n, 0)
+	}
+}
+
+// WithRetries sets how often a failed batch is retried.
+func WithRetries(n int) Option {
+	return func(b *Batcher) {
+		b.retries = n
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for posting; by default
+// http.DefaultClient.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(b *Batcher) {
+		b.httpClient = hc
+	}
+}
+
+// WithHeader adds a header to the requests, e.g. for authentication.
+func WithHeader(key, value string) Option {
+	return func(b *Batcher) {
+		b.header.Add(key, value)
+	}
+}
+
+// WithErrorHandler sets a function called with the error of each
+// dropped batch.
+func WithErrorHandler(fn func(error)) Option {
+	return func(b *Batcher) {
+		b.onError = fn
+	}
+}
+
+// Record queues rec, waiting for room in the queue until ctx is done.
+func (b *Batcher) Record(ctx context.Context, rec ipintel.Record) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return fmt.Errorf("Batcher is closed")
+	}
+	select {
+	case b.queue <- rec:
+		return nil
+	case <-b.stop:
+		return fmt.Errorf("Batcher is closed")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close posts the queued records and stops the Batcher. If ctx is done
+// first, the remaining records are dropped.
+func (b *Batcher) Close(ctx context.Context) error {
+	b.closeOnce.Do(func() {
+		close(b.stop)
+		// wait for the Records enqueueing, which stop ends
+		b.mu.Lock()
+		b.closed = true
+		b.mu.Unlock()
+		close(b.drain)
+	})
+	select {
+	case <-b.done:
+		return nil
+	case <-ctx.Done():
+		b.cancel()
+		<-b.done
+		return ctx.Err()
+	}
+}
+
+func (b *Batcher) run(ctx context.Context) {
+	defer close(b.done)
+	defer b.cancel()
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	batch := make([]ipintel.Record, 0, b.batchSize)
+	flush := func() {
+		if len(batch) > 0 {
+			b.post(ctx, batch)
+			batch = batch[:0]
+		}
+	}
+	for {
+		select {
+		case rec := <-b.queue:
+			if batch = append(batch, rec); len(batch) >= b.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-b.drain:
+			for {
+				select {
+				case rec := <-b.queue:
+					if batch = append(batch, rec); len(batch) >= b.batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// post posts batch, retrying as configured.
+func (b *Batcher) post(ctx context.Context, batch []ipintel.Record) {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		b.fail(fmt.Errorf("Failed to encode batch: %w", err))
+		return
+	}
+	backoff := minBackoff
+	for attempt := 0; ; attempt++ {
+		retry, err := b.send(ctx, body)
+		if err == nil {
+			return
+		}
+		if !retry || attempt >= b.retries || ctx.Err() != nil {
+			b.fail(fmt.Errorf("Dropped batch of %d records: %w", len(batch), err))
+			return
+		}
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+		case <-t.C:
+		}
+		backoff = min(2*backoff, maxBackoff)
+	}
+}
+
+// send posts body once, reporting whether a failure is worth retrying.
+func (b *Batcher) send(ctx context.Context, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", b.url, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("Failed preparing request: %w", err)
+	}
+	for k, v := range b.header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := b.httpClient.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("Failed to post batch: %w", err)
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("Endpoint returned %s", resp.Status)
+}
+
+func (b *Batcher) fail(err error) {
+	if b.onError != nil {
+		b.onError(err)
+	}
+}
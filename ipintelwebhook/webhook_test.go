@@ -0,0 +1,62 @@
+package ipintelwebhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+)
+
+func TestCloseKeepsAcceptedRecords(t *testing.T) {
+	var posted atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch []ipintel.Record
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			t.Error(err)
+		}
+		posted.Add(int64(len(batch)))
+	}))
+	defer srv.Close()
+
+	for range 20 {
+		posted.Store(0)
+		b := New(srv.URL, WithBatchSize(7), WithQueueSize(4))
+		var accepted atomic.Int64
+		var wg sync.WaitGroup
+		for range 8 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for range 50 {
+					if b.Record(context.Background(), ipintel.Record{}) == nil {
+						accepted.Add(1)
+					}
+				}
+			}()
+		}
+		time.Sleep(time.Millisecond)
+		if err := b.Close(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		wg.Wait()
+		if p, a := posted.Load(), accepted.Load(); p != a {
+			t.Fatalf("posted %d records, Record accepted %d", p, a)
+		}
+	}
+}
+
+func TestWithIntervalNotPositive(t *testing.T) {
+	for _, d := range []time.Duration{0, -time.Second} {
+		b := New("http://127.0.0.1:1", WithInterval(d))
+		if b.interval != DefaultInterval {
+			t.Errorf("WithInterval(%v): interval %v, want %v", d, b.interval, DefaultInterval)
+		}
+		b.Close(context.Background())
+	}
+}
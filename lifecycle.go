@@ -0,0 +1,95 @@
+package ipintel
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// workers are the background goroutines of a Client and the Clients
+// derived from it. Those of a derived Client are a child scope of the
+// workers of its parent, so closing the parent stops them as well but
+// not the other way around.
+type workers struct {
+	parent *workers
+	wg     sync.WaitGroup
+
+	mu sync.Mutex
+	// created on first use, so derived Clients without background work
+	// don't register with the context of their parent
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newWorkers(parent *workers) *workers {
+	return &workers{parent: parent}
+}
+
+// context returns the context the goroutines of w run with.
+func (w *workers) context() context.Context {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.ctx == nil {
+		parent := context.Background()
+		if w.parent != nil {
+			parent = w.parent.context()
+		}
+		w.ctx, w.cancel = context.WithCancel(parent)
+	}
+	return w.ctx
+}
+
+// add adds delta to the goroutines counted by w and its ancestors.
+func (w *workers) add(delta int) {
+	for ; w != nil; w = w.parent {
+		w.wg.Add(delta)
+	}
+}
+
+// stop cancels the goroutines of w and its children and waits for them.
+func (w *workers) stop() {
+	w.context()
+	w.cancel()
+	w.wg.Wait()
+}
+
+// start runs the background functions registered by options.
+func (c *Client) start() {
+	for _, fn := range c.starts {
+		ctx := c.workers.context()
+		c.workers.add(1)
+		go func() {
+			defer c.workers.add(-1)
+			fn(ctx)
+		}()
+	}
+	c.starts = nil
+}
+
+// Close stops the background work of c and the Clients derived from it,
+// such as list refreshes (see WithListRefresh), waiting for it to
+// finish, and closes the idle connections of the Transport c created
+// for options such as WithProxy, if any. The Client c was derived
+// from, if any, keeps running.
+// Lookups keep working. The HTTP client, cache, store and other
+// resources passed in by options are left to their owners to close.
+func (c *Client) Close() error {
+	c.workers.stop()
+	if c.transport != nil {
+		c.transport.CloseIdleConnections()
+	}
+	return nil
+}
+
+// WithListRefresh refreshes srcs into the Client's lists (see
+// WithLists) every interval in the background until the Client is
+// closed, passing failures to onError if not nil.
+func WithListRefresh(interval time.Duration, onError func(error), srcs ...ListSource) Option {
+	return func(c *Client) {
+		c.starts = append(c.starts, func(ctx context.Context) {
+			if c.lists != nil {
+				c.lists.RefreshEvery(ctx, nil, interval, onError, srcs...)
+			}
+		})
+	}
+}
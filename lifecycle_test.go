@@ -0,0 +1,76 @@
+package ipintel
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// withWorker starts a background goroutine closing done when it stops.
+func withWorker(done chan struct{}) Option {
+	return func(c *Client) {
+		c.starts = append(c.starts, func(ctx context.Context) {
+			<-ctx.Done()
+			close(done)
+		})
+	}
+}
+
+func stopped(done chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	case <-time.After(50 * time.Millisecond):
+		return false
+	}
+}
+
+func TestCloseDerivedClient(t *testing.T) {
+	parentDone, childDone := make(chan struct{}), make(chan struct{})
+	parent := NewClient("test@example.com", false, Dynamic, 0, withWorker(parentDone))
+	child := parent.WithOptions(withWorker(childDone))
+	idle := parent.WithOptions()
+
+	idle.Close()
+	child.Close()
+	if !stopped(childDone) {
+		t.Error("Close of the derived client didn't stop its worker")
+	}
+	if stopped(parentDone) {
+		t.Fatal("Close of a derived client stopped the worker of its parent")
+	}
+	parent.Close()
+	if !stopped(parentDone) {
+		t.Error("Close didn't stop the worker")
+	}
+}
+
+func TestCloseStopsDerivedClients(t *testing.T) {
+	childDone := make(chan struct{})
+	parent := NewClient("test@example.com", false, Dynamic, 0)
+	parent.WithOptions(withWorker(childDone))
+	parent.Close()
+	if !stopped(childDone) {
+		t.Error("Close didn't stop the worker of a derived client")
+	}
+}
+
+// idleCounter counts the calls to CloseIdleConnections.
+type idleCounter struct {
+	http.RoundTripper
+	closes int
+}
+
+func (t *idleCounter) CloseIdleConnections() {
+	t.closes++
+}
+
+func TestCloseLeavesSharedTransport(t *testing.T) {
+	rt := &idleCounter{RoundTripper: http.DefaultTransport}
+	c := NewClient("test@example.com", false, Dynamic, 0, WithHTTPClient(&http.Client{Transport: rt}))
+	c.Close()
+	if rt.closes != 0 {
+		t.Error("Close closed the idle connections of a Transport it doesn't own")
+	}
+}
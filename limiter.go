@@ -0,0 +1,120 @@
+package ipintel
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Limiter throttles API queries.
+type Limiter interface {
+	// WaitMaxDuration waits for count tokens to become available and
+	// reports false, without waiting, if that takes longer than maxWait.
+	WaitMaxDuration(count int64, maxWait time.Duration) bool
+}
+
+// ContextLimiter is a Limiter whose waits end early when a context is
+// done. A Client uses it when its Limiter implements it, as the Limiters
+// returned by NewLimiter do.
+type ContextLimiter interface {
+	Limiter
+	// WaitMaxDurationContext is like WaitMaxDuration, but reports false
+	// as soon as ctx is done, giving back the tokens.
+	WaitMaxDurationContext(ctx context.Context, count int64, maxWait time.Duration) bool
+}
+
+// NewLimiter returns a Limiter matching the limits imposed by the API,
+// using clock for time keeping. If clock is nil, the system clock is used.
+func NewLimiter(clock Clock) Limiter {
+	// throttle queries to ~15 req/min with a burst capacity of 15 (imposed by API)
+	return &limiter{lim: rate.NewLimiter(rate.Every(4*time.Second), 15), clock: clock}
+}
+
+// limiter adapts a rate.Limiter to Limiter. The rate.Limiter is always
+// given the time explicitly, so it follows the Clock.
+type limiter struct {
+	lim   *rate.Limiter
+	clock Clock
+}
+
+var _ ContextLimiter = (*limiter)(nil)
+
+func (l *limiter) now() time.Time {
+	if l.clock == nil {
+		return time.Now()
+	}
+	return l.clock.Now()
+}
+
+func (l *limiter) WaitMaxDuration(count int64, maxWait time.Duration) bool {
+	return l.WaitMaxDurationContext(context.Background(), count, maxWait)
+}
+
+func (l *limiter) WaitMaxDurationContext(ctx context.Context, count int64, maxWait time.Duration) bool {
+	now := l.now()
+	r := l.lim.ReserveN(now, int(count))
+	if !r.OK() {
+		return false
+	}
+	delay := r.DelayFrom(now)
+	if delay > maxWait {
+		r.CancelAt(now)
+		return false
+	}
+	if delay == 0 {
+		return true
+	}
+
+	if l.clock != nil {
+		if err := l.clock.Sleep(ctx, delay); err != nil {
+			r.CancelAt(l.now())
+			return false
+		}
+		return true
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		r.Cancel()
+		return false
+	}
+}
+
+// retryIn estimates the time until a single token is available.
+func (l *limiter) retryIn() time.Duration {
+	tokens := l.lim.TokensAt(l.now())
+	if tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - tokens) / float64(l.lim.Limit()) * float64(time.Second))
+}
+
+// Quota is the state of the rate limiter of a Client, see Client.Quota.
+type Quota struct {
+	// Queries that can be made right away
+	Available int
+	// Burst capacity of the limiter
+	Burst int
+	// Estimated time until the next query is allowed, 0 if one is
+	// available
+	RetryIn time.Duration
+}
+
+// Quota returns the state of the Client's limiter. It reports false if
+// the limiter was not created by NewLimiter, as the state of other
+// Limiters is unknown.
+func (c *Client) Quota() (Quota, bool) {
+	l, ok := c.limiter.(*limiter)
+	if !ok {
+		return Quota{}, false
+	}
+	return Quota{
+		Available: int(max(l.lim.TokensAt(l.now()), 0)),
+		Burst:     l.lim.Burst(),
+		RetryIn:   l.retryIn(),
+	}, true
+}
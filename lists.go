@@ -0,0 +1,310 @@
+package ipintel
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ListAction is what a local list does with a matching IP.
+type ListAction int
+
+const (
+	// Deny answers matching IPs with a score of 1.
+	Deny ListAction = iota
+	// Allow answers matching IPs with a score of 0. Allow lists take
+	// precedence over deny lists.
+	Allow
+)
+
+// MaxListSize caps the size of a list downloaded by Refresh.
+const MaxListSize = 64 << 20
+
+// listClient downloads lists when Refresh is given no client.
+var listClient = http.Client{Timeout: time.Minute}
+
+// Lists is a set of named local allow and deny lists consulted before
+// the API, so known answers don't consume query quota. It is safe for
+// concurrent use; lists can be replaced while in use.
+type Lists struct {
+	mu    sync.RWMutex
+	lists map[string]*list
+	// names of lists, sorted
+	names []string
+}
+
+type list struct {
+	action ListAction
+	// sorted, non-overlapping
+	prefixes []netip.Prefix
+}
+
+// NewLists returns an empty set of lists.
+func NewLists() *Lists {
+	return &Lists{lists: make(map[string]*list)}
+}
+
+// Set adds or replaces the list called name.
+func (l *Lists) Set(name string, action ListAction, prefixes []netip.Prefix) {
+	nl := &list{action: action, prefixes: normalizePrefixes(prefixes)}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.set(name, nl)
+}
+
+// set adds or replaces the list called name. The caller holds l.mu.
+func (l *Lists) set(name string, ls *list) {
+	if _, ok := l.lists[name]; !ok {
+		i := sort.SearchStrings(l.names, name)
+		l.names = append(l.names, "")
+		copy(l.names[i+1:], l.names[i:])
+		l.names[i] = name
+	}
+	l.lists[name] = ls
+}
+
+// Remove removes the list called name.
+func (l *Lists) Remove(name string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.lists[name]; !ok {
+		return
+	}
+	delete(l.lists, name)
+	i := sort.SearchStrings(l.names, name)
+	l.names = append(l.names[:i], l.names[i+1:]...)
+}
+
+// Add adds prefixes to the list called name, creating it with action if
+// there is none.
+func (l *Lists) Add(name string, action ListAction, prefixes ...netip.Prefix) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if ls, ok := l.lists[name]; ok {
+		action = ls.action
+		prefixes = append(prefixes, ls.prefixes...)
+	}
+	l.set(name, &list{action: action, prefixes: normalizePrefixes(prefixes)})
+}
+
+// Delete removes the entries of the list called name that lie within
+// one of prefixes and returns their number. Entries only partly covered
+// by prefixes are kept.
+func (l *Lists) Delete(name string, prefixes ...netip.Prefix) int {
+	prefixes = normalizePrefixes(prefixes)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ls, ok := l.lists[name]
+	if !ok {
+		return 0
+	}
+	kept := make([]netip.Prefix, 0, len(ls.prefixes))
+	for _, p := range ls.prefixes {
+		covered := false
+		for _, q := range prefixes {
+			if q.Bits() <= p.Bits() && q.Contains(p.Addr()) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			kept = append(kept, p)
+		}
+	}
+	l.lists[name] = &list{action: ls.action, prefixes: kept}
+	return len(ls.prefixes) - len(kept)
+}
+
+// Names returns the names of the lists in sorted order.
+func (l *Lists) Names() []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return append([]string{}, l.names...)
+}
+
+// Get returns the action and entries of the list called name.
+func (l *Lists) Get(name string) (action ListAction, prefixes []netip.Prefix, ok bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	ls, ok := l.lists[name]
+	if !ok {
+		return 0, nil, false
+	}
+	return ls.action, append([]netip.Prefix{}, ls.prefixes...), true
+}
+
+// Load parses a list from r (see ParseList) and adds or replaces the
+// list called name with it.
+func (l *Lists) Load(name string, action ListAction, r io.Reader) error {
+	prefixes, err := ParseList(r)
+	if err != nil {
+		return err
+	}
+	l.Set(name, action, prefixes)
+	return nil
+}
+
+// Lookup returns the name and action of a list containing ip, preferring
+// allow lists over deny lists. Among lists of the same action, the
+// first by name wins.
+func (l *Lists) Lookup(ip netip.Addr) (name string, action ListAction, ok bool) {
+	ip = ip.Unmap()
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, n := range l.names {
+		ls := l.lists[n]
+		if !ls.contains(ip) {
+			continue
+		}
+		if ls.action == Allow {
+			return n, Allow, true
+		}
+		if !ok {
+			name, action, ok = n, Deny, true
+		}
+	}
+	return
+}
+
+func (ls *list) contains(ip netip.Addr) bool {
+	// index of the first prefix starting after ip
+	i := sort.Search(len(ls.prefixes), func(i int) bool {
+		return ip.Less(ls.prefixes[i].Addr())
+	})
+	return i > 0 && ls.prefixes[i-1].Contains(ip)
+}
+
+// normalizePrefixes masks and sorts prefixes and drops those contained
+// in another one. As prefixes either nest or are disjoint, the result
+// does not overlap.
+func normalizePrefixes(prefixes []netip.Prefix) []netip.Prefix {
+	sorted := make([]netip.Prefix, 0, len(prefixes))
+	for _, p := range prefixes {
+		if p.Addr().Is4In6() && p.Bits() >= 96 {
+			p = netip.PrefixFrom(p.Addr().Unmap(), p.Bits()-96)
+		}
+		sorted = append(sorted, p.Masked())
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if a, b := sorted[i].Addr(), sorted[j].Addr(); a != b {
+			return a.Less(b)
+		}
+		return sorted[i].Bits() < sorted[j].Bits()
+	})
+
+	out := sorted[:0]
+	for _, p := range sorted {
+		if n := len(out); n > 0 && out[n-1].Overlaps(p) {
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// ParseList parses a list of IP addresses and CIDR prefixes, one per
+// line. Empty lines and text after '#' or ';' are ignored, which covers
+// FireHOL netsets and most published lists. Tor exit lists in the
+// "ExitAddress <ip> <date>" format are understood as well.
+func ParseList(r io.Reader) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Text()
+		if i := strings.IndexAny(line, "#;"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		entry := fields[0]
+		if entry == "ExitAddress" && len(fields) > 1 {
+			entry = fields[1]
+		} else if strings.HasPrefix(entry, "ExitNode") || strings.HasPrefix(entry, "Published") || strings.HasPrefix(entry, "LastStatus") {
+			continue
+		}
+
+		var p netip.Prefix
+		var err error
+		if strings.Contains(entry, "/") {
+			p, err = netip.ParsePrefix(entry)
+		} else {
+			var addr netip.Addr
+			if addr, err = netip.ParseAddr(entry); err == nil {
+				p = netip.PrefixFrom(addr, addr.BitLen())
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Line %d: invalid entry %q", n, entry)
+		}
+		prefixes = append(prefixes, p)
+	}
+	return prefixes, sc.Err()
+}
+
+// ListSource is a list published at a URL.
+type ListSource struct {
+	Name   string
+	URL    string
+	Action ListAction
+}
+
+// Refresh downloads src using hc, or a client with a one minute timeout
+// if nil, and adds or replaces the list called src.Name with it. Lists
+// larger than MaxListSize are rejected. On failure the previous version
+// of the list stays in place.
+func (l *Lists) Refresh(ctx context.Context, hc *http.Client, src ListSource) error {
+	if hc == nil {
+		hc = &listClient
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", src.URL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := hc.Do(req)
+	if err != nil {
+		return fmt.Errorf("Failed to fetch list %s: %w", src.Name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Failed to fetch list %s: %s", src.Name, resp.Status)
+	}
+	body := &io.LimitedReader{R: resp.Body, N: MaxListSize + 1}
+	prefixes, err := ParseList(body)
+	if body.N == 0 {
+		return fmt.Errorf("Failed to fetch list %s: larger than %d bytes", src.Name, MaxListSize)
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to parse list %s: %w", src.Name, err)
+	}
+	l.Set(src.Name, src.Action, prefixes)
+	return nil
+}
+
+// RefreshEvery refreshes all sources immediately and then every interval
+// until ctx is done. Errors are passed to onError, which may be nil.
+func (l *Lists) RefreshEvery(ctx context.Context, hc *http.Client, interval time.Duration, onError func(error), srcs ...ListSource) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for _, src := range srcs {
+			if err := l.Refresh(ctx, hc, src); err != nil && onError != nil && ctx.Err() == nil {
+				onError(err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package ipintel
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestListsLookupOrder(t *testing.T) {
+	l := NewLists()
+	p := netip.MustParsePrefix("192.0.2.0/24")
+	for _, name := range []string{"tor", "firehol", "spamhaus", "abuse"} {
+		l.Set(name, Deny, []netip.Prefix{p})
+	}
+	ip := netip.MustParseAddr("192.0.2.1")
+	for range 10 {
+		if name, _, _ := l.Lookup(ip); name != "abuse" {
+			t.Fatalf("Lookup: list %q, want %q", name, "abuse")
+		}
+	}
+	l.Set("zz", Allow, []netip.Prefix{p})
+	if name, action, _ := l.Lookup(ip); name != "zz" || action != Allow {
+		t.Errorf("Lookup: list %q, action %v, want allow list %q", name, action, "zz")
+	}
+	l.Remove("abuse")
+	l.Remove("zz")
+	if name, _, _ := l.Lookup(ip); name != "firehol" {
+		t.Errorf("Lookup after Remove: list %q, want %q", name, "firehol")
+	}
+	if got := l.Names(); len(got) != 3 || got[0] != "firehol" || got[2] != "tor" {
+		t.Errorf("Names() = %v", got)
+	}
+}
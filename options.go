@@ -0,0 +1,203 @@
+package ipintel
+
+import (
+	"hash/maphash"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// Option configures optional Client settings in NewClient.
+type Option func(*Client)
+
+// WithBaseURL sets the URL of the API endpoint
+// (e.g. "http://127.0.0.1:8080/check.php"), overriding the default
+// endpoint and the scheme selected by NewClient.
+func WithBaseURL(u string) Option {
+	return func(c *Client) {
+		c.baseURL = u
+	}
+}
+
+// WithEmail sets the contact email address sent with each query,
+// overriding the one passed to NewClient. With Client.WithOptions, it
+// derives a Client for another account, e.g. of a tenant, which should
+// get a Limiter of its own, as the API limits each address on its own.
+func WithEmail(email string) Option {
+	return func(c *Client) {
+		c.email = email
+	}
+}
+
+// WithCheck sets the type of check, overriding the one passed to
+// NewClient. It is mostly useful with Client.WithOptions.
+func WithCheck(check CheckType) Option {
+	return func(c *Client) {
+		c.check = check
+	}
+}
+
+// WithMaxWait sets the maximum time to wait when a query is being
+// throttled, overriding the one passed to NewClient. It is mostly
+// useful with Client.WithOptions.
+func WithMaxWait(d time.Duration) Option {
+	return func(c *Client) {
+		c.maxWait = d
+	}
+}
+
+// WithUserAgent identifies your application to the API operator by
+// prepending app (e.g. "myapp/1.4") to the User-Agent header, as
+// requested of heavy users.
+func WithUserAgent(app string) Option {
+	return func(c *Client) {
+		if app != "" {
+			c.userAgent = app + " " + userAgent
+		}
+	}
+}
+
+// WithTimeout limits each lookup to d, including the wait for the
+// limiter, independent of the timeout of the HTTP client, which still
+// applies if shorter. Derive clients for paths with different needs,
+// e.g. a login check giving up after 800ms while a batch job sharing
+// the quota waits longer:
+//
+//	login := c.WithOptions(ipintel.WithTimeout(800 * time.Millisecond))
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = d
+	}
+}
+
+// WithLimiter sets the Limiter used to throttle queries. By default
+// a limiter shared by all clients and matching the limits imposed by
+// the API is used.
+func WithLimiter(l Limiter) Option {
+	return func(c *Client) {
+		c.limiter = l
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for API requests. By default
+// a client with a 10 second timeout is used.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// WithMaxResponseSize sets the maximum size in bytes of an API
+// response; larger responses fail to parse. The default is
+// DefaultMaxResponseSize.
+func WithMaxResponseSize(n int64) Option {
+	return func(c *Client) {
+		c.maxResponseSize = n
+	}
+}
+
+// WithCountry makes queries ask the API for the country of the IP
+// (oflags=c), available from Result.Country.
+func WithCountry() Option {
+	return func(c *Client) {
+		if !strings.Contains(c.oflags, "c") {
+			c.oflags += "c"
+		}
+	}
+}
+
+// WithStore sets a Store that records every successful lookup.
+func WithStore(s Store) Option {
+	return func(c *Client) {
+		c.store = s
+	}
+}
+
+// WithChangeHook sets a function called whenever a lookup finds that an
+// IP crossed threshold since its previous lookup, i.e. a clean IP
+// turned into a proxy or vice versa. It requires a Store implementing
+// History and is called synchronously after the lookup was recorded.
+func WithChangeHook(threshold float32, hook func(Change)) Option {
+	return func(c *Client) {
+		c.changeThreshold = threshold
+		c.onChange = hook
+	}
+}
+
+// WithLists sets local allow and deny lists consulted before each query.
+// IPs on a list are answered without querying the API or recording the
+// lookup in the Store. The Results of deny lists named after a
+// ProxyType, e.g. "tor" or "datacenter", have that Type.
+func WithLists(l *Lists) Option {
+	return func(c *Client) {
+		c.lists = l
+	}
+}
+
+// WithHosting answers IPs of the hosting networks h, e.g. from
+// DefaultHosting, locally with a score of 1, the Type TypeDatacenter and
+// the List HostingList. asn tells the ASN of an IP for matching the
+// ASNs of h, e.g. ASNTable.Lookup; if nil, only its prefixes are
+// matched. Local lists (see WithLists) take precedence.
+func WithHosting(h *Hosting, asn func(netip.Addr) (uint32, bool)) Option {
+	return func(c *Client) {
+		c.hosting = h
+		c.hostingASN = asn
+	}
+}
+
+// WithSampling makes the Client query only the share rate (0 to 1) of
+// IPs not answered by lists or the cache, e.g. 0.1 for every tenth, and
+// fail with ErrNotSampled for the others. This keeps sites with far more
+// visitors than the quota allows from being throttled constantly while
+// still giving a representative proxy rate. The sample is fixed per
+// Client, so an IP left out stays left out rather than costing retries.
+func WithSampling(rate float64) Option {
+	return func(c *Client) {
+		c.sampleRate = rate
+		c.sampleSeed = maphash.MakeSeed()
+	}
+}
+
+// WithCache sets a Cache consulted before each query. Results from the
+// API are cached for ttl. Cache errors are treated as misses.
+func WithCache(cache Cache, ttl time.Duration) Option {
+	return func(c *Client) {
+		c.cache = cache
+		c.cacheTTL = ttl
+	}
+}
+
+// WithLocker sets a Locker used to deduplicate cache misses across
+// processes sharing the Cache. A lookup finding another process
+// querying the same IP waits up to wait for its result to be cached
+// before querying the API itself. It has no effect without WithCache.
+func WithLocker(l Locker, wait time.Duration) Option {
+	return func(c *Client) {
+		c.locker = l
+		c.lockWait = wait
+	}
+}
+
+// WithClock makes the Client take the time of lookups and wait between
+// retries with clock, e.g. a fake one in tests. Components with a time
+// of their own, such as the Limiter (see NewLimiter), the Cache or the
+// Store, take the clock separately.
+func WithClock(clock Clock) Option {
+	return func(c *Client) {
+		c.clock = clock
+	}
+}
+
+// WithPseudonymizer sets a Pseudonymizer applied to IPs before they are
+// recorded in the Store, e.g. TruncateIP(24, 48) or HashIP(secret). The
+// Cache still keeps real IPs, so its TTL bounds how long they are held.
+// Store history is kept per pseudonym, which with TruncateIP means per
+// network rather than per IP. Only TruncateIP values can be re-checked
+// by a Scheduler or exported with Blocklist; HashIP values are skipped.
+func WithPseudonymizer(p Pseudonymizer) Option {
+	return func(c *Client) {
+		c.pseudonymize = p
+	}
+}
@@ -0,0 +1,80 @@
+package ipintel
+
+import "strings"
+
+// Policy reports whether the IP of a Result is to be blocked. Policies
+// compose with AnyOf and AllOf, e.g. to block proxies and, regardless
+// of their score, IPs from outside some countries:
+//
+//	p := ipintel.AnyOf(ipintel.BlockRisk(ipintel.High), ipintel.AllowCountries("DE", "AT"))
+type Policy func(res Result) bool
+
+// BlockRisk returns a Policy blocking IPs at or above the risk level l.
+func BlockRisk(l RiskLevel) Policy {
+	return func(res Result) bool {
+		return res.Risk() >= l
+	}
+}
+
+// BlockScore returns a Policy blocking IPs scoring at or above
+// threshold.
+func BlockScore(threshold float32) Policy {
+	return func(res Result) bool {
+		return res.Score >= threshold
+	}
+}
+
+// AllowCountries returns a Policy blocking IPs from countries other
+// than the given ISO 3166 codes, e.g. "DE". It requires the country of
+// each IP (see WithCountry); IPs whose country is unknown, such as
+// those answered by a local list, aren't blocked.
+func AllowCountries(codes ...string) Policy {
+	set := countrySet(codes)
+	return func(res Result) bool {
+		c := res.Country()
+		return c != "" && !set[strings.ToUpper(c)]
+	}
+}
+
+// BlockCountries returns a Policy blocking IPs from the countries with
+// the given ISO 3166 codes. Like AllowCountries, it requires the country
+// of each IP.
+func BlockCountries(codes ...string) Policy {
+	set := countrySet(codes)
+	return func(res Result) bool {
+		return set[strings.ToUpper(res.Country())]
+	}
+}
+
+func countrySet(codes []string) map[string]bool {
+	set := make(map[string]bool, len(codes))
+	for _, c := range codes {
+		set[strings.ToUpper(c)] = true
+	}
+	return set
+}
+
+// AnyOf returns a Policy blocking IPs blocked by any of policies.
+func AnyOf(policies ...Policy) Policy {
+	return func(res Result) bool {
+		for _, p := range policies {
+			if p(res) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// AllOf returns a Policy blocking IPs blocked by all of policies, e.g.
+// medium risk IPs from some countries only.
+func AllOf(policies ...Policy) Policy {
+	return func(res Result) bool {
+		for _, p := range policies {
+			if !p(res) {
+				return false
+			}
+		}
+		return len(policies) > 0
+	}
+}
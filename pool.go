@@ -0,0 +1,122 @@
+package ipintel
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Rotation selects how a Pool spreads lookups over its clients.
+type Rotation int
+
+const (
+	// RoundRobin uses the clients in turn.
+	RoundRobin Rotation = iota
+	// QuotaAware uses the clients in turn but skips those their
+	// Limiter would throttle, falling back to the one available
+	// soonest. A lookup throttled anyway is retried with the next
+	// client.
+	QuotaAware
+)
+
+// Pool spreads lookups over several Clients, typically one per contact
+// address registered with the API operator, each with its own quota.
+// It is safe for concurrent use.
+type Pool struct {
+	clients  []*Client
+	rotation Rotation
+	next     atomic.Uint64
+}
+
+var _ Provider = (*Pool)(nil)
+
+// NewPool returns a Pool of clients. It panics if clients is empty.
+func NewPool(rotation Rotation, clients ...*Client) *Pool {
+	if len(clients) == 0 {
+		panic("ipintel: NewPool without clients")
+	}
+	return &Pool{clients: clients, rotation: rotation}
+}
+
+// NewContactPool creates a Client per contact address with the given
+// parameters and options, and returns a Pool of them. As the quota is
+// per contact, each Client gets its own Limiter from NewLimiter,
+// replacing one set by opts.
+func NewContactPool(rotation Rotation, contacts []string, ssl bool, check CheckType, mWait time.Duration, opts ...Option) *Pool {
+	clients := make([]*Client, len(contacts))
+	for i, contact := range contacts {
+		clients[i] = NewClient(contact, ssl, check, mWait, append(opts, WithLimiter(NewLimiter(nil)))...)
+	}
+	return NewPool(rotation, clients...)
+}
+
+// Clients returns the clients of p.
+func (p *Pool) Clients() []*Client {
+	return append([]*Client(nil), p.clients...)
+}
+
+// Close closes all clients of p (see Client.Close).
+func (p *Pool) Close() error {
+	for _, c := range p.clients {
+		c.Close()
+	}
+	return nil
+}
+
+// Name returns the name of the provider of the clients.
+func (p *Pool) Name() string {
+	return p.clients[0].Name()
+}
+
+// GetProxyScore looks up ip with the next client of the pool.
+func (p *Pool) GetProxyScore(ctx context.Context, ip string) (Result, error) {
+	start := int((p.next.Add(1) - 1) % uint64(len(p.clients)))
+	if p.rotation != QuotaAware {
+		return p.clients[start].GetProxyScore(ctx, ip)
+	}
+
+	order := p.byAvailability(start)
+	begin := time.Now()
+	var res Result
+	var err error
+	var attempts int
+	for _, c := range order {
+		res, err = c.GetProxyScore(ctx, ip)
+		attempts += res.Attempts
+		var te *ThrottleError
+		if !errors.As(err, &te) || ctx.Err() != nil {
+			break
+		}
+	}
+	res.Latency, res.Attempts = time.Since(begin), attempts
+	return res, err
+}
+
+// byAvailability returns the clients starting at start, those whose
+// Limiter allows a query now first, then by the time until it does.
+func (p *Pool) byAvailability(start int) []*Client {
+	type candidate struct {
+		c    *Client
+		wait time.Duration
+	}
+	candidates := make([]candidate, len(p.clients))
+	for i := range p.clients {
+		c := p.clients[(start+i)%len(p.clients)]
+		var wait time.Duration
+		if l, ok := c.limiter.(*limiter); ok {
+			wait = l.retryIn()
+		}
+		candidates[i] = candidate{c, wait}
+	}
+	// stable, so equal waits keep the rotation order
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].wait < candidates[j].wait
+	})
+	order := make([]*Client, len(candidates))
+	for i, cand := range candidates {
+		order[i] = cand.c
+	}
+	return order
+}
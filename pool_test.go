@@ -0,0 +1,62 @@
+package ipintel_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+	"github.com/pierelucas/go-ipintel/ipinteltest"
+)
+
+func TestPoolRoundRobin(t *testing.T) {
+	a, b := ipinteltest.NewServer(), ipinteltest.NewServer()
+	defer a.Close()
+	defer b.Close()
+	p := ipintel.NewPool(ipintel.RoundRobin, a.Client(ipintel.Dynamic), b.Client(ipintel.Dynamic))
+
+	for i := 0; i < 4; i++ {
+		if _, err := p.GetProxyScore(context.Background(), "192.0.2.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if a.Requests() != 2 || b.Requests() != 2 {
+		t.Errorf("requests %d and %d, want 2 each", a.Requests(), b.Requests())
+	}
+}
+
+func TestPoolQuotaAware(t *testing.T) {
+	a, b := ipinteltest.NewServer(), ipinteltest.NewServer()
+	defer a.Close()
+	defer b.Close()
+	clock := ipinteltest.NewClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	exhausted := ipintel.NewLimiter(clock)
+	if !exhausted.WaitMaxDuration(15, 0) {
+		t.Fatal("new limiter without burst")
+	}
+	p := ipintel.NewPool(ipintel.QuotaAware,
+		a.Client(ipintel.Dynamic).WithOptions(ipintel.WithLimiter(exhausted)),
+		b.Client(ipintel.Dynamic))
+
+	for i := 0; i < 4; i++ {
+		if _, err := p.GetProxyScore(context.Background(), "192.0.2.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if a.Requests() != 0 || b.Requests() != 4 {
+		t.Errorf("requests %d and %d, want all with the available quota", a.Requests(), b.Requests())
+	}
+
+	// a lookup throttled anyway goes on with the next client
+	p = ipintel.NewPool(ipintel.QuotaAware,
+		a.Client(ipintel.Dynamic).WithOptions(ipintel.WithLimiter(refusing{})),
+		b.Client(ipintel.Dynamic))
+	for i := 0; i < 2; i++ {
+		if _, err := p.GetProxyScore(context.Background(), "192.0.2.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if a.Requests() != 0 || b.Requests() != 6 {
+		t.Errorf("requests %d and %d, want all by the client not throttling", a.Requests(), b.Requests())
+	}
+}
@@ -0,0 +1,36 @@
+package ipintel
+
+import "fmt"
+
+// ProxyType is the kind of proxy an IP belongs to, as far as the
+// providers tell. It is empty for Results not classified, e.g. of IPs
+// below the proxy threshold.
+type ProxyType string
+
+// Proxy types.
+const (
+	// A proxy of a kind no provider told
+	TypeUnknown ProxyType = "unknown"
+	// A commercial or self-hosted VPN exit node
+	TypeVPN ProxyType = "vpn"
+	// A Tor exit node
+	TypeTor ProxyType = "tor"
+	// A hosting or cloud provider address, e.g. a scraper or open proxy
+	TypeDatacenter ProxyType = "datacenter"
+	// A residential address relaying traffic of a proxy network
+	TypeResidential ProxyType = "residential-proxy"
+)
+
+// ParseProxyType parses a proxy type as returned by String.
+func ParseProxyType(s string) (ProxyType, error) {
+	switch t := ProxyType(s); t {
+	case TypeUnknown, TypeVPN, TypeTor, TypeDatacenter, TypeResidential:
+		return t, nil
+	}
+	return "", fmt.Errorf("Unknown proxy type %q", s)
+}
+
+// String returns the type as used in JSON, e.g. "vpn".
+func (t ProxyType) String() string {
+	return string(t)
+}
@@ -0,0 +1,67 @@
+package ipintel
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/netip"
+)
+
+// Pseudonymizer maps an IP address to the value kept in long-term
+// storage in place of it, e.g. to minimize stored personal data.
+type Pseudonymizer func(ip string) string
+
+// TruncateIP returns a Pseudonymizer keeping only the first v4Bits of
+// IPv4 and v6Bits of IPv6 addresses, e.g. TruncateIP(24, 48) maps
+// 192.0.2.17 to 192.0.2.0. Invalid addresses map to "".
+func TruncateIP(v4Bits, v6Bits int) Pseudonymizer {
+	return func(ip string) string {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			return ""
+		}
+		addr = addr.Unmap()
+		bits := v6Bits
+		if addr.Is4() {
+			bits = v4Bits
+		}
+		p, err := addr.Prefix(bits)
+		if err != nil {
+			return ""
+		}
+		return p.Addr().String()
+	}
+}
+
+// HashIP returns a Pseudonymizer replacing addresses by their keyed
+// HMAC-SHA256 hash (hex-encoded, 128 bits). The same IP always maps to
+// the same value, so history and statistics per IP keep working, but
+// the IP can't be recovered without secret.
+func HashIP(secret []byte) Pseudonymizer {
+	return func(ip string) string {
+		if addr, err := netip.ParseAddr(ip); err == nil {
+			ip = addr.Unmap().String()
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(ip))
+		return hex.EncodeToString(mac.Sum(nil)[:16])
+	}
+}
+
+// storedIP returns the value under which ip is kept in the Store.
+func (c *Client) storedIP(ip string) string {
+	if c.pseudonymize == nil {
+		return ip
+	}
+	return c.pseudonymize(ip)
+}
+
+// storesAddrs reports whether the values kept in the Store are IP
+// addresses, i.e. c has no Pseudonymizer or one like TruncateIP.
+func (c *Client) storesAddrs() bool {
+	if c.pseudonymize == nil {
+		return true
+	}
+	_, err := netip.ParseAddr(c.pseudonymize("192.0.2.1"))
+	return err == nil
+}
@@ -0,0 +1,33 @@
+package ipintel
+
+import "context"
+
+// QueryGate is called before each query of a lookup, once the lists and
+// the cache couldn't answer it and the limiter granted the query, so
+// retries pass it as well. An error fails the lookup without a query
+// and isn't retried, e.g. to keep a consumer of a shared Client within
+// its share of the quota.
+type QueryGate func(ctx context.Context) error
+
+type queryGateKey struct{}
+
+// ContextWithQueryGate returns a copy of ctx whose lookups are subject
+// to gate, in addition to the gates of ctx.
+func ContextWithQueryGate(ctx context.Context, gate QueryGate) context.Context {
+	if outer := queryGate(ctx); outer != nil {
+		inner := gate
+		gate = func(ctx context.Context) error {
+			if err := outer(ctx); err != nil {
+				return err
+			}
+			return inner(ctx)
+		}
+	}
+	return context.WithValue(ctx, queryGateKey{}, gate)
+}
+
+// queryGate returns the QueryGate of ctx, nil if there is none.
+func queryGate(ctx context.Context) QueryGate {
+	gate, _ := ctx.Value(queryGateKey{}).(QueryGate)
+	return gate
+}
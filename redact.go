@@ -0,0 +1,69 @@
+package ipintel
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// redactedContact replaces the contact address in errors.
+const redactedContact = "REDACTED"
+
+// WithoutRedaction keeps the contact address in the errors of queries,
+// e.g. in request URLs. By default it is replaced with "REDACTED", so
+// errors can be logged without leaking it.
+func WithoutRedaction() Option {
+	return func(c *Client) {
+		c.noRedact = true
+	}
+}
+
+// redactURL returns rawURL with the contact address of c removed.
+func (c *Client) redactURL(rawURL string) string {
+	if c.noRedact || c.email == "" {
+		return rawURL
+	}
+	esc := url.QueryEscape(c.email)
+	return strings.NewReplacer("contact="+esc, "contact="+redactedContact, esc, redactedContact, c.email, redactedContact).Replace(rawURL)
+}
+
+// redactErr removes the contact address from the text of err, whatever
+// its type, keeping the error chain intact. A *url.Error in the chain,
+// as returned by the HTTP client, is found by errors.As with its URL
+// redacted as well.
+func (c *Client) redactErr(err error) error {
+	if err == nil {
+		return err
+	}
+	msg := err.Error()
+	redacted := c.redactURL(msg)
+	if redacted == msg {
+		return err
+	}
+	re := &redactedError{msg: redacted, err: err}
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		re.url = &url.Error{Op: ue.Op, URL: c.redactURL(ue.URL), Err: ue.Err}
+	}
+	return re
+}
+
+// redactedError is an error whose text had the contact address removed.
+type redactedError struct {
+	msg string
+	err error
+	// replaces the *url.Error of err for errors.As, if set
+	url *url.Error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+
+func (e *redactedError) Unwrap() error { return e.err }
+
+func (e *redactedError) As(target any) bool {
+	if t, ok := target.(**url.Error); ok && e.url != nil {
+		*t = e.url
+		return true
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package ipintel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const testContact = "test@example.com"
+
+func TestRedactURLError(t *testing.T) {
+	// nothing listens on port 1
+	c := NewClient(testContact, false, Dynamic, 0, WithBaseURL("http://127.0.0.1:1/check.php"), WithLimiter(unlimited{}))
+	_, err := c.GetProxyScore(context.Background(), "192.0.2.1")
+	if err == nil {
+		t.Fatal("lookup succeeded without a server")
+	}
+	if msg := err.Error(); strings.Contains(msg, testContact) || strings.Contains(msg, url.QueryEscape(testContact)) {
+		t.Errorf("error leaks the contact: %s", msg)
+	}
+	var ue *url.Error
+	if !errors.As(err, &ue) {
+		t.Fatalf("error %v doesn't wrap a *url.Error", err)
+	}
+	if strings.Contains(ue.URL, url.QueryEscape(testContact)) {
+		t.Errorf("URL of the *url.Error leaks the contact: %s", ue.URL)
+	}
+
+	c = c.WithOptions(WithoutRedaction())
+	if _, err := c.GetProxyScore(context.Background(), "192.0.2.1"); !strings.Contains(err.Error(), url.QueryEscape(testContact)) {
+		t.Errorf("error redacted despite WithoutRedaction: %v", err)
+	}
+}
+
+// quotingError quotes the URL of a request, as errors of layers may.
+type quotingError struct{ url string }
+
+func (e *quotingError) Error() string { return "refused " + e.url }
+
+func TestRedactLayerErrors(t *testing.T) {
+	for _, fail := range []func(*http.Request) error{
+		func(req *http.Request) error { return &quotingError{url: req.URL.String()} },
+		func(req *http.Request) error { return fmt.Errorf("Blocked sender %s", testContact) },
+	} {
+		mw := func(Doer) Doer {
+			return DoerFunc(func(req *http.Request) (*http.Response, error) {
+				return nil, fail(req)
+			})
+		}
+		c := NewClient(testContact, false, Dynamic, 0, WithLimiter(unlimited{}), WithMiddleware(mw))
+		_, err := c.GetProxyScore(context.Background(), "192.0.2.1")
+		if err == nil {
+			t.Fatal("lookup succeeded despite the failing layer")
+		}
+		if msg := err.Error(); strings.Contains(msg, testContact) || strings.Contains(msg, url.QueryEscape(testContact)) {
+			t.Errorf("error leaks the contact: %s", msg)
+		}
+		var qe *quotingError
+		if errors.As(err, &qe) != strings.HasPrefix(err.Error(), "Failed to query API: refused") {
+			t.Errorf("error chain of %v lost", err)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package ipintel
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ProviderFactory creates a Provider from its settings, e.g. an API key
+// given in a config file. Settings referencing secrets are passed as is;
+// factories may resolve them with ResolveSecret.
+type ProviderFactory func(params map[string]string) (Provider, error)
+
+var (
+	providersMu sync.RWMutex
+	providers   = make(map[string]ProviderFactory)
+)
+
+// RegisterProvider makes a Provider available by name to NewProvider,
+// and so to config files and the ipintel command, without them
+// importing its package. It is meant to be called from the init
+// function of the package implementing the Provider:
+//
+//	func init() {
+//		ipintel.RegisterProvider("example", func(params map[string]string) (ipintel.Provider, error) {
+//			return New(params["key"])
+//		})
+//	}
+//
+// Programs then enable it with a blank import. RegisterProvider panics
+// if factory is nil or name is already registered.
+func RegisterProvider(name string, factory ProviderFactory) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	if factory == nil {
+		panic("ipintel: RegisterProvider factory is nil")
+	}
+	if _, dup := providers[name]; dup {
+		panic("ipintel: RegisterProvider called twice for provider " + name)
+	}
+	providers[name] = factory
+}
+
+// NewProvider creates the Provider registered as name with params.
+func NewProvider(name string, params map[string]string) (Provider, error) {
+	providersMu.RLock()
+	factory, ok := providers[name]
+	providersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("Unknown provider %q", name)
+	}
+	p, err := factory(params)
+	if err != nil {
+		return nil, fmt.Errorf("Provider %s: %w", name, err)
+	}
+	return p, nil
+}
+
+// Providers returns the sorted names of the registered providers.
+func Providers() []string {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
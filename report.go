@@ -0,0 +1,279 @@
+package ipintel
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ReportOptions configures NewReport.
+type ReportOptions struct {
+	// Score at or above which an IP counts as a proxy
+	Threshold float32
+	// Width of the proxy rate buckets; one day if zero
+	Interval time.Duration
+	// Number of networks listed in TopNetworks and IPs listed in
+	// TopOffenders; 10 if zero
+	TopN int
+}
+
+// Report summarizes a set of recorded lookups.
+type Report struct {
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+	Lookups   int       `json:"lookups"`
+	UniqueIPs int       `json:"unique_ips"`
+	// Number of unique IPs whose latest score is at or above the threshold
+	Proxies   int          `json:"proxies"`
+	Threshold float32      `json:"threshold"`
+	ProxyRate []RateBucket `json:"proxy_rate"`
+	// Networks (/24 for IPv4, /64 for IPv6) with the most proxies
+	TopNetworks []NetworkStat `json:"top_networks"`
+	// Distribution of the latest score of each IP in ten bins of 0.1
+	Histogram []HistogramBin `json:"histogram"`
+	// IPs counting as proxy looked up most often
+	TopOffenders []OffenderStat `json:"top_offenders"`
+	// IPs and proxies by country, most proxies first, if the lookups
+	// include the country (see WithCountry)
+	Countries []CountryStat `json:"countries,omitempty"`
+}
+
+// OffenderStat summarizes the lookups of an IP counting as proxy.
+type OffenderStat struct {
+	IP      string  `json:"ip"`
+	Lookups int     `json:"lookups"`
+	Score   float32 `json:"score"`
+	Country string  `json:"country,omitempty"`
+}
+
+// CountryStat summarizes the IPs of a country.
+type CountryStat struct {
+	Country string `json:"country"`
+	IPs     int    `json:"ips"`
+	Proxies int    `json:"proxies"`
+}
+
+// RateBucket is the share of lookups scoring as proxy within a time interval.
+type RateBucket struct {
+	Start   time.Time `json:"start"`
+	Lookups int       `json:"lookups"`
+	Proxies int       `json:"proxies"`
+	Rate    float64   `json:"rate"`
+}
+
+// NetworkStat summarizes the IPs seen within a network.
+type NetworkStat struct {
+	Network   string  `json:"network"`
+	IPs       int     `json:"ips"`
+	Proxies   int     `json:"proxies"`
+	MeanScore float64 `json:"mean_score"`
+	MaxScore  float32 `json:"max_score"`
+}
+
+// HistogramBin counts the IPs with a score in [Min, Max).
+// The last bin includes 1.
+type HistogramBin struct {
+	Min   float32 `json:"min"`
+	Max   float32 `json:"max"`
+	Count int     `json:"count"`
+}
+
+// NewReport computes a Report from recs.
+func NewReport(recs []Record, opts ReportOptions) Report {
+	if opts.Interval <= 0 {
+		opts.Interval = 24 * time.Hour
+	}
+	if opts.TopN <= 0 {
+		opts.TopN = 10
+	}
+	r := Report{Lookups: len(recs), Threshold: opts.Threshold}
+
+	latest, lookups := latestByIP(recs), lookupsByIP(recs)
+	buckets := make(map[time.Time]*RateBucket)
+	for _, rec := range recs {
+		if r.From.IsZero() || rec.QueriedAt.Before(r.From) {
+			r.From = rec.QueriedAt
+		}
+		if rec.QueriedAt.After(r.To) {
+			r.To = rec.QueriedAt
+		}
+		start := rec.QueriedAt.Truncate(opts.Interval)
+		b := buckets[start]
+		if b == nil {
+			b = &RateBucket{Start: start}
+			buckets[start] = b
+		}
+		b.Lookups++
+		if rec.Score >= opts.Threshold {
+			b.Proxies++
+		}
+	}
+	r.UniqueIPs = len(latest)
+
+	r.ProxyRate = make([]RateBucket, 0, len(buckets))
+	for _, b := range buckets {
+		b.Rate = float64(b.Proxies) / float64(b.Lookups)
+		r.ProxyRate = append(r.ProxyRate, *b)
+	}
+	sort.Slice(r.ProxyRate, func(i, j int) bool {
+		return r.ProxyRate[i].Start.Before(r.ProxyRate[j].Start)
+	})
+
+	r.Histogram = make([]HistogramBin, 10)
+	for i := range r.Histogram {
+		r.Histogram[i] = HistogramBin{Min: float32(i) / 10, Max: float32(i+1) / 10}
+	}
+	networks := make(map[string]*NetworkStat)
+	countries := make(map[string]*CountryStat)
+	for ip, rec := range latest {
+		bin := int(rec.Score * 10)
+		if bin > 9 {
+			bin = 9
+		} else if bin < 0 {
+			bin = 0
+		}
+		r.Histogram[bin].Count++
+
+		proxy := rec.Score >= opts.Threshold
+		if proxy {
+			r.Proxies++
+			r.TopOffenders = append(r.TopOffenders, OffenderStat{
+				IP:      ip,
+				Lookups: lookups[ip],
+				Score:   rec.Score,
+				Country: rec.Country(),
+			})
+		}
+		if country := rec.Country(); country != "" {
+			cs := countries[country]
+			if cs == nil {
+				cs = &CountryStat{Country: country}
+				countries[country] = cs
+			}
+			cs.IPs++
+			if proxy {
+				cs.Proxies++
+			}
+		}
+		network := networkOf(ip)
+		if network == "" {
+			continue
+		}
+		n := networks[network]
+		if n == nil {
+			n = &NetworkStat{Network: network}
+			networks[network] = n
+		}
+		n.IPs++
+		if proxy {
+			n.Proxies++
+		}
+		n.MeanScore += float64(rec.Score)
+		if rec.Score > n.MaxScore {
+			n.MaxScore = rec.Score
+		}
+	}
+
+	r.TopNetworks = make([]NetworkStat, 0, len(networks))
+	for _, n := range networks {
+		n.MeanScore /= float64(n.IPs)
+		r.TopNetworks = append(r.TopNetworks, *n)
+	}
+	sort.Slice(r.TopNetworks, func(i, j int) bool {
+		a, b := r.TopNetworks[i], r.TopNetworks[j]
+		if a.Proxies != b.Proxies {
+			return a.Proxies > b.Proxies
+		}
+		if a.MeanScore != b.MeanScore {
+			return a.MeanScore > b.MeanScore
+		}
+		return a.Network < b.Network
+	})
+	if len(r.TopNetworks) > opts.TopN {
+		r.TopNetworks = r.TopNetworks[:opts.TopN]
+	}
+
+	sort.Slice(r.TopOffenders, func(i, j int) bool {
+		a, b := r.TopOffenders[i], r.TopOffenders[j]
+		if a.Lookups != b.Lookups {
+			return a.Lookups > b.Lookups
+		}
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return compareIPs(a.IP, b.IP) < 0
+	})
+	if len(r.TopOffenders) > opts.TopN {
+		r.TopOffenders = r.TopOffenders[:opts.TopN]
+	}
+	if r.TopOffenders == nil {
+		r.TopOffenders = []OffenderStat{}
+	}
+
+	for _, cs := range countries {
+		r.Countries = append(r.Countries, *cs)
+	}
+	sort.Slice(r.Countries, func(i, j int) bool {
+		a, b := r.Countries[i], r.Countries[j]
+		if a.Proxies != b.Proxies {
+			return a.Proxies > b.Proxies
+		}
+		if a.IPs != b.IPs {
+			return a.IPs > b.IPs
+		}
+		return a.Country < b.Country
+	})
+	return r
+}
+
+// networkOf returns the /24 (IPv4) or /64 (IPv6) network of ip,
+// or "" if ip is invalid.
+func networkOf(ip string) string {
+	return networkKey(ip, 24, 64)
+}
+
+// WriteMarkdown writes r as a Markdown document.
+func (r Report) WriteMarkdown(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("# IP intelligence report\n\n")
+	fmt.Fprintf(&b, "- Period: %s – %s\n", formatTime(r.From), formatTime(r.To))
+	fmt.Fprintf(&b, "- Lookups: %d\n", r.Lookups)
+	fmt.Fprintf(&b, "- Unique IPs: %d\n", r.UniqueIPs)
+	fmt.Fprintf(&b, "- Proxies (score ≥ %g): %d\n", r.Threshold, r.Proxies)
+
+	b.WriteString("\n## Proxy rate\n\n| Start | Lookups | Proxies | Rate |\n|---|---:|---:|---:|\n")
+	for _, rb := range r.ProxyRate {
+		fmt.Fprintf(&b, "| %s | %d | %d | %.1f%% |\n", formatTime(rb.Start), rb.Lookups, rb.Proxies, rb.Rate*100)
+	}
+
+	b.WriteString("\n## Top networks\n\n| Network | IPs | Proxies | Mean score | Max score |\n|---|---:|---:|---:|---:|\n")
+	for _, n := range r.TopNetworks {
+		fmt.Fprintf(&b, "| %s | %d | %d | %.3f | %g |\n", n.Network, n.IPs, n.Proxies, n.MeanScore, n.MaxScore)
+	}
+
+	b.WriteString("\n## Top offenders\n\n| IP | Lookups | Score | Country |\n|---|---:|---:|---|\n")
+	for _, o := range r.TopOffenders {
+		fmt.Fprintf(&b, "| %s | %d | %g | %s |\n", o.IP, o.Lookups, o.Score, o.Country)
+	}
+
+	if len(r.Countries) > 0 {
+		b.WriteString("\n## Countries\n\n| Country | IPs | Proxies |\n|---|---:|---:|\n")
+		for _, cs := range r.Countries {
+			fmt.Fprintf(&b, "| %s | %d | %d |\n", cs.Country, cs.IPs, cs.Proxies)
+		}
+	}
+
+	b.WriteString("\n## Score distribution\n\n| Score | IPs |\n|---|---:|\n")
+	for i, h := range r.Histogram {
+		closing := ")"
+		if i == len(r.Histogram)-1 {
+			closing = "]"
+		}
+		fmt.Fprintf(&b, "| [%.1f, %.1f%s | %d |\n", h.Min, h.Max, closing, h.Count)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
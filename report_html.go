@@ -0,0 +1,77 @@
+package ipintel
+
+import (
+	"html/template"
+	"io"
+)
+
+// reportHTML renders a Report as a self-contained HTML page.
+var reportHTML = template.Must(template.New("report").Funcs(template.FuncMap{
+	"time": formatTime,
+	"pct":  func(f float64) float64 { return f * 100 },
+	"share": func(n, total int) float64 {
+		if total == 0 {
+			return 0
+		}
+		return float64(n) * 100 / float64(total)
+	},
+	"last": func(i int, s []HistogramBin) bool { return i == len(s)-1 },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>IP intelligence report</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2em auto; max-width: 60em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { padding: .3em .8em; border-bottom: 1px solid #ddd; text-align: left; }
+td.n { text-align: right; font-variant-numeric: tabular-nums; }
+.bar { background: #c33; height: 1em; }
+</style>
+</head>
+<body>
+<h1>IP intelligence report</h1>
+<ul>
+<li>Period: {{time .From}} – {{time .To}}</li>
+<li>Lookups: {{.Lookups}}</li>
+<li>Unique IPs: {{.UniqueIPs}}</li>
+<li>Proxies (score ≥ {{.Threshold}}): {{.Proxies}}</li>
+</ul>
+
+<h2>Proxy rate</h2>
+<table>
+<tr><th>Start</th><th>Lookups</th><th>Proxies</th><th>Rate</th></tr>
+{{range .ProxyRate}}<tr><td>{{time .Start}}</td><td class="n">{{.Lookups}}</td><td class="n">{{.Proxies}}</td><td class="n">{{printf "%.1f" (pct .Rate)}}%</td></tr>
+{{end}}</table>
+
+<h2>Top networks</h2>
+<table>
+<tr><th>Network</th><th>IPs</th><th>Proxies</th><th>Mean score</th><th>Max score</th></tr>
+{{range .TopNetworks}}<tr><td>{{.Network}}</td><td class="n">{{.IPs}}</td><td class="n">{{.Proxies}}</td><td class="n">{{printf "%.3f" .MeanScore}}</td><td class="n">{{.MaxScore}}</td></tr>
+{{end}}</table>
+
+<h2>Top offenders</h2>
+<table>
+<tr><th>IP</th><th>Lookups</th><th>Score</th><th>Country</th></tr>
+{{range .TopOffenders}}<tr><td>{{.IP}}</td><td class="n">{{.Lookups}}</td><td class="n">{{.Score}}</td><td>{{.Country}}</td></tr>
+{{end}}</table>
+{{if .Countries}}
+<h2>Countries</h2>
+<table>
+<tr><th>Country</th><th>IPs</th><th>Proxies</th></tr>
+{{range .Countries}}<tr><td>{{.Country}}</td><td class="n">{{.IPs}}</td><td class="n">{{.Proxies}}</td></tr>
+{{end}}</table>
+{{end}}
+<h2>Score distribution</h2>
+<table>
+<tr><th>Score</th><th>IPs</th><th></th></tr>
+{{$total := .UniqueIPs}}{{$bins := .Histogram}}{{range $i, $h := .Histogram}}<tr><td>[{{printf "%.1f" .Min}}, {{printf "%.1f" .Max}}{{if last $i $bins}}]{{else}}){{end}}</td><td class="n">{{.Count}}</td><td style="width: 20em"><div class="bar" style="width: {{printf "%.1f" (share .Count $total)}}%"></div></td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// WriteHTML writes r as a self-contained HTML page.
+func (r Report) WriteHTML(w io.Writer) error {
+	return reportHTML.Execute(w, r)
+}
@@ -0,0 +1,138 @@
+package ipintel
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultMaxResponseSize caps the size of an API response unless
+// changed with WithMaxResponseSize. Real responses are well below 1 KiB;
+// anything larger means the endpoint misbehaves.
+const DefaultMaxResponseSize = 64 << 10
+
+// knownFields lists the response fields decoded into response.
+// Everything else ends up in response.Extra.
+var knownFields = []string{"status", "message", "result", "queryIP", "queryFlags", "queryFormat", "contact"}
+
+type response struct {
+	Status string                     `json:"status"`
+	ErrMsg string                     `json:"message"`
+	Score  score                      `json:"result"`
+	IP     string                     `json:"queryIP"`
+	Extra  map[string]json.RawMessage `json:"-"`
+}
+
+// bufPool holds buffers for reading responses, which are decoded and
+// copied out before the buffer is returned.
+var bufPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// readResponse parses the API response resp of at most maxSize bytes,
+// turning rejections and failures into an *APIError.
+func readResponse(resp *http.Response, maxSize int64) (respObj response, err error) {
+	if resp.StatusCode == http.StatusTooManyRequests {
+		err = &APIError{StatusCode: resp.StatusCode, Message: "Rate limit exceeded"}
+		return
+	}
+	respObj, err = parseResponse(resp.Body, maxSize)
+	if err != nil {
+		if resp.StatusCode >= 400 {
+			err = &APIError{StatusCode: resp.StatusCode, Message: resp.Status}
+		} else {
+			err = fmt.Errorf("Failed to parse API response: %w", err)
+		}
+		return
+	}
+	if respObj.Status != "success" {
+		err = &APIError{
+			Code:       int(respObj.Score),
+			StatusCode: resp.StatusCode,
+			Message:    respObj.ErrMsg,
+		}
+	}
+	return
+}
+
+// parseResponse decodes an API response of at most maxSize bytes. For
+// successful responses the score must be within [0, 1].
+//
+// The response is read into a pooled buffer rather than decoded from r
+// with a json.Decoder: the decoder buffers a complete value before
+// decoding it as well, so streaming wouldn't save memory.
+func parseResponse(r io.Reader, maxSize int64) (resp response, err error) {
+	buf := bufPool.Get().(*bytes.Buffer)
+	defer func() {
+		// don't keep buffers grown by a raised limit around
+		if buf.Cap() <= DefaultMaxResponseSize {
+			buf.Reset()
+			bufPool.Put(buf)
+		}
+	}()
+	if _, err = buf.ReadFrom(io.LimitReader(r, maxSize+1)); err != nil {
+		return
+	}
+	data := buf.Bytes()
+	if int64(len(data)) > maxSize {
+		err = fmt.Errorf("Response exceeds %d bytes", maxSize)
+		return
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")) // UTF-8 BOM
+
+	if err = json.Unmarshal(data, &resp); err != nil {
+		return
+	}
+	if resp.Status == "success" && (resp.Score < 0 || resp.Score > 1) {
+		err = fmt.Errorf("Score %v out of range", resp.Score)
+	}
+	return
+}
+
+func (r *response) UnmarshalJSON(data []byte) error {
+	// plain has the same fields but not the method, avoiding recursion
+	type plain response
+	if err := json.Unmarshal(data, (*plain)(r)); err != nil {
+		return err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for _, k := range knownFields {
+		delete(fields, k)
+	}
+	if len(fields) > 0 {
+		r.Extra = fields
+	}
+	return nil
+}
+
+// score is the result field of a response. The API sends it as a
+// string, but a plain JSON number is accepted as well.
+type score float32
+
+func (s *score) UnmarshalJSON(data []byte) error {
+	str := string(data)
+	if str == "null" {
+		return nil
+	}
+	if strings.HasPrefix(str, `"`) {
+		if err := json.Unmarshal(data, &str); err != nil {
+			return err
+		}
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(str), 32)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return fmt.Errorf("Invalid score %q", str)
+	}
+	*s = score(f)
+	return nil
+}
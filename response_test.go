@@ -0,0 +1,154 @@
+package ipintel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func FuzzParseResponse(f *testing.F) {
+	for _, seed := range []string{
+		`{"status":"success","result":"0.5","queryIP":"192.0.2.1"}`,
+		`{"status":"success","result":1}`,
+		`{"status":"error","result":"-2","message":"Invalid IP"}`,
+		"\xef\xbb\xbf" + `{"status":"success","result":"0"}`,
+		`{"status":"success","result":"1e-45"}`,
+		`{"status":"success","result":"3.5e38"}`,
+		`{"status":"success","result":"-0"}`,
+		`{"status":"success","result":"NaN"}`,
+		`{"status":"success","result":"Inf"}`,
+		`{"status":"success","result":1.0000001}`,
+		`{"status":"success","result":"0x1p-2"}`,
+		`{"status":"success","result":null}`,
+		`{"status":"success","result":"0.5","a":{"b":[{"c":[[[{}]]]}]}}`,
+		`{"status":"success","result":"0.5","Country":"\xff\xfe"}`,
+		"{\"status\":\"\xc3\x28\",\"result\":\"0.5\"}",
+		`{"status":"success","result":"0.5"` + strings.Repeat(" ", 100),
+		strings.Repeat("[", 10000),
+		`{"status":"success","result":"0.5","pad":"` + strings.Repeat("x", 2000) + `"}`,
+		``,
+	} {
+		f.Add([]byte(seed))
+	}
+	const maxSize = 1 << 10
+	f.Fuzz(func(t *testing.T, data []byte) {
+		resp, err := parseResponse(bytes.NewReader(data), maxSize)
+		if len(data) > maxSize {
+			if err == nil {
+				t.Fatalf("accepted %d bytes, limit %d", len(data), maxSize)
+			}
+			return
+		}
+		if err != nil {
+			return
+		}
+		if resp.Status == "success" && (resp.Score < 0 || resp.Score > 1) {
+			t.Fatalf("score %v out of range", resp.Score)
+		}
+		for _, k := range knownFields {
+			if _, ok := resp.Extra[k]; ok {
+				t.Fatalf("known field %q in Extra", k)
+			}
+		}
+	})
+}
+
+func TestParseResponseMaxSize(t *testing.T) {
+	body := `{"status":"success","result":"0.5"}`
+	n := int64(len(body))
+	if _, err := parseResponse(strings.NewReader(body), n); err != nil {
+		t.Errorf("body of exactly the limit: %v", err)
+	}
+	if _, err := parseResponse(strings.NewReader(body), n-1); err == nil {
+		t.Error("body over the limit was accepted")
+	}
+}
+
+type unlimited struct{}
+
+func (unlimited) WaitMaxDuration(int64, time.Duration) bool { return true }
+
+func TestWithMaxResponseSize(t *testing.T) {
+	pad := strings.Repeat("x", 4<<10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"success","result":"0.5","pad":"` + pad + `"}`))
+	}))
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		size int64
+		ok   bool
+	}{
+		{0, true}, // DefaultMaxResponseSize
+		{8 << 10, true},
+		{1 << 10, false},
+	} {
+		opts := []Option{WithBaseURL(srv.URL), WithLimiter(unlimited{})}
+		if tt.size > 0 {
+			opts = append(opts, WithMaxResponseSize(tt.size))
+		}
+		c := NewClient("test@example.com", false, Dynamic, 0, opts...)
+		res, err := c.GetProxyScore(context.Background(), "192.0.2.1")
+		if tt.ok && (err != nil || res.Score != 0.5) {
+			t.Errorf("size %d: got %v, %v", tt.size, res, err)
+		}
+		if !tt.ok && (err == nil || !strings.Contains(err.Error(), "exceeds")) {
+			t.Errorf("size %d: got error %v, want one of the limit", tt.size, err)
+		}
+		c.Close()
+	}
+}
+
+// BenchmarkParseResponse compares parseResponse with reading each
+// response into a fresh slice, as it did before the buffers were pooled.
+func BenchmarkParseResponse(b *testing.B) {
+	body := []byte(`{"status":"success","result":"0.87","queryIP":"192.0.2.1","queryFlags":"b","queryFormat":"json","contact":"test@example.com","Country":"US"}`)
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			if _, err := parseResponse(bytes.NewReader(body), DefaultMaxResponseSize); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("readall", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			data, err := io.ReadAll(io.LimitReader(bytes.NewReader(body), DefaultMaxResponseSize+1))
+			if err != nil {
+				b.Fatal(err)
+			}
+			var resp response
+			if err := json.Unmarshal(data, &resp); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkGetURL compares getURL with the fmt.Sprintf it replaced.
+func BenchmarkGetURL(b *testing.B) {
+	c := NewClient("test+ipintel@example.com", true, Dynamic, 0)
+	defer c.Close()
+	b.Run("builder", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			c.getURL("192.0.2.1", Dynamic)
+		}
+	})
+	b.Run("sprintf", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			_ = fmt.Sprintf("%s?ip=%s&contact=%s&flags=%s&format=json",
+				c.scheme+"://"+urlBase, url.QueryEscape("192.0.2.1"), url.QueryEscape(c.email), Dynamic)
+		}
+	})
+}
@@ -0,0 +1,156 @@
+package ipintel
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Result holds the decoded API response for a single query.
+type Result struct {
+	// Queried IP address as echoed back by the API
+	IP string
+	// Proxy score (see CheckType for the possible range)
+	Score float32
+	// Type of check the score was determined with
+	Check CheckType
+	// Name of the provider that determined the score
+	Provider string
+	// Time the query was made
+	QueriedAt time.Time
+	// Name of the local list that answered the query instead of the
+	// API, empty if the API was queried (see WithLists)
+	List string
+	// Whether the Result was answered from the cache (see WithCache)
+	FromCache bool
+	// Kind of proxy, if told by the provider or derived from several
+	// providers (see ipintelproviders.Fuse)
+	Type ProxyType
+	// Time the lookup took, including waiting for the rate limiter
+	Latency time.Duration
+	// Number of API requests made for the lookup, 0 if answered by a
+	// list or the cache
+	Attempts int
+	// Response fields not (yet) known to this package, e.g. data
+	// added by the API after this version was released.
+	Extra map[string]json.RawMessage
+}
+
+// Country returns the ISO 3166 code of the IP's country as reported by
+// the API when asked for it (see WithCountry), or "".
+func (r Result) Country() string {
+	var country string
+	if raw, ok := r.Extra[ExtraCountry]; ok {
+		json.Unmarshal(raw, &country)
+	}
+	return country
+}
+
+// String formats r as space-separated key=value pairs, e.g.
+// "ip=192.0.2.1 score=0.99 check=dynamic risk=high provider=getipintel cached=false".
+func (r Result) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "ip=%s score=%s check=%s risk=%s", r.IP, formatScore(r.Score), r.Check, r.Risk())
+	if r.Provider != "" {
+		fmt.Fprintf(&b, " provider=%s", r.Provider)
+	}
+	if r.List != "" {
+		fmt.Fprintf(&b, " list=%s", r.List)
+	}
+	if r.Type != "" {
+		fmt.Fprintf(&b, " type=%s", r.Type)
+	}
+	fmt.Fprintf(&b, " cached=%t", r.FromCache)
+	return b.String()
+}
+
+// MarshalText implements encoding.TextMarshaler using String.
+func (r Result) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// resultJSON is the JSON representation of a Result.
+type resultJSON struct {
+	QueriedAt *time.Time                 `json:"queried_at,omitempty"`
+	IP        string                     `json:"ip"`
+	Check     string                     `json:"check"`
+	Score     float32                    `json:"score"`
+	Risk      RiskLevel                  `json:"risk"`
+	Provider  string                     `json:"provider,omitempty"`
+	List      string                     `json:"list,omitempty"`
+	Type      ProxyType                  `json:"type,omitempty"`
+	Cached    bool                       `json:"cached"`
+	LatencyMS float64                    `json:"latency_ms,omitempty"`
+	Attempts  int                        `json:"attempts,omitempty"`
+	Extra     map[string]json.RawMessage `json:"extra,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler. The check type is written as
+// "static" or "dynamic", along with the risk level. The latter is
+// ignored by UnmarshalJSON.
+func (r Result) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.toJSON())
+}
+
+func (r Result) toJSON() resultJSON {
+	v := resultJSON{
+		IP:       r.IP,
+		Check:    r.Check.String(),
+		Score:    r.Score,
+		Risk:     r.Risk(),
+		Provider: r.Provider,
+		List:     r.List,
+		Type:     r.Type,
+		Cached:   r.FromCache,
+		Attempts: r.Attempts,
+		Extra:    r.Extra,
+	}
+	if r.Latency > 0 {
+		v.LatencyMS = float64(r.Latency) / float64(time.Millisecond)
+	}
+	if !r.QueriedAt.IsZero() {
+		v.QueriedAt = &r.QueriedAt
+	}
+	return v
+}
+
+// UnmarshalJSON implements json.Unmarshaler, reading the format
+// written by MarshalJSON.
+func (r *Result) UnmarshalJSON(data []byte) error {
+	var v resultJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	return r.fromJSON(v)
+}
+
+func (r *Result) fromJSON(v resultJSON) error {
+	*r = Result{
+		IP:        v.IP,
+		Score:     v.Score,
+		Provider:  v.Provider,
+		List:      v.List,
+		Type:      v.Type,
+		FromCache: v.Cached,
+		Latency:   time.Duration(v.LatencyMS * float64(time.Millisecond)),
+		Attempts:  v.Attempts,
+		Extra:     v.Extra,
+	}
+	if v.Check != "" {
+		check, err := ParseCheckType(v.Check)
+		if err != nil {
+			return err
+		}
+		r.Check = check
+	}
+	if v.QueriedAt != nil {
+		r.QueriedAt = *v.QueriedAt
+	}
+	return nil
+}
+
+func formatScore(score float32) string {
+	return strconv.FormatFloat(float64(score), 'f', -1, 32)
+}
@@ -0,0 +1,73 @@
+package ipintel
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"time"
+)
+
+// Retention limits how long and how much lookup data is kept.
+// Zero values mean no limit.
+type Retention struct {
+	// Data older than MaxAge is deleted
+	MaxAge time.Duration
+	// Only the newest MaxEntries entries are kept
+	MaxEntries int
+}
+
+// Purger is implemented by Stores and Caches able to delete data,
+// e.g. for privacy compliance.
+type Purger interface {
+	// PurgeBefore deletes all data about lookups made before t and
+	// returns the number of deleted entries.
+	PurgeBefore(ctx context.Context, t time.Time) (int, error)
+	// PurgeIP deletes all data about ip and returns the number of
+	// deleted entries.
+	PurgeIP(ctx context.Context, ip string) (int, error)
+}
+
+// PurgeIP deletes all data about ip from the Client's Cache and Store,
+// provided they implement Purger. The Store is purged of the value
+// recorded for ip by the Pseudonymizer, if any. A Pseudonymizer such as
+// TruncateIP records a whole network under one address, which ip can't
+// be told apart from, so PurgeIP refuses to delete it; use PurgeBefore
+// or purge the Store itself instead.
+func (c *Client) PurgeIP(ctx context.Context, ip string) error {
+	stored := c.storedIP(ip)
+	if addr, err := netip.ParseAddr(ip); err == nil && stored != addr.Unmap().String() {
+		if _, err := netip.ParseAddr(stored); err == nil {
+			return fmt.Errorf("Can't purge %s stored as %s by the Pseudonymizer along with other IPs", ip, stored)
+		}
+	}
+	return c.purge(func(p Purger, isStore bool) error {
+		v := ip
+		if isStore {
+			v = stored
+		}
+		_, err := p.PurgeIP(ctx, v)
+		return err
+	})
+}
+
+// PurgeBefore deletes all data about lookups made before t from the
+// Client's Cache and Store, provided they implement Purger.
+func (c *Client) PurgeBefore(ctx context.Context, t time.Time) error {
+	return c.purge(func(p Purger, _ bool) error {
+		_, err := p.PurgeBefore(ctx, t)
+		return err
+	})
+}
+
+// purge calls fn with the Cache and then the Store, telling them apart
+// by isStore, if they implement Purger.
+func (c *Client) purge(fn func(p Purger, isStore bool) error) error {
+	for i, v := range []interface{}{c.cache, c.store} {
+		if p, ok := v.(Purger); ok {
+			if err := fn(p, i == 1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package ipintel
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// purgeLog records the values purged.
+type purgeLog struct {
+	Store
+	ips []string
+}
+
+func (p *purgeLog) PurgeIP(ctx context.Context, ip string) (int, error) {
+	p.ips = append(p.ips, ip)
+	return 1, nil
+}
+
+func (p *purgeLog) PurgeBefore(ctx context.Context, t time.Time) (int, error) {
+	return 0, nil
+}
+
+func TestPurgeIPPseudonymized(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		opts   []Option
+		purged string
+	}{
+		{"plain", nil, "192.0.2.1"},
+		{"hashed", []Option{WithPseudonymizer(HashIP([]byte("key")))}, HashIP([]byte("key"))("192.0.2.1")},
+		{"truncated", []Option{WithPseudonymizer(TruncateIP(24, 48))}, ""},
+	} {
+		store := new(purgeLog)
+		c := NewClient("test@example.com", false, Dynamic, 0, append(tt.opts, WithStore(store))...)
+		err := c.PurgeIP(context.Background(), "192.0.2.1")
+		if tt.purged == "" {
+			if err == nil || len(store.ips) != 0 {
+				t.Errorf("%s: PurgeIP() = %v purging %v, want it refused", tt.name, err, store.ips)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: PurgeIP() = %v", tt.name, err)
+		} else if len(store.ips) != 1 || store.ips[0] != tt.purged {
+			t.Errorf("%s: purged %v, want %s", tt.name, store.ips, tt.purged)
+		}
+	}
+}
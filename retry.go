@@ -0,0 +1,142 @@
+package ipintel
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy decides whether a failed API query is retried. attempt
+// counts the queries made so far, starting at 1. resp is the response
+// of the failed query, with its body already read, or nil if there was
+// none. The returned duration is the time to wait before retrying.
+type RetryPolicy interface {
+	ShouldRetry(attempt int, resp *http.Response, err error) (bool, time.Duration)
+}
+
+// WithRetryPolicy retries failed API queries as decided by p, e.g.
+// Backoff{}. Each retry is a new query, waiting for the limiter and
+// counting against the quota; none is made once the lookup's context
+// is done. Queries aren't retried by default.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = p
+	}
+}
+
+// Backoff is a RetryPolicy retrying failures that may be temporary:
+// network errors, rate limit rejections and server errors. The wait
+// doubles from Min up to Max, or follows the Retry-After header of the
+// response if longer. Throttling by the limiter (see ThrottleError),
+// canceled lookups and errors such as an invalid IP aren't retried (see
+// Retryable).
+type Backoff struct {
+	// Number of retries; 3 if zero
+	Retries int
+	// Wait before the first retry; 500ms if zero
+	Min time.Duration
+	// Cap on the wait; 30s if zero
+	Max time.Duration
+}
+
+// ShouldRetry implements RetryPolicy.
+func (b Backoff) ShouldRetry(attempt int, resp *http.Response, err error) (bool, time.Duration) {
+	retries, lo, hi := b.Retries, b.Min, b.Max
+	if retries == 0 {
+		retries = 3
+	}
+	if lo == 0 {
+		lo = 500 * time.Millisecond
+	}
+	if hi == 0 {
+		hi = 30 * time.Second
+	}
+	if attempt > retries || !Retryable(err) {
+		return false, 0
+	}
+	wait := lo << min(attempt-1, 30)
+	if wait <= 0 || wait > hi {
+		wait = hi
+	}
+	if resp != nil {
+		if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && s > 0 {
+			wait = max(wait, min(time.Duration(s)*time.Second, hi))
+		}
+	}
+	return true, wait
+}
+
+// Retryable reports whether a failed query may succeed when retried:
+// true for network errors including timeouts of the HTTP client, rate
+// limit rejections and server errors. Custom policies may use it to
+// classify errors.
+func Retryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, ErrNotSampled) {
+		return false
+	}
+	var throttled *ThrottleError
+	if errors.As(err, &throttled) {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.RateLimited() || apiErr.Code == CodeDatabase || apiErr.StatusCode >= 500
+	}
+	// the request failed, or the response couldn't be parsed
+	return true
+}
+
+// retrying retries failed requests as decided by the RetryPolicy of c.
+// Responses are buffered to tell API errors from answers, and the last
+// one is returned with its body intact.
+func (c *Client) retrying(next Doer) Doer {
+	return DoerFunc(func(req *http.Request) (*http.Response, error) {
+		st := stateOf(req)
+		ctx := req.Context()
+		for attempt := 1; ; attempt++ {
+			st.attempts = attempt
+			resp, err := next.Do(req)
+			qerr := err
+			if err == nil {
+				qerr = c.bufferResponse(resp)
+			}
+			if qerr == nil || ctx.Err() != nil || st.rejected != nil {
+				return resp, err
+			}
+			retry, wait := c.retry.ShouldRetry(attempt, resp, qerr)
+			if !retry || !c.sleep(ctx, wait) {
+				return resp, err
+			}
+		}
+	})
+}
+
+// bufferResponse reads the body of resp into memory, replacing it with
+// a copy, and returns the error the response stands for, if any.
+func (c *Client) bufferResponse(resp *http.Response) error {
+	data, err := io.ReadAll(io.LimitReader(resp.Body, c.maxResponseSize+1))
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	_, err = readResponse(resp, c.maxResponseSize)
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	return err
+}
+
+// sleepContext waits for d, reporting false if ctx is done first.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
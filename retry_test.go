@@ -0,0 +1,95 @@
+package ipintel_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+	"github.com/pierelucas/go-ipintel/ipinteltest"
+)
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{context.Canceled, false},
+		{fmt.Errorf("query: %w", context.Canceled), false},
+		{ipintel.ErrNotSampled, false},
+		{&ipintel.ThrottleError{}, false},
+		{&ipintel.APIError{Code: ipintel.CodeInvalidIP, StatusCode: http.StatusBadRequest}, false},
+		{&ipintel.APIError{Code: ipintel.CodeBanned, StatusCode: http.StatusForbidden}, false},
+		{&ipintel.APIError{StatusCode: http.StatusTooManyRequests}, true},
+		{&ipintel.APIError{Code: ipintel.CodeDatabase, StatusCode: http.StatusOK}, true},
+		{&ipintel.APIError{StatusCode: http.StatusBadGateway}, true},
+		{errors.New("connection reset by peer"), true},
+		{context.DeadlineExceeded, true},
+	}
+	for _, tt := range tests {
+		if got := ipintel.Retryable(tt.err); got != tt.want {
+			t.Errorf("Retryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	failed := errors.New("connection refused")
+	b := ipintel.Backoff{Retries: 4, Min: time.Second, Max: 5 * time.Second}
+	for attempt, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second} {
+		retry, wait := b.ShouldRetry(attempt+1, nil, failed)
+		if !retry || wait != want {
+			t.Errorf("attempt %d: ShouldRetry = %v, %s, want true, %s", attempt+1, retry, wait, want)
+		}
+	}
+	if retry, _ := b.ShouldRetry(5, nil, failed); retry {
+		t.Error("retried after Retries")
+	}
+	if retry, _ := b.ShouldRetry(1, nil, context.Canceled); retry {
+		t.Error("retried a canceled lookup")
+	}
+
+	resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"3"}}}
+	limited := &ipintel.APIError{StatusCode: http.StatusTooManyRequests}
+	if _, wait := b.ShouldRetry(1, resp, limited); wait != 3*time.Second {
+		t.Errorf("wait with Retry-After 3 = %s, want 3s", wait)
+	}
+	resp.Header.Set("Retry-After", "60")
+	if _, wait := b.ShouldRetry(1, resp, limited); wait != 5*time.Second {
+		t.Errorf("wait with Retry-After 60 = %s, want Max", wait)
+	}
+
+	if _, wait := (ipintel.Backoff{}).ShouldRetry(1, nil, failed); wait != 500*time.Millisecond {
+		t.Errorf("default first wait = %s, want 500ms", wait)
+	}
+}
+
+func TestRetryRateLimited(t *testing.T) {
+	srv := ipinteltest.NewServer()
+	defer srv.Close()
+	srv.SetDefaultScore(0.25)
+	srv.Throttle(2)
+	c := srv.Client(ipintel.Dynamic).WithOptions(ipintel.WithRetryPolicy(ipintel.Backoff{Min: time.Millisecond}))
+
+	res, err := c.GetProxyScore(context.Background(), "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Score != 0.25 || res.Attempts != 3 || srv.Requests() != 3 {
+		t.Errorf("score %v after %d attempts and %d requests, want 0.25 after 3", res.Score, res.Attempts, srv.Requests())
+	}
+
+	srv.SetError("192.0.2.2", ipinteltest.ErrInvalidIP)
+	_, err = c.GetProxyScore(context.Background(), "192.0.2.2")
+	var apiErr *ipintel.APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != ipintel.CodeInvalidIP {
+		t.Fatalf("err = %v, want invalid IP", err)
+	}
+	if srv.Requests() != 4 {
+		t.Errorf("%d requests, invalid IP was retried", srv.Requests())
+	}
+}
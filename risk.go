@@ -0,0 +1,82 @@
+package ipintel
+
+import "fmt"
+
+// RiskLevel is a coarse classification of a proxy score.
+type RiskLevel int
+
+const (
+	// Low risk: very likely not a proxy.
+	Low RiskLevel = iota
+	// Medium risk: possibly a proxy. Worth flagging or a second factor,
+	// but too uncertain to block on. Static checks never yield Medium.
+	Medium
+	// High risk: listed as, or very likely, a proxy.
+	High
+)
+
+// Thresholds of dynamic scores as recommended by the API operator.
+const (
+	mediumRiskScore = 0.95
+	highRiskScore   = 0.99
+)
+
+// Classify returns the risk level of a score determined with check.
+// Static scores are either 0 or 1 and classified as Low or High. Dynamic
+// scores are probabilities; High starts at 0.99 and Medium at 0.95, as
+// false positives become frequent below that. Unknown check types are
+// treated as Dynamic.
+func Classify(score float32, check CheckType) RiskLevel {
+	if check == Static {
+		if score >= 0.5 {
+			return High
+		}
+		return Low
+	}
+	switch {
+	case score >= highRiskScore:
+		return High
+	case score >= mediumRiskScore:
+		return Medium
+	}
+	return Low
+}
+
+// Risk returns the risk level of r (see Classify).
+func (r Result) Risk() RiskLevel {
+	return Classify(r.Score, r.Check)
+}
+
+// String returns "low", "medium" or "high".
+func (l RiskLevel) String() string {
+	switch l {
+	case Low:
+		return "low"
+	case Medium:
+		return "medium"
+	case High:
+		return "high"
+	}
+	return "unknown"
+}
+
+// MarshalText implements encoding.TextMarshaler using String.
+func (l RiskLevel) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, accepting the
+// values returned by String.
+func (l *RiskLevel) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "low":
+		*l = Low
+	case "medium":
+		*l = Medium
+	case "high":
+		*l = High
+	default:
+		return fmt.Errorf("Unknown risk level %q", text)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package ipintel_test
+
+import (
+	"testing"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		score float32
+		check ipintel.CheckType
+		want  ipintel.RiskLevel
+	}{
+		{0, ipintel.Static, ipintel.Low},
+		{1, ipintel.Static, ipintel.High},
+		{0.97, ipintel.Static, ipintel.High},
+		{0, ipintel.Dynamic, ipintel.Low},
+		{0.94, ipintel.Dynamic, ipintel.Low},
+		{0.95, ipintel.Dynamic, ipintel.Medium},
+		{0.98, ipintel.Dynamic, ipintel.Medium},
+		{0.99, ipintel.Dynamic, ipintel.High},
+		{1, ipintel.Dynamic, ipintel.High},
+		{0.96, "x", ipintel.Medium},
+	}
+	for _, tt := range tests {
+		if got := ipintel.Classify(tt.score, tt.check); got != tt.want {
+			t.Errorf("Classify(%v, %q) = %v, want %v", tt.score, tt.check, got, tt.want)
+		}
+	}
+}
+
+func TestRiskLevelText(t *testing.T) {
+	for _, l := range []ipintel.RiskLevel{ipintel.Low, ipintel.Medium, ipintel.High} {
+		text, err := l.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got ipintel.RiskLevel
+		if err := got.UnmarshalText(text); err != nil || got != l {
+			t.Errorf("UnmarshalText(%q) = %v, %v, want %v", text, got, err, l)
+		}
+	}
+	var l ipintel.RiskLevel
+	if err := l.UnmarshalText([]byte("severe")); err == nil {
+		t.Error("UnmarshalText(severe) succeeded")
+	}
+}
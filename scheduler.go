@@ -0,0 +1,103 @@
+package ipintel
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"time"
+)
+
+// StaleSource is a source of IPs whose decisions may be outdated, such
+// as a Store or a cache.
+type StaleSource interface {
+	// Stale returns up to limit IPs whose most recent lookup happened
+	// before t, least recently checked first.
+	Stale(ctx context.Context, before time.Time, limit int) ([]string, error)
+}
+
+// Scheduler periodically re-checks IPs from a StaleSource, so that
+// stale decisions are refreshed and IPs that turned clean are noticed
+// (e.g. through WithChangeHook). Checker should record its lookups,
+// otherwise the same IPs stay stale.
+//
+// A Store written with a Pseudonymizer (see WithPseudonymizer) returns
+// pseudonyms rather than IPs. With TruncateIP they are network
+// addresses, which are re-checked in place of the IPs of the network.
+// Values of HashIP can't be looked up and are skipped, and RunOnce
+// refuses to run if Checker is a Client pseudonymizing that way.
+//
+// Example:
+//
+//	s := &ipintel.Scheduler{
+//		Checker:  c,
+//		Source:   st,
+//		Interval: time.Hour,
+//		MaxAge:   24 * time.Hour,
+//		Budget:   10,
+//	}
+//	go s.Run(ctx)
+type Scheduler struct {
+	Checker Checker
+	Source  StaleSource
+	// Time between runs
+	Interval time.Duration
+	// IPs last checked longer ago than MaxAge are re-checked
+	MaxAge time.Duration
+	// Maximum number of lookups per run. With the free API quota of
+	// 500 queries per day, Budget*(24h/Interval) should stay well below
+	// that to leave room for regular lookups.
+	Budget int
+	// Optional function called with the outcome of every re-check
+	OnResult func(ip string, res Result, err error)
+	// Clock used to determine staleness. If nil, the system clock is used.
+	Clock Clock
+}
+
+// Run re-checks stale IPs every Interval until ctx is done,
+// returning ctx.Err().
+func (s *Scheduler) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		s.RunOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce re-checks up to Budget stale IPs and returns the number of
+// lookups made. A failed lookup doesn't stop the run. Stale values that
+// aren't IP addresses are passed to OnResult with ErrPseudonymized.
+func (s *Scheduler) RunOnce(ctx context.Context) (n int, err error) {
+	if c, ok := s.Checker.(*Client); ok && !c.storesAddrs() {
+		return 0, fmt.Errorf("Can't re-check IPs recorded with a Pseudonymizer not returning IP addresses")
+	}
+	now := time.Now()
+	if s.Clock != nil {
+		now = s.Clock.Now()
+	}
+	ips, err := s.Source.Stale(ctx, now.Add(-s.MaxAge), s.Budget)
+	if err != nil {
+		return
+	}
+	for _, ip := range ips {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		if _, perr := netip.ParseAddr(ip); perr != nil {
+			if s.OnResult != nil {
+				s.OnResult(ip, Result{}, ErrPseudonymized)
+			}
+			continue
+		}
+		res, lerr := s.Checker.GetProxyScore(ctx, ip)
+		n++
+		if s.OnResult != nil {
+			s.OnResult(ip, res, lerr)
+		}
+	}
+	return
+}
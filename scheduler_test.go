@@ -0,0 +1,79 @@
+package ipintel
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type staleList []string
+
+func (l staleList) Stale(context.Context, time.Time, int) ([]string, error) {
+	return l, nil
+}
+
+type checkerFunc func(ctx context.Context, ip string) (Result, error)
+
+func (f checkerFunc) GetProxyScore(ctx context.Context, ip string) (Result, error) {
+	return f(ctx, ip)
+}
+
+func TestSchedulerSkipsHashedValues(t *testing.T) {
+	hashed := HashIP([]byte("secret"))("192.0.2.1")
+	var looked []string
+	var skipped []string
+	s := &Scheduler{
+		Checker: checkerFunc(func(ctx context.Context, ip string) (Result, error) {
+			looked = append(looked, ip)
+			return Result{IP: ip}, nil
+		}),
+		Source: staleList{"192.0.2.0", hashed},
+		Budget: 10,
+		OnResult: func(ip string, res Result, err error) {
+			if errors.Is(err, ErrPseudonymized) {
+				skipped = append(skipped, ip)
+			}
+		},
+	}
+	n, err := s.RunOnce(context.Background())
+	if err != nil || n != 1 {
+		t.Fatalf("RunOnce() = %d, %v; want 1, nil", n, err)
+	}
+	if len(looked) != 1 || looked[0] != "192.0.2.0" {
+		t.Errorf("looked up %v, want [192.0.2.0]", looked)
+	}
+	if len(skipped) != 1 || skipped[0] != hashed {
+		t.Errorf("skipped %v, want [%s]", skipped, hashed)
+	}
+}
+
+func TestSchedulerRefusesHashingClient(t *testing.T) {
+	for _, tt := range []struct {
+		p  Pseudonymizer
+		ok bool
+	}{
+		{nil, true},
+		{TruncateIP(24, 48), true},
+		{HashIP([]byte("secret")), false},
+	} {
+		c := NewClient("test@example.com", false, Dynamic, 0, WithLimiter(unlimited{}), WithPseudonymizer(tt.p))
+		s := &Scheduler{Checker: c, Source: staleList{}, Budget: 1}
+		if _, err := s.RunOnce(context.Background()); (err == nil) != tt.ok {
+			t.Errorf("RunOnce() error = %v, want ok %v", err, tt.ok)
+		}
+		c.Close()
+	}
+}
+
+func TestBlocklistSkipsHashedRecords(t *testing.T) {
+	now := time.Now()
+	recs := []Record{
+		{Result: Result{IP: "192.0.2.0", Score: 1, QueriedAt: now}},
+		{Result: Result{IP: HashIP([]byte("secret"))("192.0.2.1"), Score: 1, QueriedAt: now}},
+	}
+	entries := Blocklist(recs, 0.9, time.Hour, now)
+	if len(entries) != 1 || entries[0].IP != "192.0.2.0" {
+		t.Errorf("Blocklist() = %v, want only 192.0.2.0", entries)
+	}
+}
@@ -0,0 +1,38 @@
+package ipintel
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ResolveSecret resolves a setting that may reference a secret held
+// elsewhere, as with Docker or Kubernetes secret mounts:
+//
+//	file:///run/secrets/ipintel  contents of the file, without trailing whitespace
+//	env://NAME                   value of the environment variable NAME
+//
+// Any other value is returned as is.
+func ResolveSecret(ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, "file://"):
+		path := strings.TrimPrefix(ref, "file://")
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("Failed to read secret: %w", err)
+		}
+		v := strings.TrimRight(string(data), " \t\r\n")
+		if v == "" {
+			return "", fmt.Errorf("Secret file %s is empty", path)
+		}
+		return v, nil
+	case strings.HasPrefix(ref, "env://"):
+		name := strings.TrimPrefix(ref, "env://")
+		v := os.Getenv(name)
+		if v == "" {
+			return "", fmt.Errorf("Secret variable %s is not set", name)
+		}
+		return v, nil
+	}
+	return ref, nil
+}
@@ -0,0 +1,74 @@
+package ipintel
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// Stats are the counters of a Client, see Client.Stats.
+type Stats struct {
+	// Calls of GetProxyScore
+	Lookups uint64
+	// Lookups answered by a local list
+	ListHits uint64
+	// Lookups answered by the hosting networks (see WithHosting)
+	HostingHits uint64
+	// Lookups answered by the CleanFilter (see WithCleanFilter)
+	CleanFilterHits uint64
+	// Lookups answered from the cache
+	CacheHits uint64
+	// Requests sent to the API
+	Queries uint64
+	// Lookups failing because the limiter didn't allow a query in time
+	Throttled uint64
+	// Lookups left out by sampling (see WithSampling)
+	Unsampled uint64
+	// Lookups failing for any other reason
+	Errors uint64
+}
+
+// clientStats holds the counters updated on every lookup. They are
+// atomics so counting adds no lock to the lookup path.
+type clientStats struct {
+	lookups, listHits, cacheHits, queries, throttled, errors atomic.Uint64
+	unsampled, hostingHits, cleanFilterHits                  atomic.Uint64
+}
+
+// Stats returns the counters of c since it was created. Clients derived
+// with WithOptions share their parent's counters.
+func (c *Client) Stats() Stats {
+	s := c.stats
+	return Stats{
+		Lookups:         s.lookups.Load(),
+		ListHits:        s.listHits.Load(),
+		HostingHits:     s.hostingHits.Load(),
+		CleanFilterHits: s.cleanFilterHits.Load(),
+		CacheHits:       s.cacheHits.Load(),
+		Queries:         s.queries.Load(),
+		Throttled:       s.throttled.Load(),
+		Unsampled:       s.unsampled.Load(),
+		Errors:          s.errors.Load(),
+	}
+}
+
+// count updates the counters for a finished lookup.
+func (s *clientStats) count(res Result, err error) {
+	s.lookups.Add(1)
+	var te *ThrottleError
+	switch {
+	case errors.As(err, &te):
+		s.throttled.Add(1)
+	case errors.Is(err, ErrNotSampled):
+		s.unsampled.Add(1)
+	case err != nil:
+		s.errors.Add(1)
+	case res.List == HostingList:
+		s.hostingHits.Add(1)
+	case res.List == CleanFilterList:
+		s.cleanFilterHits.Add(1)
+	case res.List != "":
+		s.listHits.Add(1)
+	case res.FromCache:
+		s.cacheHits.Add(1)
+	}
+}
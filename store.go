@@ -0,0 +1,80 @@
+package ipintel
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// Store keeps a record of lookups, e.g. for history and reporting.
+type Store interface {
+	// Record stores the outcome of a single lookup.
+	Record(ctx context.Context, rec Record) error
+}
+
+// Record is a single lookup as kept by a Store.
+type Record struct {
+	Result
+	// Decision taken based on the score, e.g. DecisionAllow or
+	// DecisionBlock. Empty if the lookup was not used to make a
+	// decision.
+	Decision string
+}
+
+// Decisions recorded by this module.
+const (
+	DecisionAllow     = "allow"
+	DecisionBlock     = "block"
+	DecisionChallenge = "challenge"
+)
+
+type recordJSON struct {
+	resultJSON
+	Decision string `json:"decision,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler, adding the decision to the
+// JSON representation of the Result.
+func (r Record) MarshalJSON() ([]byte, error) {
+	return json.Marshal(recordJSON{r.Result.toJSON(), r.Decision})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (r *Record) UnmarshalJSON(data []byte) error {
+	var v recordJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	r.Decision = v.Decision
+	return r.Result.fromJSON(v.resultJSON)
+}
+
+// String formats r like Result.String, followed by the decision if any.
+func (r Record) String() string {
+	s := r.Result.String()
+	if r.Decision != "" {
+		s += " decision=" + r.Decision
+	}
+	return s
+}
+
+// MarshalText implements encoding.TextMarshaler using String.
+func (r Record) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// MultiStore returns a Store recording each lookup in all stores in
+// turn, e.g. a database and a publisher. It stops at the first error.
+func MultiStore(stores ...Store) Store {
+	return multiStore(append([]Store(nil), stores...))
+}
+
+type multiStore []Store
+
+func (m multiStore) Record(ctx context.Context, rec Record) error {
+	for _, s := range m {
+		if err := s.Record(ctx, rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
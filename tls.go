@@ -0,0 +1,62 @@
+package ipintel
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+)
+
+// WithTLSConfig sets the TLS configuration of HTTPS requests, e.g. to
+// require TLS 1.3 or trust a custom set of RootCAs. cfg is cloned. Like
+// WithResolver, it configures the Transport of the HTTP client set so
+// far.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(c *Client) {
+		t := c.ownTransport()
+		pins := t.TLSClientConfig
+		t.TLSClientConfig = cfg.Clone()
+		// keep pins set by an earlier WithPinnedKeys
+		if pins != nil && pins.VerifyConnection != nil && t.TLSClientConfig.VerifyConnection == nil {
+			t.TLSClientConfig.VerifyConnection = pins.VerifyConnection
+		}
+	}
+}
+
+// WithPinnedKeys restricts HTTPS connections to servers whose verified
+// certificate chain contains a public key with one of the given SPKI
+// hashes (see SPKIHash). Normal certificate verification still applies.
+func WithPinnedKeys(hashes ...[sha256.Size]byte) Option {
+	return func(c *Client) {
+		t := c.ownTransport()
+		if t.TLSClientConfig == nil {
+			t.TLSClientConfig = &tls.Config{}
+		}
+		t.TLSClientConfig.VerifyConnection = verifyPins(hashes)
+	}
+}
+
+// SPKIHash returns the SHA-256 hash of the Subject Public Key Info of
+// cert, as used by WithPinnedKeys and HPKP-style pins. The base64
+// encoding of the hash is printed by
+//
+//	openssl x509 -pubkey -noout | openssl pkey -pubin -outform der | openssl dgst -sha256 -binary | base64
+func SPKIHash(cert *x509.Certificate) [sha256.Size]byte {
+	return sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+}
+
+func verifyPins(hashes [][sha256.Size]byte) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		for _, chain := range cs.VerifiedChains {
+			for _, cert := range chain {
+				h := SPKIHash(cert)
+				for _, pin := range hashes {
+					if h == pin {
+						return nil
+					}
+				}
+			}
+		}
+		return fmt.Errorf("No pinned public key in the server certificate chain")
+	}
+}
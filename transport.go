@@ -0,0 +1,25 @@
+package ipintel
+
+import (
+	"net/http"
+)
+
+// ownTransport returns the Transport of c's HTTP client for options to
+// modify. Shared or caller-provided clients are never modified: the
+// first call replaces the client with a copy using a cloned Transport.
+func (c *Client) ownTransport() *http.Transport {
+	if c.transport != nil && c.httpClient.Transport == c.transport {
+		return c.transport
+	}
+	hc := *c.httpClient
+	base, ok := hc.Transport.(*http.Transport)
+	if !ok {
+		// nil, or a RoundTripper that can't be configured. Options
+		// configuring the Transport replace the latter.
+		base = http.DefaultTransport.(*http.Transport)
+	}
+	c.transport = base.Clone()
+	hc.Transport = c.transport
+	c.httpClient = &hc
+	return c.transport
+}
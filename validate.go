@@ -0,0 +1,49 @@
+package ipintel
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+)
+
+// Validate checks the configuration of c, returning a descriptive error
+// for settings the API would reject or that would make every query
+// fail. NewClient doesn't validate, so call it right after creating a
+// Client from untrusted configuration.
+func (c *Client) Validate() error {
+	if c.email == "" {
+		return fmt.Errorf("Missing contact email address: the API requires one")
+	}
+	if addr, err := mail.ParseAddress(c.email); err != nil || addr.Address != c.email {
+		return fmt.Errorf("Invalid contact email address %q", c.email)
+	}
+	check, maxWait := c.Check(), c.MaxWait()
+	if check != Static && check != Dynamic {
+		return fmt.Errorf("Unknown check type %q: must be Static or Dynamic", string(check))
+	}
+	if maxWait < 0 {
+		return fmt.Errorf("Invalid maximum wait %s: must not be negative", maxWait)
+	}
+	if c.baseURL != "" {
+		u, err := url.Parse(c.baseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("Invalid base URL %q: must be an absolute http(s) URL", c.baseURL)
+		}
+		if u.RawQuery != "" || u.Fragment != "" {
+			return fmt.Errorf("Invalid base URL %q: must not have a query or fragment", c.baseURL)
+		}
+	}
+	if c.limiter == nil {
+		return fmt.Errorf("Missing limiter")
+	}
+	if c.httpClient == nil {
+		return fmt.Errorf("Missing HTTP client")
+	}
+	if c.maxResponseSize <= 0 {
+		return fmt.Errorf("Invalid maximum response size %d: must be positive", c.maxResponseSize)
+	}
+	if c.cache != nil && c.cacheTTL <= 0 {
+		return fmt.Errorf("Invalid cache TTL %s: must be positive", c.cacheTTL)
+	}
+	return nil
+}
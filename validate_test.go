@@ -0,0 +1,37 @@
+package ipintel_test
+
+import (
+	"testing"
+	"time"
+
+	ipintel "github.com/pierelucas/go-ipintel"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		email string
+		check ipintel.CheckType
+		wait  time.Duration
+		opts  []ipintel.Option
+		ok    bool
+	}{
+		{"valid", "ops@example.com", ipintel.Dynamic, 0, nil, true},
+		{"base URL", "ops@example.com", ipintel.Static, 0, []ipintel.Option{ipintel.WithBaseURL("http://127.0.0.1:8080/check.php")}, true},
+		{"no email", "", ipintel.Dynamic, 0, nil, false},
+		{"invalid email", "ops", ipintel.Dynamic, 0, nil, false},
+		{"display name", "Ops <ops@example.com>", ipintel.Dynamic, 0, nil, false},
+		{"unknown check", "ops@example.com", "f", 0, nil, false},
+		{"negative wait", "ops@example.com", ipintel.Dynamic, -time.Second, nil, false},
+		{"relative base URL", "ops@example.com", ipintel.Dynamic, 0, []ipintel.Option{ipintel.WithBaseURL("/check.php")}, false},
+		{"base URL with query", "ops@example.com", ipintel.Dynamic, 0, []ipintel.Option{ipintel.WithBaseURL("http://127.0.0.1/check.php?flags=m")}, false},
+		{"no limiter", "ops@example.com", ipintel.Dynamic, 0, []ipintel.Option{ipintel.WithLimiter(nil)}, false},
+		{"no HTTP client", "ops@example.com", ipintel.Dynamic, 0, []ipintel.Option{ipintel.WithHTTPClient(nil)}, false},
+	}
+	for _, tt := range tests {
+		c := ipintel.NewClient(tt.email, true, tt.check, tt.wait, tt.opts...)
+		if err := c.Validate(); (err == nil) != tt.ok {
+			t.Errorf("%s: Validate() = %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package ipintel
+
+import (
+	"context"
+	"time"
+)
+
+// IdentityStore is implemented by Stores that can keep the lookups made
+// on behalf of identities such as accounts, API keys or device IDs.
+type IdentityStore interface {
+	// RecordIdentity stores that identity used the IP of rec.
+	RecordIdentity(ctx context.Context, identity string, rec Record) error
+	// ByIdentity returns the records of identity queried at or after
+	// t, oldest first.
+	ByIdentity(ctx context.Context, identity string, t time.Time) ([]Record, error)
+}
+
+// Velocity summarizes the IPs an identity used within a Tracker's
+// window.
+type Velocity struct {
+	Identity string
+	// Number of distinct IPs used
+	IPs int
+	// Number of distinct IPs scoring at or above the Tracker's threshold
+	RiskyIPs int
+	// Whether RiskyIPs reached the Tracker's limit
+	Flagged bool
+}
+
+// Tracker records which IPs each identity has used and flags identities
+// rotating through many risky IPs in a short time, a common sign of
+// account takeover or fraud through proxy pools. The identity is
+// supplied by the caller, e.g. a user ID. Checker should have a Cache,
+// as every call of Check looks up the IP.
+//
+// Example:
+//
+//	t := &ipintel.Tracker{Checker: c, Store: st, Window: time.Hour, MaxRiskyIPs: 3}
+//	res, v, err := t.Check(ctx, userID, ip)
+//	if err == nil && v.Flagged {
+//		// require a second factor
+//	}
+type Tracker struct {
+	Checker Checker
+	Store   IdentityStore
+	// Period over which IPs are counted; one hour if zero
+	Window time.Duration
+	// Score at or above which an IP counts as risky; 0.99 if zero
+	Threshold float32
+	// Number of distinct risky IPs within Window at which an identity
+	// is flagged; 3 if zero
+	MaxRiskyIPs int
+	// If nil, the system clock is used.
+	Clock Clock
+}
+
+// Check looks up ip, records that identity used it and returns the
+// Result along with the identity's Velocity including ip.
+func (t *Tracker) Check(ctx context.Context, identity, ip string) (Result, Velocity, error) {
+	res, err := t.Checker.GetProxyScore(ctx, ip)
+	if err != nil {
+		return res, Velocity{}, err
+	}
+	rec := Record{Result: res}
+	// the time of use, not of the possibly cached lookup
+	rec.QueriedAt = t.now()
+	if err := t.Store.RecordIdentity(ctx, identity, rec); err != nil {
+		return res, Velocity{}, err
+	}
+	v, err := t.Velocity(ctx, identity)
+	return res, v, err
+}
+
+// Velocity returns the Velocity of identity from its recorded IPs.
+func (t *Tracker) Velocity(ctx context.Context, identity string) (Velocity, error) {
+	window := t.Window
+	if window == 0 {
+		window = time.Hour
+	}
+	recs, err := t.Store.ByIdentity(ctx, identity, t.now().Add(-window))
+	if err != nil {
+		return Velocity{}, err
+	}
+	threshold := t.Threshold
+	if threshold == 0 {
+		threshold = 0.99
+	}
+	limit := t.MaxRiskyIPs
+	if limit == 0 {
+		limit = 3
+	}
+
+	v := Velocity{Identity: identity}
+	// highest score seen per IP
+	highest := foldByIP(recs, func(kept, rec Record) bool {
+		return rec.Score > kept.Score
+	})
+	v.IPs = len(highest)
+	for _, rec := range highest {
+		if rec.Score >= threshold {
+			v.RiskyIPs++
+		}
+	}
+	v.Flagged = v.RiskyIPs >= limit
+	return v, nil
+}
+
+func (t *Tracker) now() time.Time {
+	if t.Clock == nil {
+		return time.Now()
+	}
+	return t.Clock.Now()
+}